@@ -0,0 +1,326 @@
+package main
+
+/*
+CĂUTARE LEXICALĂ (BM25) + FUZIUNE RRF
+
+Textul fiecărui punct are un index full-text în Qdrant (tokenizer "word",
+lowercase). Pentru o interogare:
+  1. df-ul fiecărui termen vine dintr-un count cu match text; candidații sunt
+     punctele utilizatorului (și ale documentului) care conțin un termen, luați
+     începând cu termenii cei mai rari, până la BM25_MAX_CANDIDATES (implicit
+     1000): punctele lăsate deoparte conțin doar termeni frecvenți, cu idf mic
+  2. scorul BM25 (k1=1.2, b=0.75) se calculează local pe candidați; N vine din
+     count, lungimea medie din câmpul token_count al tuturor punctelor;
+     media este ținută în memorie per scope (BM25_STATS_TTL_SECONDS, implicit
+     300) și recalculată când se schimbă numărul de puncte sau după o încărcare
+  3. rezultatele lexicale și cele vectoriale se combină cu Reciprocal Rank
+     Fusion: score = Σ weight / (k + rank), cu ponderi configurabile în /search
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	bm25K1          = 1.2
+	bm25B           = 0.75
+	maxQueryTerms   = 32
+	defaultRRFK     = 60
+	minSearchFanout = 20 // results fetched from each retriever before fusion
+
+	defaultBM25StatsTTL      = 300 // seconds
+	maxBM25StatsCacheSize    = 1000
+	defaultBM25MaxCandidates = 1000 // chunks scored per keyword query
+)
+
+// SearchWeights controls how keyword and vector rankings are fused
+type SearchWeights struct {
+	Keyword float64 `json:"keyword"`
+	Vector  float64 `json:"vector"`
+	RRFK    int     `json:"rrf_k"`
+}
+
+func defaultSearchWeights() SearchWeights {
+	return SearchWeights{Keyword: 1, Vector: 1, RRFK: defaultRRFK}
+}
+
+// tokenizeForBM25 lowercases and splits on anything that is not a letter or digit,
+// like Qdrant's "word" tokenizer; single-character tokens are dropped
+func tokenizeForBM25(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := words[:0]
+	for _, word := range words {
+		if len([]rune(word)) >= 2 {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+// queryTerms returns the distinct query tokens, in order
+func queryTerms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, token := range tokenizeForBM25(query) {
+		if seen[token] {
+			continue
+		}
+		seen[token] = true
+		terms = append(terms, token)
+		if len(terms) == maxQueryTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// bm25Stats is the cached average chunk length of one scope
+type bm25Stats struct {
+	avgLength  float64
+	points     int
+	generation uint64
+	computed   time.Time
+}
+
+var (
+	bm25StatsMu         sync.Mutex
+	bm25StatsCache      = make(map[string]bm25Stats) // scope filter (JSON) -> stats
+	bm25StatsGeneration uint64                       // bumped by every upload
+)
+
+// invalidateBM25Stats drops the cached averages (the stored chunks changed)
+func invalidateBM25Stats() {
+	bm25StatsMu.Lock()
+	defer bm25StatsMu.Unlock()
+	bm25StatsGeneration++
+	bm25StatsCache = make(map[string]bm25Stats)
+}
+
+// cachedAverageTokenCount returns the average chunk length of scope, which has
+// points points, without scrolling the scope on every query. An entry is reused
+// while the point count is the same, no upload happened and it is younger than
+// BM25_STATS_TTL_SECONDS.
+func cachedAverageTokenCount(scope map[string]interface{}, points int, fallback float64) (float64, error) {
+	keyBytes, err := json.Marshal(scope) // map keys are sorted, so equal scopes share a key
+	if err != nil {
+		return averageTokenCount(scope, fallback)
+	}
+	key := string(keyBytes)
+	ttl := time.Duration(envInt("BM25_STATS_TTL_SECONDS", defaultBM25StatsTTL)) * time.Second
+
+	bm25StatsMu.Lock()
+	cached, ok := bm25StatsCache[key]
+	generation := bm25StatsGeneration
+	bm25StatsMu.Unlock()
+	if ok && cached.points == points && cached.generation == generation && time.Since(cached.computed) < ttl {
+		return cached.avgLength, nil
+	}
+
+	avgLength, err := averageTokenCount(scope, fallback)
+	if err != nil {
+		return 0, err
+	}
+
+	bm25StatsMu.Lock()
+	if bm25StatsGeneration == generation {
+		if len(bm25StatsCache) >= maxBM25StatsCacheSize {
+			bm25StatsCache = make(map[string]bm25Stats)
+		}
+		bm25StatsCache[key] = bm25Stats{avgLength: avgLength, points: points, generation: generation, computed: time.Now()}
+	}
+	bm25StatsMu.Unlock()
+	return avgLength, nil
+}
+
+// averageTokenCount is the mean chunk length over all points matching filter.
+// Points stored before token_count existed fall back to fallback.
+func averageTokenCount(filter map[string]interface{}, fallback float64) (float64, error) {
+	points, err := scrollAllPoints(filter, []string{"token_count"})
+	if err != nil {
+		return 0, err
+	}
+	if len(points) == 0 {
+		return fallback, nil
+	}
+	total := 0.0
+	for _, point := range points {
+		if point.Payload.TokenCount > 0 {
+			total += float64(point.Payload.TokenCount)
+		} else {
+			total += fallback
+		}
+	}
+	return total / float64(len(points)), nil
+}
+
+// searchPagesKeyword ranks the user's chunks with BM25 over the whole collection
+// (not just the first scroll page). Score is the raw BM25 value.
+func searchPagesKeyword(scope map[string]interface{}, query string, limit int) ([]SearchResult, error) {
+	terms := queryTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	total, err := countPoints(scope)
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, nil
+	}
+
+	// df from the full-text index, exact even when the candidates are capped
+	termMatch := func(term string) map[string]interface{} {
+		return map[string]interface{}{"key": "text", "match": map[string]string{"text": term}}
+	}
+	docFreq := make(map[string]int, len(terms))
+	var matched []string
+	for _, term := range terms {
+		df, err := countPoints(withMust(scope, termMatch(term)))
+		if err != nil {
+			return nil, err
+		}
+		if df > 0 {
+			docFreq[term] = df
+			matched = append(matched, term)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, nil
+	}
+
+	// Candidates: chunks containing a term, rarest terms first (highest idf), so
+	// the chunks left out by the cap only contain common terms
+	maxCandidates := envInt("BM25_MAX_CANDIDATES", defaultBM25MaxCandidates)
+	if maxCandidates < limit {
+		maxCandidates = limit
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return docFreq[matched[i]] < docFreq[matched[j]] })
+	var candidates []SearchResult
+	var fetched []map[string]interface{} // terms already scrolled, excluded from the next ones
+	for _, term := range matched {
+		if len(candidates) >= maxCandidates {
+			break
+		}
+		filter := withMust(scope, termMatch(term))
+		if len(fetched) > 0 {
+			filter = withMust(filter, map[string]interface{}{"must_not": fetched})
+		}
+		points, err := scrollPoints(filter, searchPayload, maxCandidates-len(candidates))
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, points...)
+		fetched = append(fetched, termMatch(term))
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	termFreqs := make([]map[string]int, len(candidates))
+	lengths := make([]int, len(candidates))
+	candidateLength := 0
+	for i, point := range candidates {
+		tokens := tokenizeForBM25(point.Payload.Text)
+		lengths[i] = len(tokens)
+		candidateLength += len(tokens)
+
+		termFreqs[i] = make(map[string]int, len(terms))
+		for _, token := range tokens {
+			if docFreq[token] > 0 {
+				termFreqs[i][token]++
+			}
+		}
+	}
+
+	avgLength, err := cachedAverageTokenCount(scope, total, float64(candidateLength)/float64(len(candidates)))
+	if err != nil {
+		return nil, err
+	}
+	if avgLength <= 0 {
+		avgLength = 1
+	}
+
+	n := float64(total)
+	var results []SearchResult
+	for i, point := range candidates {
+		score := 0.0
+		for _, term := range terms {
+			tf := float64(termFreqs[i][term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(lengths[i])/avgLength))
+		}
+		// The index may match tokens this tokenizer splits differently
+		if score == 0 {
+			continue
+		}
+		point.Score = float32(score)
+		results = append(results, point)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	fmt.Printf("🔤 BM25: %d candidates (max %d), %d scored, N=%d, avgdl=%.1f\n", len(candidates), maxCandidates, len(results), total, avgLength)
+	return results, nil
+}
+
+// rrfFuse merges rankings with weighted Reciprocal Rank Fusion. Score becomes the
+// fused score; KeywordRank/VectorRank keep the 1-based rank in each list.
+func rrfFuse(keywordResults, vectorResults []SearchResult, weights SearchWeights, limit int) []SearchResult {
+	k := float64(weights.RRFK)
+	fused := make(map[string]*SearchResult)
+	scores := make(map[string]float64)
+	var order []string
+
+	add := func(results []SearchResult, weight float64, keyword bool) {
+		if weight <= 0 {
+			return
+		}
+		for rank, result := range results {
+			entry, ok := fused[result.ID]
+			if !ok {
+				copied := result
+				entry = &copied
+				fused[result.ID] = entry
+				order = append(order, result.ID)
+			}
+			if keyword {
+				entry.KeywordRank = rank + 1
+				entry.KeywordScore = result.Score
+			} else {
+				entry.VectorRank = rank + 1
+				entry.VectorScore = result.Score
+			}
+			scores[result.ID] += weight / (k + float64(rank+1))
+		}
+	}
+	add(keywordResults, weights.Keyword, true)
+	add(vectorResults, weights.Vector, false)
+
+	combined := make([]SearchResult, 0, len(order))
+	for _, id := range order {
+		result := *fused[id]
+		result.Score = float32(scores[id])
+		combined = append(combined, result)
+	}
+	sort.SliceStable(combined, func(i, j int) bool { return combined[i].Score > combined[j].Score })
+	if len(combined) > limit {
+		combined = combined[:limit]
+	}
+	return combined
+}
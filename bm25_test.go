@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenizeForBM25(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", []string{}},
+		{"The Ocean, the ocean!", []string{"the", "ocean", "the", "ocean"}},
+		{"a b cd", []string{"cd"}},
+		{"Ștefan cel Mare (1457-1504)", []string{"ștefan", "cel", "mare", "1457", "1504"}},
+		{"e-mail: ana@x.ro", []string{"mail", "ana", "ro"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := tokenizeForBM25(tt.text)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenizeForBM25(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryTermsAreDistinct(t *testing.T) {
+	got := queryTerms("Ocean waves, ocean TIDES and waves")
+	want := []string{"ocean", "waves", "tides", "and"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("queryTerms = %q, want %q", got, want)
+	}
+}
+
+func TestRRFFuse(t *testing.T) {
+	results := func(ids ...string) []SearchResult {
+		var out []SearchResult
+		for _, id := range ids {
+			out = append(out, SearchResult{ID: id})
+		}
+		return out
+	}
+	ids := func(fused []SearchResult) []string {
+		var out []string
+		for _, r := range fused {
+			out = append(out, r.ID)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		keyword []SearchResult
+		vector  []SearchResult
+		weights SearchWeights
+		limit   int
+		want    []string
+	}{
+		{"found by both ranks first", results("a", "b"), results("c", "b"), SearchWeights{Keyword: 1, Vector: 1, RRFK: 60}, 10, []string{"b", "a", "c"}},
+		{"zero weight disables a retriever", results("a", "b"), results("c"), SearchWeights{Keyword: 0, Vector: 1, RRFK: 60}, 10, []string{"c"}},
+		{"heavier keyword weight", results("a"), results("c"), SearchWeights{Keyword: 2, Vector: 1, RRFK: 60}, 10, []string{"a", "c"}},
+		{"ties keep keyword order first", results("a"), results("c"), SearchWeights{Keyword: 1, Vector: 1, RRFK: 60}, 10, []string{"a", "c"}},
+		{"limit", results("a", "b", "d"), results("c"), SearchWeights{Keyword: 1, Vector: 1, RRFK: 60}, 2, []string{"a", "c"}},
+		{"small k favours the top rank", results("a", "b", "d", "e", "c"), results("x", "y", "z", "w", "c"), SearchWeights{Keyword: 1, Vector: 1, RRFK: 1}, 1, []string{"a"}},
+		{"large k favours agreement", results("a", "b", "d", "e", "c"), results("x", "y", "z", "w", "c"), SearchWeights{Keyword: 1, Vector: 1, RRFK: 60}, 1, []string{"c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(rrfFuse(tt.keyword, tt.vector, tt.weights, tt.limit)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rrfFuse = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Ranks and fused score of a result found by both retrievers
+	fused := rrfFuse(results("a", "b"), results("b"), SearchWeights{Keyword: 1, Vector: 2, RRFK: 10}, 10)
+	b := fused[0]
+	if b.ID != "b" || b.KeywordRank != 2 || b.VectorRank != 1 {
+		t.Fatalf("first result = %+v, want b with keyword rank 2 and vector rank 1", b)
+	}
+	if want := 1.0/12 + 2.0/11; math.Abs(float64(b.Score)-want) > 1e-6 {
+		t.Errorf("fused score = %v, want %v", b.Score, want)
+	}
+}
+
+func TestCachedAverageTokenCount(t *testing.T) {
+	useTestVectorStore(t)
+	invalidateBM25Stats()
+	storeTestChunks(t, "ana", "notes.pdf", []int{1, 2}, []string{"two words", "four words in here"})
+
+	scope := userDocFilter("ana", "")
+	average := func() float64 {
+		t.Helper()
+		total, err := countPoints(scope)
+		if err != nil {
+			t.Fatalf("count failed: %v", err)
+		}
+		avg, err := cachedAverageTokenCount(scope, total, 1)
+		if err != nil {
+			t.Fatalf("cachedAverageTokenCount failed: %v", err)
+		}
+		return avg
+	}
+
+	if got := average(); got != 3 {
+		t.Fatalf("average = %v, want 3", got)
+	}
+
+	// Token counts changed behind the cache's back: the cached value is reused...
+	if err := setPayloadByFilter(scope, map[string]interface{}{"token_count": 10}); err != nil {
+		t.Fatalf("set payload failed: %v", err)
+	}
+	if got := average(); got != 3 {
+		t.Errorf("average = %v, want the cached 3", got)
+	}
+
+	// ...until an upload invalidates it
+	storeTestChunks(t, "ana", "more.pdf", []int{1}, []string{"six words are in this chunk"})
+	if got := average(); got != (10+10+6)/3.0 {
+		t.Errorf("average after upload = %v, want %v", got, (10+10+6)/3.0)
+	}
+}
+
+// scrollCounter counts the points scrolled from the store
+type scrollCounter struct {
+	*EmbeddedStore
+	points int
+}
+
+func (s *scrollCounter) Scroll(req ScrollRequest, out interface{}) (interface{}, error) {
+	next, err := s.EmbeddedStore.Scroll(req, out)
+	if results, ok := out.(*[]SearchResult); ok {
+		s.points += len(*results)
+	}
+	return next, err
+}
+
+func TestSearchPagesKeywordCapsCandidates(t *testing.T) {
+	store := useTestVectorStore(t)
+	counter := &scrollCounter{EmbeddedStore: store}
+	qdrant.Store = counter
+	t.Setenv("BM25_MAX_CANDIDATES", "5")
+	t.Setenv("BM25_STATS_TTL_SECONDS", "0")
+
+	var pages []int
+	var texts []string
+	for i := 0; i < 30; i++ {
+		pages = append(pages, i+1)
+		texts = append(texts, fmt.Sprintf("the common word appears on page %d", i+1))
+	}
+	pages = append(pages, 31, 32)
+	texts = append(texts, "a rare word next to the common one", "rare and common together again")
+	storeTestChunks(t, "ana", "many.pdf", pages, texts)
+	scope := userDocFilter("ana", "")
+
+	counter.points = 0
+	results, err := searchPagesKeyword(scope, "rare common", 3)
+	if err != nil {
+		t.Fatalf("searchPagesKeyword failed: %v", err)
+	}
+	// The candidates are capped; the token_count scroll for avgdl is not
+	if scored := counter.points - 32; scored != 5 {
+		t.Errorf("scrolled %d candidates, want 5", scored)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	for _, r := range results[:2] {
+		if !strings.Contains(r.Payload.Text, "rare") {
+			t.Errorf("top results %q, want the chunks with the rare term first", r.Payload.Text)
+		}
+	}
+}
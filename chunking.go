@@ -0,0 +1,727 @@
+package main
+
+/*
+CHUNKING PENTRU STOCARE (/extract/store, câmpul "chunking")
+
+  - page       o bucată per pagină cu overlap din paginile vecine; cu grade=2..10
+               pagina este împărțită în paragrafe egale (comportamentul vechi, implicit)
+  - fixed      ferestre de chunk_tokens tokeni, cu chunk_overlap tokeni comuni
+  - sentence   propoziții întregi până la chunk_tokens; bucata următoare repetă
+               ultimele sentence_overlap propoziții (sentence window)
+  - recursive  împarte după titluri, apoi paragrafe, linii, propoziții, cuvinte,
+               până când fiecare bucată încape în chunk_tokens, și unește bucățile mici
+  - semantic   propozițiile sunt grupate după distanța dintre embedding-urile lor:
+               o rupere apare unde distanța depășește percentila semantic_percentile
+
+Textul paginilor PDF are spațiile normalizate (fără \n), așa că pentru recursive
+titlurile, paragrafele și liniile vin din layout-ul MuPDF: o linie mai înaltă
+decât media sau de forma "2. Titlu" / "CAPITOLUL" începe o secțiune, iar un
+spațiu vertical mai mare începe un paragraf. Pentru alte formate se folosesc
+liniile goale și \n din text.
+
+Tokenii sunt numărați cu tokenizer-ul BPE al modelului de embeddings (tokenizer.go).
+Bucățile nu trec peste granița paginii, sunt subșiruri ale textului paginii
+(offset-uri pe granițe de rune) și păstrează numărul paginii sursă.
+
+Cu parent_tokens > 0 (small-to-big, vezi context.go), fiecare pagină este
+împărțită și în bucăți părinte de cel mult parent_tokens tokeni (ca recursive:
+titluri, paragrafe, propoziții), iar fiecare bucată mică este legată de
+părintele în care începe. Căutarea găsește bucățile mici, /answer primește
+părinții.
+
+Env: CHUNK_STRATEGY (implicit page), CHUNK_TOKENS (400), CHUNK_OVERLAP_TOKENS (50),
+CHUNK_PARENT_TOKENS (0, fără părinți).
+*/
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	ChunkPage      = "page"
+	ChunkFixed     = "fixed"
+	ChunkSentence  = "sentence"
+	ChunkRecursive = "recursive"
+	ChunkSemantic  = "semantic"
+
+	defaultChunkTokens        = 400
+	defaultChunkOverlapTokens = 50
+	defaultSentenceOverlap    = 1
+	defaultSemanticPercentile = 90
+	minChunkTokens            = 32
+	maxChunkTokens            = 8000 // text-embedding-3 accepts 8191
+	maxSemanticSentences      = 20000
+)
+
+// ChunkOptions selects and configures the chunking strategy
+type ChunkOptions struct {
+	Strategy         string  `json:"strategy"`
+	MaxTokens        int     `json:"max_tokens,omitempty"`
+	OverlapTokens    int     `json:"overlap_tokens,omitempty"`
+	OverlapSentences int     `json:"overlap_sentences,omitempty"`
+	Percentile       float64 `json:"percentile,omitempty"`
+	ParentTokens     int     `json:"parent_tokens,omitempty"` // 0: no parent chunks
+}
+
+// String describes the options; stored in the payload so a change re-chunks the document
+func (o ChunkOptions) String() string {
+	if o.ParentTokens > 0 {
+		child := o
+		child.ParentTokens = 0
+		return fmt.Sprintf("%s+parent:%d", child, o.ParentTokens)
+	}
+	switch o.Strategy {
+	case ChunkFixed:
+		return fmt.Sprintf("fixed:%d/%d", o.MaxTokens, o.OverlapTokens)
+	case ChunkSentence:
+		return fmt.Sprintf("sentence:%d/%ds", o.MaxTokens, o.OverlapSentences)
+	case ChunkRecursive:
+		return fmt.Sprintf("recursive:%d", o.MaxTokens)
+	case ChunkSemantic:
+		return fmt.Sprintf("semantic:%d/p%g", o.MaxTokens, o.Percentile)
+	default:
+		return o.Strategy
+	}
+}
+
+// TextChunk is a piece of one page; Start/End are byte offsets into the page text
+type TextChunk struct {
+	Text   string
+	Page   int // 1-based source page
+	Start  int
+	End    int
+	Tokens int
+	Parent int // index in the parents returned by chunkPages, -1 without parents
+}
+
+// parseChunkOptions reads the chunking form fields of /extract/store
+func parseChunkOptions(formValue func(key string, defaultValue ...string) string) (ChunkOptions, error) {
+	strategy := os.Getenv("CHUNK_STRATEGY")
+	if strategy == "" {
+		strategy = ChunkPage
+	}
+	opts := ChunkOptions{Strategy: strings.ToLower(formValue("chunking", strategy))}
+
+	intField := func(name string, def, min, max int) (int, error) {
+		raw := formValue(name)
+		if raw == "" {
+			return def, nil
+		}
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < min || v > max {
+			return 0, fmt.Errorf("%s must be an integer between %d and %d", name, min, max)
+		}
+		return v, nil
+	}
+
+	var err error
+	switch opts.Strategy {
+	case ChunkPage:
+		if formValue("parent_tokens") != "" {
+			return opts, fmt.Errorf("parent_tokens needs a chunking strategy other than page")
+		}
+		return opts, nil
+	case ChunkFixed, ChunkSentence, ChunkRecursive, ChunkSemantic:
+	default:
+		return opts, fmt.Errorf("unknown chunking %q (use page, fixed, sentence, recursive or semantic)", opts.Strategy)
+	}
+
+	if opts.MaxTokens, err = intField("chunk_tokens", envInt("CHUNK_TOKENS", defaultChunkTokens), minChunkTokens, maxChunkTokens); err != nil {
+		return opts, err
+	}
+	switch opts.Strategy {
+	case ChunkFixed:
+		if opts.OverlapTokens, err = intField("chunk_overlap", envInt("CHUNK_OVERLAP_TOKENS", defaultChunkOverlapTokens), 0, opts.MaxTokens/2); err != nil {
+			return opts, err
+		}
+	case ChunkSentence:
+		if opts.OverlapSentences, err = intField("sentence_overlap", defaultSentenceOverlap, 0, 10); err != nil {
+			return opts, err
+		}
+	case ChunkSemantic:
+		percentile, err := intField("semantic_percentile", defaultSemanticPercentile, 50, 99)
+		if err != nil {
+			return opts, err
+		}
+		opts.Percentile = float64(percentile)
+	}
+
+	if opts.ParentTokens, err = intField("parent_tokens", envInt("CHUNK_PARENT_TOKENS", 0), 0, maxChunkTokens); err != nil {
+		return opts, err
+	}
+	if opts.ParentTokens > 0 && opts.ParentTokens <= opts.MaxTokens {
+		return opts, fmt.Errorf("parent_tokens (%d) must be larger than chunk_tokens (%d)", opts.ParentTokens, opts.MaxTokens)
+	}
+	return opts, nil
+}
+
+type span struct {
+	start, end int // byte offsets, end exclusive
+}
+
+// chunker holds the text of one page and counts tokens of its spans
+type chunker struct {
+	text      string
+	tokenizer Tokenizer
+	opts      ChunkOptions
+	structure *pageStructure // from the PDF layout, nil for other formats
+}
+
+// pageStructure holds byte offsets in the page text where headings, paragraphs
+// and lines start
+type pageStructure struct {
+	headings   []int
+	paragraphs []int
+	lines      []int
+}
+
+// structureFromLayout derives the cut points of a page from its layout lines
+func structureFromLayout(text string, layout PageLayout) *pageStructure {
+	// rune offset -> byte offset
+	byteAt := make([]int, 0, len(text)+1)
+	for i := range text {
+		byteAt = append(byteAt, i)
+	}
+	byteAt = append(byteAt, len(text))
+
+	var lines []LayoutLine
+	var heights []float64
+	for _, line := range layout.Lines {
+		if line.Start < 0 || line.Start >= len(byteAt) {
+			continue
+		}
+		lines = append(lines, line)
+		heights = append(heights, line.BBox.Y1-line.BBox.Y0)
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Start < lines[j].Start })
+	medianHeight := percentile(heights, 50)
+
+	structure := &pageStructure{}
+	for i, line := range lines {
+		offset := byteAt[line.Start]
+		height := line.BBox.Y1 - line.BBox.Y0
+		structure.lines = append(structure.lines, offset)
+
+		if height > 1.15*medianHeight || isHeadingLine(line.Text) {
+			structure.headings = append(structure.headings, offset)
+		}
+		if i > 0 && line.BBox.Y0-lines[i-1].BBox.Y1 > 0.5*medianHeight {
+			structure.paragraphs = append(structure.paragraphs, offset)
+		}
+	}
+	return structure
+}
+
+func (c chunker) tokens(s span) int {
+	return c.tokenizer.Count(c.text[s.start:s.end])
+}
+
+// ParentChunk is a larger piece of a page that small chunks link to
+type ParentChunk struct {
+	Text   string
+	Page   int
+	Start  int // byte offsets into the page text
+	End    int
+	Tokens int
+}
+
+// chunkPages splits every page with the selected strategy (not ChunkPage).
+// layouts (PDF, optional) give the recursive strategy its headings and paragraphs;
+// the embedder is only used by the semantic strategy. Parents are returned only
+// when opts.ParentTokens > 0.
+func chunkPages(pages []string, layouts []PageLayout, opts ChunkOptions, tokenizer Tokenizer, embedder Embedder) ([]TextChunk, []ParentChunk, error) {
+	structures := make([]*pageStructure, len(pages))
+	if len(layouts) == len(pages) {
+		for i, page := range pages {
+			structures[i] = structureFromLayout(page, layouts[i])
+		}
+	}
+
+	pageSpans := make([][]span, len(pages))
+	if opts.Strategy == ChunkSemantic {
+		var err error
+		if pageSpans, err = semanticSpans(pages, opts, tokenizer, embedder); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		for i, page := range pages {
+			c := chunker{text: page, tokenizer: tokenizer, opts: opts, structure: structures[i]}
+			whole := span{0, len(page)}
+			switch opts.Strategy {
+			case ChunkFixed:
+				pageSpans[i] = c.fixed(whole, opts.OverlapTokens)
+			case ChunkSentence:
+				pageSpans[i] = c.pack(sentenceSpans(page, whole), opts.OverlapSentences)
+			case ChunkRecursive:
+				pageSpans[i] = c.recursiveSections(whole)
+			default:
+				return nil, nil, fmt.Errorf("unsupported chunking strategy %q", opts.Strategy)
+			}
+		}
+	}
+
+	var chunks []TextChunk
+	var parents []ParentChunk
+	for i, spans := range pageSpans {
+		// Parents of this page, like recursive chunks of ParentTokens
+		var pageParents []span
+		firstParent := len(parents)
+		if opts.ParentTokens > 0 {
+			parentOpts := opts
+			parentOpts.MaxTokens = opts.ParentTokens
+			c := chunker{text: pages[i], tokenizer: tokenizer, opts: parentOpts, structure: structures[i]}
+			for _, p := range c.recursiveSections(span{0, len(pages[i])}) {
+				if p = trimSpan(pages[i], p); p.start < p.end {
+					pageParents = append(pageParents, p)
+					text := pages[i][p.start:p.end]
+					parents = append(parents, ParentChunk{
+						Text: text, Page: i + 1, Start: p.start, End: p.end, Tokens: tokenizer.Count(text),
+					})
+				}
+			}
+		}
+
+		for _, s := range spans {
+			s = trimSpan(pages[i], s)
+			if s.start >= s.end {
+				continue
+			}
+			text := pages[i][s.start:s.end]
+			chunk := TextChunk{
+				Text:   text,
+				Page:   i + 1,
+				Start:  s.start,
+				End:    s.end,
+				Tokens: tokenizer.Count(text),
+				Parent: -1,
+			}
+			// The parent where the chunk starts (the last one starting before it)
+			for j, p := range pageParents {
+				if p.start <= s.start || j == 0 {
+					chunk.Parent = firstParent + j
+				}
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks, parents, nil
+}
+
+func trimSpan(text string, s span) span {
+	for s.start < s.end {
+		r, size := utf8.DecodeRuneInString(text[s.start:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		s.start += size
+	}
+	for s.end > s.start {
+		r, size := utf8.DecodeLastRuneInString(text[:s.end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		s.end -= size
+	}
+	return s
+}
+
+// fixed cuts s into windows of MaxTokens tokens sharing overlap tokens
+func (c chunker) fixed(s span, overlap int) []span {
+	boundaries := c.tokenizer.Boundaries(c.text[s.start:s.end])
+	n := len(boundaries)
+	if n <= c.opts.MaxTokens {
+		return []span{s}
+	}
+
+	step := c.opts.MaxTokens - overlap
+	if step < 1 {
+		step = 1
+	}
+	var spans []span
+	for first := 0; ; first += step {
+		last := first + c.opts.MaxTokens
+		if last > n {
+			last = n
+		}
+		start := s.start
+		if first > 0 {
+			start += boundaries[first-1]
+		}
+		end := s.start + boundaries[last-1]
+		if end > start {
+			spans = append(spans, span{start, end})
+		}
+		if last == n {
+			return spans
+		}
+	}
+}
+
+// pack groups consecutive units (sentences) up to MaxTokens; each group starts
+// with the last overlap units of the previous one. Oversized units are cut by tokens.
+func (c chunker) pack(units []span, overlap int) []span {
+	counts := make([]int, len(units))
+	for i, u := range units {
+		counts[i] = c.tokens(u)
+	}
+
+	var spans []span
+	for i := 0; i < len(units); {
+		if counts[i] > c.opts.MaxTokens {
+			spans = append(spans, c.fixed(units[i], 0)...)
+			i++
+			continue
+		}
+		j, total := i, 0
+		for j < len(units) && counts[j] <= c.opts.MaxTokens && total+counts[j] <= c.opts.MaxTokens {
+			total += counts[j]
+			j++
+		}
+		spans = append(spans, span{units[i].start, units[j-1].end})
+		if j == len(units) {
+			break
+		}
+		next := j - overlap
+		if next <= i {
+			next = i + 1
+		}
+		i = next
+	}
+	return spans
+}
+
+// merge joins adjacent pieces while the sum of their tokens fits in MaxTokens
+func (c chunker) merge(pieces []span) []span {
+	var merged []span
+	current, currentTokens := span{-1, -1}, 0
+	for _, p := range pieces {
+		t := c.tokens(p)
+		if current.start >= 0 && currentTokens+t <= c.opts.MaxTokens {
+			current.end = p.end
+			currentTokens += t
+			continue
+		}
+		if current.start >= 0 {
+			merged = append(merged, current)
+		}
+		current, currentTokens = p, t
+	}
+	if current.start >= 0 {
+		merged = append(merged, current)
+	}
+	return merged
+}
+
+// recursiveSections keeps every heading at the start of a chunk
+func (c chunker) recursiveSections(s span) []span {
+	sections := headingSpans(c.text, s)
+	if c.structure != nil {
+		sections = cutAt(s, c.structure.headings)
+	}
+
+	var spans []span
+	for _, section := range sections {
+		spans = append(spans, c.recursive(section, 0)...)
+	}
+	return spans
+}
+
+// split partitions s at the separators of a level, from the coarsest to the finest:
+// paragraphs, lines, sentences, words
+func (c chunker) split(s span, level int) []span {
+	switch level {
+	case 0:
+		if c.structure != nil {
+			return cutAt(s, c.structure.paragraphs)
+		}
+		return paragraphSpans(c.text, s)
+	case 1:
+		if c.structure != nil {
+			return cutAt(s, c.structure.lines)
+		}
+		return lineSpans(c.text, s)
+	case 2:
+		return sentenceSpans(c.text, s)
+	default:
+		return wordSpans(c.text, s)
+	}
+}
+
+const recursiveLevels = 4
+
+func (c chunker) recursive(s span, level int) []span {
+	if c.tokens(s) <= c.opts.MaxTokens {
+		return []span{s}
+	}
+	if level >= recursiveLevels {
+		return c.fixed(s, 0)
+	}
+
+	parts := c.split(s, level)
+	if len(parts) <= 1 {
+		return c.recursive(s, level+1)
+	}
+
+	var pieces []span
+	for _, part := range parts {
+		pieces = append(pieces, c.recursive(part, level+1)...)
+	}
+	return c.merge(pieces)
+}
+
+// cutAt partitions s at the given byte offsets (relative to the whole text)
+func cutAt(s span, cuts []int) []span {
+	var spans []span
+	start := s.start
+	for _, cut := range cuts {
+		if cut > start && cut < s.end {
+			spans = append(spans, span{start, cut})
+			start = cut
+		}
+	}
+	return append(spans, span{start, s.end})
+}
+
+var (
+	paragraphBreak = regexp.MustCompile(`\n[ \t\r]*\n\s*`)
+	wordBreak      = regexp.MustCompile(`\s+`)
+	headingPattern = regexp.MustCompile(`(?i)^(#{1,6}\s|(chapter|capitolul|section|secțiunea|part|partea)\b|\d+(\.\d+)*\.?\s+\p{Lu})`)
+)
+
+func paragraphSpans(text string, s span) []span {
+	var cuts []int
+	for _, m := range paragraphBreak.FindAllStringIndex(text[s.start:s.end], -1) {
+		cuts = append(cuts, s.start+m[1])
+	}
+	return cutAt(s, cuts)
+}
+
+func lineSpans(text string, s span) []span {
+	var cuts []int
+	for i := s.start; i < s.end; i++ {
+		if text[i] == '\n' {
+			cuts = append(cuts, i+1)
+		}
+	}
+	return cutAt(s, cuts)
+}
+
+func wordSpans(text string, s span) []span {
+	var cuts []int
+	for _, m := range wordBreak.FindAllStringIndex(text[s.start:s.end], -1) {
+		cuts = append(cuts, s.start+m[1])
+	}
+	return cutAt(s, cuts)
+}
+
+// headingSpans starts a new section at every line that looks like a heading
+func headingSpans(text string, s span) []span {
+	var cuts []int
+	lineStart := s.start
+	for lineStart < s.end {
+		lineEnd := strings.IndexByte(text[lineStart:s.end], '\n')
+		if lineEnd < 0 {
+			lineEnd = s.end
+		} else {
+			lineEnd += lineStart
+		}
+		if isHeadingLine(text[lineStart:lineEnd]) {
+			cuts = append(cuts, lineStart)
+		}
+		lineStart = lineEnd + 1
+	}
+	return cutAt(s, cuts)
+}
+
+func isHeadingLine(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" || utf8.RuneCountInString(line) > 80 {
+		return false
+	}
+	if headingPattern.MatchString(line) {
+		return true
+	}
+	// SHORT ALL-CAPS LINES without a final period
+	letters := 0
+	for _, r := range line {
+		if unicode.IsLetter(r) {
+			if !unicode.IsUpper(r) {
+				return false
+			}
+			letters++
+		}
+	}
+	return letters >= 3 && !strings.HasSuffix(line, ".")
+}
+
+// sentenceAbbreviations do not end a sentence
+var sentenceAbbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "st": true, "vs": true,
+	"nr": true, "ex": true, "fig": true, "pag": true, "pp": true, "vol": true, "cap": true,
+	"art": true, "al": true, "e.g": true, "i.e": true, "dl": true, "dna": true,
+}
+
+// sentenceSpans partitions s into sentences: a break follows . ! ? … (and closing
+// quotes or brackets) before whitespace, or a blank line
+func sentenceSpans(text string, s span) []span {
+	var cuts []int
+	for i := s.start; i < s.end; {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		next := i + size
+
+		switch {
+		case r == '\n':
+			if j := skipSpaces(text, next, s.end); j < s.end && text[j] == '\n' {
+				cuts = append(cuts, j+1)
+			}
+		case r == '.' || r == '!' || r == '?' || r == '…':
+			end := next
+			for end < s.end {
+				closing, closingSize := utf8.DecodeRuneInString(text[end:])
+				if !strings.ContainsRune(`"')]»”’`, closing) {
+					break
+				}
+				end += closingSize
+			}
+			if end >= s.end {
+				break
+			}
+			if after, _ := utf8.DecodeRuneInString(text[end:]); unicode.IsSpace(after) && !(r == '.' && isAbbreviation(text[s.start:i])) {
+				cuts = append(cuts, skipSpaces(text, end, s.end))
+			}
+		}
+		i = next
+	}
+	return cutAt(s, cuts)
+}
+
+func skipSpaces(text string, i, end int) int {
+	for i < end && (text[i] == ' ' || text[i] == '\t' || text[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// isAbbreviation checks the word before a period ("Dr", initials like "J", numbers)
+func isAbbreviation(before string) bool {
+	start := strings.LastIndexFunc(before, unicode.IsSpace) + 1
+	word := strings.ToLower(before[start:])
+	if utf8.RuneCountInString(word) == 1 {
+		r, _ := utf8.DecodeRuneInString(word)
+		return unicode.IsLetter(r)
+	}
+	// Numbered headings and list items ("2. Software", "3.1. Scope")
+	if word != "" && strings.Trim(word, "0123456789.") == "" {
+		return true
+	}
+	return sentenceAbbreviations[word]
+}
+
+// semanticSpans embeds every sentence with its neighbours and breaks where the
+// cosine distance to the next sentence is above the chosen percentile
+func semanticSpans(pages []string, opts ChunkOptions, tokenizer Tokenizer, embedder Embedder) ([][]span, error) {
+	type sentenceRef struct {
+		page  int
+		index int
+	}
+
+	sentences := make([][]span, len(pages))
+	var windows []string
+	var refs []sentenceRef
+	for p, page := range pages {
+		for _, s := range sentenceSpans(page, span{0, len(page)}) {
+			if t := trimSpan(page, s); t.start < t.end {
+				sentences[p] = append(sentences[p], s)
+			}
+		}
+		for i := range sentences[p] {
+			from := sentences[p][maxInt(i-1, 0)].start
+			to := sentences[p][minInt(i+1, len(sentences[p])-1)].end
+			windows = append(windows, page[from:to])
+			refs = append(refs, sentenceRef{p, i})
+		}
+	}
+	if len(windows) > maxSemanticSentences {
+		return nil, fmt.Errorf("document has %d sentences, semantic chunking supports up to %d", len(windows), maxSemanticSentences)
+	}
+
+	var vectors [][]float32
+	if len(windows) > 0 {
+		var err error
+		if vectors, err = embedder.Embed(windows); err != nil {
+			return nil, fmt.Errorf("failed to embed sentences: %v", err)
+		}
+		if len(vectors) != len(windows) {
+			return nil, fmt.Errorf("mismatch between sentences (%d) and embeddings (%d)", len(windows), len(vectors))
+		}
+	}
+
+	// distance[k] is between sentence k and k+1 of the same page
+	distances := make([]float64, len(refs))
+	var all []float64
+	for k := 0; k+1 < len(refs); k++ {
+		if refs[k].page != refs[k+1].page {
+			continue
+		}
+		distances[k] = 1 - cosineSimilarity(vectors[k], vectors[k+1])
+		all = append(all, distances[k])
+	}
+	threshold := percentile(all, opts.Percentile)
+
+	result := make([][]span, len(pages))
+	k := 0
+	for p, page := range pages {
+		c := chunker{text: page, tokenizer: tokenizer, opts: opts}
+		var group []span
+		for i, s := range sentences[p] {
+			group = append(group, s)
+			last := i == len(sentences[p])-1
+			if last || (distances[k] > 0 && distances[k] >= threshold) {
+				result[p] = append(result[p], c.pack(group, 0)...)
+				group = nil
+			}
+			k++
+		}
+	}
+	return result, nil
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		if i >= len(b) {
+			break
+		}
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// percentile uses linear interpolation between the closest ranks
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return math.Inf(1)
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := p / 100 * float64(len(sorted)-1)
+	low := int(math.Floor(rank))
+	high := int(math.Ceil(rank))
+	return sorted[low] + (sorted[high]-sorted[low])*(rank-float64(low))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func testTokenizer(t *testing.T) Tokenizer {
+	t.Helper()
+	tokenizer, err := tokenizerForEmbedder(hashEmbedder{dimensions: 64}.Name())
+	if err != nil {
+		t.Fatalf("failed to load tokenizer: %v", err)
+	}
+	return tokenizer
+}
+
+func TestChunkPages(t *testing.T) {
+	tokenizer := testTokenizer(t)
+	embedder := hashEmbedder{dimensions: 64}
+
+	ocean := strings.Repeat("The ocean covers most of the planet. Waves carry energy across it. ", 8)
+	mountains := strings.Repeat("Mountains rise above the clouds. Glaciers carve deep valleys. ", 8)
+	pages := []string{ocean, "   \n  ", mountains}
+
+	tests := []struct {
+		name        string
+		opts        ChunkOptions
+		wantParents bool
+		sentences   bool // every chunk ends on a sentence
+		slack       int  // a token cut re-tokenized on its own can count one more
+	}{
+		{"fixed", ChunkOptions{Strategy: ChunkFixed, MaxTokens: 40, OverlapTokens: 10}, false, false, 1},
+		{"fixed without overlap", ChunkOptions{Strategy: ChunkFixed, MaxTokens: 40}, false, false, 1},
+		{"sentence", ChunkOptions{Strategy: ChunkSentence, MaxTokens: 40, OverlapSentences: 1}, false, true, 0},
+		{"recursive", ChunkOptions{Strategy: ChunkRecursive, MaxTokens: 40}, false, true, 0},
+		{"semantic", ChunkOptions{Strategy: ChunkSemantic, MaxTokens: 40, Percentile: 90}, false, true, 0},
+		{"recursive with parents", ChunkOptions{Strategy: ChunkRecursive, MaxTokens: 32, ParentTokens: 100}, true, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, parents, err := chunkPages(pages, nil, tt.opts, tokenizer, embedder)
+			if err != nil {
+				t.Fatalf("chunkPages failed: %v", err)
+			}
+			if len(chunks) < 2 {
+				t.Fatalf("got %d chunks, want the pages split", len(chunks))
+			}
+			if tt.wantParents != (len(parents) > 0) {
+				t.Fatalf("got %d parents, want parents = %v", len(parents), tt.wantParents)
+			}
+
+			covered := make(map[int]int)
+			for i, chunk := range chunks {
+				if chunk.Page != 1 && chunk.Page != 3 {
+					t.Fatalf("chunk %d on page %d, the blank page 2 has no text", i, chunk.Page)
+				}
+				page := pages[chunk.Page-1]
+				if page[chunk.Start:chunk.End] != chunk.Text || chunk.Text != strings.TrimSpace(chunk.Text) {
+					t.Errorf("chunk %d: text %q does not match its trimmed offsets", i, chunk.Text)
+				}
+				if chunk.Tokens != tokenizer.Count(chunk.Text) || chunk.Tokens > tt.opts.MaxTokens+tt.slack {
+					t.Errorf("chunk %d: %d tokens, max %d", i, chunk.Tokens, tt.opts.MaxTokens)
+				}
+				if tt.sentences && !strings.HasSuffix(chunk.Text, ".") {
+					t.Errorf("chunk %d ends mid-sentence: %q", i, chunk.Text)
+				}
+				if chunk.End > covered[chunk.Page] {
+					covered[chunk.Page] = chunk.End
+				}
+
+				if !tt.wantParents {
+					if chunk.Parent != -1 {
+						t.Errorf("chunk %d: parent %d without parents", i, chunk.Parent)
+					}
+					continue
+				}
+				if chunk.Parent < 0 || chunk.Parent >= len(parents) {
+					t.Fatalf("chunk %d: parent %d out of range", i, chunk.Parent)
+				}
+				parent := parents[chunk.Parent]
+				if parent.Page != chunk.Page || chunk.Start < parent.Start || chunk.Start >= parent.End {
+					t.Errorf("chunk %d (page %d, %d-%d) does not start inside its parent (page %d, %d-%d)",
+						i, chunk.Page, chunk.Start, chunk.End, parent.Page, parent.Start, parent.End)
+				}
+			}
+			for _, n := range []int{1, 3} {
+				if want := len(strings.TrimSpace(pages[n-1])); covered[n] != want {
+					t.Errorf("page %d covered up to %d, want %d", n, covered[n], want)
+				}
+			}
+			for i, parent := range parents {
+				if parent.Tokens > tt.opts.ParentTokens {
+					t.Errorf("parent %d: %d tokens, max %d", i, parent.Tokens, tt.opts.ParentTokens)
+				}
+			}
+		})
+	}
+}
+
+func TestChunkPagesRejectsPageStrategy(t *testing.T) {
+	if _, _, err := chunkPages([]string{"text"}, nil, ChunkOptions{Strategy: ChunkPage}, testTokenizer(t), nil); err == nil {
+		t.Error("chunkPages accepted the page strategy")
+	}
+}
+
+func TestJoinChunks(t *testing.T) {
+	point := func(page, index, start, end int, text string) SearchResult {
+		return SearchResult{Payload: QdrantPage{PageNum: page, ChunkIndex: index, ChunkStart: start, ChunkEnd: end, Text: text}}
+	}
+
+	tests := []struct {
+		name   string
+		points []SearchResult
+		want   string
+	}{
+		{"empty", nil, ""},
+		{"overlap written once", []SearchResult{
+			point(1, 0, 0, 11, "hello world"),
+			point(1, 1, 6, 17, "world again"),
+		}, "hello world again"},
+		{"sorted by offsets", []SearchResult{
+			point(1, 1, 6, 17, "world again"),
+			point(1, 0, 0, 11, "hello world"),
+		}, "hello world again"},
+		{"contained chunk skipped", []SearchResult{
+			point(1, 0, 0, 17, "hello world again"),
+			point(1, 1, 6, 11, "world"),
+		}, "hello world again"},
+		{"gap on the page", []SearchResult{
+			point(1, 0, 0, 5, "hello"),
+			point(1, 1, 20, 25, "later"),
+		}, "hello later"},
+		{"pages in order", []SearchResult{
+			point(2, 0, 0, 6, "second"),
+			point(1, 0, 0, 5, "first"),
+		}, "first\n\nsecond"},
+		{"without offsets", []SearchResult{
+			point(1, 1, 0, 0, "b"),
+			point(1, 0, 0, 0, "a"),
+		}, "a\n\nb"},
+		{"rune offsets", []SearchResult{
+			point(1, 0, 0, 9, "ștefan și"),
+			point(1, 1, 7, 14, "și ana"),
+		}, "ștefan și ana"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := joinChunks(tt.points); got != tt.want {
+				t.Errorf("joinChunks = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
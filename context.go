@@ -0,0 +1,330 @@
+package main
+
+/*
+CONTEXT PENTRU /answer ȘI /smart-search (small-to-big)
+
+Căutarea întoarce bucăți mici (precise), dar modelul primește un context mai
+larg, construit după câmpul "context" (implicit ANSWER_CONTEXT=parent):
+  - chunks  textul bucăților găsite, ca înainte
+  - parent  textul părintelui fiecărei bucăți (chunking cu parent_tokens, vezi
+            chunking.go); bucățile cu același părinte dau un singur bloc, iar
+            cele fără părinte (documente mai vechi) rămân ca atare. Părintele
+            se caută în toate documentele utilizatorului, nu doar în filtrul
+            căutării: prima bucată a părintelui poate fi pe o pagină exclusă
+  - window  toate bucățile documentului din paginile [pagină-w, pagină+w]
+            (context_window=w, implicit 1); ferestrele care se suprapun se unesc
+
+Blocurile păstrează ordinea primei bucăți găsite și sunt limitate la
+ANSWER_CONTEXT_TOKENS (implicit 6000) tokeni; ultimul bloc poate fi tăiat.
+*/
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	ContextChunks = "chunks"
+	ContextParent = "parent"
+	ContextWindow = "window"
+
+	defaultContextWindow = 1
+	maxContextWindow     = 3
+	defaultContextTokens = 6000
+	minContextTailTokens = 50 // a truncated block shorter than this is dropped
+)
+
+// ContextBlock is one passage sent to the model
+type ContextBlock struct {
+	DocName   string  `json:"doc_name"`
+	FirstPage int     `json:"first_page"`
+	LastPage  int     `json:"last_page"`
+	Score     float32 `json:"score"`  // best search result in the block
+	Hits      int     `json:"hits"`   // search results merged into the block
+	Source    string  `json:"source"` // chunk, parent or window
+	Tokens    int     `json:"tokens,omitempty"`
+	Truncated bool    `json:"truncated,omitempty"`
+	Text      string  `json:"-"`
+}
+
+// contextOptions resolves the request's "context" and "context_window" fields
+func contextOptions(mode string, window *int) (string, int, error) {
+	if mode == "" {
+		mode = os.Getenv("ANSWER_CONTEXT")
+	}
+	mode = strings.ToLower(mode)
+	switch mode {
+	case "":
+		mode = ContextParent
+	case ContextChunks, ContextParent, ContextWindow:
+	default:
+		return "", 0, fmt.Errorf("unknown context %q (use chunks, parent or window)", mode)
+	}
+
+	w := defaultContextWindow
+	if window != nil {
+		if *window < 0 || *window > maxContextWindow {
+			return "", 0, fmt.Errorf("context_window must be between 0 and %d", maxContextWindow)
+		}
+		w = *window
+	}
+	return mode, w, nil
+}
+
+// buildAnswerContext expands the search results of username into context blocks.
+// On a Qdrant error the matched chunks are used, so the answer still has a context.
+func buildAnswerContext(username string, scope map[string]interface{}, results []SearchResult, mode string, window int) []ContextBlock {
+	var blocks []ContextBlock
+	var err error
+	switch mode {
+	case ContextParent:
+		blocks, err = parentBlocks(username, results)
+	case ContextWindow:
+		blocks, err = windowBlocks(scope, results, window)
+	default:
+		blocks = chunkBlocks(results)
+	}
+	if err != nil {
+		fmt.Printf("⚠️ Context expansion (%s) failed, using the matched chunks: %v\n", mode, err)
+		blocks = chunkBlocks(results)
+	}
+	return applyContextBudget(blocks, envInt("ANSWER_CONTEXT_TOKENS", defaultContextTokens))
+}
+
+func chunkBlock(result SearchResult) ContextBlock {
+	return ContextBlock{
+		DocName:   result.Payload.DocName,
+		FirstPage: result.Payload.PageNum,
+		LastPage:  result.Payload.PageNum,
+		Score:     result.Score,
+		Hits:      1,
+		Source:    "chunk",
+		Text:      result.Payload.Text,
+	}
+}
+
+func chunkBlocks(results []SearchResult) []ContextBlock {
+	blocks := make([]ContextBlock, 0, len(results))
+	for _, result := range results {
+		blocks = append(blocks, chunkBlock(result))
+	}
+	return blocks
+}
+
+// parentBlocks replaces every chunk by its parent, once per parent
+func parentBlocks(username string, results []SearchResult) ([]ContextBlock, error) {
+	var blocks []ContextBlock
+	byParent := make(map[string]int) // parent_id -> block
+	var parentIDs []string
+	for _, result := range results {
+		id := result.Payload.ParentID
+		if id == "" {
+			blocks = append(blocks, chunkBlock(result))
+			continue
+		}
+		if k, ok := byParent[id]; ok {
+			blocks[k].Hits++
+			continue
+		}
+		byParent[id] = len(blocks)
+		parentIDs = append(parentIDs, id)
+		blocks = append(blocks, chunkBlock(result))
+	}
+	if len(parentIDs) == 0 {
+		return blocks, nil
+	}
+
+	// The parent text is on the first child of each parent, which the search
+	// filter (pages, metadata, routing) may exclude: parent IDs are unique per
+	// document, so the user's points are enough
+	anchors, err := scrollAllPoints(withMust(userDocFilter(username, ""),
+		map[string]interface{}{"key": "parent_id", "match": map[string]interface{}{"any": parentIDs}},
+		map[string]interface{}{"must_not": []map[string]interface{}{
+			{"is_empty": map[string]string{"key": "parent_text"}},
+		}},
+	), []string{"parent_id", "parent_text", "parent_tokens"})
+	if err != nil {
+		return nil, err
+	}
+	for _, anchor := range anchors {
+		if k, ok := byParent[anchor.Payload.ParentID]; ok {
+			blocks[k].Text = anchor.Payload.ParentText
+			blocks[k].Source = "parent"
+		}
+	}
+
+	fmt.Printf("🧩 Expanded %d results into %d parents (%d blocks)\n", len(results), len(anchors), len(blocks))
+	return blocks, nil
+}
+
+// windowBlocks merges the chunks of the pages around every result
+func windowBlocks(scope map[string]interface{}, results []SearchResult, window int) ([]ContextBlock, error) {
+	type pageWindow struct {
+		docName, docHash string
+		first, last      int
+		block            ContextBlock
+	}
+	var windows []*pageWindow
+
+	for _, result := range results {
+		first, last := result.Payload.PageNum-window, result.Payload.PageNum+window
+		if first < 1 {
+			first = 1
+		}
+
+		// Windows of the same document that touch are merged (shared pages once)
+		var merged *pageWindow
+		for _, w := range windows {
+			if w.docName == result.Payload.DocName && w.docHash == result.Payload.DocHash &&
+				first <= w.last+1 && last >= w.first-1 {
+				merged = w
+				break
+			}
+		}
+		if merged == nil {
+			block := chunkBlock(result)
+			block.Source = "window"
+			windows = append(windows, &pageWindow{
+				docName: result.Payload.DocName, docHash: result.Payload.DocHash,
+				first: first, last: last, block: block,
+			})
+			continue
+		}
+		merged.block.Hits++
+		if first < merged.first {
+			merged.first = first
+		}
+		if last > merged.last {
+			merged.last = last
+		}
+	}
+
+	blocks := make([]ContextBlock, 0, len(windows))
+	for _, w := range windows {
+		conditions := []map[string]interface{}{
+			{"key": "doc_name", "match": map[string]string{"value": w.docName}},
+			{"key": "page_num", "range": map[string]int{"gte": w.first, "lte": w.last}},
+		}
+		if w.docHash != "" {
+			conditions = append(conditions, map[string]interface{}{"key": "doc_hash", "match": map[string]string{"value": w.docHash}})
+		}
+		points, err := scrollAllPoints(withMust(scope, conditions...),
+			[]string{"page_num", "text", "chunk_index", "chunk_start", "chunk_end"})
+		if err != nil {
+			return nil, err
+		}
+
+		block := w.block
+		if len(points) > 0 {
+			block.Text = joinChunks(points)
+			block.FirstPage = points[0].Payload.PageNum
+			block.LastPage = points[0].Payload.PageNum
+			for _, p := range points {
+				if p.Payload.PageNum < block.FirstPage {
+					block.FirstPage = p.Payload.PageNum
+				}
+				if p.Payload.PageNum > block.LastPage {
+					block.LastPage = p.Payload.PageNum
+				}
+			}
+		}
+		blocks = append(blocks, block)
+	}
+
+	fmt.Printf("🧩 Expanded %d results into %d page windows (±%d)\n", len(results), len(blocks), window)
+	return blocks, nil
+}
+
+// chunkBefore is the reading order of chunks: page, offset in the page (when
+// both have one), then the order they were stored in
+func chunkBefore(a, b QdrantPage) bool {
+	if a.PageNum != b.PageNum {
+		return a.PageNum < b.PageNum
+	}
+	if a.ChunkEnd > 0 && b.ChunkEnd > 0 && a.ChunkStart != b.ChunkStart {
+		return a.ChunkStart < b.ChunkStart
+	}
+	return a.ChunkIndex < b.ChunkIndex
+}
+
+// joinChunks rebuilds the text of consecutive chunks. Chunks of one page with
+// offsets (chunk_start/chunk_end) are merged without repeating their overlap.
+func joinChunks(points []SearchResult) string {
+	sort.SliceStable(points, func(i, j int) bool { return chunkBefore(points[i].Payload, points[j].Payload) })
+
+	var text strings.Builder
+	page, pageEnd := 0, -1 // pageEnd: rune offset covered on the current page, -1 unknown
+	for _, point := range points {
+		p := point.Payload
+		switch {
+		case text.Len() == 0:
+		case p.PageNum != page || p.ChunkEnd == 0 || pageEnd < 0:
+			text.WriteString("\n\n")
+		case p.ChunkEnd <= pageEnd:
+			continue // inside what was already written
+		case p.ChunkStart < pageEnd:
+			// Overlap with the previous chunk: write only the new part
+			runes := []rune(p.Text)
+			if skip := pageEnd - p.ChunkStart; skip < len(runes) {
+				text.WriteString(string(runes[skip:]))
+			}
+			pageEnd = p.ChunkEnd
+			continue
+		default:
+			text.WriteString(" ")
+		}
+
+		text.WriteString(p.Text)
+		page = p.PageNum
+		pageEnd = -1
+		if p.ChunkEnd > 0 {
+			pageEnd = p.ChunkEnd
+		}
+	}
+	return text.String()
+}
+
+// applyContextBudget keeps blocks in order until budget tokens; the block that
+// crosses the budget is cut on a token boundary
+func applyContextBudget(blocks []ContextBlock, budget int) []ContextBlock {
+	tokenizer, err := tokenizerForEmbedder(qdrant.Embedder.Name())
+	if err != nil || budget <= 0 {
+		return blocks
+	}
+
+	used := 0
+	for i := range blocks {
+		blocks[i].Tokens = tokenizer.Count(blocks[i].Text)
+		if used+blocks[i].Tokens <= budget {
+			used += blocks[i].Tokens
+			continue
+		}
+
+		remaining := budget - used
+		if remaining < minContextTailTokens {
+			return blocks[:i]
+		}
+		boundaries := tokenizer.Boundaries(blocks[i].Text)
+		blocks[i].Text = blocks[i].Text[:boundaries[remaining-1]]
+		blocks[i].Tokens = remaining
+		blocks[i].Truncated = true
+		return blocks[:i+1]
+	}
+	return blocks
+}
+
+// formatAnswerContext is the text given to answerFromVectorDB
+func formatAnswerContext(blocks []ContextBlock) string {
+	var context strings.Builder
+	for i, block := range blocks {
+		pages := fmt.Sprintf("page %d", block.FirstPage)
+		if block.LastPage != block.FirstPage {
+			pages = fmt.Sprintf("pages %d-%d", block.FirstPage, block.LastPage)
+		}
+		context.WriteString(fmt.Sprintf("Document %d (%s, %s, Score: %.3f):\n%s\n\n",
+			i+1, block.DocName, pages, block.Score, block.Text))
+	}
+	return context.String()
+}
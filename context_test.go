@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParentChunkIDIsUniquePerDocument(t *testing.T) {
+	base := parentChunkID("id-1", "0123456789abcdef0123", 1)
+
+	tests := []struct {
+		name string
+		id   string
+		same bool
+	}{
+		{"same inputs", parentChunkID("id-1", "0123456789abcdef0123", 1), true},
+		{"other document", parentChunkID("id-2", "0123456789abcdef0123", 1), false},
+		{"other version", parentChunkID("id-1", "fedcba9876543210fedc", 1), false},
+		{"other parent", parentChunkID("id-1", "0123456789abcdef0123", 2), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.id == base) != tt.same {
+				t.Errorf("parentChunkID = %s, base %s, want same = %v", tt.id, base, tt.same)
+			}
+		})
+	}
+}
+
+// storeParentDocument stores one parent split into three children on pages 1-3
+func storeParentDocument(t *testing.T, username, docName, parentText string) {
+	t.Helper()
+	chunks := []StoreChunk{
+		{Text: "first child", PageNum: 1, Parent: 1, ParentText: parentText},
+		{Text: "second child", PageNum: 2, Parent: 1},
+		{Text: "third child", PageNum: 3, Parent: 1},
+	}
+	if _, err := storePagesInQdrant(username, chunks, docName, "same-file", "recursive", nil, nil, nil); err != nil {
+		t.Fatalf("failed to store %s: %v", docName, err)
+	}
+}
+
+func TestParentBlocksOutsideTheSearchScope(t *testing.T) {
+	useTestVectorStore(t)
+	storeParentDocument(t, "ana", "a.pdf", "parent of a")
+	storeParentDocument(t, "ana", "b.pdf", "parent of b") // same file, second name
+	storeParentDocument(t, "bob", "a.pdf", "parent of bob")
+
+	// The search was limited to page 3 of a.pdf: the anchor (page 1) is outside it
+	scope := withMust(userDocFilter("ana", "a.pdf"),
+		map[string]interface{}{"key": "page_num", "range": map[string]int{"gte": 3}})
+	results, err := scrollAllPoints(scope, searchPayload)
+	if err != nil {
+		t.Fatalf("scroll failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Payload.ParentID == "" {
+		t.Fatalf("got %+v, want the third child with a parent", results)
+	}
+
+	blocks := buildAnswerContext("ana", scope, results, ContextParent, 0)
+	if len(blocks) != 1 {
+		t.Fatalf("got %d blocks, want 1", len(blocks))
+	}
+	if blocks[0].Source != "parent" || blocks[0].Text != "parent of a" {
+		t.Errorf("block = %q from %s, want the parent of a.pdf", blocks[0].Text, blocks[0].Source)
+	}
+}
@@ -0,0 +1,629 @@
+package main
+
+/*
+RUTARE PE DOCUMENTE (căutare în două etape)
+
+Pe lângă pagini, fiecare document are un punct în colecția de documente
+(QDRANT_DOC_COLLECTION, implicit "<QDRANT_COLLECTION>_docs"), cu embedding-ul
+unui rezumat al documentului:
+
+    Document: raport.pdf
+    Title: Raport anual 2024
+    Metadata: course: Fizica 1; year: 2024
+    Sections: Introducere; Rezultate; Concluzii
+
+    <abstract>
+
+Abstract-ul (DOC_SUMMARY) este:
+  - llm         3-5 propoziții generate de DOC_SUMMARY_MODEL (implicit modelul de
+                răspuns) din începutul documentului
+  - extractive  primele propoziții din document (fără apeluri externe)
+  - auto        llm dacă OPENROUTER_API_KEY este setat, altfel extractive (implicit)
+  - off         fără puncte de document (și fără rutare)
+
+Punctul este actualizat la /extract/store (re-încărcarea aceluiași fișier
+refolosește abstract-ul; doar metadata sau numele schimbă embedding-ul), la
+redenumire și la ștergere. Documentele salvate înainte de această funcție nu
+au punct: o re-încărcare (neschimbată) îl creează.
+
+/search, /answer și /smart-search (fără doc_name) aleg întâi cele mai apropiate
+"route_docs" documente, apoi caută pagini doar în ele și în documentele fără
+rezumat (sau cu rezumat de la alt embedder), care altfel n-ar mai putea fi
+găsite: filtrul adăugat automat este doc_name ∈ rutate SAU doc_name ∉ rezumate.
+Fără route_docs, rutarea pornește singură când utilizatorul are cel puțin
+SEARCH_ROUTE_MIN_DOCS (implicit 20) documente rezumate și folosește
+SEARCH_ROUTE_DOCS (implicit 5) documente; route_docs: 0 o dezactivează.
+Filtrul cererii se aplică și documentelor, dacă nu folosește page_num.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DocSummaryAuto       = "auto"
+	DocSummaryLLM        = "llm"
+	DocSummaryExtractive = "extractive"
+	DocSummaryOff        = "off"
+
+	defaultRouteDocs    = 5
+	maxRouteDocs        = 50
+	defaultRouteMinDocs = 20
+	docAbstractTokens   = 3000 // beginning of the document given to the LLM
+	docAbstractChars    = 600  // length of an extractive abstract
+	maxDocAbstractChars = 1500
+	maxDocSections      = 20
+	maxDocSectionChars  = 120
+)
+
+// documentIndex is the document-level collection (nil: no summaries, no routing)
+var documentIndex *QdrantClient
+
+// DocumentSummary is the payload of a document point
+type DocumentSummary struct {
+	Username       string                 `json:"username"`
+	DocName        string                 `json:"doc_name"`
+	DocHash        string                 `json:"doc_hash"`
+	Embedder       string                 `json:"embedder"`
+	UploadedAt     string                 `json:"uploaded_at,omitempty"`
+	Title          string                 `json:"title"`
+	Abstract       string                 `json:"abstract"`
+	AbstractSource string                 `json:"abstract_source"` // extractive or llm:<model>
+	Sections       []string               `json:"sections,omitempty"`
+	NumPages       int                    `json:"num_pages"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	SummaryText    string                 `json:"summary_text"` // what the vector was computed from
+}
+
+// RoutedDocument is a document picked by the first search stage
+type RoutedDocument struct {
+	DocName string  `json:"doc_name"`
+	Title   string  `json:"title,omitempty"`
+	Score   float32 `json:"score"`
+}
+
+// DocumentRoute is returned with the search results when routing was used
+type DocumentRoute struct {
+	Documents  []RoutedDocument `json:"documents"`
+	Candidates int              `json:"candidates,omitempty"` // summarized documents in scope (automatic routing)
+}
+
+// newDocumentIndex shares the connection (or the store directory) of the page collection
+func newDocumentIndex(pages *QdrantClient) (*QdrantClient, error) {
+	collection := os.Getenv("QDRANT_DOC_COLLECTION")
+	if collection == "" {
+		collection = pages.Collection + "_docs"
+	}
+	q := &QdrantClient{
+		URL:        pages.URL,
+		APIKey:     pages.APIKey,
+		Collection: collection,
+		VectorSize: pages.VectorSize,
+		Embedder:   pages.Embedder,
+		httpClient: pages.httpClient,
+	}
+	q.Store = qdrantStore{q}
+	if _, ok := pages.Store.(*EmbeddedStore); ok {
+		store, err := openEmbeddedStore(vectorStorePath(), collection)
+		if err != nil {
+			return nil, err
+		}
+		q.Store = store
+	}
+	return q, nil
+}
+
+// EnsureDocumentCollection creates the document collection (one simple vector)
+// and its payload indexes
+func (q *QdrantClient) EnsureDocumentCollection() error {
+	if store, ok := q.Store.(*EmbeddedStore); ok {
+		if err := store.ensure(q.VectorSize, false); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Embedded collection '%s' ready (document summaries, %d points)\n", q.Collection, store.Len())
+		return nil
+	}
+
+	body, status, err := q.do("GET", q.collectionPath(""), nil)
+	if err != nil {
+		return fmt.Errorf("failed to reach Qdrant at %s: %v", q.URL, err)
+	}
+
+	switch {
+	case status == http.StatusNotFound:
+		create, _ := json.Marshal(map[string]interface{}{
+			"vectors": VectorConfig{Size: q.VectorSize, Distance: qdrantDistance},
+		})
+		body, status, err := q.do("PUT", q.collectionPath(""), create)
+		if err != nil {
+			return fmt.Errorf("failed to create collection '%s': %v", q.Collection, err)
+		}
+		if status >= 400 {
+			return fmt.Errorf("failed to create collection '%s': status %d, response: %s", q.Collection, status, string(body))
+		}
+		fmt.Printf("🆕 Created Qdrant collection '%s' (document summaries, %d %s)\n", q.Collection, q.VectorSize, qdrantDistance)
+	case status >= 400:
+		return fmt.Errorf("failed to get collection '%s': status %d, response: %s", q.Collection, status, string(body))
+	default:
+		if err := q.checkVectorConfig(body); err != nil {
+			return err
+		}
+		if q.Hybrid {
+			return fmt.Errorf("%w: collection '%s' must have a single unnamed vector", errQdrantVectorMismatch, q.Collection)
+		}
+		q.loadIndexedFields(body)
+	}
+
+	for _, field := range []string{"username", "doc_name", "embedder"} {
+		if err := q.ensurePayloadIndex(field, "keyword"); err != nil {
+			return err
+		}
+	}
+	return q.ensurePayloadIndex("uploaded_at", "datetime")
+}
+
+// docSummaryPointID is stable per user and document name (a replaced file
+// overwrites its summary)
+func docSummaryPointID(username, docName string) string {
+	return uuid.NewSHA1(pointIDNamespace, []byte(fmt.Sprintf("doc\x00%s\x00%s", username, docName))).String()
+}
+
+// docSummaryMode returns the configured abstract source ("" when summaries are off)
+func docSummaryMode() string {
+	mode := strings.ToLower(os.Getenv("DOC_SUMMARY"))
+	switch mode {
+	case "", DocSummaryAuto:
+		if os.Getenv("OPENROUTER_API_KEY") != "" {
+			return DocSummaryLLM
+		}
+		return DocSummaryExtractive
+	case DocSummaryLLM, DocSummaryExtractive:
+		return mode
+	case DocSummaryOff:
+		return ""
+	default:
+		fmt.Printf("⚠️ Unknown DOC_SUMMARY=%q, using %s\n", mode, DocSummaryExtractive)
+		return DocSummaryExtractive
+	}
+}
+
+func docSummaryModel() string {
+	if model := os.Getenv("DOC_SUMMARY_MODEL"); model != "" {
+		return model
+	}
+	return OpenRouterModel
+}
+
+// text is what the document vector is computed from
+func (s DocumentSummary) text() string {
+	var text strings.Builder
+	text.WriteString("Document: " + s.DocName + "\n")
+	if s.Title != "" && s.Title != strings.TrimSuffix(s.DocName, filepath.Ext(s.DocName)) {
+		text.WriteString("Title: " + s.Title + "\n")
+	}
+	if len(s.Metadata) > 0 {
+		keys := make([]string, 0, len(s.Metadata))
+		for key := range s.Metadata {
+			if key != "title" {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		fields := make([]string, 0, len(keys))
+		for _, key := range keys {
+			value := s.Metadata[key]
+			if list, ok := value.([]interface{}); ok {
+				items := make([]string, len(list))
+				for i, item := range list {
+					items[i] = fmt.Sprint(item)
+				}
+				value = strings.Join(items, ", ")
+			}
+			fields = append(fields, fmt.Sprintf("%s: %v", key, value))
+		}
+		if len(fields) > 0 {
+			text.WriteString("Metadata: " + strings.Join(fields, "; ") + "\n")
+		}
+	}
+	if len(s.Sections) > 0 {
+		text.WriteString("Sections: " + strings.Join(s.Sections, "; ") + "\n")
+	}
+	text.WriteString("\n" + s.Abstract)
+	return text.String()
+}
+
+// updateDocumentSummary creates or refreshes the document point after the pages
+// were stored. The abstract of an unchanged file is reused. Returns created,
+// updated or unchanged ("" when summaries are off).
+func updateDocumentSummary(username, docName, docHash string, pages []string, blocks []DocBlock, metadata map[string]interface{}) (string, error) {
+	mode := docSummaryMode()
+	if documentIndex == nil || mode == "" {
+		return "", nil
+	}
+
+	existing, err := documentIndex.getDocumentSummary(username, docName)
+	if err != nil {
+		return "", err
+	}
+
+	source := DocSummaryExtractive
+	if mode == DocSummaryLLM {
+		source = "llm:" + docSummaryModel()
+	}
+
+	summary := DocumentSummary{
+		Username:   username,
+		DocName:    docName,
+		DocHash:    docHash,
+		Embedder:   documentIndex.Embedder.Name(),
+		UploadedAt: time.Now().UTC().Format(time.RFC3339),
+		NumPages:   len(pages),
+		Metadata:   metadata,
+	}
+	if existing != nil && existing.DocHash == docHash && existing.AbstractSource == source {
+		// Same file: only the name, metadata or model can change the vector
+		summary.UploadedAt = existing.UploadedAt
+		summary.Title = existing.Title
+		summary.Abstract = existing.Abstract
+		summary.AbstractSource = existing.AbstractSource
+		summary.Sections = existing.Sections
+		if metadata == nil {
+			summary.Metadata = existing.Metadata
+		} else if title, ok := metadata["title"].(string); ok && strings.TrimSpace(title) != "" {
+			summary.Title = strings.TrimSpace(title)
+		}
+		if existing.Embedder == summary.Embedder && existing.SummaryText == summary.text() {
+			return "unchanged", nil
+		}
+	} else {
+		summary.Title = documentTitle(metadata, blocks, docName)
+		summary.Sections = documentSections(pages, blocks)
+		summary.Abstract, summary.AbstractSource = documentAbstract(mode, summary.Title, summary.Sections, pages)
+	}
+
+	if err := documentIndex.putDocumentSummary(summary); err != nil {
+		return "", err
+	}
+	outcome := "created"
+	if existing != nil {
+		outcome = "updated"
+	}
+	fmt.Printf("🗂️ Document summary of '%s' for user '%s' %s (%s)\n", docName, username, outcome, summary.AbstractSource)
+	return outcome, nil
+}
+
+// renameDocumentSummary moves the summary to the new name (re-embedded, same abstract)
+func renameDocumentSummary(username, docName, newName string) error {
+	if documentIndex == nil {
+		return nil
+	}
+	summary, err := documentIndex.getDocumentSummary(username, docName)
+	if err != nil || summary == nil {
+		return err
+	}
+	// A title taken from the file name follows the new name
+	if summary.Title == strings.TrimSuffix(docName, filepath.Ext(docName)) {
+		summary.Title = strings.TrimSuffix(newName, filepath.Ext(newName))
+	}
+	summary.DocName = newName
+	if err := documentIndex.putDocumentSummary(*summary); err != nil {
+		return err
+	}
+	return documentIndex.Store.Delete(userDocFilter(username, docName))
+}
+
+// deleteDocumentSummaries removes the summaries of one document ("" for all of the user's)
+func deleteDocumentSummaries(username, docName string) error {
+	if documentIndex == nil {
+		return nil
+	}
+	return documentIndex.Store.Delete(userDocFilter(username, docName))
+}
+
+func (q *QdrantClient) getDocumentSummary(username, docName string) (*DocumentSummary, error) {
+	var point struct {
+		Payload DocumentSummary `json:"payload"`
+	}
+	found, err := q.Store.Get(docSummaryPointID(username, docName), &point)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &point.Payload, nil
+}
+
+func (q *QdrantClient) putDocumentSummary(summary DocumentSummary) error {
+	summary.SummaryText = summary.text()
+	summary.Embedder = q.Embedder.Name()
+	if summary.Metadata != nil {
+		q.ensureMetadataIndexes(summary.Metadata)
+	}
+
+	embeddings, err := q.Embedder.Embed([]string{summary.SummaryText})
+	if err != nil {
+		return fmt.Errorf("failed to get document embedding: %v", err)
+	}
+	if len(embeddings) != 1 {
+		return fmt.Errorf("got %d embeddings for the document summary", len(embeddings))
+	}
+
+	err = q.Store.Upsert([]QdrantPoint{{
+		ID:      docSummaryPointID(summary.Username, summary.DocName),
+		Vector:  embeddings[0],
+		Payload: summary,
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to upload document summary: %v", err)
+	}
+	return nil
+}
+
+// documentSections lists the headings of the document (structure blocks when
+// extracted, otherwise heading-like lines)
+func documentSections(pages []string, blocks []DocBlock) []string {
+	var headings []string
+	for _, block := range blocks {
+		if block.Kind == BlockHeading {
+			headings = append(headings, block.Text)
+		}
+	}
+	if len(headings) == 0 {
+		for _, page := range pages {
+			for _, line := range strings.Split(page, "\n") {
+				if isHeadingLine(line) {
+					headings = append(headings, line)
+				}
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	var sections []string
+	for _, heading := range headings {
+		heading = strings.Join(strings.Fields(heading), " ")
+		if runes := []rune(heading); len(runes) > maxDocSectionChars {
+			heading = string(runes[:maxDocSectionChars])
+		}
+		if heading == "" || seen[heading] {
+			continue
+		}
+		seen[heading] = true
+		sections = append(sections, heading)
+		if len(sections) == maxDocSections {
+			break
+		}
+	}
+	return sections
+}
+
+// documentAbstract generates the abstract; a failed LLM call falls back to the extractive one
+func documentAbstract(mode, title string, sections []string, pages []string) (string, string) {
+	if mode == DocSummaryLLM {
+		abstract, err := llmAbstract(title, sections, pages)
+		if err == nil {
+			return abstract, "llm:" + docSummaryModel()
+		}
+		fmt.Printf("⚠️ Document abstract with %s failed, using the first sentences: %v\n", docSummaryModel(), err)
+	}
+	return extractiveAbstract(pages), DocSummaryExtractive
+}
+
+// extractiveAbstract takes the first sentences of the document, without heading lines
+func extractiveAbstract(pages []string) string {
+	var body []string
+	for _, page := range pages {
+		for _, line := range strings.Split(page, "\n") {
+			if !isHeadingLine(line) {
+				body = append(body, line)
+			}
+		}
+		body = append(body, "")
+	}
+	text := strings.Join(body, "\n")
+
+	var abstract []string
+	length := 0
+	for _, s := range sentenceSpans(text, span{0, len(text)}) {
+		if s = trimSpan(text, s); s.end <= s.start {
+			continue
+		}
+		sentence := strings.Join(strings.Fields(text[s.start:s.end]), " ")
+		abstract = append(abstract, sentence)
+		if length += utf8.RuneCountInString(sentence); length >= docAbstractChars {
+			break
+		}
+	}
+	return capRunes(strings.Join(abstract, " "), maxDocAbstractChars)
+}
+
+func llmAbstract(title string, sections []string, pages []string) (string, error) {
+	tokenizer, err := tokenizerForEmbedder(qdrant.Embedder.Name())
+	if err != nil {
+		return "", err
+	}
+	excerpt := strings.Join(pages, "\n\n")
+	if boundaries := tokenizer.Boundaries(excerpt); len(boundaries) > docAbstractTokens {
+		excerpt = excerpt[:boundaries[docAbstractTokens-1]]
+	}
+
+	prompt := fmt.Sprintf(`<document title=%q>
+%s
+</document>
+
+Sections: %s
+
+Write an abstract of this document in 3 to 5 sentences: its subject, scope and main topics, so that it can be found by a search over many documents. Use the language of the document. Answer with the abstract only.`,
+		title, excerpt, strings.Join(sections, "; "))
+
+	response, err := callOpenRouter(OpenRouterRequest{
+		Model:       docSummaryModel(),
+		Temperature: 0,
+		MaxTokens:   400,
+		Messages:    []OpenRouterMessage{{Role: "user", Content: prompt}},
+	}, os.Getenv("OPENROUTER_API_KEY"))
+	if err != nil {
+		return "", err
+	}
+	abstract := strings.Join(strings.Fields(response), " ")
+	if abstract == "" {
+		return "", fmt.Errorf("empty abstract")
+	}
+	return capRunes(abstract, maxDocAbstractChars), nil
+}
+
+func capRunes(s string, max int) string {
+	if runes := []rune(s); len(runes) > max {
+		return string(runes[:max])
+	}
+	return s
+}
+
+// routeDocCount resolves "route_docs": nil means automatic (SEARCH_ROUTE_DOCS
+// once the user has SEARCH_ROUTE_MIN_DOCS summarized documents)
+func routeDocCount(requested *int) (int, bool, error) {
+	if requested == nil {
+		return envInt("SEARCH_ROUTE_DOCS", defaultRouteDocs), true, nil
+	}
+	if *requested < 0 || *requested > maxRouteDocs {
+		return 0, false, fmt.Errorf("route_docs must be between 0 and %d", maxRouteDocs)
+	}
+	return *requested, false, nil
+}
+
+// routedSearchScope is searchScope plus the document routing stage. Only invalid
+// requests return an error; when routing fails the pages of all documents are searched.
+func routedSearchScope(username, docName string, filter *SearchFilter, query string, routeDocs *int) (map[string]interface{}, *DocumentRoute, error) {
+	scope, err := searchScope(username, docName, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	limit, auto, err := routeDocCount(routeDocs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if docName != "" || limit == 0 || documentIndex == nil {
+		return scope, nil, nil
+	}
+
+	route, err := routeDocuments(username, filter, scope, query, limit, auto)
+	if err != nil {
+		fmt.Printf("⚠️ Document routing failed, searching all documents: %v\n", err)
+		return scope, nil, nil
+	}
+	if route == nil {
+		return scope, nil, nil
+	}
+
+	// Documents without a (current) summary cannot be routed: they stay searchable
+	summarized, err := summarizedDocNames(username)
+	if err != nil {
+		fmt.Printf("⚠️ Document routing failed, searching all documents: %v\n", err)
+		return scope, nil, nil
+	}
+	names := make([]interface{}, len(route.Documents))
+	for i, doc := range route.Documents {
+		names[i] = doc.DocName
+	}
+	scope = withMust(scope, map[string]interface{}{"should": []map[string]interface{}{
+		{"key": "doc_name", "match": map[string]interface{}{"any": names}},
+		{"must_not": []map[string]interface{}{
+			{"key": "doc_name", "match": map[string]interface{}{"any": summarized}},
+		}},
+	}})
+	return scope, route, nil
+}
+
+// summarizedDocNames lists the documents of username that have a summary from the
+// current embedder, i.e. the ones routing can pick
+func summarizedDocNames(username string) ([]interface{}, error) {
+	filter := withMust(userDocFilter(username, ""), embedderFilter(documentIndex.Embedder.Name()))
+	var names []interface{}
+	var offset interface{}
+	for {
+		var points []struct {
+			Payload DocumentSummary `json:"payload"`
+		}
+		next, err := documentIndex.Store.Scroll(ScrollRequest{
+			Filter:      filter,
+			Limit:       documentScrollPageSize,
+			Offset:      offset,
+			WithPayload: []string{"doc_name"},
+		}, &points)
+		if err != nil {
+			return nil, err
+		}
+		for _, point := range points {
+			names = append(names, point.Payload.DocName)
+		}
+		if next == nil || len(points) == 0 {
+			return names, nil
+		}
+		offset = next
+	}
+}
+
+// routeDocuments picks the documents closest to the query (nil: no routing)
+func routeDocuments(username string, filter *SearchFilter, scope map[string]interface{}, query string, limit int, auto bool) (*DocumentRoute, error) {
+	// Page-level conditions do not exist on document points
+	docScope := scope
+	if filter.usesField("page_num") {
+		docScope = userDocFilter(username, "")
+	}
+	docScope = withMust(docScope, embedderFilter(documentIndex.Embedder.Name()))
+
+	route := &DocumentRoute{}
+	if auto {
+		count, err := documentIndex.Store.Count(docScope)
+		if err != nil {
+			return nil, err
+		}
+		if count < envInt("SEARCH_ROUTE_MIN_DOCS", defaultRouteMinDocs) {
+			return nil, nil
+		}
+		route.Candidates = count
+	}
+
+	queryEmbeddings, err := documentIndex.Embedder.Embed([]string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get query embedding: %v", err)
+	}
+	if len(queryEmbeddings) == 0 {
+		return nil, fmt.Errorf("no embedding generated for query")
+	}
+
+	var hits []struct {
+		Score   float32         `json:"score"`
+		Payload DocumentSummary `json:"payload"`
+	}
+	err = documentIndex.Store.Search(SearchRequest{
+		Vector:      queryEmbeddings[0],
+		Filter:      docScope,
+		Limit:       limit,
+		WithPayload: []string{"doc_name", "title"},
+	}, &hits)
+	if err != nil {
+		return nil, err
+	}
+	if len(hits) == 0 {
+		return nil, nil // no summarized documents: search everything
+	}
+
+	for _, hit := range hits {
+		route.Documents = append(route.Documents, RoutedDocument{
+			DocName: hit.Payload.DocName,
+			Title:   hit.Payload.Title,
+			Score:   hit.Score,
+		})
+	}
+	fmt.Printf("🧭 Routed query to %d documents for user '%s'\n", len(route.Documents), username)
+	return route, nil
+}
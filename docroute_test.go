@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+)
+
+// useTestDocumentIndex adds an embedded document collection next to the test store
+func useTestDocumentIndex(t *testing.T) {
+	t.Helper()
+	t.Setenv("DOC_SUMMARY", DocSummaryExtractive)
+	index, err := newDocumentIndex(qdrant)
+	if err != nil {
+		t.Fatalf("failed to open document index: %v", err)
+	}
+	if err := index.EnsureDocumentCollection(); err != nil {
+		t.Fatalf("failed to create document collection: %v", err)
+	}
+	previous := documentIndex
+	documentIndex = index
+	t.Cleanup(func() {
+		documentIndex = previous
+		index.Store.(*EmbeddedStore).Flush()
+	})
+}
+
+func TestRoutingKeepsUnsummarizedDocumentsSearchable(t *testing.T) {
+	useTestVectorStore(t)
+	useTestDocumentIndex(t)
+
+	summarized := map[string]string{
+		"ocean.pdf":     "the ocean covers most of the planet and its waves carry energy",
+		"mountains.pdf": "mountains rise above the clouds and glaciers carve valleys",
+		"cooking.pdf":   "bread needs flour water salt and yeast",
+	}
+	for name, text := range summarized {
+		storeTestChunks(t, "ana", name, []int{1}, []string{text})
+		if _, err := updateDocumentSummary("ana", name, "hash-"+name, []string{text}, nil, nil); err != nil {
+			t.Fatalf("failed to summarize %s: %v", name, err)
+		}
+	}
+	// Stored before summaries existed (or with summaries off)
+	storeTestChunks(t, "ana", "legacy.pdf", []int{1}, []string{"an old report about ocean tides"})
+	storeTestChunks(t, "bob", "other.pdf", []int{1}, []string{"the ocean again"})
+
+	one, zero := 1, 0
+	tests := []struct {
+		name      string
+		routeDocs *int
+		want      []string
+	}{
+		{"routing to one document", &one, []string{"legacy.pdf", "ocean.pdf"}},
+		{"routing disabled", &zero, []string{"cooking.pdf", "legacy.pdf", "mountains.pdf", "ocean.pdf"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, route, err := routedSearchScope("ana", "", nil, "ocean waves energy planet", tt.routeDocs)
+			if err != nil {
+				t.Fatalf("routedSearchScope failed: %v", err)
+			}
+			if tt.routeDocs != nil && *tt.routeDocs > 0 && (route == nil || len(route.Documents) != 1) {
+				t.Fatalf("route = %+v, want one document", route)
+			}
+			got := scopeDocNames(t, scope)
+			if len(got) != len(tt.want) {
+				t.Fatalf("searched %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("searched %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+/*
+GESTIONARE DOCUMENTE (peste payload-ul username / doc_name din Qdrant)
+
+  GET    /documents/:username             - documentele utilizatorului (pagini, chunk-uri, data încărcării, metadata)
+  GET    /documents/:username/:docName    - toate chunk-urile salvate ale unui document, în ordinea paginilor
+  DELETE /documents/:username/:docName    - șterge un document
+  PATCH  /documents/:username/:docName    - redenumește un document ({"new_name": "..."})
+  GET    /users/:username/stats           - statistici de stocare per utilizator
+
+Punctele salvate înainte de câmpul uploaded_at nu au dată de încărcare.
+*/
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const documentScrollPageSize = 256
+
+// DocumentInfo - un document din lista utilizatorului
+type DocumentInfo struct {
+	DocName    string                 `json:"doc_name"`
+	Pages      int                    `json:"pages"`  // distinct source pages
+	Chunks     int                    `json:"chunks"` // stored points
+	UploadedAt string                 `json:"uploaded_at,omitempty"`
+	Embedder   string                 `json:"embedder,omitempty"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type StoredPage struct {
+	ID         string `json:"id"`
+	PageNum    int    `json:"page_num"`
+	ChunkIndex int    `json:"chunk_index"`
+	ChunkStart int    `json:"chunk_start,omitempty"` // rune offsets in the page (token chunking)
+	ChunkEnd   int    `json:"chunk_end,omitempty"`
+	Text       string `json:"text"`
+}
+
+type UserStorageStats struct {
+	Username       string `json:"username"`
+	Documents      int    `json:"documents"`
+	Points         int    `json:"points"`
+	TextChars      int    `json:"text_chars"`
+	TextBytes      int    `json:"text_bytes"`
+	VectorBytes    int    `json:"vector_bytes"`
+	EstimatedBytes int    `json:"estimated_bytes"`
+}
+
+// userDocFilter matches the points of a user, optionally of one document
+func userDocFilter(username, docName string) map[string]interface{} {
+	conditions := []map[string]interface{}{
+		{"key": "username", "match": map[string]string{"value": username}},
+	}
+	if docName != "" {
+		conditions = append(conditions, map[string]interface{}{
+			"key": "doc_name", "match": map[string]string{"value": docName},
+		})
+	}
+	return map[string]interface{}{"must": conditions}
+}
+
+// scrollAllPoints pages through every point matching filter
+func scrollAllPoints(filter map[string]interface{}, withPayload interface{}) ([]SearchResult, error) {
+	return scrollPoints(filter, withPayload, 0)
+}
+
+// scrollPoints pages through the points matching filter, stopping after max (0: all)
+func scrollPoints(filter map[string]interface{}, withPayload interface{}, max int) ([]SearchResult, error) {
+	var all []SearchResult
+	var offset interface{}
+
+	for {
+		pageSize := documentScrollPageSize
+		if max > 0 && max-len(all) < pageSize {
+			pageSize = max - len(all)
+		}
+		var points []SearchResult
+		next, err := qdrant.Store.Scroll(ScrollRequest{
+			Filter:      filter,
+			Limit:       pageSize,
+			Offset:      offset,
+			WithPayload: withPayload,
+		}, &points)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, points...)
+		if next == nil || len(points) == 0 || (max > 0 && len(all) >= max) {
+			return all, nil
+		}
+		offset = next
+	}
+}
+
+// countPoints returns the exact number of points matching filter
+func countPoints(filter map[string]interface{}) (int, error) {
+	return qdrant.Store.Count(filter)
+}
+
+// deletePointsByFilter removes every point matching filter
+func deletePointsByFilter(filter map[string]interface{}) error {
+	return qdrant.Store.Delete(filter)
+}
+
+// setPayloadByFilter overwrites the given payload keys on every point matching filter
+func setPayloadByFilter(filter map[string]interface{}, values map[string]interface{}) error {
+	return qdrant.Store.SetPayload(filter, values)
+}
+
+func listDocuments(username string) ([]DocumentInfo, error) {
+	points, err := scrollAllPoints(userDocFilter(username, ""), []string{"doc_name", "page_num", "uploaded_at", "embedder", "metadata"})
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]*DocumentInfo{}
+	pagesByName := map[string]map[int]bool{}
+	for _, p := range points {
+		doc, ok := byName[p.Payload.DocName]
+		if !ok {
+			doc = &DocumentInfo{DocName: p.Payload.DocName}
+			byName[p.Payload.DocName] = doc
+			pagesByName[p.Payload.DocName] = map[int]bool{}
+		}
+		doc.Chunks++
+		if pages := pagesByName[p.Payload.DocName]; !pages[p.Payload.PageNum] {
+			pages[p.Payload.PageNum] = true
+			doc.Pages++
+		}
+		// Most recent upload wins (RFC 3339 strings sort chronologically)
+		if p.Payload.UploadedAt > doc.UploadedAt {
+			doc.UploadedAt = p.Payload.UploadedAt
+			doc.Metadata = p.Payload.Metadata
+		}
+		if doc.Embedder == "" {
+			doc.Embedder = p.Payload.Embedder
+		}
+	}
+
+	documents := make([]DocumentInfo, 0, len(byName))
+	for _, doc := range byName {
+		documents = append(documents, *doc)
+	}
+	sort.Slice(documents, func(i, j int) bool {
+		if documents[i].UploadedAt != documents[j].UploadedAt {
+			return documents[i].UploadedAt > documents[j].UploadedAt
+		}
+		return documents[i].DocName < documents[j].DocName
+	})
+	return documents, nil
+}
+
+func getDocumentPages(username, docName string) ([]StoredPage, error) {
+	points, err := scrollAllPoints(userDocFilter(username, docName),
+		[]string{"page_num", "chunk_index", "chunk_start", "chunk_end", "text"})
+	if err != nil {
+		return nil, err
+	}
+
+	// Same order as joinChunks: the scroll returns points by ID
+	sort.SliceStable(points, func(i, j int) bool { return chunkBefore(points[i].Payload, points[j].Payload) })
+	pages := make([]StoredPage, 0, len(points))
+	for _, p := range points {
+		pages = append(pages, StoredPage{
+			ID: p.ID, PageNum: p.Payload.PageNum, ChunkIndex: p.Payload.ChunkIndex,
+			ChunkStart: p.Payload.ChunkStart, ChunkEnd: p.Payload.ChunkEnd, Text: p.Payload.Text,
+		})
+	}
+	return pages, nil
+}
+
+func userStorageStats(username string) (*UserStorageStats, error) {
+	points, err := scrollAllPoints(userDocFilter(username, ""), []string{"doc_name", "text"})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &UserStorageStats{Username: username, Points: len(points)}
+	documents := map[string]bool{}
+	for _, p := range points {
+		documents[p.Payload.DocName] = true
+		stats.TextChars += utf8.RuneCountInString(p.Payload.Text)
+		stats.TextBytes += len(p.Payload.Text)
+	}
+	stats.Documents = len(documents)
+	stats.VectorBytes = len(points) * qdrant.VectorSize * 4 // float32
+	stats.EstimatedBytes = stats.TextBytes + stats.VectorBytes
+	return stats, nil
+}
+
+// docNameParam reads an URL-encoded document name from the route
+func docNameParam(c *fiber.Ctx) string {
+	raw := c.Params("docName")
+	if name, err := url.PathUnescape(raw); err == nil {
+		return name
+	}
+	return raw
+}
+
+// Handler: list a user's documents
+func handleListDocuments(c *fiber.Ctx) error {
+	username := c.Params("username")
+
+	documents, err := listDocuments(username)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to list documents: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":   true,
+		"username":  username,
+		"total":     len(documents),
+		"documents": documents,
+	})
+}
+
+// Handler: all stored chunks of one document, in page order
+func handleGetDocument(c *fiber.Ctx) error {
+	username := c.Params("username")
+	docName := docNameParam(c)
+
+	pages, err := getDocumentPages(username, docName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get document: " + err.Error(),
+		})
+	}
+	if len(pages) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   fmt.Sprintf("document '%s' not found", docName),
+		})
+	}
+
+	distinct := map[int]bool{}
+	for _, p := range pages {
+		distinct[p.PageNum] = true
+	}
+
+	return c.JSON(fiber.Map{
+		"success":    true,
+		"username":   username,
+		"doc_name":   docName,
+		"num_pages":  len(distinct),
+		"num_chunks": len(pages),
+		"pages":      pages,
+	})
+}
+
+// Handler: delete one document
+func handleDeleteDocument(c *fiber.Ctx) error {
+	username := c.Params("username")
+	docName := docNameParam(c)
+	filter := userDocFilter(username, docName)
+
+	count, err := countPoints(filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to delete document: " + err.Error(),
+		})
+	}
+	if count == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   fmt.Sprintf("document '%s' not found", docName),
+		})
+	}
+
+	if err := deletePointsByFilter(filter); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to delete document: " + err.Error(),
+		})
+	}
+
+	if err := deleteDocumentSummaries(username, docName); err != nil {
+		fmt.Printf("⚠️ Failed to delete the summary of '%s': %v\n", docName, err)
+	}
+	originals.Prune(username)
+
+	fmt.Printf("🗑️ Deleted document '%s' (%d points) for user '%s'\n", docName, count, username)
+	return c.JSON(fiber.Map{
+		"success":       true,
+		"username":      username,
+		"doc_name":      docName,
+		"deleted_count": count,
+	})
+}
+
+// Handler: rename one document
+func handleRenameDocument(c *fiber.Ctx) error {
+	username := c.Params("username")
+	docName := docNameParam(c)
+
+	var req struct {
+		NewName string `json:"new_name"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request format: " + err.Error(),
+		})
+	}
+	req.NewName = strings.TrimSpace(req.NewName)
+	if req.NewName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "new_name is required",
+		})
+	}
+
+	count, err := countPoints(userDocFilter(username, docName))
+	if err == nil && count > 0 && req.NewName != docName {
+		var existing int
+		existing, err = countPoints(userDocFilter(username, req.NewName))
+		if err == nil && existing > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"error":   fmt.Sprintf("document '%s' already exists", req.NewName),
+			})
+		}
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to rename document: " + err.Error(),
+		})
+	}
+	if count == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   fmt.Sprintf("document '%s' not found", docName),
+		})
+	}
+
+	if err := setPayloadByFilter(userDocFilter(username, docName), map[string]interface{}{"doc_name": req.NewName}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to rename document: " + err.Error(),
+		})
+	}
+
+	if req.NewName != docName {
+		if err := renameDocumentSummary(username, docName, req.NewName); err != nil {
+			fmt.Printf("⚠️ Failed to rename the summary of '%s': %v\n", docName, err)
+		}
+	}
+
+	fmt.Printf("✏️ Renamed document '%s' -> '%s' (%d points) for user '%s'\n", docName, req.NewName, count, username)
+	return c.JSON(fiber.Map{
+		"success":       true,
+		"username":      username,
+		"doc_name":      req.NewName,
+		"previous_name": docName,
+		"updated_count": count,
+	})
+}
+
+// Handler: per-user storage stats
+func handleUserStats(c *fiber.Ctx) error {
+	stats, err := userStorageStats(c.Params("username"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get storage stats: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"stats":   stats,
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// useTestVectorStore points the global client at an empty embedded store with the
+// hash embedder, so storage and search run offline
+func useTestVectorStore(t *testing.T) *EmbeddedStore {
+	t.Helper()
+	t.Setenv("VECTOR_STORE", VectorStoreEmbedded)
+	t.Setenv("VECTOR_STORE_PATH", t.TempDir())
+
+	client, err := NewQdrantClientFromEnv(hashEmbedder{dimensions: 64})
+	if err != nil {
+		t.Fatalf("failed to open embedded store: %v", err)
+	}
+	if err := client.EnsureCollection(); err != nil {
+		t.Fatalf("failed to create collection: %v", err)
+	}
+
+	store := client.Store.(*EmbeddedStore)
+	previous := qdrant
+	qdrant = client
+	t.Cleanup(func() {
+		qdrant = previous
+		store.Flush() // before the temporary directory is removed
+	})
+	return store
+}
+
+// storeTestChunks stores texts as one document, chunk i on page pages[i]
+func storeTestChunks(t *testing.T, username, docName string, pages []int, texts []string) {
+	t.Helper()
+	chunks := make([]StoreChunk, len(texts))
+	for i, text := range texts {
+		chunks[i] = StoreChunk{Text: text, PageNum: pages[i]}
+	}
+	if _, err := storePagesInQdrant(username, chunks, docName, "hash-"+docName, "page", nil, nil, nil); err != nil {
+		t.Fatalf("failed to store %s: %v", docName, err)
+	}
+}
+
+func TestListDocumentsCountsPagesAndChunks(t *testing.T) {
+	useTestVectorStore(t)
+
+	storeTestChunks(t, "ana", "notes.pdf", []int{1, 1, 1, 2}, []string{"one", "two", "three", "four"})
+	storeTestChunks(t, "ana", "short.pdf", []int{1}, []string{"single page"})
+	storeTestChunks(t, "bob", "other.pdf", []int{1, 2, 3}, []string{"a", "b", "c"})
+
+	documents, err := listDocuments("ana")
+	if err != nil {
+		t.Fatalf("listDocuments failed: %v", err)
+	}
+
+	tests := []struct {
+		docName string
+		pages   int
+		chunks  int
+	}{
+		{"notes.pdf", 2, 4},
+		{"short.pdf", 1, 1},
+	}
+	if len(documents) != len(tests) {
+		t.Fatalf("got %d documents, want %d: %+v", len(documents), len(tests), documents)
+	}
+	byName := map[string]DocumentInfo{}
+	for _, doc := range documents {
+		byName[doc.DocName] = doc
+	}
+	for _, tt := range tests {
+		doc, ok := byName[tt.docName]
+		if !ok {
+			t.Errorf("document %s not listed", tt.docName)
+			continue
+		}
+		if doc.Pages != tt.pages || doc.Chunks != tt.chunks {
+			t.Errorf("%s: %d pages, %d chunks; want %d pages, %d chunks", tt.docName, doc.Pages, doc.Chunks, tt.pages, tt.chunks)
+		}
+	}
+}
+
+func TestGetDocumentPagesKeepsChunkOrder(t *testing.T) {
+	useTestVectorStore(t)
+
+	// Stored out of reading order; the offsets decide within a page
+	chunks := []StoreChunk{
+		{Text: "third part of page one", PageNum: 1, Start: 40, End: 60},
+		{Text: "only chunk of page two", PageNum: 2, Start: 0, End: 22},
+		{Text: "first part of page one", PageNum: 1, Start: 0, End: 22},
+		{Text: "second part of page one", PageNum: 1, Start: 20, End: 43},
+	}
+	if _, err := storePagesInQdrant("ana", chunks, "offsets.pdf", "hash-offsets", "fixed:8/2", nil, nil, nil); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+	// Without offsets the stored order is kept
+	storeTestChunks(t, "ana", "plain.pdf", []int{1, 1, 1, 1, 2}, []string{"c1", "c2", "c3", "c4", "c5"})
+
+	tests := []struct {
+		docName string
+		want    []string
+	}{
+		{"offsets.pdf", []string{"first part of page one", "second part of page one", "third part of page one", "only chunk of page two"}},
+		{"plain.pdf", []string{"c1", "c2", "c3", "c4", "c5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.docName, func(t *testing.T) {
+			pages, err := getDocumentPages("ana", tt.docName)
+			if err != nil {
+				t.Fatalf("getDocumentPages failed: %v", err)
+			}
+			var texts []string
+			for _, p := range pages {
+				texts = append(texts, p.Text)
+			}
+			if strings.Join(texts, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("chunks in order %q, want %q", texts, tt.want)
+			}
+		})
+	}
+
+	pages, _ := getDocumentPages("ana", "offsets.pdf")
+	if first := pages[0]; first.ChunkIndex != 2 || first.ChunkStart != 0 || first.ChunkEnd != 22 {
+		t.Errorf("first chunk = %+v, want chunk_index 2 at 0-22", first)
+	}
+}
@@ -0,0 +1,942 @@
+package main
+
+/*
+STOCARE VECTORIALĂ ÎN PROCES (VECTOR_STORE=embedded)
+
+Implementarea VectorStore fără Qdrant, pentru rulare locală și teste:
+  - punctele stau în memorie; căutarea este exhaustivă (brute force):
+    cosine pe vectorul dense, produs scalar cu IDF pe vectorul sparse "bm25"
+    (același IDF ca modifier-ul "idf" din Qdrant), fuziune RRF cu k-ul cerut
+    ({"rrf": {"k": ...}}) sau cu k=2, implicitul Qdrant ({"fusion": "rrf"})
+  - filtrele suportă ce folosește aplicația: must/should/must_not imbricate,
+    match value/any/text, range pe numere și date, is_empty, chei cu punct
+    ("metadata.course") și valori listă
+  - fiecare colecție este salvată (gob) în VECTOR_STORE_PATH/<colecție>.snapshot,
+    la cel mult 2 secunde după ultima modificare și la oprirea serverului;
+    scrierea trece printr-un fișier temporar, deci un snapshot nu rămâne
+    niciodată pe jumătate scris
+
+Indexurile de payload nu sunt necesare (CreateIndex nu face nimic).
+*/
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	embeddedSnapshotVersion = 1
+	embeddedFlushDelay      = 2 * time.Second
+	embeddedDefaultScroll   = 10
+	qdrantDefaultRRFK       = 2 // k of {"fusion": "rrf"} and of {"rrf": {}} in Qdrant
+)
+
+// EmbeddedStore is an in-process collection persisted to a snapshot file
+type EmbeddedStore struct {
+	name string
+	path string
+
+	mu         sync.RWMutex
+	vectorSize int
+	hybrid     bool
+	points     map[string]*embeddedPoint
+
+	flushMu    sync.Mutex
+	flushTimer *time.Timer
+}
+
+type embeddedPoint struct {
+	ID      string
+	Dense   []float32 // normalized (Cosine)
+	Sparse  map[uint32]float32
+	Payload map[string]interface{}
+	terms   map[string]bool // tokens of payload "text", for match text
+}
+
+// embeddedSnapshot is the file format (payloads as JSON, vectors as gob)
+type embeddedSnapshot struct {
+	Version    int
+	VectorSize int
+	Hybrid     bool
+	Points     []embeddedSnapshotPoint
+}
+
+type embeddedSnapshotPoint struct {
+	ID            string
+	Dense         []float32
+	SparseIndices []uint32
+	SparseValues  []float32
+	Payload       []byte
+}
+
+var (
+	embeddedStoresMu sync.Mutex
+	embeddedStores   = make(map[string]*EmbeddedStore) // path -> store
+)
+
+// openEmbeddedStore loads (or starts) the collection in dir; one store per file
+func openEmbeddedStore(dir, collection string) (*EmbeddedStore, error) {
+	path := filepath.Join(dir, collection+".snapshot")
+
+	embeddedStoresMu.Lock()
+	defer embeddedStoresMu.Unlock()
+	if store, ok := embeddedStores[path]; ok {
+		return store, nil
+	}
+
+	store := &EmbeddedStore{name: collection, path: path, points: make(map[string]*embeddedPoint)}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	embeddedStores[path] = store
+	return store, nil
+}
+
+// closeEmbeddedStores writes every pending snapshot (server shutdown)
+func closeEmbeddedStores() {
+	embeddedStoresMu.Lock()
+	defer embeddedStoresMu.Unlock()
+	for _, store := range embeddedStores {
+		if err := store.Flush(); err != nil {
+			fmt.Printf("⚠️ %v\n", err)
+		}
+	}
+}
+
+// ensure sets the vector layout of a new collection or checks an existing one
+func (s *EmbeddedStore) ensure(vectorSize int, hybrid bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.vectorSize == 0 {
+		s.vectorSize, s.hybrid = vectorSize, hybrid
+		return nil
+	}
+	if s.vectorSize != vectorSize || s.hybrid != hybrid {
+		return fmt.Errorf("%w: embedded collection '%s' has size %d (hybrid %v), expected %d (hybrid %v)",
+			errQdrantVectorMismatch, s.name, s.vectorSize, s.hybrid, vectorSize, hybrid)
+	}
+	return nil
+}
+
+func (s *EmbeddedStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.points)
+}
+
+func (s *EmbeddedStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot %s: %v", s.path, err)
+	}
+
+	var snapshot embeddedSnapshot
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snapshot); err != nil {
+		return fmt.Errorf("failed to decode snapshot %s: %v", s.path, err)
+	}
+	if snapshot.Version != embeddedSnapshotVersion {
+		return fmt.Errorf("snapshot %s has version %d, expected %d", s.path, snapshot.Version, embeddedSnapshotVersion)
+	}
+
+	s.vectorSize, s.hybrid = snapshot.VectorSize, snapshot.Hybrid
+	for _, sp := range snapshot.Points {
+		point := &embeddedPoint{ID: sp.ID, Dense: sp.Dense}
+		if len(sp.SparseIndices) > 0 {
+			point.Sparse = make(map[uint32]float32, len(sp.SparseIndices))
+			for i, index := range sp.SparseIndices {
+				point.Sparse[index] = sp.SparseValues[i]
+			}
+		}
+		if err := json.Unmarshal(sp.Payload, &point.Payload); err != nil {
+			return fmt.Errorf("snapshot %s: point %s: %v", s.path, sp.ID, err)
+		}
+		point.indexText()
+		s.points[sp.ID] = point
+	}
+	return nil
+}
+
+// Flush writes the snapshot now
+func (s *EmbeddedStore) Flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	if s.flushTimer == nil {
+		return nil // nothing changed since the last write
+	}
+	s.flushTimer.Stop()
+	s.flushTimer = nil
+
+	s.mu.RLock()
+	snapshot := embeddedSnapshot{Version: embeddedSnapshotVersion, VectorSize: s.vectorSize, Hybrid: s.hybrid}
+	for _, point := range s.points {
+		sp := embeddedSnapshotPoint{ID: point.ID, Dense: point.Dense}
+		for index, value := range point.Sparse {
+			sp.SparseIndices = append(sp.SparseIndices, index)
+			sp.SparseValues = append(sp.SparseValues, value)
+		}
+		payload, err := json.Marshal(point.Payload)
+		if err != nil {
+			s.mu.RUnlock()
+			return fmt.Errorf("failed to encode point %s: %v", point.ID, err)
+		}
+		sp.Payload = payload
+		snapshot.Points = append(snapshot.Points, sp)
+	}
+	s.mu.RUnlock()
+
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(snapshot); err != nil {
+		return fmt.Errorf("failed to encode snapshot %s: %v", s.path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(s.path), err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write snapshot %s: %v", s.path, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write snapshot %s: %v", s.path, err)
+	}
+	fmt.Printf("💾 Saved embedded collection '%s' (%d points, %d KB)\n", s.name, len(snapshot.Points), data.Len()/1024)
+	return nil
+}
+
+// changed schedules a snapshot write; writes close together share one flush
+func (s *EmbeddedStore) changed() {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	if s.flushTimer != nil {
+		return
+	}
+	s.flushTimer = time.AfterFunc(embeddedFlushDelay, func() {
+		if err := s.Flush(); err != nil {
+			fmt.Printf("⚠️ %v\n", err)
+		}
+	})
+}
+
+func (p *embeddedPoint) indexText() {
+	p.terms = nil
+	if text, ok := p.Payload["text"].(string); ok {
+		p.terms = make(map[string]bool)
+		for _, token := range tokenizeForBM25(text) {
+			p.terms[token] = true
+		}
+	}
+}
+
+func (s *EmbeddedStore) Upsert(points []QdrantPoint) error {
+	parsed := make([]*embeddedPoint, 0, len(points))
+	named := make([]bool, 0, len(points)) // point has named (hybrid) vectors
+	for _, p := range points {
+		var raw struct {
+			Vector  json.RawMessage        `json:"vector"`
+			Payload map[string]interface{} `json:"payload"`
+		}
+		if err := decodeResult(p, &raw); err != nil {
+			return fmt.Errorf("point %s: %v", p.ID, err)
+		}
+		point := &embeddedPoint{ID: p.ID, Payload: raw.Payload}
+		if point.Payload == nil {
+			point.Payload = make(map[string]interface{})
+		}
+
+		var dense []float32
+		var vectors struct {
+			Dense  []float32     `json:"dense"`
+			Sparse *SparseVector `json:"bm25"`
+		}
+		switch {
+		case json.Unmarshal(raw.Vector, &dense) == nil && dense != nil:
+			named = append(named, false)
+		case json.Unmarshal(raw.Vector, &vectors) == nil && vectors.Dense != nil:
+			named = append(named, true)
+			dense = vectors.Dense
+			if vectors.Sparse != nil {
+				point.Sparse = make(map[uint32]float32, len(vectors.Sparse.Indices))
+				for i, index := range vectors.Sparse.Indices {
+					point.Sparse[index] = vectors.Sparse.Values[i]
+				}
+			}
+		default:
+			return fmt.Errorf("point %s: unsupported vector", p.ID)
+		}
+		point.Dense = dense
+		point.indexText()
+		parsed = append(parsed, point)
+	}
+
+	// The layout is checked under the lock that ensure() takes to set it
+	s.mu.Lock()
+	for i, point := range parsed {
+		switch {
+		case named[i] && !s.hybrid:
+			s.mu.Unlock()
+			return fmt.Errorf("point %s: collection '%s' expects a single vector", point.ID, s.name)
+		case !named[i] && s.hybrid:
+			s.mu.Unlock()
+			return fmt.Errorf("point %s: collection '%s' expects named vectors", point.ID, s.name)
+		case len(point.Dense) != s.vectorSize:
+			s.mu.Unlock()
+			return fmt.Errorf("point %s: vector has %d dimensions, collection '%s' expects %d", point.ID, len(point.Dense), s.name, s.vectorSize)
+		}
+	}
+	for _, point := range parsed {
+		point.Dense = normalizeVector(point.Dense)
+		s.points[point.ID] = point
+	}
+	s.mu.Unlock()
+	s.changed()
+	return nil
+}
+
+func normalizeVector(v []float32) []float32 {
+	norm := 0.0
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	if norm == 0 {
+		return out
+	}
+	norm = math.Sqrt(norm)
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
+
+// scoredPoint is a match of a search, before the payload is selected
+type scoredPoint struct {
+	point *embeddedPoint
+	score float32
+}
+
+func (s *EmbeddedStore) Search(req SearchRequest, out interface{}) error {
+	filter, err := newEmbeddedFilter(req.Filter)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.hybrid {
+		return fmt.Errorf("collection '%s' has named vectors, use the Query API", s.name)
+	}
+	hits, err := s.denseSearch(req.Vector, filter, req.Limit)
+	if err != nil {
+		return err
+	}
+	return decodeResult(selectPayloads(hits, req.WithPayload), out)
+}
+
+func (s *EmbeddedStore) denseSearch(vector []float32, filter embeddedFilter, limit int) ([]scoredPoint, error) {
+	if len(vector) != s.vectorSize {
+		return nil, fmt.Errorf("query vector has %d dimensions, collection '%s' expects %d", len(vector), s.name, s.vectorSize)
+	}
+	query := normalizeVector(vector)
+
+	var hits []scoredPoint
+	for _, point := range s.points {
+		if len(point.Dense) != len(query) || !filter.matches(point) {
+			continue
+		}
+		score := 0.0
+		for i, x := range query {
+			score += float64(x) * float64(point.Dense[i])
+		}
+		hits = append(hits, scoredPoint{point, float32(score)})
+	}
+	return topHits(hits, limit), nil
+}
+
+// sparseSearch scores with IDF over the whole collection, like Qdrant's "idf" modifier
+func (s *EmbeddedStore) sparseSearch(vector SparseVector, filter embeddedFilter, limit int) []scoredPoint {
+	n := 0
+	docFreq := make(map[uint32]int, len(vector.Indices))
+	for _, point := range s.points {
+		if point.Sparse == nil {
+			continue
+		}
+		n++
+		for _, index := range vector.Indices {
+			if _, ok := point.Sparse[index]; ok {
+				docFreq[index]++
+			}
+		}
+	}
+
+	var hits []scoredPoint
+	for _, point := range s.points {
+		if point.Sparse == nil || !filter.matches(point) {
+			continue
+		}
+		score, overlap := 0.0, false
+		for i, index := range vector.Indices {
+			value, ok := point.Sparse[index]
+			if !ok {
+				continue
+			}
+			overlap = true
+			df := float64(docFreq[index])
+			idf := math.Log(1 + (float64(n)-df+0.5)/(df+0.5))
+			score += idf * float64(vector.Values[i]) * float64(value)
+		}
+		if overlap {
+			hits = append(hits, scoredPoint{point, float32(score)})
+		}
+	}
+	return topHits(hits, limit)
+}
+
+// topHits sorts by score (ties by id, so results are stable) and keeps limit
+func topHits(hits []scoredPoint, limit int) []scoredPoint {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].point.ID < hits[j].point.ID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+func (s *EmbeddedStore) Query(req QueryRequest, out interface{}) error {
+	filter, err := newEmbeddedFilter(req.Filter)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var hits []scoredPoint
+	if len(req.Prefetch) == 0 {
+		if hits, err = s.queryOne(req.Query, req.Using, filter, req.Limit); err != nil {
+			return err
+		}
+	} else {
+		k, err := rrfQueryK(req.Query)
+		if err != nil {
+			return err
+		}
+
+		// Reciprocal Rank Fusion of the prefetch lists, restricted by the outer filter
+		scores := make(map[string]float64)
+		points := make(map[string]*embeddedPoint)
+		for _, prefetch := range req.Prefetch {
+			prefetchFilter, err := newEmbeddedFilter(prefetch.Filter)
+			if err != nil {
+				return err
+			}
+			list, err := s.queryOne(prefetch.Query, prefetch.Using, prefetchFilter, prefetch.Limit)
+			if err != nil {
+				return err
+			}
+			for rank, hit := range list {
+				if !filter.matches(hit.point) {
+					continue
+				}
+				scores[hit.point.ID] += 1 / float64(k+rank+1)
+				points[hit.point.ID] = hit.point
+			}
+		}
+		for id, score := range scores {
+			hits = append(hits, scoredPoint{points[id], float32(score)})
+		}
+		hits = topHits(hits, req.Limit)
+	}
+
+	result := selectPayloads(hits, req.WithPayload)
+	return decodeResult(result, out)
+}
+
+// rrfQueryK returns the k of a fusion query: {"rrf": {"k": N}}, or Qdrant's
+// default for {"rrf": {}} and {"fusion": "rrf"}
+func rrfQueryK(query interface{}) (int, error) {
+	var fusion struct {
+		Fusion string `json:"fusion"`
+		RRF    *struct {
+			K *int `json:"k"`
+		} `json:"rrf"`
+	}
+	if err := decodeResult(query, &fusion); err == nil {
+		switch {
+		case fusion.RRF != nil && fusion.RRF.K == nil:
+			return qdrantDefaultRRFK, nil
+		case fusion.RRF != nil && *fusion.RRF.K > 0:
+			return *fusion.RRF.K, nil
+		case fusion.RRF == nil && fusion.Fusion == "rrf":
+			return qdrantDefaultRRFK, nil
+		}
+	}
+	return 0, fmt.Errorf("embedded store: prefetch needs {\"rrf\": {\"k\": N}} or {\"fusion\": \"rrf\"}")
+}
+
+// queryOne runs a dense (vector array) or sparse (indices/values) query
+func (s *EmbeddedStore) queryOne(query interface{}, using string, filter embeddedFilter, limit int) ([]scoredPoint, error) {
+	var raw json.RawMessage
+	if err := decodeResult(query, &raw); err != nil {
+		return nil, err
+	}
+
+	var dense []float32
+	if json.Unmarshal(raw, &dense) == nil && dense != nil {
+		if s.hybrid && using != denseVectorName {
+			return nil, fmt.Errorf("collection '%s' has no vector %q", s.name, using)
+		}
+		return s.denseSearch(dense, filter, limit)
+	}
+	var sparse SparseVector
+	if json.Unmarshal(raw, &sparse) == nil && sparse.Indices != nil {
+		if using != sparseVectorName || !s.hybrid {
+			return nil, fmt.Errorf("collection '%s' has no sparse vector %q", s.name, using)
+		}
+		return s.sparseSearch(sparse, filter, limit), nil
+	}
+	return nil, fmt.Errorf("embedded store: unsupported query %s", string(raw))
+}
+
+// sortedIDs returns the ids of the points matching filter, in Qdrant's scroll order
+func (s *EmbeddedStore) sortedIDs(filter embeddedFilter) []string {
+	var ids []string
+	for id, point := range s.points {
+		if filter.matches(point) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *EmbeddedStore) Scroll(req ScrollRequest, out interface{}) (interface{}, error) {
+	filter, err := newEmbeddedFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = embeddedDefaultScroll
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := s.sortedIDs(filter)
+	start := 0
+	if offset, ok := req.Offset.(string); ok {
+		start = sort.SearchStrings(ids, offset)
+	}
+
+	var page []scoredPoint
+	var next interface{}
+	for i := start; i < len(ids); i++ {
+		if len(page) == limit {
+			next = ids[i]
+			break
+		}
+		page = append(page, scoredPoint{point: s.points[ids[i]]})
+	}
+
+	points := selectPayloads(page, req.WithPayload)
+	if req.WithVector {
+		for i, hit := range page {
+			points[i]["vector"] = hit.point.vector(s.hybrid)
+		}
+	}
+	return next, decodeResult(points, out)
+}
+
+func (p *embeddedPoint) vector(hybrid bool) interface{} {
+	if !hybrid {
+		return p.Dense
+	}
+	sparse := SparseVector{Indices: []uint32{}, Values: []float32{}}
+	weights := make(map[uint32]float64, len(p.Sparse))
+	for index, value := range p.Sparse {
+		weights[index] = float64(value)
+	}
+	if len(weights) > 0 {
+		sparse = newSparseVector(weights)
+	}
+	return map[string]interface{}{denseVectorName: p.Dense, sparseVectorName: sparse}
+}
+
+func (s *EmbeddedStore) Count(filter map[string]interface{}) (int, error) {
+	f, err := newEmbeddedFilter(filter)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	count := 0
+	for _, point := range s.points {
+		if f.matches(point) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *EmbeddedStore) Delete(filter map[string]interface{}) error {
+	f, err := newEmbeddedFilter(filter)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	deleted := 0
+	for id, point := range s.points {
+		if f.matches(point) {
+			delete(s.points, id)
+			deleted++
+		}
+	}
+	s.mu.Unlock()
+	if deleted > 0 {
+		s.changed()
+	}
+	return nil
+}
+
+func (s *EmbeddedStore) SetPayload(filter map[string]interface{}, values map[string]interface{}) error {
+	f, err := newEmbeddedFilter(filter)
+	if err != nil {
+		return err
+	}
+	var generic map[string]interface{}
+	if err := decodeResult(values, &generic); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	updated := 0
+	for _, point := range s.points {
+		if !f.matches(point) {
+			continue
+		}
+		// Copy on write: payloads may be shared with results being encoded
+		payload := make(map[string]interface{}, len(point.Payload)+len(generic))
+		for key, value := range point.Payload {
+			payload[key] = value
+		}
+		for key, value := range generic {
+			payload[key] = value
+		}
+		point.Payload = payload
+		if _, ok := generic["text"]; ok {
+			point.indexText()
+		}
+		updated++
+	}
+	s.mu.Unlock()
+	if updated > 0 {
+		s.changed()
+	}
+	return nil
+}
+
+func (s *EmbeddedStore) Get(id string, out interface{}) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	point, ok := s.points[id]
+	if !ok {
+		return false, nil
+	}
+	return true, decodeResult(map[string]interface{}{"id": point.ID, "payload": point.Payload}, out)
+}
+
+// CreateIndex is not needed: every search scans the collection
+func (s *EmbeddedStore) CreateIndex(field string, schema interface{}) error {
+	return nil
+}
+
+// selectPayloads builds Qdrant-like results: with_payload true/false, a list of
+// keys, or {"include": [...]} / {"exclude": [...]}
+func selectPayloads(hits []scoredPoint, withPayload interface{}) []map[string]interface{} {
+	var selector interface{}
+	decodeResult(withPayload, &selector)
+	include, exclude := map[string]bool(nil), map[string]bool(nil)
+	all := false
+	switch w := selector.(type) {
+	case bool:
+		all = w
+	case []interface{}:
+		include = stringSet(w)
+	case map[string]interface{}:
+		if keys, ok := w["include"].([]interface{}); ok {
+			include = stringSet(keys)
+		} else if keys, ok := w["exclude"].([]interface{}); ok {
+			exclude = stringSet(keys)
+			all = true
+		}
+	}
+
+	results := make([]map[string]interface{}, 0, len(hits))
+	for _, hit := range hits {
+		payload := make(map[string]interface{})
+		for key, value := range hit.point.Payload {
+			if (all && !exclude[key]) || include[key] {
+				payload[key] = value
+			}
+		}
+		results = append(results, map[string]interface{}{
+			"id":      hit.point.ID,
+			"score":   hit.score,
+			"payload": payload,
+		})
+	}
+	return results
+}
+
+func stringSet(keys []interface{}) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if s, ok := key.(string); ok {
+			set[s] = true
+		}
+	}
+	return set
+}
+
+// embeddedFilter is a Qdrant filter decoded to generic JSON values
+type embeddedFilter struct {
+	must, should, mustNot []map[string]interface{}
+}
+
+func newEmbeddedFilter(filter interface{}) (embeddedFilter, error) {
+	var f embeddedFilter
+	if filter == nil {
+		return f, nil
+	}
+	var generic map[string]interface{}
+	if err := decodeResult(filter, &generic); err != nil {
+		return f, fmt.Errorf("invalid filter: %v", err)
+	}
+	return parseEmbeddedFilter(generic)
+}
+
+func parseEmbeddedFilter(generic map[string]interface{}) (embeddedFilter, error) {
+	var f embeddedFilter
+	for clause, target := range map[string]*[]map[string]interface{}{
+		"must": &f.must, "should": &f.should, "must_not": &f.mustNot,
+	} {
+		raw, ok := generic[clause]
+		if !ok || raw == nil {
+			continue
+		}
+		list, ok := raw.([]interface{})
+		if !ok {
+			if single, isMap := raw.(map[string]interface{}); isMap {
+				list = []interface{}{single}
+			} else {
+				return f, fmt.Errorf("invalid filter: %s must be a list", clause)
+			}
+		}
+		for _, item := range list {
+			condition, ok := item.(map[string]interface{})
+			if !ok {
+				return f, fmt.Errorf("invalid filter condition in %s", clause)
+			}
+			*target = append(*target, condition)
+		}
+	}
+	return f, nil
+}
+
+func (f embeddedFilter) matches(point *embeddedPoint) bool {
+	for _, c := range f.must {
+		if !conditionMatches(c, point) {
+			return false
+		}
+	}
+	for _, c := range f.mustNot {
+		if conditionMatches(c, point) {
+			return false
+		}
+	}
+	if len(f.should) == 0 {
+		return true
+	}
+	for _, c := range f.should {
+		if conditionMatches(c, point) {
+			return true
+		}
+	}
+	return false
+}
+
+func conditionMatches(c map[string]interface{}, point *embeddedPoint) bool {
+	payload, terms := point.Payload, point.terms
+
+	if ids, ok := c["has_id"].([]interface{}); ok {
+		for _, id := range ids {
+			if fmt.Sprint(id) == point.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	if empty, ok := c["is_empty"].(map[string]interface{}); ok {
+		key, _ := empty["key"].(string)
+		values := payloadValues(payload, key)
+		return len(values) == 0
+	}
+
+	key, ok := c["key"].(string)
+	if !ok {
+		// Nested filter
+		nested, err := parseEmbeddedFilter(c)
+		return err == nil && nested.matches(point)
+	}
+	values := payloadValues(payload, key)
+
+	if match, ok := c["match"].(map[string]interface{}); ok {
+		if text, ok := match["text"].(string); ok {
+			return textMatches(key, text, payload, terms)
+		}
+		var accepted []interface{}
+		if value, ok := match["value"]; ok {
+			accepted = []interface{}{value}
+		} else if any, ok := match["any"].([]interface{}); ok {
+			accepted = any
+		}
+		for _, value := range values {
+			for _, want := range accepted {
+				if value == want {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if bounds, ok := c["range"].(map[string]interface{}); ok {
+		for _, value := range values {
+			if inRange(value, bounds) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// payloadValues resolves a dotted key; lists are flattened, nulls dropped
+func payloadValues(payload map[string]interface{}, key string) []interface{} {
+	var current interface{} = payload
+	for _, part := range strings.Split(key, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[part]
+	}
+	switch v := current.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
+
+// textMatches is the full-text condition: every token of text is in the field
+func textMatches(key, text string, payload map[string]interface{}, terms map[string]bool) bool {
+	if key != "text" || terms == nil {
+		terms = make(map[string]bool)
+		for _, value := range payloadValues(payload, key) {
+			if s, ok := value.(string); ok {
+				for _, token := range tokenizeForBM25(s) {
+					terms[token] = true
+				}
+			}
+		}
+	}
+	tokens := tokenizeForBM25(text)
+	if len(tokens) == 0 {
+		return false
+	}
+	for _, token := range tokens {
+		if !terms[token] {
+			return false
+		}
+	}
+	return true
+}
+
+// inRange compares numbers, or dates (RFC 3339 / YYYY-MM-DD) for datetime ranges
+func inRange(value interface{}, bounds map[string]interface{}) bool {
+	compare := func(bound interface{}) (int, bool) {
+		if a, ok := value.(float64); ok {
+			if b, ok := bound.(float64); ok {
+				switch {
+				case a < b:
+					return -1, true
+				case a > b:
+					return 1, true
+				}
+				return 0, true
+			}
+			return 0, false
+		}
+		a, okA := parseRangeTime(value)
+		b, okB := parseRangeTime(bound)
+		if !okA || !okB {
+			return 0, false
+		}
+		return a.Compare(b), true
+	}
+
+	for op, bound := range bounds {
+		if bound == nil {
+			continue
+		}
+		cmp, ok := compare(bound)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "gt":
+			ok = cmp > 0
+		case "gte":
+			ok = cmp >= 0
+		case "lt":
+			ok = cmp < 0
+		case "lte":
+			ok = cmp <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func parseRangeTime(value interface{}) (time.Time, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC3339Nano, metadataDateOnlyLayout} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
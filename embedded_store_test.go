@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// embeddedTestPoint builds a point from a JSON payload
+func embeddedTestPoint(t *testing.T, id, payload string) *embeddedPoint {
+	t.Helper()
+	point := &embeddedPoint{ID: id}
+	if err := json.Unmarshal([]byte(payload), &point.Payload); err != nil {
+		t.Fatalf("bad payload %s: %v", payload, err)
+	}
+	point.indexText()
+	return point
+}
+
+func TestEmbeddedFilterMatches(t *testing.T) {
+	point := embeddedTestPoint(t, "p1", `{
+		"username": "ana", "doc_name": "notes.pdf", "page_num": 3,
+		"text": "The Ocean covers the planet",
+		"uploaded_at": "2024-05-01T10:00:00Z",
+		"metadata": {"course": "Fizica 1", "tags": ["exam", "waves"], "year": 2024},
+		"parent_text": "", "sections": []
+	}`)
+
+	tests := []struct {
+		name   string
+		filter string
+		want   bool
+	}{
+		{"no filter", `null`, true},
+		{"match value", `{"must": [{"key": "username", "match": {"value": "ana"}}]}`, true},
+		{"match other value", `{"must": [{"key": "username", "match": {"value": "bob"}}]}`, false},
+		{"match any", `{"must": [{"key": "doc_name", "match": {"any": ["a.pdf", "notes.pdf"]}}]}`, true},
+		{"match number", `{"must": [{"key": "page_num", "match": {"value": 3}}]}`, true},
+		{"dotted key", `{"must": [{"key": "metadata.course", "match": {"value": "Fizica 1"}}]}`, true},
+		{"list value", `{"must": [{"key": "metadata.tags", "match": {"value": "waves"}}]}`, true},
+		{"text, all tokens", `{"must": [{"key": "text", "match": {"text": "ocean PLANET"}}]}`, true},
+		{"text, missing token", `{"must": [{"key": "text", "match": {"text": "ocean moon"}}]}`, false},
+		{"range", `{"must": [{"key": "page_num", "range": {"gte": 2, "lt": 4}}]}`, true},
+		{"range excluded", `{"must": [{"key": "page_num", "range": {"gt": 3}}]}`, false},
+		{"date range", `{"must": [{"key": "uploaded_at", "range": {"gte": "2024-01-01", "lt": "2024-06-01T00:00:00Z"}}]}`, true},
+		{"date range excluded", `{"must": [{"key": "uploaded_at", "range": {"gt": "2024-05-01T10:00:00Z"}}]}`, false},
+		{"is_empty on empty list", `{"must": [{"is_empty": {"key": "sections"}}]}`, true},
+		{"an empty string is a value", `{"must": [{"is_empty": {"key": "parent_text"}}]}`, false},
+		{"is_empty on missing key", `{"must": [{"is_empty": {"key": "doc_id"}}]}`, true},
+		{"is_empty on value", `{"must": [{"is_empty": {"key": "doc_name"}}]}`, false},
+		{"has_id", `{"must": [{"has_id": ["p0", "p1"]}]}`, true},
+		{"must_not has_id", `{"must_not": [{"has_id": ["p1"]}]}`, false},
+		{"should, one matches", `{"should": [{"key": "username", "match": {"value": "bob"}}, {"key": "page_num", "match": {"value": 3}}]}`, true},
+		{"should, none matches", `{"should": [{"key": "username", "match": {"value": "bob"}}]}`, false},
+		{"nested filter", `{"must": [{"should": [
+			{"key": "doc_name", "match": {"any": ["other.pdf"]}},
+			{"must_not": [{"key": "doc_name", "match": {"any": ["other.pdf"]}}]}
+		]}]}`, true},
+		{"single condition instead of a list", `{"must": {"key": "username", "match": {"value": "ana"}}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw interface{}
+			if err := json.Unmarshal([]byte(tt.filter), &raw); err != nil {
+				t.Fatalf("bad filter: %v", err)
+			}
+			filter, err := newEmbeddedFilter(raw)
+			if err != nil {
+				t.Fatalf("newEmbeddedFilter failed: %v", err)
+			}
+			if got := filter.matches(point); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedFilterRejectsInvalidFilters(t *testing.T) {
+	for _, filter := range []string{`{"must": "username"}`, `{"should": [1, 2]}`, `"filter"`} {
+		var raw interface{}
+		if err := json.Unmarshal([]byte(filter), &raw); err != nil {
+			t.Fatalf("bad filter: %v", err)
+		}
+		if _, err := newEmbeddedFilter(raw); err == nil {
+			t.Errorf("newEmbeddedFilter(%s) accepted an invalid filter", filter)
+		}
+	}
+}
+
+func TestRRFQueryK(t *testing.T) {
+	tests := []struct {
+		query   interface{}
+		want    int
+		wantErr bool
+	}{
+		{map[string]interface{}{"rrf": map[string]int{"k": 60}}, 60, false},
+		{map[string]interface{}{"rrf": map[string]int{}}, qdrantDefaultRRFK, false},
+		{map[string]string{"fusion": "rrf"}, qdrantDefaultRRFK, false},
+		{map[string]string{"fusion": "dbsf"}, 0, true},
+		{[]float32{0.1, 0.2}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.query), func(t *testing.T) {
+			got, err := rrfQueryK(tt.query)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("rrfQueryK = %d, %v; want %d, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newTestEmbeddedStore is an empty hybrid store of 4 dimensions, outside the store cache
+func newTestEmbeddedStore(t *testing.T, dir string) *EmbeddedStore {
+	t.Helper()
+	store := &EmbeddedStore{name: "test", path: filepath.Join(dir, "test.snapshot"), points: make(map[string]*embeddedPoint)}
+	if err := store.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := store.ensure(4, true); err != nil {
+		t.Fatalf("ensure failed: %v", err)
+	}
+	t.Cleanup(func() { store.Flush() })
+	return store
+}
+
+func embeddedTestPoints(count int) []QdrantPoint {
+	points := make([]QdrantPoint, count)
+	for i := range points {
+		points[i] = QdrantPoint{
+			ID: fmt.Sprintf("00000000-0000-0000-0000-%012d", i),
+			Vector: map[string]interface{}{
+				denseVectorName:  []float32{float32(i + 1), 1, 0, 0},
+				sparseVectorName: SparseVector{Indices: []uint32{uint32(i), 1000}, Values: []float32{1, 0.5}},
+			},
+			Payload: QdrantPage{Username: "ana", DocName: "notes.pdf", PageNum: i%3 + 1, Text: fmt.Sprintf("chunk number %d", i)},
+		}
+	}
+	return points
+}
+
+func TestEmbeddedScrollPaging(t *testing.T) {
+	store := newTestEmbeddedStore(t, t.TempDir())
+	if err := store.Upsert(embeddedTestPoints(25)); err != nil {
+		t.Fatalf("upsert failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		filter    map[string]interface{}
+		limit     int
+		wantPages []int
+	}{
+		{"all points", nil, 10, []int{10, 10, 5}},
+		{"exact multiple", nil, 5, []int{5, 5, 5, 5, 5}},
+		{"default limit", nil, 0, []int{10, 10, 5}},
+		{"filtered", map[string]interface{}{"must": []map[string]interface{}{{"key": "page_num", "match": map[string]int{"value": 1}}}}, 4, []int{4, 4, 1}},
+		{"nothing matches", map[string]interface{}{"must": []map[string]interface{}{{"key": "page_num", "match": map[string]int{"value": 9}}}}, 4, []int{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pages []int
+			var ids []string
+			var offset interface{}
+			for {
+				var points []SearchResult
+				next, err := store.Scroll(ScrollRequest{Filter: tt.filter, Limit: tt.limit, Offset: offset, WithPayload: true}, &points)
+				if err != nil {
+					t.Fatalf("scroll failed: %v", err)
+				}
+				pages = append(pages, len(points))
+				for _, point := range points {
+					ids = append(ids, point.ID)
+				}
+				if next == nil {
+					break
+				}
+				offset = next
+			}
+			if !reflect.DeepEqual(pages, tt.wantPages) {
+				t.Errorf("page sizes = %v, want %v", pages, tt.wantPages)
+			}
+			for i := 1; i < len(ids); i++ {
+				if ids[i] <= ids[i-1] {
+					t.Fatalf("ids are not in order or repeat: %v", ids)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddedSnapshotRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestEmbeddedStore(t, dir)
+	if err := store.Upsert(embeddedTestPoints(7)); err != nil {
+		t.Fatalf("upsert failed: %v", err)
+	}
+	if err := store.Delete(map[string]interface{}{"must": []map[string]interface{}{{"key": "page_num", "match": map[string]int{"value": 2}}}}); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+
+	reloaded := newTestEmbeddedStore(t, dir)
+	if reloaded.vectorSize != 4 || !reloaded.hybrid {
+		t.Fatalf("reloaded layout: size %d, hybrid %v", reloaded.vectorSize, reloaded.hybrid)
+	}
+	if reloaded.Len() != store.Len() {
+		t.Fatalf("reloaded %d points, want %d", reloaded.Len(), store.Len())
+	}
+	for id, want := range store.points {
+		got, ok := reloaded.points[id]
+		if !ok {
+			t.Errorf("point %s lost", id)
+			continue
+		}
+		if !reflect.DeepEqual(got.Dense, want.Dense) || !reflect.DeepEqual(got.Sparse, want.Sparse) ||
+			!reflect.DeepEqual(got.Payload, want.Payload) || !reflect.DeepEqual(got.terms, want.terms) {
+			t.Errorf("point %s changed: %+v, want %+v", id, got, want)
+		}
+	}
+
+	// Searches see the same ranking after the reload
+	query := QueryRequest{
+		Prefetch: []QueryPrefetch{
+			{Query: []float32{1, 1, 0, 0}, Using: denseVectorName, Limit: 10},
+			{Query: SparseVector{Indices: []uint32{3, 1000}, Values: []float32{1, 1}}, Using: sparseVectorName, Limit: 10},
+		},
+		Query: map[string]interface{}{"rrf": map[string]int{"k": 60}},
+		Limit: 5,
+	}
+	var before, after []SearchResult
+	if err := store.Query(query, &before); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if err := reloaded.Query(query, &after); err != nil {
+		t.Fatalf("query after reload failed: %v", err)
+	}
+	if !reflect.DeepEqual(resultIDs(before), resultIDs(after)) {
+		t.Errorf("ranking after reload = %v, want %v", resultIDs(after), resultIDs(before))
+	}
+}
+
+func TestEmbeddedUpsertChecksTheLayout(t *testing.T) {
+	store := newTestEmbeddedStore(t, t.TempDir())
+
+	tests := []struct {
+		name   string
+		vector interface{}
+	}{
+		{"single vector in a hybrid collection", []float32{1, 0, 0, 0}},
+		{"wrong size", map[string]interface{}{denseVectorName: []float32{1, 0}}},
+		{"no vector", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.Upsert([]QdrantPoint{{ID: "x", Vector: tt.vector}}); err == nil {
+				t.Errorf("upsert accepted %v", tt.vector)
+			}
+		})
+	}
+	if store.Len() != 0 {
+		t.Errorf("rejected points were stored: %d", store.Len())
+	}
+
+	// Concurrent upserts and searches (run with -race)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Upsert(embeddedTestPoints(10))
+			var results []SearchResult
+			store.Query(QueryRequest{Query: []float32{1, 0, 0, 0}, Using: denseVectorName, Limit: 3}, &results)
+		}()
+	}
+	wg.Wait()
+}
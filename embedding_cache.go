@@ -0,0 +1,386 @@
+package main
+
+/*
+CACHE EMBEDDINGS (bbolt pe disc)
+
+  - EMBEDDING_CACHE_PATH         fișierul cache (implicit embedding_cache.db, "off" = dezactivat)
+  - EMBEDDING_CACHE_MAX_ENTRIES  numărul maxim de vectori (implicit 100000, LRU)
+
+Cheia este SHA-256(nume embedder + text), deci același text cu alt model nu
+produce un hit. Citirile folosesc tranzacții View (fără fsync); actualizarea
+ordinii LRU pentru hit-uri se adună în memorie și se scrie în lot, periodic.
+Doar textele lipsă ajung la provider, așa că reîncărcarea aceluiași document
+sau repetarea unei căutări nu mai costă nimic.
+Metricile (hit/miss/evictions) apar în /health.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultEmbeddingCachePath       = "embedding_cache.db"
+	defaultEmbeddingCacheMaxEntries = 100000
+	embeddingCacheTouchInterval     = 2 * time.Second
+	embeddingCacheMaxPendingTouches = 10000
+)
+
+var (
+	cacheVectorsBucket = []byte("vectors") // key -> float32 little endian
+	cacheAccessBucket  = []byte("access")  // key -> last access sequence
+	cacheLRUBucket     = []byte("lru")     // sequence + key -> nil, oldest first
+)
+
+// EmbeddingCacheStats - metrici pentru /health
+type EmbeddingCacheStats struct {
+	Path       string  `json:"path"`
+	Entries    int     `json:"entries"`
+	MaxEntries int     `json:"max_entries"`
+	Hits       uint64  `json:"hits"`
+	Misses     uint64  `json:"misses"`
+	Evictions  uint64  `json:"evictions"`
+	HitRate    float64 `json:"hit_rate"`
+}
+
+// EmbeddingCache stores vectors on local disk with LRU eviction
+type EmbeddingCache struct {
+	db         *bolt.DB
+	path       string
+	maxEntries int
+
+	mu      sync.Mutex // serializes writes that change the entry count
+	entries int
+
+	// LRU touches of cache hits, written in batches by touchLoop
+	touchMu   sync.Mutex
+	pending   map[string]struct{}
+	flushNow  chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+var embeddingCache *EmbeddingCache
+
+func newEmbeddingCacheFromEnv() (*EmbeddingCache, error) {
+	path := os.Getenv("EMBEDDING_CACHE_PATH")
+	if path == "" {
+		path = defaultEmbeddingCachePath
+	}
+	if strings.EqualFold(path, "off") {
+		return nil, nil
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedding cache %s: %v", path, err)
+	}
+
+	cache := &EmbeddingCache{
+		db:         db,
+		path:       path,
+		maxEntries: envInt("EMBEDDING_CACHE_MAX_ENTRIES", defaultEmbeddingCacheMaxEntries),
+		pending:    make(map[string]struct{}),
+		flushNow:   make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{cacheVectorsBucket, cacheAccessBucket, cacheLRUBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		cache.entries = tx.Bucket(cacheVectorsBucket).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize embedding cache: %v", err)
+	}
+
+	go cache.touchLoop()
+
+	fmt.Printf("🗄️ Embedding cache %s (%d entries, max %d)\n", path, cache.entries, cache.maxEntries)
+	return cache, nil
+}
+
+func embeddingCacheKey(model, text string) []byte {
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+	return sum[:]
+}
+
+// Get returns the cached vectors (nil where missing). Hits are marked as recently
+// used asynchronously, so lookups never wait for a disk sync.
+func (c *EmbeddingCache) Get(model string, texts []string) [][]float32 {
+	vectors := make([][]float32, len(texts))
+	var hitKeys [][]byte
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+		stored := tx.Bucket(cacheVectorsBucket)
+		for i, text := range texts {
+			key := embeddingCacheKey(model, text)
+			if raw := stored.Get(key); raw != nil {
+				vectors[i] = decodeVector(raw) // copies, raw is only valid inside the transaction
+				hitKeys = append(hitKeys, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("⚠️ Embedding cache read failed: %v\n", err)
+		return make([][]float32, len(texts))
+	}
+
+	if len(hitKeys) > 0 {
+		c.touchMu.Lock()
+		for _, key := range hitKeys {
+			c.pending[string(key)] = struct{}{}
+		}
+		full := len(c.pending) >= embeddingCacheMaxPendingTouches
+		c.touchMu.Unlock()
+		if full {
+			select {
+			case c.flushNow <- struct{}{}:
+			default:
+			}
+		}
+	}
+
+	for _, v := range vectors {
+		if v != nil {
+			c.hits.Add(1)
+		} else {
+			c.misses.Add(1)
+		}
+	}
+	return vectors
+}
+
+// Put stores vectors and evicts the least recently used entries above the cap
+func (c *EmbeddingCache) Put(model string, texts []string, vectors [][]float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		stored := tx.Bucket(cacheVectorsBucket)
+		for i, text := range texts {
+			key := embeddingCacheKey(model, text)
+			if stored.Get(key) == nil {
+				c.entries++
+			}
+			if err := stored.Put(key, encodeVector(vectors[i])); err != nil {
+				return err
+			}
+			if err := c.touch(tx, key); err != nil {
+				return err
+			}
+		}
+		return c.evict(tx)
+	})
+	if err != nil {
+		fmt.Printf("⚠️ Embedding cache write failed: %v\n", err)
+	}
+}
+
+// touchLoop writes the pending LRU touches every few seconds, or sooner when many
+// are waiting, until Close
+func (c *EmbeddingCache) touchLoop() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(embeddingCacheTouchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.flushNow:
+		case <-c.stop:
+			c.flushTouches()
+			return
+		}
+		c.flushTouches()
+	}
+}
+
+// flushTouches moves the keys hit since the last flush to the recent end of the LRU
+// index, in one transaction. Keys evicted in the meantime are skipped.
+func (c *EmbeddingCache) flushTouches() {
+	c.touchMu.Lock()
+	if len(c.pending) == 0 {
+		c.touchMu.Unlock()
+		return
+	}
+	keys := c.pending
+	c.pending = make(map[string]struct{})
+	c.touchMu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		stored := tx.Bucket(cacheVectorsBucket)
+		for key := range keys {
+			if stored.Get([]byte(key)) == nil {
+				continue
+			}
+			if err := c.touch(tx, []byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("⚠️ Embedding cache LRU update failed: %v\n", err)
+	}
+}
+
+// touch moves key to the most recently used end of the LRU index
+func (c *EmbeddingCache) touch(tx *bolt.Tx, key []byte) error {
+	access := tx.Bucket(cacheAccessBucket)
+	lru := tx.Bucket(cacheLRUBucket)
+
+	if old := access.Get(key); old != nil {
+		if err := lru.Delete(append(append([]byte{}, old...), key...)); err != nil {
+			return err
+		}
+	}
+
+	seq, err := lru.NextSequence()
+	if err != nil {
+		return err
+	}
+	seqBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(seqBytes, seq)
+
+	if err := access.Put(key, seqBytes); err != nil {
+		return err
+	}
+	return lru.Put(append(seqBytes, key...), nil)
+}
+
+func (c *EmbeddingCache) evict(tx *bolt.Tx) error {
+	if c.maxEntries <= 0 {
+		return nil
+	}
+
+	stored := tx.Bucket(cacheVectorsBucket)
+	access := tx.Bucket(cacheAccessBucket)
+	cursor := tx.Bucket(cacheLRUBucket).Cursor()
+
+	for c.entries > c.maxEntries {
+		lruKey, _ := cursor.First()
+		if lruKey == nil {
+			break
+		}
+		key := append([]byte{}, lruKey[8:]...)
+		if err := cursor.Delete(); err != nil {
+			return err
+		}
+		if err := stored.Delete(key); err != nil {
+			return err
+		}
+		if err := access.Delete(key); err != nil {
+			return err
+		}
+		c.entries--
+		c.evictions.Add(1)
+	}
+	return nil
+}
+
+func (c *EmbeddingCache) Stats() EmbeddingCacheStats {
+	c.mu.Lock()
+	entries := c.entries
+	c.mu.Unlock()
+
+	stats := EmbeddingCacheStats{
+		Path:       c.path,
+		Entries:    entries,
+		MaxEntries: c.maxEntries,
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		Evictions:  c.evictions.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = math.Round(float64(stats.Hits)/float64(total)*1000) / 1000
+	}
+	return stats
+}
+
+// Close writes the pending LRU touches and closes the database
+func (c *EmbeddingCache) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+	})
+	return c.db.Close()
+}
+
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
+
+// cachedEmbedder wraps an Embedder and only sends cache misses to it
+type cachedEmbedder struct {
+	Embedder
+	cache *EmbeddingCache
+}
+
+func (e cachedEmbedder) Embed(texts []string) ([][]float32, error) {
+	vectors := e.cache.Get(e.Name(), texts)
+
+	var missingTexts []string
+	var missingIndex []int
+	for i, v := range vectors {
+		if v == nil {
+			missingTexts = append(missingTexts, texts[i])
+			missingIndex = append(missingIndex, i)
+		}
+	}
+	if len(missingTexts) == 0 {
+		fmt.Printf("🗄️ Embedding cache: %d/%d hits\n", len(texts), len(texts))
+		return vectors, nil
+	}
+
+	computed, err := e.Embedder.Embed(missingTexts)
+	if err != nil {
+		return nil, err
+	}
+	if len(computed) != len(missingTexts) {
+		return nil, fmt.Errorf("embedder %s returned %d vectors for %d texts", e.Name(), len(computed), len(missingTexts))
+	}
+	for j, i := range missingIndex {
+		vectors[i] = computed[j]
+	}
+	e.cache.Put(e.Name(), missingTexts, computed)
+
+	fmt.Printf("🗄️ Embedding cache: %d/%d hits\n", len(texts)-len(missingTexts), len(texts))
+	return vectors, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// countingEmbedder records how many texts reach the wrapped embedder
+type countingEmbedder struct {
+	Embedder
+	texts *int
+}
+
+func (e countingEmbedder) Embed(texts []string) ([][]float32, error) {
+	*e.texts += len(texts)
+	return e.Embedder.Embed(texts)
+}
+
+func openTestEmbeddingCache(t *testing.T, maxEntries string) *EmbeddingCache {
+	t.Helper()
+	t.Setenv("EMBEDDING_CACHE_PATH", filepath.Join(t.TempDir(), "cache.db"))
+	t.Setenv("EMBEDDING_CACHE_MAX_ENTRIES", maxEntries)
+	cache, err := newEmbeddingCacheFromEnv()
+	if err != nil {
+		t.Fatalf("failed to open cache: %v", err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	return cache
+}
+
+func TestCachedEmbedderOnlyEmbedsMisses(t *testing.T) {
+	cache := openTestEmbeddingCache(t, "100")
+	sent := 0
+	base := hashEmbedder{dimensions: 16}
+	embedder := cachedEmbedder{Embedder: countingEmbedder{Embedder: base, texts: &sent}, cache: cache}
+
+	tests := []struct {
+		name     string
+		texts    []string
+		wantSent int
+	}{
+		{"all new", []string{"alpha", "beta"}, 2},
+		{"all cached", []string{"beta", "alpha"}, 0},
+		{"mixed", []string{"alpha", "gamma", "delta"}, 2},
+		{"duplicates of a cached text", []string{"gamma", "gamma"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent = 0
+			vectors, err := embedder.Embed(tt.texts)
+			if err != nil {
+				t.Fatalf("Embed failed: %v", err)
+			}
+			if sent != tt.wantSent {
+				t.Errorf("%d texts sent to the provider, want %d", sent, tt.wantSent)
+			}
+			want, _ := base.Embed(tt.texts)
+			if !reflect.DeepEqual(vectors, want) {
+				t.Errorf("cached vectors differ from the provider's")
+			}
+		})
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 5 || stats.Misses != 4 || stats.Entries != 4 {
+		t.Errorf("stats = %+v, want 5 hits, 4 misses, 4 entries", stats)
+	}
+}
+
+func TestEmbeddingCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := openTestEmbeddingCache(t, "2")
+	vector := [][]float32{{1, 2}}
+
+	cache.Put("m", []string{"old"}, vector)
+	cache.Put("m", []string{"new"}, vector)
+
+	// A hit on "old" makes "new" the least recently used entry once the touch is written
+	if got := cache.Get("m", []string{"old"}); got[0] == nil {
+		t.Fatalf("expected a hit for old")
+	}
+	cache.flushTouches()
+	cache.Put("m", []string{"third"}, vector)
+
+	tests := []struct {
+		text string
+		hit  bool
+	}{
+		{"old", true},
+		{"new", false},
+		{"third", true},
+	}
+	for _, tt := range tests {
+		if got := cache.Get("m", []string{tt.text}); (got[0] != nil) != tt.hit {
+			t.Errorf("Get(%q) hit = %v, want %v", tt.text, got[0] != nil, tt.hit)
+		}
+	}
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("stats = %+v, want 2 entries and 1 eviction", stats)
+	}
+}
+
+func TestEmbeddingCacheModelIsPartOfTheKey(t *testing.T) {
+	cache := openTestEmbeddingCache(t, "10")
+	cache.Put("model-a", []string{"text"}, [][]float32{{0.5}})
+
+	if got := cache.Get("model-b", []string{"text"}); got[0] != nil {
+		t.Errorf("vector of model-a returned for model-b")
+	}
+	if got := cache.Get("model-a", []string{"text"}); !reflect.DeepEqual(got[0], []float32{0.5}) {
+		t.Errorf("Get = %v, want [0.5]", got[0])
+	}
+}
+
+// shortEmbedder drops the last vector, like a provider answering a partial batch
+type shortEmbedder struct{ Embedder }
+
+func (e shortEmbedder) Embed(texts []string) ([][]float32, error) {
+	vectors, err := e.Embedder.Embed(texts)
+	return vectors[:len(vectors)-1], err
+}
+
+func TestCachedEmbedderRejectsShortResponse(t *testing.T) {
+	cache := openTestEmbeddingCache(t, "100")
+	embedder := cachedEmbedder{Embedder: shortEmbedder{hashEmbedder{dimensions: 16}}, cache: cache}
+
+	if _, err := embedder.Embed([]string{"alpha", "beta"}); err == nil {
+		t.Fatal("Embed accepted 1 vector for 2 texts")
+	}
+	if vectors := cache.Get(embedder.Name(), []string{"alpha"}); vectors[0] != nil {
+		t.Error("a partial response was cached")
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+/*
+EMBEDDINGS (provider configurabil)
+
+  - EMBEDDING_PROVIDER    openai (implicit) | local | hash
+  - EMBEDDING_MODEL       implicit text-embedding-3-small (openai) / nomic-embed-text (local)
+  - EMBEDDING_URL         endpoint compatibil OpenAI pentru "local"
+                          (implicit Ollama: http://localhost:11434/v1/embeddings)
+  - EMBEDDING_DIMENSIONS  dimensiunea vectorilor; obligatorie pentru "local",
+                          pentru "openai" este trimisă modelului (modelele
+                          text-embedding-3 pot scurta vectorii), implicit 1536,
+                          pentru "hash" implicit 256
+
+Provider-ul ține de colecție: dimensiunea colecției Qdrant vine din embedder,
+iar numele lui (ex. "openai:text-embedding-3-small") este salvat în payload și
+folosit ca filtru la căutare, ca vectorii din modele diferite să nu se amestece.
+Embedder-ul "hash" este determinist și nu folosește rețeaua (dezvoltare, teste).
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	OpenAIAPIURL              = "https://api.openai.com/v1/embeddings"
+	defaultOpenAIModel        = "text-embedding-3-small" // Fast, efficient, 1536 dimensions
+	defaultOpenAIDimensions   = 1536
+	defaultLocalEmbeddingURL  = "http://localhost:11434/v1/embeddings"
+	defaultLocalModel         = "nomic-embed-text"
+	defaultHashDimensions     = 256
+	embeddingRequestBatchSize = 100
+)
+
+// legacyEmbedderName - punctele salvate înainte de câmpul "embedder" în payload
+const legacyEmbedderName = "openai:" + defaultOpenAIModel
+
+// Embedder turns texts into vectors of a fixed dimension
+type Embedder interface {
+	// Name identifies provider and model; stored in the payload of every point
+	Name() string
+	Dimensions() int
+	Embed(texts []string) ([][]float32, error)
+}
+
+// OpenAI Embedding Request/Response structures
+type OpenAIEmbeddingRequest struct {
+	Input          []string `json:"input"`
+	Model          string   `json:"model"`
+	EncodingFormat string   `json:"encoding_format,omitempty"`
+	Dimensions     int      `json:"dimensions,omitempty"`
+}
+
+type OpenAIEmbeddingResponse struct {
+	Data []struct {
+		Object    string    `json:"object"`
+		Embedding []float32 `json:"embedding"`
+		Index     int       `json:"index"`
+	} `json:"data"`
+	Model string `json:"model"`
+	Usage struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+func newEmbedderFromEnv() (Embedder, error) {
+	provider := strings.ToLower(os.Getenv("EMBEDDING_PROVIDER"))
+	model := os.Getenv("EMBEDDING_MODEL")
+	dimensions := envInt("EMBEDDING_DIMENSIONS", 0)
+
+	switch provider {
+	case "", "openai":
+		// The key is checked on use, so extraction-only deployments still start
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if model == "" {
+			model = defaultOpenAIModel
+		}
+		e := &openAIEmbedder{
+			provider: "openai", url: OpenAIAPIURL, apiKey: apiKey, model: model, dimensions: dimensions,
+			client: newResilientClient("openai", 2*time.Minute),
+		}
+		// Only an explicit size is sent: older models reject the parameter
+		e.requestDimensions = dimensions
+		if e.dimensions == 0 {
+			e.dimensions = defaultOpenAIDimensions
+		}
+		return e, nil
+
+	case "local":
+		url := os.Getenv("EMBEDDING_URL")
+		if url == "" {
+			url = defaultLocalEmbeddingURL
+		}
+		if model == "" {
+			model = defaultLocalModel
+		}
+		// The collection is sized at startup, when the local server may still be down
+		if dimensions == 0 {
+			return nil, fmt.Errorf("EMBEDDING_DIMENSIONS is required for the local provider (e.g. 768 for %s)", defaultLocalModel)
+		}
+		return &openAIEmbedder{
+			provider: "local", url: url, apiKey: os.Getenv("EMBEDDING_API_KEY"), model: model, dimensions: dimensions,
+			client: newResilientClient("local-embeddings", 5*time.Minute),
+		}, nil
+
+	case "hash":
+		if dimensions == 0 {
+			dimensions = defaultHashDimensions
+		}
+		return hashEmbedder{dimensions: dimensions}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown EMBEDDING_PROVIDER %q (use openai, local or hash)", provider)
+	}
+}
+
+// openAIEmbedder calls the OpenAI embeddings API or any server exposing the
+// same endpoint (Ollama, llama.cpp server, vLLM)
+type openAIEmbedder struct {
+	provider   string
+	url        string
+	apiKey     string
+	model      string
+	dimensions int
+	client     *ResilientClient
+
+	requestDimensions int // sent as "dimensions" when > 0
+}
+
+func (e *openAIEmbedder) Name() string    { return e.provider + ":" + e.model }
+func (e *openAIEmbedder) Dimensions() int { return e.dimensions }
+
+// Embed processes texts in batches of 100 (OpenAI batch size limit)
+func (e *openAIEmbedder) Embed(texts []string) ([][]float32, error) {
+	if e.provider == "openai" && e.apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	}
+
+	var allEmbeddings [][]float32
+
+	for i := 0; i < len(texts); i += embeddingRequestBatchSize {
+		end := i + embeddingRequestBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+
+		batchEmbeddings, err := e.embedBatch(texts[i:end])
+		if err != nil {
+			return nil, fmt.Errorf("failed to get embeddings for batch %d-%d: %v", i, end-1, err)
+		}
+
+		allEmbeddings = append(allEmbeddings, batchEmbeddings...)
+	}
+
+	return allEmbeddings, nil
+}
+
+func (e *openAIEmbedder) embedBatch(texts []string) ([][]float32, error) {
+	reqBody := OpenAIEmbeddingRequest{
+		Input:          texts,
+		Model:          e.model,
+		EncodingFormat: "float",
+		Dimensions:     e.requestDimensions,
+	}
+
+	payload, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embedding request: %v", err)
+	}
+
+	result, err := e.client.Do(func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", e.url, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if e.apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+e.apiKey)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s embeddings API: %v", e.provider, err)
+	}
+
+	if result.StatusCode != 200 {
+		return nil, fmt.Errorf("%s embeddings API returned status %d: %s", e.provider, result.StatusCode, truncateBody(result.Body, 512))
+	}
+
+	var embeddingResp OpenAIEmbeddingResponse
+	if err := json.Unmarshal(result.Body, &embeddingResp); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding response: %v", err)
+	}
+
+	// Extract embeddings in the same order as input
+	embeddings := make([][]float32, len(texts))
+	for _, data := range embeddingResp.Data {
+		if data.Index >= 0 && data.Index < len(embeddings) {
+			embeddings[data.Index] = data.Embedding
+		}
+	}
+	for i, embedding := range embeddings {
+		if embedding == nil {
+			return nil, fmt.Errorf("missing embedding for input %d", i)
+		}
+		if e.dimensions > 0 && len(embedding) != e.dimensions {
+			return nil, fmt.Errorf("model %s returned %d dimensions, expected %d", e.model, len(embedding), e.dimensions)
+		}
+	}
+
+	fmt.Printf("🔮 Generated %d %s embeddings (tokens: %d)\n", len(embeddings), e.Name(), embeddingResp.Usage.TotalTokens)
+	return embeddings, nil
+}
+
+// hashEmbedder is a deterministic bag-of-words embedder (feature hashing of
+// lowercase words, L2 normalized). No network, no model: for development and tests.
+type hashEmbedder struct {
+	dimensions int
+}
+
+func (e hashEmbedder) Name() string    { return fmt.Sprintf("hash:%d", e.dimensions) }
+func (e hashEmbedder) Dimensions() int { return e.dimensions }
+
+func (e hashEmbedder) Embed(texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, e.dimensions)
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			h := fnv.New64a()
+			h.Write([]byte(word))
+			sum := h.Sum64()
+			// The top bit picks the sign so collisions tend to cancel out
+			sign := float32(1)
+			if sum>>63 == 1 {
+				sign = -1
+			}
+			vector[sum%uint64(e.dimensions)] += sign
+		}
+
+		norm := 0.0
+		for _, v := range vector {
+			norm += float64(v) * float64(v)
+		}
+		if norm > 0 {
+			norm = math.Sqrt(norm)
+			for j := range vector {
+				vector[j] = float32(float64(vector[j]) / norm)
+			}
+		}
+		embeddings[i] = vector
+	}
+	return embeddings, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHashEmbedder(t *testing.T) {
+	e := hashEmbedder{dimensions: 32}
+	vectors, err := e.Embed([]string{"Alpha beta, beta!", "alpha BETA beta", "", "gamma"})
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	if len(vectors) != 4 || e.Name() != "hash:32" {
+		t.Fatalf("%d vectors from %s", len(vectors), e.Name())
+	}
+
+	norm := func(v []float32) float64 {
+		sum := 0.0
+		for _, x := range v {
+			sum += float64(x) * float64(x)
+		}
+		return math.Sqrt(sum)
+	}
+	for i, v := range vectors {
+		if len(v) != 32 {
+			t.Fatalf("vector %d has %d dimensions", i, len(v))
+		}
+	}
+	// Case and punctuation do not matter, the empty text stays a zero vector
+	for j := range vectors[0] {
+		if vectors[0][j] != vectors[1][j] {
+			t.Fatalf("same words gave different vectors: %v / %v", vectors[0], vectors[1])
+		}
+	}
+	if n := norm(vectors[0]); math.Abs(n-1) > 1e-6 {
+		t.Errorf("norm = %f, want 1", n)
+	}
+	if n := norm(vectors[2]); n != 0 {
+		t.Errorf("empty text norm = %f, want 0", n)
+	}
+}
+
+func TestNewEmbedderFromEnv(t *testing.T) {
+	tests := []struct {
+		provider   string
+		dimensions string
+		wantName   string
+		wantDims   int
+		wantSent   int
+		wantErr    string
+	}{
+		{"", "", "openai:text-embedding-3-small", 1536, 0, ""},
+		{"openai", "512", "openai:text-embedding-3-small", 512, 512, ""},
+		{"local", "768", "local:nomic-embed-text", 768, 0, ""},
+		{"local", "", "", 0, 0, "EMBEDDING_DIMENSIONS is required"},
+		{"hash", "", "hash:256", 256, 0, ""},
+		{"cohere", "", "", 0, 0, "unknown EMBEDDING_PROVIDER"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.provider+"/"+tt.dimensions, func(t *testing.T) {
+			t.Setenv("EMBEDDING_PROVIDER", tt.provider)
+			t.Setenv("EMBEDDING_DIMENSIONS", tt.dimensions)
+			t.Setenv("EMBEDDING_MODEL", "")
+			t.Setenv("EMBEDDING_URL", "http://127.0.0.1:1/unreachable")
+
+			e, err := newEmbedderFromEnv()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("newEmbedderFromEnv error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newEmbedderFromEnv failed: %v", err)
+			}
+			if e.Name() != tt.wantName || e.Dimensions() != tt.wantDims {
+				t.Errorf("%s with %d dimensions, want %s with %d", e.Name(), e.Dimensions(), tt.wantName, tt.wantDims)
+			}
+			if oe, ok := e.(*openAIEmbedder); ok && oe.requestDimensions != tt.wantSent {
+				t.Errorf("sends dimensions %d, want %d", oe.requestDimensions, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestOpenAIEmbedderResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     [][]float32
+		wantErr  string
+	}{
+		{"reordered", `{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}],"usage":{"total_tokens":4}}`,
+			[][]float32{{1, 0}, {0, 1}}, ""},
+		{"missing index", `{"data":[{"index":0,"embedding":[1,0]}]}`, nil, "missing embedding for input 1"},
+		{"index out of range", `{"data":[{"index":0,"embedding":[1,0]},{"index":5,"embedding":[0,1]}]}`, nil, "missing embedding for input 1"},
+		{"negative index", `{"data":[{"index":-1,"embedding":[1,0]},{"index":0,"embedding":[1,0]}]}`, nil, "missing embedding for input 1"},
+		{"wrong dimensions", `{"data":[{"index":0,"embedding":[1,0,0]},{"index":1,"embedding":[0,1,0]}]}`, nil, "returned 3 dimensions, expected 2"},
+		{"not json", `<html>`, nil, "failed to decode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request OpenAIEmbeddingRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				json.Unmarshal(body, &request)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			e := &openAIEmbedder{
+				provider: "local", url: server.URL, model: "test", dimensions: 2,
+				client: newResilientClient("test-embeddings", 0), requestDimensions: 2,
+			}
+			vectors, err := e.Embed([]string{"first", "second"})
+			if request.Dimensions != 2 || len(request.Input) != 2 || request.Model != "test" {
+				t.Errorf("request = %+v", request)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Embed error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Embed failed: %v", err)
+			}
+			if len(vectors) != len(tt.want) {
+				t.Fatalf("got %d vectors, want %d", len(vectors), len(tt.want))
+			}
+			for i := range tt.want {
+				for j := range tt.want[i] {
+					if vectors[i][j] != tt.want[i][j] {
+						t.Fatalf("vectors = %v, want %v", vectors, tt.want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+/*
+ÎMBOGĂȚIRE CONTEXTUALĂ A BUCĂȚILOR (/extract/store, câmpul "enrich")
+
+Înainte de embedding, fiecărei bucăți i se adaugă în față un antet cu
+contextul ei în document:
+
+    Document: Raport anual 2024
+    Section: Capitolul 3 > Rezultate
+    Context: Secțiunea descrie rezultatele financiare din T3.   (doar enrich=llm)
+
+  - none    fără antet (implicit, CHUNK_ENRICH)
+  - header  titlul documentului și calea de titluri (secțiunea) a bucății
+  - llm     în plus o propoziție generată de ENRICH_LLM_MODEL care situează
+            bucata în document (ENRICH_CONCURRENCY cereri în paralel)
+
+Titlul este metadata "title", altfel primul titlu din document, altfel numele
+fișierului. Secțiunea vine din structura extrasă (structure.go): titlurile de
+dinaintea bucății, plus titlul cu care începe bucata.
+
+Antetul intră în embedding și în vectorul sparse, dar nu în "text": payload-ul
+păstrează textul brut pentru afișare, antetul în "context_header" și calea în
+"section". Căutarea BM25 a colecțiilor vechi (bm25.go) folosește doar textul.
+
+"enrichment" din payload spune ce a primit fiecare bucată: dacă rezumatul LLM
+a eșuat, bucata rămâne "header", iar documentul nu mai este considerat
+neschimbat la următoarea încărcare (rezumatele lipsă se cer din nou).
+*/
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	EnrichNone   = "none"
+	EnrichHeader = "header"
+	EnrichLLM    = "llm"
+
+	defaultEnrichConcurrency = 4
+	enrichExcerptTokens      = 2000 // beginning of the document given to the LLM
+	enrichSummaryMaxChars    = 300
+	sectionHeadingLead       = 200 // a heading this close to the chunk start is its own title
+)
+
+// parseEnrichMode reads the "enrich" form field (default CHUNK_ENRICH, none)
+func parseEnrichMode(formValue func(key string, defaultValue ...string) string) (string, error) {
+	mode := os.Getenv("CHUNK_ENRICH")
+	if mode == "" {
+		mode = EnrichNone
+	}
+	mode = strings.ToLower(formValue("enrich", mode))
+	switch mode {
+	case EnrichNone, EnrichHeader:
+		return mode, nil
+	case EnrichLLM:
+		if os.Getenv("OPENROUTER_API_KEY") == "" {
+			return mode, fmt.Errorf("enrich=llm needs OPENROUTER_API_KEY")
+		}
+		return mode, nil
+	default:
+		return mode, fmt.Errorf("unknown enrich %q (use none, header or llm)", mode)
+	}
+}
+
+// documentTitle picks the title shown in the context header
+func documentTitle(metadata map[string]interface{}, blocks []DocBlock, filename string) string {
+	if title, ok := metadata["title"].(string); ok && strings.TrimSpace(title) != "" {
+		return strings.TrimSpace(title)
+	}
+	for _, block := range blocks {
+		if block.Kind == BlockHeading && strings.TrimSpace(block.Text) != "" {
+			return strings.Join(strings.Fields(block.Text), " ")
+		}
+	}
+	return strings.TrimSuffix(filename, filepath.Ext(filename))
+}
+
+// sectionHeading is a heading located in the page text
+type sectionHeading struct {
+	level  int
+	title  string
+	page   int // 1-based
+	offset int // rune offset in the page text
+}
+
+// SectionIndex finds the heading path at any position of the document
+type SectionIndex struct {
+	headings []sectionHeading // in reading order
+}
+
+// newSectionIndex locates the structure headings in the page texts. A heading
+// that cannot be found (different whitespace or hyphenation) is placed right
+// after the previous one on its page.
+func newSectionIndex(pages []string, blocks []DocBlock) *SectionIndex {
+	index := &SectionIndex{}
+	searchFrom := make([]int, len(pages)) // byte offset per page
+	for _, block := range blocks {
+		if block.Kind != BlockHeading || block.Page < 1 || block.Page > len(pages) {
+			continue
+		}
+		title := strings.Join(strings.Fields(block.Text), " ")
+		if title == "" {
+			continue
+		}
+		page := pages[block.Page-1]
+		from := searchFrom[block.Page-1]
+		at := from
+		if i := strings.Index(page[from:], title); i >= 0 {
+			at = from + i
+			searchFrom[block.Page-1] = at + len(title)
+		}
+		level := block.Level
+		if level < 1 {
+			level = 1
+		}
+		index.headings = append(index.headings, sectionHeading{
+			level:  level,
+			title:  title,
+			page:   block.Page,
+			offset: utf8.RuneCountInString(page[:at]),
+		})
+	}
+	return index
+}
+
+// PathAt returns the titles of the sections containing a chunk that starts at
+// (page, rune offset), outermost first
+func (s *SectionIndex) PathAt(page, offset int) []string {
+	if s == nil {
+		return nil
+	}
+	var stack []sectionHeading
+	for _, h := range s.headings {
+		if h.page > page || (h.page == page && h.offset >= offset+sectionHeadingLead) {
+			break
+		}
+		for len(stack) > 0 && stack[len(stack)-1].level >= h.level {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, h)
+	}
+	path := make([]string, len(stack))
+	for i, h := range stack {
+		path[i] = h.title
+	}
+	return path
+}
+
+// chunkEnricher builds the context headers of one document
+type chunkEnricher struct {
+	mode    string
+	title   string
+	excerpt string // beginning of the document, for the LLM
+	model   string
+}
+
+func newChunkEnricher(mode, title string, pages []string) (*chunkEnricher, error) {
+	if mode == EnrichNone {
+		return nil, nil
+	}
+	e := &chunkEnricher{mode: mode, title: title}
+	if mode == EnrichLLM {
+		e.model = os.Getenv("ENRICH_LLM_MODEL")
+		if e.model == "" {
+			e.model = OpenRouterModel
+		}
+		tokenizer, err := tokenizerForEmbedder(qdrant.Embedder.Name())
+		if err != nil {
+			return nil, err
+		}
+		text := strings.Join(pages, "\n\n")
+		if boundaries := tokenizer.Boundaries(text); len(boundaries) > enrichExcerptTokens {
+			text = text[:boundaries[enrichExcerptTokens-1]]
+		}
+		e.excerpt = text
+	}
+	return e, nil
+}
+
+// Name is the requested enrichment; changing it re-embeds the document. The
+// payload ("enrichment") records what each chunk really got (see Headers).
+func (e *chunkEnricher) Name() string {
+	if e.mode == EnrichLLM {
+		return "llm:" + e.model
+	}
+	return e.mode
+}
+
+// Headers returns the context header of every chunk (section paths come from the
+// payload) and the enrichment applied to it. LLM failures leave that chunk without
+// the Context line, recorded as "header", so the next upload retries it.
+func (e *chunkEnricher) Headers(chunks []QdrantPage) (headers, applied []string) {
+	summaries := make([]string, len(chunks))
+	if e.mode == EnrichLLM {
+		summaries = e.summaries(chunks)
+	}
+
+	headers = make([]string, len(chunks))
+	applied = make([]string, len(chunks))
+	for i, chunk := range chunks {
+		applied[i] = e.Name()
+		if e.mode == EnrichLLM && summaries[i] == "" {
+			applied[i] = EnrichHeader
+		}
+
+		var header strings.Builder
+		header.WriteString("Document: " + e.title + "\n")
+		if chunk.Section != "" {
+			header.WriteString("Section: " + chunk.Section + "\n")
+		}
+		if summaries[i] != "" {
+			header.WriteString("Context: " + summaries[i] + "\n")
+		}
+		header.WriteString("\n")
+		headers[i] = header.String()
+	}
+	return headers, applied
+}
+
+func (e *chunkEnricher) summaries(chunks []QdrantPage) []string {
+	apiKey := os.Getenv("OPENROUTER_API_KEY")
+	summaries := make([]string, len(chunks))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	concurrency := envInt("ENRICH_CONCURRENCY", defaultEnrichConcurrency)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	for i := range chunks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			summary, err := e.summarize(chunks[i], apiKey)
+			if err != nil {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+				return
+			}
+			summaries[i] = summary
+		}(i)
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		fmt.Printf("⚠️ Context summary failed for %d of %d chunks (header without Context line)\n", failed, len(chunks))
+	}
+	fmt.Printf("📝 Generated %d context summaries with %s\n", len(chunks)-failed, e.model)
+	return summaries
+}
+
+func (e *chunkEnricher) summarize(chunk QdrantPage, apiKey string) (string, error) {
+	section := chunk.Section
+	if section == "" {
+		section = "(none)"
+	}
+	prompt := fmt.Sprintf(`<document title=%q>
+%s
+</document>
+
+Here is a chunk from page %d of this document (section: %s):
+<chunk>
+%s
+</chunk>
+
+Write ONE short sentence that situates this chunk within the overall document, to improve search retrieval of the chunk. Use the language of the document. Answer with the sentence only.`,
+		e.title, e.excerpt, chunk.PageNum, section, chunk.Text)
+
+	response, err := callOpenRouter(OpenRouterRequest{
+		Model:       e.model,
+		Temperature: 0,
+		MaxTokens:   120,
+		Messages:    []OpenRouterMessage{{Role: "user", Content: prompt}},
+	}, apiKey)
+	if err != nil {
+		return "", err
+	}
+
+	summary := strings.TrimSpace(response)
+	if line, _, found := strings.Cut(summary, "\n"); found {
+		summary = strings.TrimSpace(line)
+	}
+	if runes := []rune(summary); len(runes) > enrichSummaryMaxChars {
+		summary = string(runes[:enrichSummaryMaxChars])
+	}
+	if summary == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return summary, nil
+}
+
+// embeddedText is what the dense and sparse vectors of a point are computed from
+func embeddedText(page QdrantPage) string {
+	return page.ContextHeader + page.Text
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeOpenRouter answers context summary prompts; chunks containing a failing
+// word get an empty answer, which the enricher treats as a failed summary
+type fakeOpenRouter struct {
+	mu      sync.Mutex
+	failing string
+	calls   int
+}
+
+func (f *fakeOpenRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req OpenRouterRequest
+	json.Unmarshal(body, &req)
+	_, chunk, _ := strings.Cut(req.Messages[0].Content, "<chunk>\n")
+	chunk, _, _ = strings.Cut(chunk, "\n</chunk>")
+
+	f.mu.Lock()
+	f.calls++
+	summary := "About " + chunk + "."
+	if f.failing != "" && strings.Contains(chunk, f.failing) {
+		summary = ""
+	}
+	f.mu.Unlock()
+
+	json.NewEncoder(w).Encode(OpenRouterResponse{Choices: []OpenRouterChoice{
+		{Message: OpenRouterMessage{Role: "assistant", Content: summary}},
+	}})
+}
+
+// useFakeOpenRouter sends the OpenRouter calls of the test to fake
+func useFakeOpenRouter(t *testing.T, fake *fakeOpenRouter) {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	previousURL, previousClient := openRouterURL, openRouterClient
+	openRouterURL = server.URL
+	openRouterClient = newResilientClient("test-openrouter", 0)
+	t.Setenv("OPENROUTER_API_KEY", "test-key")
+	t.Cleanup(func() {
+		openRouterURL, openRouterClient = previousURL, previousClient
+		server.Close()
+	})
+}
+
+func TestChunkEnricherHeaders(t *testing.T) {
+	useTestVectorStore(t)
+	useFakeOpenRouter(t, &fakeOpenRouter{failing: "beta"})
+	t.Setenv("ENRICH_CONCURRENCY", "0") // clamped to 1
+	t.Setenv("ENRICH_LLM_MODEL", "test-model")
+
+	chunks := []QdrantPage{
+		{Text: "alpha results", PageNum: 1, Section: "Capitolul 1 > Rezultate"},
+		{Text: "beta notes", PageNum: 2},
+	}
+	tests := []struct {
+		mode        string
+		wantHeaders []string
+		wantApplied []string
+	}{
+		{EnrichHeader,
+			[]string{"Document: Raport\nSection: Capitolul 1 > Rezultate\n\n", "Document: Raport\n\n"},
+			[]string{"header", "header"}},
+		{EnrichLLM,
+			[]string{"Document: Raport\nSection: Capitolul 1 > Rezultate\nContext: About alpha results.\n\n", "Document: Raport\n\n"},
+			[]string{"llm:test-model", "header"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			enricher, err := newChunkEnricher(tt.mode, "Raport", []string{"alpha results", "beta notes"})
+			if err != nil {
+				t.Fatalf("newChunkEnricher failed: %v", err)
+			}
+			headers, applied := enricher.Headers(chunks)
+			if !reflect.DeepEqual(headers, tt.wantHeaders) {
+				t.Errorf("headers = %q, want %q", headers, tt.wantHeaders)
+			}
+			if !reflect.DeepEqual(applied, tt.wantApplied) {
+				t.Errorf("applied = %q, want %q", applied, tt.wantApplied)
+			}
+		})
+	}
+}
+
+func TestStoreRetriesFailedSummaries(t *testing.T) {
+	useTestVectorStore(t)
+	fake := &fakeOpenRouter{failing: "beta"}
+	useFakeOpenRouter(t, fake)
+	t.Setenv("ENRICH_LLM_MODEL", "test-model")
+
+	pages := []string{"alpha results of the year", "beta notes about the method"}
+	store := func() string {
+		t.Helper()
+		enricher, err := newChunkEnricher(EnrichLLM, "Raport", pages)
+		if err != nil {
+			t.Fatalf("newChunkEnricher failed: %v", err)
+		}
+		chunks := []StoreChunk{{Text: pages[0], PageNum: 1}, {Text: pages[1], PageNum: 2}}
+		outcome, err := storePagesInQdrant("ana", chunks, "raport.pdf", "hash-raport", "", nil, enricher, nil)
+		if err != nil {
+			t.Fatalf("store failed: %v", err)
+		}
+		return outcome
+	}
+	enrichments := func() map[string]string {
+		t.Helper()
+		points, err := scrollAllPoints(userDocFilter("ana", "raport.pdf"), []string{"text", "enrichment"})
+		if err != nil {
+			t.Fatalf("scroll failed: %v", err)
+		}
+		out := map[string]string{}
+		for _, p := range points {
+			out[p.Payload.Text] = p.Payload.Enrichment
+		}
+		return out
+	}
+
+	if outcome := store(); outcome != StoreCreated {
+		t.Fatalf("first store: %s, want %s", outcome, StoreCreated)
+	}
+	if got := enrichments(); got[pages[0]] != "llm:test-model" || got[pages[1]] != EnrichHeader {
+		t.Fatalf("enrichment after a failed summary = %v", got)
+	}
+
+	// The same file again: the missing summary is requested again
+	fake.mu.Lock()
+	fake.failing = ""
+	fake.mu.Unlock()
+	if outcome := store(); outcome != StoreReplaced {
+		t.Fatalf("second store: %s, want %s", outcome, StoreReplaced)
+	}
+	if got := enrichments(); got[pages[1]] != "llm:test-model" {
+		t.Fatalf("enrichment after the retry = %v", got)
+	}
+
+	// Fully enriched: nothing to do and no LLM call
+	fake.mu.Lock()
+	calls := fake.calls
+	fake.mu.Unlock()
+	if outcome := store(); outcome != StoreUnchanged {
+		t.Fatalf("third store: %s, want %s", outcome, StoreUnchanged)
+	}
+	if fake.calls != calls {
+		t.Errorf("unchanged store made %d LLM calls", fake.calls-calls)
+	}
+}
@@ -7,7 +7,10 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 	"unicode/utf16"
 
@@ -123,44 +126,191 @@ func extractDOCXText(data []byte) ([]string, error) {
 	return splitTextIntoPages(text), nil
 }
 
+// ExtractStats - timpi și throughput pentru extragere, returnate în răspuns
+type ExtractStats struct {
+	DurationMs     int64   `json:"duration_ms"`
+	TotalPages     int     `json:"total_pages"`
+	Shards         int     `json:"shards"`
+	Workers        int     `json:"workers"`
+	PagesPerSecond float64 `json:"pages_per_second"`
+}
+
+const (
+	pdfParallelMinPages = 40 // below this a single document handle is faster
+	pdfPagesPerShard    = 25
+	pdfMaxShardWorkers  = 8
+)
+
 func extractPDFText(data []byte) ([]string, error) {
+	result, err := extractPDF(data, ExtractOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return result.Pages, nil
+}
+
+// extractPDF extracts large PDFs in parallel: pages are split into contiguous
+// ranges (shards) and processed by a bounded pool of goroutines, each with its
+// own fitz.Document opened from the same bytes (MuPDF contexts are not shared
+// between threads). Results are written by page index, so order is preserved.
+func extractPDF(data []byte, opts ExtractOptions) (*ExtractResult, error) {
+	startTime := time.Now()
+
 	// Create a document from PDF data using go-fitz (MuPDF)
 	doc, err := fitz.NewFromMemory(data)
 	if err != nil {
 		return nil, fmt.Errorf("cannot open PDF with MuPDF: %v", err)
 	}
-	defer doc.Close()
 
 	totalPages := doc.NumPage()
-	pages := make([]string, 0, totalPages)
-
-	for pageNum := 0; pageNum < totalPages; pageNum++ {
-		// Extract text from the page using MuPDF
-		text, err := doc.Text(pageNum)
-		if err != nil {
-			// If text extraction fails, try alternative methods
-			fmt.Printf("Warning: Failed to extract text from page %d: %v\n", pageNum+1, err)
-			pages = append(pages, "")
-			continue
+	pages := make([]string, totalPages)
+	pageLines := make([]pdfPageLines, totalPages)
+	quality := make([]PageQuality, totalPages)
+
+	// Split pages into shards
+	type pageRange struct{ start, end int }
+	var shards []pageRange
+	shardSize := totalPages
+	if totalPages >= pdfParallelMinPages {
+		shardSize = pdfPagesPerShard
+	}
+	for start := 0; start < totalPages; start += shardSize {
+		end := start + shardSize
+		if end > totalPages {
+			end = totalPages
+		}
+		shards = append(shards, pageRange{start, end})
+	}
+
+	workers := envInt("PDF_EXTRACT_PARALLELISM", runtime.NumCPU())
+	if workers > pdfMaxShardWorkers {
+		workers = pdfMaxShardWorkers
+	}
+	if workers > len(shards) {
+		workers = len(shards)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	extractRange := func(d *fitz.Document, r pageRange) {
+		for pageNum := r.start; pageNum < r.end; pageNum++ {
+			// Extract text from the page using MuPDF
+			text, err := d.Text(pageNum)
+			if err != nil {
+				fmt.Printf("Warning: Failed to extract text from page %d: %v\n", pageNum+1, err)
+				quality[pageNum] = PageQuality{Page: pageNum + 1, Status: QualityError, Issues: []string{err.Error()}}
+				continue
+			}
+
+			// Diagnostics use the raw text, before spacing is normalized
+			quality[pageNum] = assessPageQuality(pageNum+1, text)
+
+			// Clean the extracted text
+			pages[pageNum] = cleanUnicodeText(text)
+
+			// Structured text (fonts, positions) for markdown/tree output and bounding boxes
+			if opts.Structure || opts.Layout {
+				html, err := d.HTML(pageNum, false)
+				if err != nil {
+					fmt.Printf("Warning: Failed to extract structure from page %d: %v\n", pageNum+1, err)
+					continue
+				}
+				pageLines[pageNum] = parseMuPDFHTML(html, pageNum+1)
+
+				// Glyph positions for the horizontal extent of words and lines
+				if opts.Layout {
+					svg, err := d.SVG(pageNum)
+					if err != nil {
+						fmt.Printf("Warning: Failed to read glyph positions from page %d, boxes are estimated: %v\n", pageNum+1, err)
+						continue
+					}
+					pageLines[pageNum].Glyphs = parseMuPDFSVGGlyphs(svg)
+				}
+			}
+		}
+	}
+
+	if workers == 1 {
+		for _, r := range shards {
+			extractRange(doc, r)
+		}
+		doc.Close()
+	} else {
+		doc.Close()
+
+		shardCh := make(chan pageRange)
+		errCh := make(chan error, workers)
+		var wg sync.WaitGroup
+
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				// Each worker has its own document handle
+				d, err := fitz.NewFromMemory(data)
+				if err != nil {
+					errCh <- err
+					for range shardCh {
+						// drain so the producer never blocks
+					}
+					return
+				}
+				defer d.Close()
+
+				for r := range shardCh {
+					extractRange(d, r)
+				}
+			}()
 		}
 
-		// Clean the extracted text
-		cleanedText := cleanUnicodeText(text)
+		for _, r := range shards {
+			shardCh <- r
+		}
+		close(shardCh)
+		wg.Wait()
+		close(errCh)
 
-		if strings.TrimSpace(cleanedText) != "" {
-			pages = append(pages, cleanedText)
+		if err := <-errCh; err != nil {
+			return nil, fmt.Errorf("cannot open PDF shard with MuPDF: %v", err)
 		}
 	}
 
 	// Filter out empty pages
 	var nonEmptyPages []string
-	for _, page := range pages {
+	var nonEmptyLines []pdfPageLines
+	for i, page := range pages {
 		if strings.TrimSpace(page) != "" {
 			nonEmptyPages = append(nonEmptyPages, page)
+			nonEmptyLines = append(nonEmptyLines, pageLines[i])
 		}
 	}
 
-	return nonEmptyPages, nil
+	duration := time.Since(startTime)
+	stats := &ExtractStats{
+		DurationMs: duration.Milliseconds(),
+		TotalPages: totalPages,
+		Shards:     len(shards),
+		Workers:    workers,
+	}
+	if duration > 0 {
+		stats.PagesPerSecond = float64(totalPages) / duration.Seconds()
+	}
+
+	fmt.Printf("📄 Extracted %d pages in %v (%d shards, %d workers, %.1f pages/s)\n",
+		totalPages, duration, stats.Shards, workers, stats.PagesPerSecond)
+
+	result := &ExtractResult{Pages: nonEmptyPages, Stats: stats, Quality: buildQualityReport(quality)}
+	if opts.Structure {
+		result.Blocks = pdfBlocksFromLines(nonEmptyLines)
+	}
+	if opts.Layout {
+		for i, lines := range nonEmptyLines {
+			result.Layout = append(result.Layout, pageLayoutFromLines(lines, nonEmptyPages[i]))
+		}
+	}
+	return result, nil
 }
 
 // cleanExtractedText - Curăță textul extras pentru a îmbunătăți calitatea
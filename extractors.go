@@ -0,0 +1,326 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExtractOptions - opțiuni transmise extractorului
+type ExtractOptions struct {
+	Filename  string
+	Structure bool // also return Blocks (headings, lists, tables) for markdown/tree output
+	Layout    bool // also return line/word bounding boxes (PDF only)
+}
+
+// ExtractResult - rezultatul unei extrageri
+type ExtractResult struct {
+	Pages   []string
+	Blocks  []DocBlock
+	Layout  []PageLayout // aligned with Pages
+	Stats   *ExtractStats
+	Quality *QualityReport // per source page, including empty ones
+}
+
+// Extractor is implemented by every supported document format.
+// Adding a format means implementing this interface and registering it in init().
+type Extractor interface {
+	// Name is the short format id returned as file_type ("pdf", "docx", ...)
+	Name() string
+	// Extensions lists file extensions (with dot) used for name-based detection
+	Extensions() []string
+	SupportedMIMETypes() []string
+	// Detect reports whether the content looks like this format
+	Detect(data []byte) bool
+	Extract(data []byte, opts ExtractOptions) (*ExtractResult, error)
+}
+
+// ExtractorRegistry keeps extractors in registration order; detection tries them in that order
+type ExtractorRegistry struct {
+	mu         sync.RWMutex
+	extractors []Extractor
+	byName     map[string]Extractor
+}
+
+func NewExtractorRegistry() *ExtractorRegistry {
+	return &ExtractorRegistry{byName: make(map[string]Extractor)}
+}
+
+var extractors = NewExtractorRegistry()
+
+func init() {
+	extractors.Register(docExtractor{})
+	extractors.Register(pdfExtractor{})
+	extractors.Register(docxExtractor{})
+	extractors.Register(odtExtractor{})
+}
+
+// Register adds an extractor, replacing any previous one with the same name
+func (r *ExtractorRegistry) Register(e Extractor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.byName[e.Name()]; exists {
+		for i, old := range r.extractors {
+			if old.Name() == e.Name() {
+				r.extractors[i] = e
+			}
+		}
+	} else {
+		r.extractors = append(r.extractors, e)
+	}
+	r.byName[e.Name()] = e
+}
+
+func (r *ExtractorRegistry) Lookup(name string) (Extractor, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.byName[name]
+	return e, ok
+}
+
+func (r *ExtractorRegistry) All() []Extractor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Extractor(nil), r.extractors...)
+}
+
+func (r *ExtractorRegistry) Names() []string {
+	var names []string
+	for _, e := range r.All() {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+// DetectByName matches the filename extension
+func (r *ExtractorRegistry) DetectByName(filename string) (Extractor, bool) {
+	filename = strings.ToLower(filename)
+	for _, e := range r.All() {
+		for _, ext := range e.Extensions() {
+			if strings.HasSuffix(filename, ext) {
+				return e, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// DetectByContent asks every extractor whether it recognizes the bytes
+func (r *ExtractorRegistry) DetectByContent(data []byte) (Extractor, bool) {
+	for _, e := range r.All() {
+		if e.Detect(data) {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// DetectByMIMEType matches a Content-Type header (parameters are ignored)
+func (r *ExtractorRegistry) DetectByMIMEType(contentType string) (Extractor, bool) {
+	mimeType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if mimeType == "" {
+		return nil, false
+	}
+	for _, e := range r.All() {
+		for _, m := range e.SupportedMIMETypes() {
+			if m == mimeType {
+				return e, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// extractDocument runs the registered extractor for fileType
+func extractDocument(data []byte, fileType string, opts ExtractOptions) (*ExtractResult, error) {
+	e, ok := extractors.Lookup(fileType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported file type: %s (supported: %s)", fileType, strings.Join(extractors.Names(), ", "))
+	}
+
+	startTime := time.Now()
+	result, err := e.Extract(data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extractors that do not measure themselves get a simple timing
+	if result.Stats == nil {
+		duration := time.Since(startTime)
+		result.Stats = &ExtractStats{
+			DurationMs: duration.Milliseconds(),
+			TotalPages: len(result.Pages),
+			Shards:     1,
+			Workers:    1,
+		}
+		if duration > 0 {
+			result.Stats.PagesPerSecond = float64(len(result.Pages)) / duration.Seconds()
+		}
+	}
+
+	if result.Quality == nil {
+		result.Quality = qualityFromPages(result.Pages)
+	}
+
+	return result, nil
+}
+
+// zipHasFile opens data as a ZIP archive and reports whether it contains name
+func zipHasFile(data []byte, name string) bool {
+	if !bytes.HasPrefix(data, []byte("PK")) {
+		return false
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false
+	}
+	for _, f := range zr.File {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// zipFileContent returns the content of name from a ZIP archive (nil if missing)
+func zipFileContent(data []byte, name string) []byte {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil
+	}
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				return nil
+			}
+			content, _ := io.ReadAll(rc)
+			rc.Close()
+			return content
+		}
+	}
+	return nil
+}
+
+// PDF - extracted by MuPDF in the isolated worker pool
+type pdfExtractor struct{}
+
+func (pdfExtractor) Name() string         { return "pdf" }
+func (pdfExtractor) Extensions() []string { return []string{".pdf"} }
+func (pdfExtractor) SupportedMIMETypes() []string {
+	return []string{"application/pdf", "application/x-pdf"}
+}
+
+func (pdfExtractor) Detect(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("%PDF"))
+}
+
+func (pdfExtractor) Extract(data []byte, opts ExtractOptions) (*ExtractResult, error) {
+	return extractPDFIsolated(data, opts)
+}
+
+// Legacy MS Word .doc (OLE Compound File Binary Format)
+type docExtractor struct{}
+
+func (docExtractor) Name() string         { return "doc" }
+func (docExtractor) Extensions() []string { return []string{".doc"} }
+func (docExtractor) SupportedMIMETypes() []string {
+	return []string{"application/msword"}
+}
+
+func (docExtractor) Detect(data []byte) bool {
+	// OLE files start with D0 CF 11 E0
+	return len(data) >= 8 && bytes.HasPrefix(data, []byte{0xD0, 0xCF, 0x11, 0xE0})
+}
+
+func (docExtractor) Extract(data []byte, opts ExtractOptions) (*ExtractResult, error) {
+	pages, err := extractDOCText(data)
+	if err != nil {
+		return nil, err
+	}
+	result := &ExtractResult{Pages: pages}
+	if opts.Structure {
+		// The heuristic DOC reader has no styles, only paragraphs
+		result.Blocks = blocksFromPages(pages)
+	}
+	return result, nil
+}
+
+// DOCX - ZIP archive with word/document.xml
+type docxExtractor struct{}
+
+func (docxExtractor) Name() string         { return "docx" }
+func (docxExtractor) Extensions() []string { return []string{".docx"} }
+func (docxExtractor) SupportedMIMETypes() []string {
+	return []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"}
+}
+
+func (docxExtractor) Detect(data []byte) bool {
+	return zipHasFile(data, "word/document.xml")
+}
+
+func (docxExtractor) Extract(data []byte, opts ExtractOptions) (*ExtractResult, error) {
+	pages, err := extractDOCXText(data)
+	if err != nil {
+		return nil, err
+	}
+	result := &ExtractResult{Pages: pages}
+	if opts.Structure {
+		result.Blocks = extractDOCXBlocks(data)
+	}
+	return result, nil
+}
+
+// ODT - ZIP archive with content.xml and an OpenDocument text mimetype
+type odtExtractor struct{}
+
+func (odtExtractor) Name() string         { return "odt" }
+func (odtExtractor) Extensions() []string { return []string{".odt"} }
+func (odtExtractor) SupportedMIMETypes() []string {
+	return []string{"application/vnd.oasis.opendocument.text"}
+}
+
+func (odtExtractor) Detect(data []byte) bool {
+	if !zipHasFile(data, "content.xml") {
+		return false
+	}
+	// The mimetype entry distinguishes text documents from spreadsheets/presentations
+	mimetype := zipFileContent(data, "mimetype")
+	return mimetype == nil || strings.TrimSpace(string(mimetype)) == "application/vnd.oasis.opendocument.text"
+}
+
+func (odtExtractor) Extract(data []byte, opts ExtractOptions) (*ExtractResult, error) {
+	pages, err := extractODTText(data)
+	if err != nil {
+		return nil, err
+	}
+	result := &ExtractResult{Pages: pages}
+	if opts.Structure {
+		result.Blocks = extractODTBlocks(data)
+	}
+	return result, nil
+}
+
+// FormatInfo - descrierea unui format suportat pentru /formats
+type FormatInfo struct {
+	Name       string   `json:"name"`
+	Extensions []string `json:"extensions"`
+	MIMETypes  []string `json:"mime_types"`
+}
+
+func supportedFormats() []FormatInfo {
+	var formats []FormatInfo
+	for _, e := range extractors.All() {
+		formats = append(formats, FormatInfo{
+			Name:       e.Name(),
+			Extensions: e.Extensions(),
+			MIMETypes:  e.SupportedMIMETypes(),
+		})
+	}
+	return formats
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+// testZip builds a ZIP archive with the given entries, in order
+func testZip(t *testing.T, entries ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := zw.Create(entry[0])
+		if err != nil {
+			t.Fatalf("failed to add %s: %v", entry[0], err)
+		}
+		w.Write([]byte(entry[1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to build zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractorRegistryDetectByContent(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string // "" when no extractor matches
+	}{
+		{"pdf", []byte("%PDF-1.7\n..."), "pdf"},
+		{"doc", []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, "doc"},
+		{"short ole header", []byte{0xD0, 0xCF, 0x11, 0xE0}, ""},
+		{"docx", testZip(t, [2]string{"word/document.xml", "<w:document/>"}), "docx"},
+		{"odt", testZip(t,
+			[2]string{"mimetype", "application/vnd.oasis.opendocument.text"},
+			[2]string{"content.xml", "<office:document-content/>"}), "odt"},
+		{"odt without mimetype", testZip(t, [2]string{"content.xml", "<office:document-content/>"}), "odt"},
+		{"ods spreadsheet", testZip(t,
+			[2]string{"mimetype", "application/vnd.oasis.opendocument.spreadsheet"},
+			[2]string{"content.xml", "<office:document-content/>"}), ""},
+		{"unknown zip", testZip(t, [2]string{"readme.txt", "hello"}), ""},
+		{"broken zip", []byte("PK\x03\x04 not really"), ""},
+		{"plain text", []byte("hello world"), ""},
+		{"empty", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, ok := extractors.DetectByContent(tt.data)
+			got := ""
+			if ok {
+				got = e.Name()
+			}
+			if got != tt.want {
+				t.Errorf("DetectByContent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractorRegistryDetectByNameAndMIMEType(t *testing.T) {
+	tests := []struct {
+		filename    string
+		contentType string
+		want        string
+	}{
+		{"Report.PDF", "application/pdf", "pdf"},
+		{"notes.doc", "application/msword", "doc"},
+		{"notes.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", "docx"},
+		{"eseu.odt", "application/vnd.oasis.opendocument.text; charset=binary", "odt"},
+		{"archive.zip", "application/zip", ""},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			byName, byMIME := "", ""
+			if e, ok := extractors.DetectByName(tt.filename); ok {
+				byName = e.Name()
+			}
+			if e, ok := extractors.DetectByMIMEType(tt.contentType); ok {
+				byMIME = e.Name()
+			}
+			if byName != tt.want || byMIME != tt.want {
+				t.Errorf("DetectByName = %q, DetectByMIMEType = %q, want %q", byName, byMIME, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractorRegistryRegisterReplaces(t *testing.T) {
+	r := NewExtractorRegistry()
+	r.Register(pdfExtractor{})
+	r.Register(docxExtractor{})
+	r.Register(pdfExtractor{})
+
+	names := r.Names()
+	if len(names) != 2 || names[0] != "pdf" || names[1] != "docx" {
+		t.Errorf("Names = %v, want [pdf docx]", names)
+	}
+	if _, ok := r.Lookup("odt"); ok {
+		t.Error("Lookup found an unregistered extractor")
+	}
+}
+
+func TestExtractDocumentUnknownType(t *testing.T) {
+	if _, err := extractDocument([]byte("x"), "rtf", ExtractOptions{}); err == nil {
+		t.Error("extractDocument accepted an unsupported type")
+	}
+}
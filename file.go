@@ -1,8 +1,6 @@
 package main
 
 import (
-	"archive/zip"
-	"bytes"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -20,7 +18,36 @@ func handleExtractJSON(c *fiber.Ctx) error {
 		})
 	}
 
-	pages, err := extractTextPages(fileData, fileType)
+	// Output format: text (pages only), markdown or tree
+	format := strings.ToLower(c.FormValue("format", c.Query("format", "text")))
+	if format != "text" && format != "markdown" && format != "tree" {
+		return c.Status(fiber.StatusBadRequest).JSON(ExtractResponse{
+			Success: false,
+			Error:   "format must be one of: text, markdown, tree",
+		})
+	}
+
+	layoutMode, err := parseLayoutMode(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ExtractResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+	if layoutMode != "" && fileType != "pdf" {
+		return c.Status(fiber.StatusBadRequest).JSON(ExtractResponse{
+			Success: false,
+			Error:   "layout is only available for PDF files",
+		})
+	}
+
+	opts := ExtractOptions{
+		Filename:  filename,
+		Structure: format != "text",
+		Layout:    layoutMode != "",
+	}
+
+	result, err := extractDocument(fileData, fileType, opts)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(ExtractResponse{
 			Success: false,
@@ -28,13 +55,34 @@ func handleExtractJSON(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(ExtractResponse{
+	response := ExtractResponse{
 		Success:  true,
 		FileType: fileType,
 		Filename: filename,
-		NumPages: len(pages),
-		Pages:    pages,
-	})
+		NumPages: len(result.Pages),
+		Pages:    result.Pages,
+		Timing:   result.Stats,
+		Quality:  result.Quality,
+	}
+
+	switch layoutMode {
+	case "words":
+		response.Layout = result.Layout
+	case "lines":
+		response.Layout = withoutWords(result.Layout)
+	}
+
+	switch format {
+	case "markdown":
+		response.Format = format
+		response.Markdown = renderMarkdown(result.Blocks)
+	case "tree":
+		// Text holds the plain text that the tree's character offsets refer to
+		response.Format = format
+		response.Tree, response.Text = buildDocumentTree(result.Blocks)
+	}
+
+	return c.JSON(response)
 }
 
 func getFileFromRequest(c *fiber.Ctx) ([]byte, string, string, error) {
@@ -65,8 +113,13 @@ func getFileFromRequest(c *fiber.Ctx) ([]byte, string, string, error) {
 		filename = originalName
 	}
 
-	// Detect file type from content
+	// Detect file type from content, then from the declared Content-Type
 	fileType := detectFileType(data)
+	if fileType == "unknown" {
+		if e, ok := extractors.DetectByMIMEType(c.Get("Content-Type")); ok {
+			fileType = e.Name()
+		}
+	}
 	return data, fileType, filename, nil
 }
 
@@ -92,18 +145,8 @@ func readMultipartFile(fh *multipart.FileHeader) ([]byte, string, error) {
 }
 
 func detectFileTypeFromName(filename string) string {
-	filename = strings.ToLower(filename)
-	if strings.HasSuffix(filename, ".pdf") {
-		return "pdf"
-	}
-	if strings.HasSuffix(filename, ".odt") {
-		return "odt"
-	}
-	if strings.HasSuffix(filename, ".doc") {
-		return "doc"
-	}
-	if strings.HasSuffix(filename, ".docx") {
-		return "docx"
+	if e, ok := extractors.DetectByName(filename); ok {
+		return e.Name()
 	}
 	return "unknown"
 }
@@ -112,53 +155,41 @@ func detectFileType(data []byte) string {
 	if len(data) < 4 {
 		return "unknown"
 	}
-
-	// Legacy MS Word .doc (OLE Compound File Binary Format) starts with D0 CF 11 E0
-	if len(data) >= 8 && bytes.HasPrefix(data, []byte{0xD0, 0xCF, 0x11, 0xE0}) {
-		return "doc"
-	}
-
-	if bytes.HasPrefix(data, []byte("%PDF")) {
-		return "pdf"
-	}
-
-	// Both DOCX and ODT are ZIP files starting with "PK"
-	if bytes.HasPrefix(data, []byte("PK")) {
-		// Try to distinguish between DOCX and ODT by checking ZIP contents
-		r := bytes.NewReader(data)
-		zr, err := zip.NewReader(r, int64(len(data)))
-		if err != nil {
-			return "unknown"
-		}
-
-		// Check for DOCX structure (word/document.xml)
-		for _, f := range zr.File {
-			if f.Name == "word/document.xml" || f.Name == "[Content_Types].xml" {
-				return "docx"
-			}
-			if f.Name == "content.xml" || f.Name == "META-INF/manifest.xml" {
-				return "odt"
-			}
-		}
-
-		// Default to docx for unknown ZIP files
-		return "docx"
+	if e, ok := extractors.DetectByContent(data); ok {
+		return e.Name()
 	}
-
 	return "unknown"
 }
 
 func extractTextPages(data []byte, fileType string) ([]string, error) {
-	switch fileType {
-	case "pdf":
-		return extractPDFText(data)
-	case "odt":
-		return extractODTText(data)
-	case "doc":
-		return extractDOCText(data)
-	case "docx":
-		return extractDOCXText(data)
+	result, err := extractDocument(data, fileType, ExtractOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return result.Pages, nil
+}
+
+// parseLayoutMode reads the layout option: "words" (or "true"), "lines", or empty for none
+func parseLayoutMode(c *fiber.Ctx) (string, error) {
+	mode := strings.ToLower(c.FormValue("layout", c.Query("layout")))
+	switch mode {
+	case "", "false", "0", "none":
+		return "", nil
+	case "true", "1", "words":
+		return "words", nil
+	case "lines":
+		return "lines", nil
 	default:
-		return nil, fmt.Errorf("unsupported file type: %s (supported: pdf, odt, doc, docx)", fileType)
+		return "", fmt.Errorf("layout must be one of: words, lines")
 	}
 }
+
+// Handler: list the formats supported by the running server
+func handleListFormats(c *fiber.Ctx) error {
+	formats := supportedFormats()
+	return c.JSON(fiber.Map{
+		"success": true,
+		"formats": formats,
+		"total":   len(formats),
+	})
+}
@@ -1,27 +1,35 @@
 package main
 
 import (
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 // New handler: Extract and store in Qdrant
-func handleExtractAndStore(c *fiber.Ctx) error {
-	username := c.FormValue("username", "anon1")
-
-	grade := c.FormValue("grade", "1")
-	paragraphGrade := 1
-	if grade != "1" {
-		if g, err := strconv.Atoi(grade); err == nil && g >= 2 && g <= 10 {
-			paragraphGrade = g
-		}
-	}
+// IngestRequest is a parsed /extract/store request; jobs persist it as JSON
+// (the file is stored next to it, see jobs.go)
+type IngestRequest struct {
+	Username       string                 `json:"username"`
+	ParagraphGrade int                    `json:"grade"`
+	ChunkOpts      ChunkOptions           `json:"chunking"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	EnrichMode     string                 `json:"enrich,omitempty"`
+	LayoutMode     string                 `json:"layout,omitempty"`
+	FileType       string                 `json:"file_type"`
+	Filename       string                 `json:"filename"`
+	CallbackURL    string                 `json:"callback_url,omitempty"` // notified when an async job finishes (see webhooks.go)
+	FileData       []byte                 `json:"-"`
+}
 
-	fileData, fileType, filename, err := getFileFromRequest(c)
+func handleExtractAndStore(c *fiber.Ctx) error {
+	req, err := parseIngestRequest(c)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(ExtractResponse{
 			Success: false,
@@ -29,38 +37,234 @@ func handleExtractAndStore(c *fiber.Ctx) error {
 		})
 	}
 
-	pages, err := extractTextPages(fileData, fileType)
-	if err != nil {
+	// async=true: queue the document and return the job right away (see jobs.go)
+	if async := c.FormValue("async", c.Query("async")); async == "true" || async == "1" {
+		job, err := ingestJobs.Submit(req)
+		if err != nil {
+			status := fiber.StatusInternalServerError
+			if errors.Is(err, errJobQueueFull) || errors.Is(err, errJobsStopped) {
+				status = fiber.StatusServiceUnavailable
+			}
+			return c.Status(status).JSON(fiber.Map{"success": false, "error": err.Error()})
+		}
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"success":    true,
+			"job_id":     job.ID,
+			"status":     job.Status,
+			"status_url": "/jobs/" + job.ID,
+		})
+	}
+
+	resp, err := ingestDocument(req, nil)
+	if err != nil && resp == nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(ExtractResponse{
 			Success: false,
-			Error:   "Failed to extract text: " + err.Error(),
+			Error:   err.Error(),
 		})
 	}
+	if err != nil {
+		// Extracted but not stored: still a 200 with the pages, the callback reports the failure
+		c.Locals(callbackFailureLocal, err)
+	}
+	return c.JSON(resp)
+}
+
+func parseIngestRequest(c *fiber.Ctx) (*IngestRequest, error) {
+	req := &IngestRequest{
+		Username:       c.FormValue("username", "anon1"),
+		ParagraphGrade: 1,
+		CallbackURL:    c.FormValue("callback_url", c.Query("callback_url")),
+	}
+
+	grade := c.FormValue("grade", "1")
+	if grade != "1" {
+		if g, err := strconv.Atoi(grade); err == nil && g >= 2 && g <= 10 {
+			req.ParagraphGrade = g
+		}
+	}
+
+	var err error
+	// Chunking strategy (see chunking.go)
+	if req.ChunkOpts, err = parseChunkOptions(c.FormValue); err != nil {
+		return nil, err
+	}
+	// Optional user metadata, indexed for search filters (see metadata.go)
+	if req.Metadata, err = parseMetadata(c.FormValue("metadata")); err != nil {
+		return nil, err
+	}
+	// Optional context header embedded with every chunk (see enrich.go)
+	if req.EnrichMode, err = parseEnrichMode(c.FormValue); err != nil {
+		return nil, err
+	}
+	if req.FileData, req.FileType, req.Filename, err = getFileFromRequest(c); err != nil {
+		return nil, err
+	}
+	// Optional bounding boxes, stored in the payload so hits map back to the page
+	if req.LayoutMode, err = parseLayoutMode(c); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// ingestDocument extracts, chunks, embeds and stores a document. The error is
+// returned without a response when nothing was stored; when only the store
+// failed, the response has StoredInQdrant false and the error wraps errStoreFailed.
+func ingestDocument(req *IngestRequest, progress ingestProgress) (*ExtractResponse, error) {
+	username, paragraphGrade, chunkOpts, metadata, enrichMode, layoutMode :=
+		req.Username, req.ParagraphGrade, req.ChunkOpts, req.Metadata, req.EnrichMode, req.LayoutMode
+	fileData, fileType, filename := req.FileData, req.FileType, req.Filename
+
+	withLayout := layoutMode != "" && fileType == "pdf"
+	// Recursive chunking of PDFs finds headings and paragraphs in the layout
+	structureFromPDF := chunkOpts.Strategy == ChunkRecursive && fileType == "pdf"
+
+	// Headings give the section paths (enrich) and the sections of the document
+	// summary; PDFs pay for them only when the layout is extracted anyway
+	withStructure := enrichMode != EnrichNone ||
+		(docSummaryMode() != "" && (fileType != "pdf" || withLayout || structureFromPDF))
+
+	progress.report(JobStageExtracting, 0, 0)
+	extracted, err := extractDocument(fileData, fileType, ExtractOptions{
+		Filename:  filename,
+		Layout:    withLayout || structureFromPDF,
+		Structure: withStructure,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to extract text: %v", err)
+	}
+	pages := extracted.Pages
+	progress.report(JobStageChunking, len(pages), len(pages))
+	withLayout = withLayout && len(extracted.Layout) == len(pages)
 
-	// Split pages into paragraphs if grade > 1
 	var finalContent []string
-	if paragraphGrade > 1 && fileType == "pdf" {
-		finalContent = splitPagesIntoParagraphs(pages, paragraphGrade)
+	var chunks []StoreChunk
+	chunking := "" // page chunking keeps the payload of earlier versions
+
+	if chunkOpts.Strategy == ChunkPage {
+		// Split pages into paragraphs if grade > 1
+		if paragraphGrade > 1 && fileType == "pdf" {
+			finalContent = splitPagesIntoParagraphs(pages, paragraphGrade)
+		} else {
+			finalContent = pages
+		}
+
+		var layouts []*ChunkLayout
+		if withLayout {
+			layouts = chunkLayoutsForContent(finalContent, pages, extracted.Layout, paragraphGrade > 1)
+		}
+		chunks = pageStoreChunks(finalContent, layouts)
 	} else {
-		finalContent = pages
+		tokenizer, err := tokenizerForEmbedder(qdrant.Embedder.Name())
+		if err != nil {
+			return nil, err
+		}
+		var structureLayouts []PageLayout
+		if structureFromPDF {
+			structureLayouts = extracted.Layout
+		}
+		textChunks, parents, err := chunkPages(pages, structureLayouts, chunkOpts, tokenizer, qdrant.Embedder)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to chunk text: %v", err)
+		}
+
+		chunking = chunkOpts.String()
+		anchored := make(map[int]bool) // parents whose text is already on a chunk
+		for _, tc := range textChunks {
+			page := pages[tc.Page-1]
+			start := utf8.RuneCountInString(page[:tc.Start])
+			end := start + utf8.RuneCountInString(tc.Text)
+			chunk := StoreChunk{Text: tc.Text, PageNum: tc.Page, Tokens: tc.Tokens, Start: start, End: end}
+			if withLayout {
+				chunk.Layout = chunkLayoutAt(extracted.Layout[tc.Page-1], start, end, 0)
+			}
+			if tc.Parent >= 0 {
+				chunk.Parent = tc.Parent + 1
+				if !anchored[tc.Parent] {
+					anchored[tc.Parent] = true
+					chunk.ParentText = parents[tc.Parent].Text
+					chunk.ParentTokens = parents[tc.Parent].Tokens
+				}
+			}
+			chunks = append(chunks, chunk)
+			finalContent = append(finalContent, tc.Text)
+		}
+		fmt.Printf("✂️ Chunked %d pages into %d chunks, %d parents (%s, %s)\n", len(pages), len(chunks), len(parents), chunking, tokenizer.Name())
 	}
 
+	if layoutMode == "lines" {
+		for _, chunk := range chunks {
+			if chunk.Layout != nil {
+				for i := range chunk.Layout.Lines {
+					chunk.Layout.Lines[i].Words = nil
+				}
+			}
+		}
+	}
+
+	// Paragraph splits (grade > 1) are not pages, so they get no section
+	var enricher *chunkEnricher
+	if enrichMode != EnrichNone {
+		if chunkOpts.Strategy != ChunkPage || paragraphGrade == 1 || fileType != "pdf" {
+			sections := newSectionIndex(pages, extracted.Blocks)
+			for i := range chunks {
+				chunks[i].Section = strings.Join(sections.PathAt(chunks[i].PageNum, chunks[i].Start), " > ")
+			}
+		}
+		enricher, err = newChunkEnricher(enrichMode, documentTitle(metadata, extracted.Blocks, filename), pages)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Fingerprint of the file: re-uploads are no-ops, changed files replace the old version
+	docHash := fmt.Sprintf("%x", sha256.Sum256(fileData))
+
 	// Store in Qdrant using the actual filename
 	storedInQdrant := false
-	if err := storePagesInQdrant(username, finalContent, filename); err != nil {
-		fmt.Printf("⚠️ Failed to store in Qdrant: %v\n", err)
+	storeStatus, storeErr := storePagesInQdrant(username, chunks, filename, docHash, chunking, metadata, enricher, progress)
+	if storeErr != nil {
+		fmt.Printf("⚠️ Failed to store in Qdrant: %v\n", storeErr)
+		storeErr = fmt.Errorf("%w: %v", errStoreFailed, storeErr)
 	} else {
 		storedInQdrant = true
 	}
 
-	return c.JSON(ExtractResponse{
+	// The PDF itself, so /render can show pages of the stored document (see originals.go)
+	if storedInQdrant && fileType == "pdf" {
+		if err := originals.Save(username, docHash, fileData); err != nil {
+			fmt.Printf("⚠️ Failed to keep the original of '%s': %v\n", filename, err)
+		}
+	}
+	if storeStatus == StoreReplaced {
+		originals.Prune(username)
+	}
+
+	// Document-level point for routing; a failure only affects routing
+	docSummary := ""
+	if storedInQdrant {
+		progress.report(JobStageSummarizing, len(chunks), len(chunks))
+		docSummary, err = updateDocumentSummary(username, filename, docHash, pages, extracted.Blocks, metadata)
+		if err != nil {
+			fmt.Printf("⚠️ Failed to store the document summary: %v\n", err)
+		}
+	}
+
+	return &ExtractResponse{
 		Success:        true,
 		FileType:       fileType,
 		Filename:       filename,
 		NumPages:       len(finalContent),
 		Pages:          finalContent,
 		StoredInQdrant: storedInQdrant,
-	})
+		StoreStatus:    storeStatus,
+		DocHash:        docHash,
+		Chunking:       chunkOpts.String(),
+		Metadata:       metadata,
+		Enrich:         enrichMode,
+		DocSummary:     docSummary,
+		Timing:         extracted.Stats,
+		Quality:        extracted.Quality,
+	}, storeErr
 }
 
 type SearchPageInQdrant struct {
@@ -68,6 +272,43 @@ type SearchPageInQdrant struct {
 	Query    string `json:"query"`
 	DocName  string `json:"doc_name,omitempty"` // Optional: filter by document name
 	Limit    int    `json:"limit,omitempty"`
+
+	Filter *SearchFilter `json:"filter,omitempty"` // metadata / page / doc filters (see metadata.go)
+
+	// RRF fusion: a weight of 0 disables that retriever (defaults 1, 1, k=60,
+	// the same k whether Qdrant or rrfFuse does the fusion)
+	KeywordWeight *float64 `json:"keyword_weight,omitempty"`
+	VectorWeight  *float64 `json:"vector_weight,omitempty"`
+	RRFK          int      `json:"rrf_k,omitempty"`
+
+	Rerank string `json:"rerank,omitempty"` // none | llm | cross-encoder (default RERANKER)
+
+	Snippets         *int  `json:"snippets,omitempty"`          // highlighted passages per result (default SEARCH_SNIPPETS)
+	SemanticSnippets *bool `json:"semantic_snippets,omitempty"` // also pick the sentence closest to the query embedding (default SEARCH_SEMANTIC_SNIPPETS, on)
+	IncludeText      *bool `json:"include_text,omitempty"`      // false drops the full text from the results
+
+	RouteDocs *int `json:"route_docs,omitempty"` // documents searched after routing, 0 disables (see docroute.go)
+}
+
+// searchWeights applies the request overrides to the defaults
+func (req SearchPageInQdrant) searchWeights() (SearchWeights, error) {
+	weights := defaultSearchWeights()
+	if req.KeywordWeight != nil {
+		weights.Keyword = *req.KeywordWeight
+	}
+	if req.VectorWeight != nil {
+		weights.Vector = *req.VectorWeight
+	}
+	if req.RRFK > 0 {
+		weights.RRFK = req.RRFK
+	}
+	if weights.Keyword < 0 || weights.Vector < 0 {
+		return weights, fmt.Errorf("weights must not be negative")
+	}
+	if weights.Keyword == 0 && weights.Vector == 0 {
+		return weights, fmt.Errorf("at least one of keyword_weight and vector_weight must be positive")
+	}
+	return weights, nil
 }
 
 // New handler: Search pages by username and similarity
@@ -95,7 +336,39 @@ func handleSearchPages(c *fiber.Ctx) error {
 		req.Limit = 5 // Default limit
 	}
 
-	results, err := searchPagesHybrid(req.Username, req.Query, req.DocName, req.Limit)
+	weights, err := req.searchWeights()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ParagraphSearchResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	reranker, err := rerankerByName(req.Rerank)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ParagraphSearchResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	scope, route, err := routedSearchScope(req.Username, req.DocName, req.Filter, req.Query, req.RouteDocs)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ParagraphSearchResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	snippets, err := snippetCount(req.Snippets)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ParagraphSearchResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	results, rerankErr, err := searchAndRerank(scope, req.Query, req.Query, req.Limit, weights, reranker)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(ParagraphSearchResponse{
 			Success: false,
@@ -103,12 +376,23 @@ func handleSearchPages(c *fiber.Ctx) error {
 		})
 	}
 
+	addSnippets(results, req.Query, snippets, weights.Vector > 0 && semanticSnippets(req.SemanticSnippets))
+	if req.IncludeText != nil && !*req.IncludeText {
+		for i := range results {
+			results[i].Payload.Text = ""
+		}
+	}
+
 	return c.JSON(ParagraphSearchResponse{
 		Success:    true,
 		Results:    results,
 		Query:      req.Query,
 		Username:   req.Username,
 		TotalFound: len(results),
+		Weights:    &weights,
+		Reranker:   rerankerName(reranker),
+		RerankErr:  rerankErr,
+		Route:      route,
 	})
 }
 
@@ -178,6 +462,9 @@ func splitPagesIntoParagraphs(pages []string, grade int) []string {
 			if end > textLength {
 				end = textLength
 			}
+			// Never cut a multi-byte character in half
+			start = runeStart(cleanText, start)
+			end = runeStart(cleanText, end)
 
 			paragraphText := cleanText[start:end]
 
@@ -203,10 +490,18 @@ func splitPagesIntoParagraphs(pages []string, grade int) []string {
 
 func handleAnswerQuestion(c *fiber.Ctx) error {
 	var req struct {
-		Username string `json:"username"`
-		Question string `json:"question"`
-		DocName  string `json:"doc_name,omitempty"`
-		Limit    int    `json:"limit,omitempty"`
+		Username string        `json:"username"`
+		Question string        `json:"question"`
+		DocName  string        `json:"doc_name,omitempty"`
+		Limit    int           `json:"limit,omitempty"`
+		Rerank   string        `json:"rerank,omitempty"`
+		Filter   *SearchFilter `json:"filter,omitempty"`
+
+		// Context for the model: chunks, parent or window (see context.go)
+		Context       string `json:"context,omitempty"`
+		ContextWindow *int   `json:"context_window,omitempty"`
+
+		RouteDocs *int `json:"route_docs,omitempty"` // see docroute.go
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -227,6 +522,30 @@ func handleAnswerQuestion(c *fiber.Ctx) error {
 		req.Limit = 5
 	}
 
+	reranker, err := rerankerByName(req.Rerank)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	scope, route, err := routedSearchScope(req.Username, req.DocName, req.Filter, req.Question, req.RouteDocs)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	contextMode, contextWindow, err := contextOptions(req.Context, req.ContextWindow)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
 	keywordsResult, err := extractKeywords(req.Question)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -235,7 +554,7 @@ func handleAnswerQuestion(c *fiber.Ctx) error {
 		})
 	}
 
-	searchResults, err := searchPagesHybrid(req.Username, req.Question, req.DocName, req.Limit)
+	searchResults, rerankErr, err := searchAndRerank(scope, req.Question, req.Question, req.Limit, defaultSearchWeights(), reranker)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -243,20 +562,18 @@ func handleAnswerQuestion(c *fiber.Ctx) error {
 		})
 	}
 
-	var contextText strings.Builder
-	for i, result := range searchResults {
-		contextText.WriteString(fmt.Sprintf("Document %d (Score: %.3f):\n%s\n\n",
-			i+1, result.Score, result.Payload.Text))
-	}
+	// Small-to-big: the matched chunks are expanded to their parents or page windows
+	contextBlocks := buildAnswerContext(req.Username, scope, searchResults, contextMode, contextWindow)
+	contextText := formatAnswerContext(contextBlocks)
 
-	if contextText.Len() == 0 {
+	if len(contextBlocks) == 0 {
 		return c.JSON(fiber.Map{
 			"success": true,
 			"answer":  "Nu am găsit informații relevante pentru întrebarea ta în documentele încărcate.",
 		})
 	}
 
-	answerResult, err := answerFromVectorDB(req.Question, keywordsResult.Language, contextText.String())
+	answerResult, err := answerFromVectorDB(req.Question, keywordsResult.Language, contextText)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -264,14 +581,24 @@ func handleAnswerQuestion(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(fiber.Map{
+	response := fiber.Map{
 		"success":        true,
 		"answer":         answerResult.Answer,
 		"foundAnswer":    answerResult.FoundAnswer,
 		"language":       keywordsResult.Language,
 		"sources_found":  len(searchResults),
 		"search_results": searchResults,
-	})
+		"reranker":       rerankerName(reranker),
+		"context_mode":   contextMode,
+		"context_blocks": contextBlocks,
+	}
+	if rerankErr != "" {
+		response["rerank_error"] = rerankErr
+	}
+	if route != nil {
+		response["route"] = route
+	}
+	return c.JSON(response)
 }
 
 func handleExtractKeywords(c *fiber.Ctx) error {
@@ -311,10 +638,18 @@ func handleExtractKeywords(c *fiber.Ctx) error {
 // Handler: Smart search - Extract keywords with AI, search in Qdrant, and return AI answer
 func handleSmartSearch(c *fiber.Ctx) error {
 	var req struct {
-		Username string `json:"username"`
-		Query    string `json:"query"`
-		DocName  string `json:"doc_name,omitempty"`
-		Limit    int    `json:"limit,omitempty"`
+		Username string        `json:"username"`
+		Query    string        `json:"query"`
+		DocName  string        `json:"doc_name,omitempty"`
+		Limit    int           `json:"limit,omitempty"`
+		Rerank   string        `json:"rerank,omitempty"`
+		Filter   *SearchFilter `json:"filter,omitempty"`
+
+		// Context for the model: chunks, parent or window (see context.go)
+		Context       string `json:"context,omitempty"`
+		ContextWindow *int   `json:"context_window,omitempty"`
+
+		RouteDocs *int `json:"route_docs,omitempty"` // see docroute.go
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -336,6 +671,30 @@ func handleSmartSearch(c *fiber.Ctx) error {
 		req.Limit = 5
 	}
 
+	reranker, err := rerankerByName(req.Rerank)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	scope, route, err := routedSearchScope(req.Username, req.DocName, req.Filter, req.Query, req.RouteDocs)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	contextMode, contextWindow, err := contextOptions(req.Context, req.ContextWindow)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
 	// Step 1: Extract keywords using AI
 	keywordsResult, err := extractKeywords(req.Query)
 	if err != nil {
@@ -352,7 +711,8 @@ func handleSmartSearch(c *fiber.Ctx) error {
 		enhancedQuery = req.Query + " " + keywordsResult.Query
 	}
 
-	searchResults, err := searchPagesHybrid(req.Username, enhancedQuery, req.DocName, req.Limit)
+	// Retrieve with the keywords, rerank against the original question
+	searchResults, rerankErr, err := searchAndRerank(scope, enhancedQuery, req.Query, req.Limit, defaultSearchWeights(), reranker)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -360,14 +720,11 @@ func handleSmartSearch(c *fiber.Ctx) error {
 		})
 	}
 
-	// Step 3: Convert search results to text for AI processing
-	var contextText strings.Builder
-	for i, result := range searchResults {
-		contextText.WriteString(fmt.Sprintf("Document %d (Score: %.3f):\n%s\n\n",
-			i+1, result.Score, result.Payload.Text))
-	}
+	// Step 3: Expand the results (parents / page windows) into the context for AI processing
+	contextBlocks := buildAnswerContext(req.Username, scope, searchResults, contextMode, contextWindow)
+	contextText := formatAnswerContext(contextBlocks)
 
-	if contextText.Len() == 0 {
+	if len(contextBlocks) == 0 {
 		return c.JSON(fiber.Map{
 			"success":            true,
 			"answer":             "Nu am găsit informații relevante pentru întrebarea ta în documentele încărcate.",
@@ -377,7 +734,7 @@ func handleSmartSearch(c *fiber.Ctx) error {
 		})
 	}
 
-	answerResult, err := answerFromVectorDB(req.Query, keywordsResult.Language, contextText.String())
+	answerResult, err := answerFromVectorDB(req.Query, keywordsResult.Language, contextText)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -385,7 +742,7 @@ func handleSmartSearch(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(fiber.Map{
+	response := fiber.Map{
 		"success":            true,
 		"answer":             answerResult.Answer,
 		"foundAnswer":        answerResult.FoundAnswer,
@@ -394,7 +751,17 @@ func handleSmartSearch(c *fiber.Ctx) error {
 		"enhanced_query":     enhancedQuery,
 		"sources_found":      len(searchResults),
 		"search_results":     searchResults,
-	})
+		"reranker":           rerankerName(reranker),
+		"context_mode":       contextMode,
+		"context_blocks":     contextBlocks,
+	}
+	if rerankErr != "" {
+		response["rerank_error"] = rerankErr
+	}
+	if route != nil {
+		response["route"] = route
+	}
+	return c.JSON(response)
 }
 
 // Handler for generating PDF summary
@@ -0,0 +1,592 @@
+package main
+
+/*
+JOBURI DE INGESTIE (POST /extract/store cu async=true)
+
+Cererea este validată imediat (aceleași câmpuri ca varianta sincronă), apoi
+documentul intră într-o coadă și răspunsul 202 conține job_id. Un pool de
+JOB_WORKERS (implicit 2) procesează coada de JOB_QUEUE_SIZE (implicit 100)
+joburi; cu coada plină răspunsul este 503.
+
+GET /jobs/:id întoarce starea jobului:
+  - status   queued | running | retrying | succeeded | failed
+  - stage    extracting | chunking | embedding | upserting | summarizing
+  - done / total  pagini extrase (chunking), apoi chunk-uri trimise la
+                  embedding și salvate (embedding, upserting)
+  - attempts, errors (o eroare pentru fiecare încercare eșuată)
+  - result   răspunsul /extract/store, fără textul paginilor
+
+Cu callback_url, evenimentul ingestion.succeeded / ingestion.failed (cu starea
+jobului) este trimis când jobul se termină (vezi webhooks.go).
+
+Erorile de salvare (embedding, Qdrant) sunt reîncercate de cel mult
+JOB_MAX_ATTEMPTS ori (implicit 3), după JOB_RETRY_BASE_SECONDS * 2^n secunde
+(implicit 5); un fișier care nu poate fi extras eșuează imediat. Bucățile deja
+salvate de o încercare eșuată sunt șterse (storePagesInQdrant), deci un job
+eșuat nu lasă jumătăți de document în căutare.
+
+Joburile și fișierele lor sunt salvate în JOBS_DB_PATH (bbolt, implicit
+jobs.db; "off" = doar în memorie). La pornire joburile neterminate sunt reluate
+de la început; re-încărcarea este idempotentă (ID-uri deterministe, vezi
+storePagesInQdrant). Fișierul este șters când jobul se termină, iar jobul
+după JOB_RETENTION_HOURS (implicit 24).
+
+La oprire nu se mai acceptă joburi (503), workerii termină jobul curent (cel
+mult JOB_SHUTDOWN_TIMEOUT_SECONDS, implicit 30) și abia apoi se închide baza;
+joburile rămase în coadă sunt reluate la următoarea pornire.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobRetrying  = "retrying"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+
+	JobStageExtracting  = "extracting"
+	JobStageChunking    = "chunking"
+	JobStageEmbedding   = "embedding"
+	JobStageUpserting   = "upserting"
+	JobStageSummarizing = "summarizing"
+
+	defaultJobsDBPath       = "jobs.db"
+	defaultJobWorkers       = 2
+	defaultJobQueueSize     = 100
+	defaultJobMaxAttempts   = 3
+	defaultJobRetryBaseSecs = 5
+	defaultJobRetentionHrs  = 24
+	defaultJobShutdownSecs  = 30
+	maxJobRetryDelay        = 10 * time.Minute
+)
+
+var (
+	jobsBucket    = []byte("jobs")    // id -> IngestJob JSON
+	uploadsBucket = []byte("uploads") // id -> file bytes, until the job finishes
+
+	errJobQueueFull = errors.New("ingestion queue is full, try again later")
+	errJobsStopped  = errors.New("the server is shutting down, try again later")
+	// errStoreFailed - the document was extracted but not stored (worth a retry)
+	errStoreFailed = errors.New("failed to store the document")
+)
+
+// ingestProgress receives the stage of an ingestion and the items done (nil: not tracked)
+type ingestProgress func(stage string, done, total int)
+
+func (p ingestProgress) report(stage string, done, total int) {
+	if p != nil {
+		p(stage, done, total)
+	}
+}
+
+// IngestJob is the state returned by GET /jobs/:id
+type IngestJob struct {
+	ID            string           `json:"id"`
+	Status        string           `json:"status"`
+	Stage         string           `json:"stage,omitempty"`
+	Done          int              `json:"done"`
+	Total         int              `json:"total"`
+	Attempts      int              `json:"attempts"`
+	MaxAttempts   int              `json:"max_attempts"`
+	Errors        []string         `json:"errors,omitempty"`
+	Request       IngestRequest    `json:"request"`
+	Result        *ExtractResponse `json:"result,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+	NextAttemptAt *time.Time       `json:"next_attempt_at,omitempty"`
+	FinishedAt    *time.Time       `json:"finished_at,omitempty"`
+}
+
+func (j *IngestJob) finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
+
+// JobManager queues ingestion jobs and runs them on a fixed pool of workers
+type JobManager struct {
+	db          *bolt.DB // nil: jobs are kept in memory only
+	queue       chan string
+	workers     int
+	maxAttempts int
+	retryBase   time.Duration
+	retention   time.Duration
+	shutdown    time.Duration // how long Close waits for the running jobs
+
+	stopping  chan struct{} // closed by Close: no new jobs, workers exit
+	stopOnce  sync.Once
+	workersWG sync.WaitGroup
+
+	mu    sync.Mutex
+	jobs  map[string]*IngestJob
+	files map[string][]byte // uploads when db is nil
+}
+
+// ingestJobs is configured in main() after the collections are ready
+var ingestJobs *JobManager
+
+func newJobManagerFromEnv() (*JobManager, error) {
+	// An unbuffered queue would reject every submission, a negative size panics
+	queueSize := envInt("JOB_QUEUE_SIZE", defaultJobQueueSize)
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	m := &JobManager{
+		queue:       make(chan string, queueSize),
+		workers:     envInt("JOB_WORKERS", defaultJobWorkers),
+		maxAttempts: envInt("JOB_MAX_ATTEMPTS", defaultJobMaxAttempts),
+		retryBase:   time.Duration(envInt("JOB_RETRY_BASE_SECONDS", defaultJobRetryBaseSecs)) * time.Second,
+		retention:   time.Duration(envInt("JOB_RETENTION_HOURS", defaultJobRetentionHrs)) * time.Hour,
+		shutdown:    time.Duration(envInt("JOB_SHUTDOWN_TIMEOUT_SECONDS", defaultJobShutdownSecs)) * time.Second,
+		stopping:    make(chan struct{}),
+		jobs:        make(map[string]*IngestJob),
+		files:       make(map[string][]byte),
+	}
+	if m.workers < 1 {
+		m.workers = 1
+	}
+	if m.maxAttempts < 1 {
+		m.maxAttempts = 1
+	}
+
+	path := os.Getenv("JOBS_DB_PATH")
+	if path == "" {
+		path = defaultJobsDBPath
+	}
+	if !strings.EqualFold(path, "off") {
+		db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+		if err != nil {
+			return m, fmt.Errorf("failed to open job store %s: %v", path, err)
+		}
+		if err := m.load(db); err != nil {
+			db.Close()
+			return m, err
+		}
+		m.db = db
+	}
+	return m, nil
+}
+
+// load reads the saved jobs; unfinished ones are run again by Start
+func (m *JobManager) load(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{jobsBucket, uploadsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("failed to initialize job store: %v", err)
+			}
+		}
+		return tx.Bucket(jobsBucket).ForEach(func(id, data []byte) error {
+			var job IngestJob
+			if err := json.Unmarshal(data, &job); err != nil {
+				fmt.Printf("⚠️ Skipping unreadable job %s: %v\n", id, err)
+				return nil
+			}
+			m.jobs[job.ID] = &job
+			return nil
+		})
+	})
+}
+
+// Start launches the workers and resumes the jobs interrupted by a restart
+func (m *JobManager) Start() {
+	m.workersWG.Add(m.workers)
+	for i := 0; i < m.workers; i++ {
+		go m.worker()
+	}
+
+	type resume struct {
+		id      string
+		created time.Time
+		delay   time.Duration
+	}
+	m.mu.Lock()
+	var pending []resume
+	for _, job := range m.jobs {
+		if job.finished() {
+			continue
+		}
+		r := resume{id: job.ID, created: job.CreatedAt}
+		if job.Status == JobRetrying && job.NextAttemptAt != nil {
+			r.delay = time.Until(*job.NextAttemptAt)
+		}
+		pending = append(pending, r)
+	}
+	m.mu.Unlock()
+	m.cleanup()
+
+	// Oldest first; the queue may be smaller than the backlog
+	sort.Slice(pending, func(i, j int) bool { return pending[i].created.Before(pending[j].created) })
+	go func() {
+		for _, r := range pending {
+			m.schedule(r.id, r.delay)
+		}
+	}()
+
+	storage := "in memory"
+	if m.db != nil {
+		storage = m.db.Path()
+	}
+	fmt.Printf("🧵 Started %d ingestion workers (queue %d, %s, %d jobs resumed)\n", m.workers, cap(m.queue), storage, len(pending))
+}
+
+// Submit saves the job and queues it; errJobQueueFull when the queue has no room,
+// errJobsStopped once Close was called
+func (m *JobManager) Submit(req *IngestRequest) (*IngestJob, error) {
+	if m.stopped() {
+		return nil, errJobsStopped
+	}
+	now := time.Now().UTC()
+	job := &IngestJob{
+		ID:          uuid.NewString(),
+		Status:      JobQueued,
+		MaxAttempts: m.maxAttempts,
+		Request:     *req,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	m.mu.Lock()
+	if len(m.queue) == cap(m.queue) {
+		m.mu.Unlock()
+		return nil, errJobQueueFull
+	}
+	m.jobs[job.ID] = job
+	if m.db == nil {
+		m.files[job.ID] = req.FileData
+	}
+	snapshot := *job
+	m.mu.Unlock()
+
+	if err := m.save(&snapshot, req.FileData); err != nil {
+		m.mu.Lock()
+		delete(m.jobs, job.ID)
+		m.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case <-m.stopping:
+		m.remove(job.ID)
+		return nil, errJobsStopped
+	case m.queue <- job.ID:
+	default:
+		m.remove(job.ID)
+		return nil, errJobQueueFull
+	}
+	fmt.Printf("📥 Queued job %s: '%s' for user '%s'\n", job.ID, req.Filename, req.Username)
+	return &snapshot, nil
+}
+
+// Get returns a copy of the job (nil if unknown)
+func (m *JobManager) Get(id string) *IngestJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil
+	}
+	snapshot := *job
+	return &snapshot
+}
+
+// Stats counts the jobs by status (for /health)
+func (m *JobManager) Stats() map[string]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := map[string]int{"queue_capacity": cap(m.queue), "workers": m.workers}
+	for _, job := range m.jobs {
+		stats[job.Status]++
+	}
+	return stats
+}
+
+// Close stops accepting jobs, waits up to JOB_SHUTDOWN_TIMEOUT_SECONDS for the
+// running ones and closes the job store. Queued and unfinished jobs stay saved
+// and are resumed by the next Start.
+func (m *JobManager) Close() {
+	m.stopOnce.Do(func() { close(m.stopping) })
+
+	done := make(chan struct{})
+	go func() {
+		m.workersWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(m.shutdown):
+		fmt.Printf("⚠️ Ingestion jobs still running after %v, they will be resumed on the next start\n", m.shutdown)
+	}
+
+	if m.db != nil {
+		m.db.Close()
+	}
+}
+
+func (m *JobManager) stopped() bool {
+	select {
+	case <-m.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// schedule queues the job after delay (blocks while the queue is full); after
+// Close the job is left to the next start
+func (m *JobManager) schedule(id string, delay time.Duration) {
+	enqueue := func() {
+		select {
+		case m.queue <- id:
+		case <-m.stopping:
+		}
+	}
+	if delay <= 0 {
+		enqueue()
+		return
+	}
+	time.AfterFunc(delay, enqueue)
+}
+
+// worker runs queued jobs until Close; the job in progress is finished first
+func (m *JobManager) worker() {
+	defer m.workersWG.Done()
+	for {
+		select {
+		case <-m.stopping:
+			return
+		case id := <-m.queue:
+			if m.stopped() {
+				return // picked at the same time as the stop: resumed on the next start
+			}
+			m.run(id)
+		}
+	}
+}
+
+func (m *JobManager) run(id string) {
+	var req IngestRequest
+	runnable := false
+	m.update(id, func(job *IngestJob) {
+		if job.finished() {
+			return
+		}
+		job.Status = JobRunning
+		job.Stage, job.Done, job.Total = "", 0, 0
+		job.NextAttemptAt = nil
+		job.Attempts++
+		req = job.Request
+		runnable = true
+	})
+	if !runnable {
+		return
+	}
+
+	fileData, err := m.file(id)
+	if err != nil || fileData == nil {
+		m.finish(id, nil, fmt.Errorf("uploaded file is missing: %v", err))
+		return
+	}
+	req.FileData = fileData
+
+	started := time.Now()
+	resp, err := m.ingest(&req, func(stage string, done, total int) {
+		m.update(id, func(job *IngestJob) {
+			job.Stage, job.Done, job.Total = stage, done, total
+		})
+	})
+
+	job := m.Get(id)
+	if err != nil && errors.Is(err, errStoreFailed) && job != nil && job.Attempts < job.MaxAttempts {
+		delay := m.retryBase << (job.Attempts - 1)
+		if delay > maxJobRetryDelay || delay <= 0 {
+			delay = maxJobRetryDelay
+		}
+		next := time.Now().UTC().Add(delay)
+		m.update(id, func(job *IngestJob) {
+			job.Status = JobRetrying
+			job.Errors = append(job.Errors, err.Error())
+			job.NextAttemptAt = &next
+		})
+		fmt.Printf("🔁 Job %s failed (attempt %d/%d), retrying in %v: %v\n", id, job.Attempts, job.MaxAttempts, delay, err)
+		m.schedule(id, delay)
+		return
+	}
+
+	m.finish(id, resp, err)
+	if err == nil {
+		fmt.Printf("✅ Job %s done in %v (%s)\n", id, time.Since(started).Round(time.Millisecond), resp.StoreStatus)
+	}
+}
+
+// ingest runs one attempt; a panic fails the job instead of the server
+func (m *JobManager) ingest(req *IngestRequest, progress ingestProgress) (resp *ExtractResponse, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp, err = nil, fmt.Errorf("ingestion panicked: %v", r)
+		}
+	}()
+	return ingestDocument(req, progress)
+}
+
+// finish records the outcome and drops the uploaded file
+func (m *JobManager) finish(id string, resp *ExtractResponse, err error) {
+	now := time.Now().UTC()
+	m.update(id, func(job *IngestJob) {
+		job.FinishedAt = &now
+		if err != nil {
+			job.Status = JobFailed
+			job.Errors = append(job.Errors, err.Error())
+			return
+		}
+		job.Status = JobSucceeded
+		job.Stage = ""
+		result := *resp
+		result.Pages = nil // the text is in the collection; keep the job small
+		job.Result = &result
+	})
+	if err != nil {
+		fmt.Printf("❌ Job %s failed: %v\n", id, err)
+	}
+	if job := m.Get(id); job != nil && job.Request.CallbackURL != "" {
+		webhooks.Send(job.Request.CallbackURL, "ingestion."+job.Status, job)
+	}
+
+	m.mu.Lock()
+	delete(m.files, id)
+	m.mu.Unlock()
+	if m.db != nil {
+		if err := m.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(uploadsBucket).Delete([]byte(id))
+		}); err != nil {
+			fmt.Printf("⚠️ Failed to delete the upload of job %s: %v\n", id, err)
+		}
+	}
+	m.cleanup()
+}
+
+// update changes a job and saves it; false if the job does not exist
+func (m *JobManager) update(id string, change func(job *IngestJob)) bool {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return false
+	}
+	change(job)
+	job.UpdatedAt = time.Now().UTC()
+	snapshot := *job
+	m.mu.Unlock()
+
+	if err := m.save(&snapshot, nil); err != nil {
+		fmt.Printf("⚠️ %v\n", err)
+	}
+	return true
+}
+
+// save writes the job and, when given, its file
+func (m *JobManager) save(job *IngestJob, fileData []byte) error {
+	if m.db == nil {
+		return nil
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %v", job.ID, err)
+	}
+	err = m.db.Update(func(tx *bolt.Tx) error {
+		if fileData != nil {
+			if err := tx.Bucket(uploadsBucket).Put([]byte(job.ID), fileData); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(jobsBucket).Put([]byte(job.ID), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save job %s: %v", job.ID, err)
+	}
+	return nil
+}
+
+func (m *JobManager) file(id string) ([]byte, error) {
+	if m.db == nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.files[id], nil
+	}
+	var data []byte
+	err := m.db.View(func(tx *bolt.Tx) error {
+		if stored := tx.Bucket(uploadsBucket).Get([]byte(id)); stored != nil {
+			data = append([]byte(nil), stored...) // only valid inside the transaction
+		}
+		return nil
+	})
+	return data, err
+}
+
+// remove deletes a job and its file
+func (m *JobManager) remove(ids ...string) {
+	m.mu.Lock()
+	for _, id := range ids {
+		delete(m.jobs, id)
+		delete(m.files, id)
+	}
+	m.mu.Unlock()
+
+	if m.db == nil {
+		return
+	}
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		for _, id := range ids {
+			if err := tx.Bucket(jobsBucket).Delete([]byte(id)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(uploadsBucket).Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("⚠️ Failed to delete jobs: %v\n", err)
+	}
+}
+
+// cleanup removes the jobs finished more than JOB_RETENTION_HOURS ago
+func (m *JobManager) cleanup() {
+	cutoff := time.Now().Add(-m.retention)
+	var expired []string
+	m.mu.Lock()
+	for id, job := range m.jobs {
+		if job.finished() && job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+			expired = append(expired, id)
+		}
+	}
+	m.mu.Unlock()
+	if len(expired) > 0 {
+		m.remove(expired...)
+		fmt.Printf("🧹 Removed %d finished jobs\n", len(expired))
+	}
+}
+
+// handleGetJob returns the state of an ingestion job
+func handleGetJob(c *fiber.Ctx) error {
+	job := ingestJobs.Get(c.Params("id"))
+	if job == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "job not found",
+		})
+	}
+	return c.JSON(fiber.Map{"success": true, "job": job})
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// gatedEmbedder blocks every call until release is closed, after signalling started
+type gatedEmbedder struct {
+	Embedder
+	started chan struct{}
+	release chan struct{}
+}
+
+func (e gatedEmbedder) Embed(texts []string) ([][]float32, error) {
+	select {
+	case e.started <- struct{}{}:
+	default:
+	}
+	<-e.release
+	return e.Embedder.Embed(texts)
+}
+
+// startTestJobManager runs one worker on a job store in dir, with a gated embedder
+func startTestJobManager(t *testing.T, dir string) (*JobManager, gatedEmbedder) {
+	t.Helper()
+	useTestVectorStore(t)
+	gate := gatedEmbedder{Embedder: qdrant.Embedder, started: make(chan struct{}, 1), release: make(chan struct{})}
+	qdrant.Embedder = gate
+
+	t.Setenv("JOBS_DB_PATH", filepath.Join(dir, "jobs.db"))
+	t.Setenv("JOB_WORKERS", "1")
+	m, err := newJobManagerFromEnv()
+	if err != nil {
+		t.Fatalf("failed to open job manager: %v", err)
+	}
+	m.Start()
+	return m, gate
+}
+
+func submitTestJob(t *testing.T, m *JobManager, name string) string {
+	t.Helper()
+	job, err := m.Submit(&IngestRequest{
+		Username: "ana", Filename: name, FileType: "pdf",
+		ChunkOpts: ChunkOptions{Strategy: ChunkPage}, FileData: testTextPDF(t, 2),
+	})
+	if err != nil {
+		t.Fatalf("submit failed: %v", err)
+	}
+	return job.ID
+}
+
+// savedJob reads a job back from the closed job store
+func savedJob(t *testing.T, dir, id string) *IngestJob {
+	t.Helper()
+	t.Setenv("JOBS_DB_PATH", filepath.Join(dir, "jobs.db"))
+	m, err := newJobManagerFromEnv()
+	if err != nil {
+		t.Fatalf("failed to reopen job store: %v", err)
+	}
+	defer m.Close()
+	return m.Get(id)
+}
+
+func waitStarted(t *testing.T, gate gatedEmbedder) {
+	t.Helper()
+	select {
+	case <-gate.started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the job never reached the embedder")
+	}
+}
+
+func TestJobManagerCloseWaitsForRunningJobs(t *testing.T) {
+	dir := t.TempDir()
+	m, gate := startTestJobManager(t, dir)
+	id := submitTestJob(t, m, "a.pdf")
+	waitStarted(t, gate)
+
+	closed := make(chan struct{})
+	go func() {
+		m.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("Close returned while a job was running")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, err := m.Submit(&IngestRequest{Username: "ana", Filename: "b.pdf", FileType: "pdf"}); !errors.Is(err, errJobsStopped) {
+		t.Errorf("submit while closing: %v, want errJobsStopped", err)
+	}
+
+	close(gate.release)
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close did not return after the job finished")
+	}
+
+	if job := savedJob(t, dir, id); job == nil || job.Status != JobSucceeded {
+		t.Errorf("saved job = %+v, want succeeded", job)
+	}
+}
+
+func TestJobManagerCloseTimesOut(t *testing.T) {
+	dir := t.TempDir()
+	m, gate := startTestJobManager(t, dir)
+	m.shutdown = 50 * time.Millisecond
+	t.Cleanup(func() {
+		close(gate.release)
+		m.workersWG.Wait() // before the test store goes away
+	})
+
+	id := submitTestJob(t, m, "a.pdf")
+	waitStarted(t, gate)
+
+	start := time.Now()
+	m.Close()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Close took %v", elapsed)
+	}
+
+	// The interrupted job is still unfinished in the store: the next start resumes it
+	if job := savedJob(t, dir, id); job == nil || job.finished() {
+		t.Errorf("saved job = %+v, want an unfinished job", job)
+	}
+}
+
+// failingUpserts fails the nth upsert (1-based) of the wrapped store
+type failingUpserts struct {
+	*EmbeddedStore
+	failAt, calls int
+}
+
+func (s *failingUpserts) Upsert(points []QdrantPoint) error {
+	s.calls++
+	if s.calls == s.failAt {
+		return fmt.Errorf("connection reset")
+	}
+	return s.EmbeddedStore.Upsert(points)
+}
+
+func TestFailedUploadLeavesNoPartialDocument(t *testing.T) {
+	texts := func(count int, version string) []StoreChunk {
+		chunks := make([]StoreChunk, count)
+		for i := range chunks {
+			chunks[i] = StoreChunk{Text: fmt.Sprintf("%s chunk %d", version, i), PageNum: i + 1}
+		}
+		return chunks
+	}
+
+	tests := []struct {
+		name       string
+		previous   int // chunks of a stored earlier version, 0 for none
+		failAt     int
+		wantChunks int
+	}{
+		{"new document, second batch fails", 0, 2, 0},
+		{"new document, first batch fails", 0, 1, 0},
+		{"replacement keeps the previous version", 3, 2, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := useTestVectorStore(t)
+			if tt.previous > 0 {
+				if _, err := storePagesInQdrant("ana", texts(tt.previous, "old"), "a.pdf", "hash-old", "page", nil, nil, nil); err != nil {
+					t.Fatalf("failed to store the previous version: %v", err)
+				}
+			}
+			qdrant.Store = &failingUpserts{EmbeddedStore: store, failAt: tt.failAt}
+
+			chunks := texts(qdrantUpsertBatchSize+10, "new")
+			if _, err := storePagesInQdrant("ana", chunks, "a.pdf", "hash-new", "page", nil, nil, nil); err == nil {
+				t.Fatal("upload succeeded, want the injected failure")
+			}
+
+			count, err := countPoints(userDocFilter("ana", "a.pdf"))
+			if err != nil {
+				t.Fatalf("count failed: %v", err)
+			}
+			if count != tt.wantChunks {
+				t.Errorf("a.pdf has %d chunks, want %d", count, tt.wantChunks)
+			}
+			newChunks, err := countPoints(withMust(userDocFilter("ana", "a.pdf"),
+				map[string]interface{}{"key": "doc_hash", "match": map[string]string{"value": "hash-new"}}))
+			if err != nil {
+				t.Fatalf("count failed: %v", err)
+			}
+			if newChunks != 0 {
+				t.Errorf("%d chunks of the failed upload remain", newChunks)
+			}
+		})
+	}
+}
+
+func TestJobQueueSizeIsAtLeastOne(t *testing.T) {
+	for _, size := range []string{"0", "-3"} {
+		t.Run(size, func(t *testing.T) {
+			t.Setenv("JOBS_DB_PATH", filepath.Join(t.TempDir(), "jobs.db"))
+			t.Setenv("JOB_QUEUE_SIZE", size)
+			m, err := newJobManagerFromEnv()
+			if err != nil {
+				t.Fatalf("failed to open job manager: %v", err)
+			}
+			defer m.Close()
+			if cap(m.queue) != 1 {
+				t.Errorf("queue size %d, want 1", cap(m.queue))
+			}
+		})
+	}
+}
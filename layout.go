@@ -0,0 +1,501 @@
+package main
+
+/*
+LAYOUT (bounding boxes pentru text PDF)
+
+Coordonatele vin din textul structurat MuPDF (aceeași sursă ca format=markdown):
+fiecare linie are poziția (top, left), înălțimea și mărimea fontului, în puncte
+PDF, cu originea în colțul stânga-sus al paginii.
+
+MuPDF nu exportă lățimea liniilor în HTML, așa că poziția orizontală a
+caracterelor vine din SVG-ul paginii (glifele desenate ca path-uri, cu data-text):
+originea fiecărui glif și extinderea lui (ink). Liniile care nu pot fi potrivite
+cu glifele (text rotit, fonturi Type3, SVG indisponibil) primesc poziții estimate
+din lățimea medie a caracterelor (Helvetica) și sunt marcate "estimated": true.
+
+Offset-urile (start/end) sunt în caractere (rune) față de textul paginii, iar în
+Qdrant față de textul salvat în payload (inclusiv overlap-ul). Diferențele de
+spațiere dintre linia MuPDF și textul paginii sunt ignorate; liniile care tot nu
+se găsesc au start/end = -1 și sunt numărate în "unmatched_lines".
+*/
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BBox is a rectangle in PDF points, origin top-left
+type BBox struct {
+	X0 float64 `json:"x0"`
+	Y0 float64 `json:"y0"`
+	X1 float64 `json:"x1"`
+	Y1 float64 `json:"y1"`
+}
+
+// LayoutWord - Estimated is set when the horizontal extent is not taken from glyph positions
+type LayoutWord struct {
+	Text      string `json:"text"`
+	BBox      BBox   `json:"bbox"`
+	Start     int    `json:"start"`
+	End       int    `json:"end"`
+	Estimated bool   `json:"estimated,omitempty"`
+}
+
+// LayoutLine - Start/End are -1 when the line cannot be located in the page text
+type LayoutLine struct {
+	Text      string       `json:"text"`
+	BBox      BBox         `json:"bbox"`
+	Start     int          `json:"start"`
+	End       int          `json:"end"`
+	Estimated bool         `json:"estimated,omitempty"`
+	Words     []LayoutWord `json:"words,omitempty"`
+}
+
+// PageLayout - liniile și cuvintele unei pagini cu dimensiunile paginii
+type PageLayout struct {
+	Page           int          `json:"page"` // 1-based source page
+	Width          float64      `json:"width"`
+	Height         float64      `json:"height"`
+	Lines          []LayoutLine `json:"lines"`
+	UnmatchedLines int          `json:"unmatched_lines,omitempty"`
+}
+
+// ChunkLayout is stored in the Qdrant payload; offsets are relative to the payload text
+type ChunkLayout struct {
+	SourcePage int          `json:"source_page"`
+	PageWidth  float64      `json:"page_width"`
+	PageHeight float64      `json:"page_height"`
+	Lines      []LayoutLine `json:"lines"`
+}
+
+// charWidthFactor approximates Helvetica advance widths as a fraction of the font size
+func charWidthFactor(r rune) float64 {
+	switch {
+	case unicode.IsSpace(r):
+		return 0.278
+	case strings.ContainsRune("iljtfrI.,:;!|'()[]", r):
+		return 0.3
+	case strings.ContainsRune("mwMW", r):
+		return 0.85
+	case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+		return 1.0
+	case unicode.IsUpper(r):
+		return 0.68
+	case unicode.IsDigit(r):
+		return 0.556
+	default:
+		return 0.52
+	}
+}
+
+func estimateTextWidth(text string, fontSize float64) float64 {
+	width := 0.0
+	for _, r := range text {
+		width += charWidthFactor(r)
+	}
+	return width * fontSize
+}
+
+// pageLayoutFromLines builds line and word boxes for one page. Offsets are
+// located in pageText (the cleaned page text returned in "pages").
+func pageLayoutFromLines(pl pdfPageLines, pageText string) PageLayout {
+	layout := PageLayout{Page: pl.Page, Width: pl.Width, Height: pl.Height}
+
+	cursor := 0      // byte position in pageText
+	glyphCursor := 0 // index in pl.Glyphs
+	for _, l := range pl.Lines {
+		height := l.LineHeight
+		if height <= 0 {
+			height = l.FontSize
+		}
+		fontSize := l.FontSize
+		if fontSize <= 0 {
+			fontSize = height
+		}
+
+		line := LayoutLine{
+			Text:  l.Text,
+			BBox:  BBox{X0: round2(l.Left), Y0: round2(l.Top), Y1: round2(l.Top + height)},
+			Start: -1,
+			End:   -1,
+		}
+
+		// Locate the line in the page text, preferably after the previous line
+		positions, next := alignText(pageText, cursor, l.Text)
+		if positions != nil {
+			first, last := -1, -1
+			for i, p := range positions {
+				if p < 0 {
+					continue
+				}
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+			_, lastSize := utf8.DecodeRuneInString(l.Text[last:])
+			line.Start = utf8.RuneCountInString(pageText[:positions[first]])
+			line.End = utf8.RuneCountInString(pageText[:positions[last]+lastSize])
+			if next > cursor {
+				cursor = next
+			}
+		} else {
+			layout.UnmatchedLines++
+		}
+
+		// Horizontal extent of every character, from the glyphs MuPDF drew
+		spans, nextGlyph := lineGlyphSpans(pl.Glyphs, glyphCursor, l, l.Top, l.Top+height)
+		if spans != nil {
+			glyphCursor = nextGlyph
+			x0, x1 := math.Inf(1), math.Inf(-1)
+			for _, sp := range spans {
+				if sp.ok {
+					x0 = math.Min(x0, sp.x0)
+					x1 = math.Max(x1, sp.x1)
+				}
+			}
+			line.BBox.X0, line.BBox.X1 = round2(x0), round2(x1)
+		} else {
+			line.Estimated = true
+			x1 := l.Left + estimateTextWidth(l.Text, fontSize)
+			if pl.Width > 0 && x1 > pl.Width {
+				x1 = pl.Width
+			}
+			line.BBox.X1 = round2(x1)
+		}
+
+		x := l.Left // estimated pen position, used when a word has no glyphs
+		consumed := 0
+		for _, field := range splitWordsWithOffsets(l.Text) {
+			x += estimateTextWidth(l.Text[consumed:field.start], fontSize)
+			w := estimateTextWidth(field.text, fontSize)
+			consumed = field.start + len(field.text)
+
+			word := LayoutWord{
+				Text:  field.text,
+				BBox:  BBox{X0: round2(x), Y0: line.BBox.Y0, X1: round2(x + w), Y1: line.BBox.Y1},
+				Start: -1,
+				End:   -1,
+			}
+			x += w
+
+			found := false
+			if spans != nil {
+				wx0, wx1 := math.Inf(1), math.Inf(-1)
+				for _, sp := range spans[field.start:consumed] {
+					if sp.ok {
+						wx0 = math.Min(wx0, sp.x0)
+						wx1 = math.Max(wx1, sp.x1)
+						found = true
+					}
+				}
+				if found {
+					word.BBox.X0, word.BBox.X1 = round2(wx0), round2(wx1)
+				}
+			}
+			word.Estimated = !found
+
+			if positions != nil {
+				first, last := -1, -1
+				for i := field.start; i < consumed; i++ {
+					if positions[i] >= 0 {
+						if first < 0 {
+							first = i
+						}
+						last = i
+					}
+				}
+				if first >= 0 {
+					_, lastSize := utf8.DecodeRuneInString(l.Text[last:])
+					word.Start = utf8.RuneCountInString(pageText[:positions[first]])
+					word.End = utf8.RuneCountInString(pageText[:positions[last]+lastSize])
+				}
+			}
+			line.Words = append(line.Words, word)
+		}
+
+		layout.Lines = append(layout.Lines, line)
+	}
+
+	return layout
+}
+
+// alignText locates line in pageText, first from byte offset from on, then in the
+// whole page. Whitespace is ignored, because the page text has its spacing collapsed
+// while MuPDF lines keep their own. It returns, for every byte of line that starts a
+// non-space rune, its byte offset in pageText (-1 elsewhere), plus the byte offset
+// after the match; nil when the line is not found.
+func alignText(pageText string, from int, line string) ([]int, int) {
+	type textRune struct {
+		r   rune
+		pos int
+	}
+	var needle []textRune
+	for i, r := range line {
+		if !unicode.IsSpace(r) {
+			needle = append(needle, textRune{r, i})
+		}
+	}
+	if len(needle) == 0 {
+		return nil, from
+	}
+
+	matchAt := func(start int) ([]int, int) {
+		positions := make([]int, len(line))
+		for i := range positions {
+			positions[i] = -1
+		}
+		p := start
+		for _, n := range needle {
+			for p < len(pageText) {
+				r, size := utf8.DecodeRuneInString(pageText[p:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				p += size
+			}
+			if p >= len(pageText) {
+				return nil, 0
+			}
+			r, size := utf8.DecodeRuneInString(pageText[p:])
+			if r != n.r {
+				return nil, 0
+			}
+			positions[n.pos] = p
+			p += size
+		}
+		return positions, p
+	}
+
+	for _, begin := range []int{from, 0} {
+		if idx := strings.Index(pageText[begin:], line); idx >= 0 {
+			return matchAt(begin + idx)
+		}
+		for p := begin; p < len(pageText); {
+			r, size := utf8.DecodeRuneInString(pageText[p:])
+			if r == needle[0].r {
+				if positions, end := matchAt(p); positions != nil {
+					return positions, end
+				}
+			}
+			p += size
+		}
+		if begin == 0 {
+			break
+		}
+	}
+	return nil, from
+}
+
+// charSpan is the horizontal extent of one character of a line
+type charSpan struct {
+	x0, x1 float64
+	ok     bool
+}
+
+// lineGlyphSpans matches line l to the glyphs drawn on its baseline, between top and
+// bottom and starting near l.Left, and returns the extent of its characters indexed by
+// byte offset in l.Text. Characters without a glyph (e.g. split ligatures) are left
+// unset; nil is returned when fewer than 90% of them are found.
+func lineGlyphSpans(glyphs []pdfGlyph, from int, l pdfTextLine, top, bottom float64) ([]charSpan, int) {
+	type textRune struct {
+		r   rune
+		pos int
+	}
+	var runes []textRune
+	for i, r := range l.Text {
+		if !unicode.IsSpace(r) {
+			runes = append(runes, textRune{r, i})
+		}
+	}
+	if len(runes) == 0 || len(glyphs) == 0 {
+		return nil, from
+	}
+
+	tryAt := func(start int) ([]charSpan, int) {
+		spans := make([]charSpan, len(l.Text))
+		baseline := glyphs[start].Y
+		j, matched := start, 0
+		for _, tr := range runes {
+			// Look a few glyphs ahead, so a missing glyph does not derail the line
+			for k := j; k < len(glyphs) && k < j+3; k++ {
+				g := glyphs[k]
+				if g.Rune == tr.r && math.Abs(g.Y-baseline) <= g.Size {
+					spans[tr.pos] = charSpan{x0: g.X0, x1: g.X1, ok: true}
+					j = k + 1
+					matched++
+					break
+				}
+			}
+		}
+		if matched*10 < len(runes)*9 {
+			return nil, start
+		}
+		return spans, j
+	}
+
+	isStart := func(g pdfGlyph) bool {
+		return g.Rune == runes[0].r && g.Y >= top-1 && g.Y <= bottom+1 &&
+			g.X0 >= l.Left-g.Size && g.X0 <= l.Left+g.Size
+	}
+	for i := from; i < len(glyphs); i++ {
+		if isStart(glyphs[i]) {
+			if spans, next := tryAt(i); spans != nil {
+				return spans, next
+			}
+		}
+	}
+	for i := 0; i < from && i < len(glyphs); i++ {
+		if isStart(glyphs[i]) {
+			if spans, next := tryAt(i); spans != nil {
+				return spans, next
+			}
+		}
+	}
+	return nil, from
+}
+
+type wordField struct {
+	text  string
+	start int // byte offset in the line
+}
+
+func splitWordsWithOffsets(text string) []wordField {
+	var fields []wordField
+	start := -1
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				fields = append(fields, wordField{text: text[start:i], start: start})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, wordField{text: text[start:], start: start})
+	}
+	return fields
+}
+
+// chunkLayoutFor maps a stored chunk back to the page layout. chunkText must be a
+// substring of the page text; offsetInStored is where it starts (in runes) in the payload text.
+func chunkLayoutFor(page PageLayout, pageText, chunkText string, offsetInStored int) *ChunkLayout {
+	idx := strings.Index(pageText, chunkText)
+	if idx < 0 {
+		return nil
+	}
+	chunkStart := utf8.RuneCountInString(pageText[:idx])
+	return chunkLayoutAt(page, chunkStart, chunkStart+utf8.RuneCountInString(chunkText), offsetInStored)
+}
+
+// chunkLayoutAt maps the lines between rune offsets [chunkStart, chunkEnd) of the
+// page text to a stored text in which the chunk begins at offsetInStored
+func chunkLayoutAt(page PageLayout, chunkStart, chunkEnd, offsetInStored int) *ChunkLayout {
+	shift := offsetInStored - chunkStart
+
+	chunk := &ChunkLayout{SourcePage: page.Page, PageWidth: page.Width, PageHeight: page.Height}
+	for _, line := range page.Lines {
+		if line.Start < 0 || line.End <= chunkStart || line.Start >= chunkEnd {
+			continue
+		}
+		// Lines cut by the chunk boundary are clamped to the chunk
+		shifted := line
+		shifted.Start = maxInt(line.Start, chunkStart) + shift
+		shifted.End = minInt(line.End, chunkEnd) + shift
+		shifted.Words = nil
+		for _, w := range line.Words {
+			if w.Start < chunkStart || w.End > chunkEnd {
+				continue
+			}
+			w.Start += shift
+			w.End += shift
+			shifted.Words = append(shifted.Words, w)
+		}
+		chunk.Lines = append(chunk.Lines, shifted)
+	}
+	return chunk
+}
+
+// shiftChunkLayout moves all offsets by delta runes (e.g. when overlap text is prepended)
+func shiftChunkLayout(chunk *ChunkLayout, delta int) *ChunkLayout {
+	if chunk == nil {
+		return nil
+	}
+	shifted := *chunk
+	shifted.Lines = make([]LayoutLine, len(chunk.Lines))
+	for i, line := range chunk.Lines {
+		line.Start += delta
+		line.End += delta
+		words := make([]LayoutWord, len(line.Words))
+		for j, w := range line.Words {
+			w.Start += delta
+			w.End += delta
+			words[j] = w
+		}
+		line.Words = words
+		shifted.Lines[i] = line
+	}
+	return &shifted
+}
+
+// chunkLayoutsForContent maps every stored text (page or "[Page N, Paragraph i/g]" split)
+// to its layout. Offsets are relative to the content strings.
+func chunkLayoutsForContent(content []string, pages []string, layouts []PageLayout, paragraphs bool) []*ChunkLayout {
+	result := make([]*ChunkLayout, len(content))
+	if len(layouts) != len(pages) {
+		return result
+	}
+
+	for i, text := range content {
+		if !paragraphs {
+			if i < len(pages) {
+				result[i] = chunkLayoutFor(layouts[i], pages[i], strings.TrimSpace(text), 0)
+			}
+			continue
+		}
+
+		// "[Page N, Paragraph i/g]\n<body>"
+		var pageNum int
+		if _, err := fmt.Sscanf(text, "[Page %d,", &pageNum); err != nil || pageNum < 1 || pageNum > len(pages) {
+			continue
+		}
+		newline := strings.Index(text, "\n")
+		if newline < 0 {
+			continue
+		}
+		body := text[newline+1:]
+		result[i] = chunkLayoutFor(layouts[pageNum-1], pages[pageNum-1], body, utf8.RuneCountInString(text[:newline+1]))
+	}
+
+	return result
+}
+
+// withoutWords drops word boxes (layout=lines)
+func withoutWords(layouts []PageLayout) []PageLayout {
+	out := make([]PageLayout, len(layouts))
+	for i, p := range layouts {
+		out[i] = p
+		out[i].Lines = make([]LayoutLine, len(p.Lines))
+		for j, l := range p.Lines {
+			l.Words = nil
+			out[i].Lines[j] = l
+		}
+	}
+	return out
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitWordsWithOffsets(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []wordField
+	}{
+		{"empty", "", nil},
+		{"only spaces", "   ", nil},
+		{"single word", "ocean", []wordField{{"ocean", 0}}},
+		{"leading and trailing spaces", "  two words ", []wordField{{"two", 2}, {"words", 6}}},
+		{"tabs and repeated spaces", "a\t\tb   c", []wordField{{"a", 0}, {"b", 3}, {"c", 7}}},
+		{"multibyte offsets are in bytes", "ăla și", []wordField{{"ăla", 0}, {"și", 5}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitWordsWithOffsets(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitWordsWithOffsets(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlignText(t *testing.T) {
+	tests := []struct {
+		name      string
+		pageText  string
+		from      int
+		line      string
+		wantStart int // byte offset of the first rune, -1 when not found
+		wantEnd   int
+	}{
+		{"exact match", "alpha beta gamma", 0, "beta", 6, 10},
+		{"match after cursor", "beta alpha beta", 5, "beta", 11, 15},
+		{"before cursor falls back to whole page", "beta alpha", 5, "beta", 0, 4},
+		{"different spacing", "The ocean covers", 0, "The  ocean\tcovers", 0, 16},
+		{"line without spaces in page", "Dr.Smith", 0, "Dr. Smith", 0, 8},
+		{"not found", "alpha beta", 0, "delta", -1, -1},
+		{"only spaces", "alpha", 0, "  ", -1, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			positions, end := alignText(tt.pageText, tt.from, tt.line)
+			if tt.wantStart < 0 {
+				if positions != nil {
+					t.Fatalf("alignText found %q in %q", tt.line, tt.pageText)
+				}
+				return
+			}
+			if positions == nil {
+				t.Fatalf("alignText did not find %q in %q", tt.line, tt.pageText)
+			}
+			first := -1
+			for _, p := range positions {
+				if p >= 0 {
+					first = p
+					break
+				}
+			}
+			if first != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("alignText = [%d, %d), want [%d, %d)", first, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestSVGPathXExtent(t *testing.T) {
+	tests := []struct {
+		name     string
+		d        string
+		min, max float64
+		ok       bool
+	}{
+		{"empty glyph", "M0 0Z", 0, 0, true},
+		{"compact numbers", "M.23799134 .4889984V0H.37799073V.70899966H.2849884Z", .23799134, .37799073, true},
+		{"negative numbers without separator", "M.5 .1C.4-.02 .1-.02 .03 .25Z", .03, .5, true},
+		{"y values are ignored", "M1 5L2 9V100Z", 1, 2, true},
+		{"relative commands", "m1 1l2 2z", 0, 0, false},
+		{"no coordinates", "Z", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			min, max, ok := svgPathXExtent(tt.d)
+			if ok != tt.ok || (ok && (min != tt.min || max != tt.max)) {
+				t.Errorf("svgPathXExtent(%q) = %v, %v, %v; want %v, %v, %v", tt.d, min, max, ok, tt.min, tt.max, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseMuPDFSVGGlyphs(t *testing.T) {
+	svg := `<svg><defs>
+<path id="font_1_18" d="M.2 .4V0H.5V.7Z"/>
+<path id="font_1_1" d="M0 0Z"/>
+</defs>
+<use data-text="1" xlink:href="#font_1_18" transform="matrix(10,0,0,-10,30,40)"/>
+<use data-text=" " xlink:href="#font_1_1" transform="matrix(10,0,0,-10,36,40)"/>
+<use data-text="&amp;" xlink:href="#font_1_18" transform="matrix(10,0,0,-10,40,40)"/>
+<use data-text="x" xlink:href="#font_1_18" transform="matrix(0,10,10,0,50,40)"/>
+</svg>`
+
+	want := []pdfGlyph{
+		{Rune: '1', X0: 30, X1: 35, Y: 40, Size: 10},
+		{Rune: '&', X0: 40, X1: 45, Y: 40, Size: 10},
+	}
+	if got := parseMuPDFSVGGlyphs(svg); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMuPDFSVGGlyphs = %+v, want %+v", got, want)
+	}
+}
+
+func TestPageLayoutFromLines(t *testing.T) {
+	line := pdfTextLine{Text: "Hi yo", Top: 10, Left: 20, LineHeight: 12, FontSize: 10}
+	glyphs := []pdfGlyph{
+		{Rune: 'H', X0: 20, X1: 27, Y: 19, Size: 10},
+		{Rune: 'i', X0: 27, X1: 30, Y: 19, Size: 10},
+		{Rune: 'y', X0: 33, X1: 38, Y: 19, Size: 10},
+		{Rune: 'o', X0: 38, X1: 43, Y: 19, Size: 10},
+	}
+
+	tests := []struct {
+		name          string
+		glyphs        []pdfGlyph
+		pageText      string
+		wantLineBox   BBox
+		wantEstimated bool
+		wantStart     int
+		wantUnmatched int
+	}{
+		{"glyph positions", glyphs, "Title Hi yo", BBox{X0: 20, Y0: 10, X1: 43, Y1: 22}, false, 6, 0},
+		{"no glyphs are estimated", nil, "Hi yo", BBox{X0: 20, Y0: 10, X1: 20 + estimateTextWidth("Hi yo", 10), Y1: 22}, true, 0, 0},
+		{"glyphs of another line", glyphs[:2], "Hi yo", BBox{X0: 20, Y0: 10, X1: 20 + estimateTextWidth("Hi yo", 10), Y1: 22}, true, 0, 0},
+		{"text not on page", glyphs, "something else", BBox{X0: 20, Y0: 10, X1: 43, Y1: 22}, false, -1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pl := pdfPageLines{Page: 1, Width: 600, Height: 800, Lines: []pdfTextLine{line}, Glyphs: tt.glyphs}
+			layout := pageLayoutFromLines(pl, tt.pageText)
+			if len(layout.Lines) != 1 {
+				t.Fatalf("got %d lines, want 1", len(layout.Lines))
+			}
+			got := layout.Lines[0]
+			want := tt.wantLineBox
+			want.X1 = round2(want.X1)
+			if got.BBox != want {
+				t.Errorf("line bbox = %+v, want %+v", got.BBox, want)
+			}
+			if got.Estimated != tt.wantEstimated {
+				t.Errorf("line estimated = %v, want %v", got.Estimated, tt.wantEstimated)
+			}
+			for _, w := range got.Words {
+				if w.Estimated != tt.wantEstimated {
+					t.Errorf("word %q estimated = %v, want %v", w.Text, w.Estimated, tt.wantEstimated)
+				}
+			}
+			if got.Start != tt.wantStart {
+				t.Errorf("line start = %d, want %d", got.Start, tt.wantStart)
+			}
+			if layout.UnmatchedLines != tt.wantUnmatched {
+				t.Errorf("unmatched lines = %d, want %d", layout.UnmatchedLines, tt.wantUnmatched)
+			}
+			if !tt.wantEstimated && got.Words[1].BBox.X0 != 33 {
+				t.Errorf("second word starts at %v, want 33", got.Words[1].BBox.X0)
+			}
+		})
+	}
+}
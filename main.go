@@ -1,7 +1,11 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -12,14 +16,26 @@ import (
 )
 
 type ExtractResponse struct {
-	Success        bool     `json:"success"`
-	FileType       string   `json:"file_type"`
-	Filename       string   `json:"filename,omitempty"`
-	NumPages       int      `json:"num_pages,omitempty"`
-	Pages          []string `json:"pages,omitempty"`
-	Text           string   `json:"text,omitempty"`
-	Error          string   `json:"error,omitempty"`
-	StoredInQdrant bool     `json:"stored_in_qdrant,omitempty"`
+	Success        bool                   `json:"success"`
+	FileType       string                 `json:"file_type"`
+	Filename       string                 `json:"filename,omitempty"`
+	NumPages       int                    `json:"num_pages,omitempty"`
+	Pages          []string               `json:"pages,omitempty"`
+	Text           string                 `json:"text,omitempty"`
+	Error          string                 `json:"error,omitempty"`
+	StoredInQdrant bool                   `json:"stored_in_qdrant,omitempty"`
+	StoreStatus    string                 `json:"store_status,omitempty"` // created, unchanged, replaced
+	DocHash        string                 `json:"doc_hash,omitempty"`
+	Chunking       string                 `json:"chunking,omitempty"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	Enrich         string                 `json:"enrich,omitempty"`      // context header mode of the stored chunks
+	DocSummary     string                 `json:"doc_summary,omitempty"` // document-level point: created, updated, unchanged
+	Timing         *ExtractStats          `json:"timing,omitempty"`
+	Format         string                 `json:"format,omitempty"`
+	Markdown       string                 `json:"markdown,omitempty"`
+	Tree           *DocumentNode          `json:"tree,omitempty"`
+	Layout         []PageLayout           `json:"layout,omitempty"`
+	Quality        *QualityReport         `json:"quality,omitempty"`
 }
 
 type ParagraphSearchResponse struct {
@@ -28,10 +44,25 @@ type ParagraphSearchResponse struct {
 	Query      string         `json:"query"`
 	Username   string         `json:"username"`
 	TotalFound int            `json:"total_found"`
+	Weights    *SearchWeights `json:"weights,omitempty"`
+	Reranker   string         `json:"reranker,omitempty"`
+	RerankErr  string         `json:"rerank_error,omitempty"` // reranking failed, results keep retrieval order
+	Route      *DocumentRoute `json:"route,omitempty"`        // documents searched after routing (docroute.go)
 	Error      string         `json:"error,omitempty"`
 }
 
 func main() {
+	// Child process mode: sandboxed MuPDF extraction worker (see worker.go)
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		runExtractionWorker()
+		return
+	}
+
+	// Admin command: copy a simple vector collection into dense + sparse (see migrate.go)
+	if len(os.Args) > 1 && os.Args[1] == "migrate-collection" {
+		godotenv.Load()
+		os.Exit(runCollectionMigration(os.Args[2:]))
+	}
 
 	app := fiber.New(fiber.Config{
 		BodyLimit:         15 << 20,         // 15 MB
@@ -53,22 +84,117 @@ func main() {
 
 	godotenv.Load()
 
+	// Start PDF extraction workers (crash isolation for MuPDF)
+	pool, err := newExtractionPoolFromEnv()
+	if err != nil {
+		fmt.Printf("⚠️ %v, falling back to in-process extraction\n", err)
+	}
+	extractionPool = pool
+
+	// External API clients with retries and circuit breakers (see resilient_http.go)
+	openRouterClient = newResilientClient("openrouter", 35*time.Second)
+	crossEncoderClient = newResilientClient("reranker", time.Minute)
+
+	// Embedding provider for the collection (see embeddings.go)
+	embedder, err := newEmbedderFromEnv()
+	if err != nil {
+		fmt.Printf("❌ Embeddings: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Persistent embedding cache in front of the provider
+	cache, err := newEmbeddingCacheFromEnv()
+	if err != nil {
+		fmt.Printf("⚠️ %v, embeddings will not be cached\n", err)
+	} else if cache != nil {
+		embeddingCache = cache
+		embedder = cachedEmbedder{Embedder: embedder, cache: cache}
+	}
+
+	// Qdrant collection and payload indexes (a wrong vector config is fatal)
+	qdrant, err = NewQdrantClientFromEnv(embedder)
+	if err != nil {
+		fmt.Printf("❌ Vector store: %v\n", err)
+		os.Exit(1)
+	}
+	if err := qdrant.EnsureCollection(); err != nil {
+		if errors.Is(err, errQdrantVectorMismatch) {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("⚠️ Qdrant not ready: %v\n", err)
+	}
+
+	// Document summaries for two-stage search (see docroute.go)
+	if docSummaryMode() != "" {
+		documentIndex, err = newDocumentIndex(qdrant)
+		if err == nil {
+			err = documentIndex.EnsureDocumentCollection()
+		}
+		if err != nil {
+			fmt.Printf("⚠️ Document routing disabled: %v\n", err)
+			documentIndex = nil
+		}
+	}
+
+	// Uploaded PDFs, so /render accepts stored documents (see originals.go)
+	originals, err = newOriginalStoreFromEnv()
+	if err != nil {
+		fmt.Printf("⚠️ %v, /render will need the file\n", err)
+	}
+
+	// Signed callbacks for ingestion and summaries (see webhooks.go)
+	webhooks, err = newWebhookDispatcherFromEnv()
+	if err != nil {
+		fmt.Printf("⚠️ %v, the webhook log will be kept in memory\n", err)
+	}
+	webhooks.Start()
+
+	// Background ingestion (POST /extract/store with async=true, see jobs.go)
+	ingestJobs, err = newJobManagerFromEnv()
+	if err != nil {
+		fmt.Printf("⚠️ %v, jobs will be kept in memory\n", err)
+	}
+	ingestJobs.Start()
+
 	// Health check
 	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"status": "ok", "service": "document-extractor"})
+		health := fiber.Map{"status": "ok", "service": "document-extractor"}
+		if embeddingCache != nil {
+			health["embedding_cache"] = embeddingCache.Stats()
+		}
+		health["circuits"] = circuitStatuses()
+		health["jobs"] = ingestJobs.Stats()
+		return c.JSON(health)
 	})
 
 	// PDF ROUTES
 	// Extract from PDF, returns JSON
 	app.Post("/extract", handleExtractJSON)
+	// Formats supported by the registered extractors
+	app.Get("/formats", handleListFormats)
+	// Render a PDF page as PNG/JPEG/WebP, or thumbnails for every page
+	app.Post("/render", handleRender)
 
 	// QDRANT ROUTES
 	// Extract from PDF -> Put pages in Qdrant
-	app.Post("/extract/store", handleExtractAndStore)
+	app.Post("/extract/store", withCallback("ingestion", handleExtractAndStore))
+	// Status of an async ingestion job
+	app.Get("/jobs/:id", handleGetJob)
+	// Webhook delivery log and replay
+	app.Get("/webhooks/deliveries", handleListWebhookDeliveries)
+	app.Get("/webhooks/deliveries/:id", handleGetWebhookDelivery)
+	app.Post("/webhooks/deliveries/:id/replay", handleReplayWebhookDelivery)
 	// Search by username and query
 	app.Post("/search", handleSearchPages)
 	// Delete all user data from Qdrant
 	app.Delete("/leave/:username", handleOnLeave)
+	// Document management (list, get, delete, rename, stats)
+	app.Get("/documents/:username", handleListDocuments)
+	app.Get("/documents/:username/:docName", handleGetDocument)
+	app.Delete("/documents/:username/:docName", handleDeleteDocument)
+	app.Patch("/documents/:username/:docName", handleRenameDocument)
+	app.Get("/users/:username/stats", handleUserStats)
 
 	// OPENROUTER ROUTES
 	// Answer questions based on vector search results
@@ -80,16 +206,16 @@ func main() {
 
 	// SUMMARY ROUTES - 3 TIPURI SEPARATE
 	// Chapter summary (receives full PDF)
-	app.Post("/summary/chapters", handleChapterSummary)
-	app.Post("/summary/chapters/download", handleDownloadChapterSummaryPDF)
+	app.Post("/summary/chapters", withCallback("summary.chapters", handleChapterSummary))
+	app.Post("/summary/chapters/download", withCallback("summary.chapters", handleDownloadChapterSummaryPDF))
 
 	// General summary (receive all pages, return small summary)
-	app.Post("/summary/general", handleGeneralSummary)
-	app.Post("/summary/general/download", handleDownloadGeneralSummaryPDF)
+	app.Post("/summary/general", withCallback("summary.general", handleGeneralSummary))
+	app.Post("/summary/general/download", withCallback("summary.general", handleDownloadGeneralSummaryPDF))
 
 	// Advanced summary, with levels
-	app.Post("/summary/level", handleLevelSummary)
-	app.Post("/summary/level/download", handleDownloadLevelSummaryPDF)
+	app.Post("/summary/level", withCallback("summary.level", handleLevelSummary))
+	app.Post("/summary/level/download", withCallback("summary.level", handleDownloadLevelSummaryPDF))
 
 	// Use PORT env var if present (Railway sets PORT)
 	port := os.Getenv("PORT")
@@ -97,5 +223,23 @@ func main() {
 		port = "3000"
 	}
 
-	app.Listen(":" + port)
+	// Graceful shutdown, so the embedded vector store writes its snapshots
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		fmt.Printf("🛑 Shutting down...\n")
+		app.Shutdown()
+	}()
+
+	if err := app.Listen(":" + port); err != nil {
+		fmt.Printf("❌ %v\n", err)
+	}
+	ingestJobs.Close()
+	webhooks.Close()
+	originals.Close()
+	if embeddingCache != nil {
+		embeddingCache.Close()
+	}
+	closeEmbeddedStores()
 }
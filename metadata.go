@@ -0,0 +1,440 @@
+package main
+
+/*
+METADATA DOCUMENTE + FILTRE DE CĂUTARE
+
+La /extract/store câmpul "metadata" este un obiect JSON, salvat pe fiecare
+chunk în payload-ul "metadata" și indexat automat în Qdrant:
+
+    metadata={"tags": ["fizică", "examen"], "course": "Fizica 1", "year": 2024,
+              "date": "2024-05-01", "language": "ro"}
+
+  - chei: litere, cifre și _, cel mult 64 de caractere, cel mult 32 de chei
+  - valori: text, număr, bool sau listă de text/numere (de același tip)
+  - text de forma 2024-05-01 sau RFC 3339 este indexat ca datetime, restul ca
+    keyword; numerele întregi ca integer, celelalte ca float
+
+O re-încărcare a aceluiași fișier cu alte metadata actualizează doar payload-ul.
+
+/search, /answer și /smart-search acceptă "filter", tradus într-un filtru Qdrant
+(pe lângă username și doc_name, care rămân obligatorii):
+
+    "filter": {
+      "must":     [{"field": "course", "match": "Fizica 1"},
+                   {"field": "page_num", "range": {"gte": 1, "lte": 10}}],
+      "should":   [{"field": "tags", "any": ["examen", "curs"]}],
+      "must_not": [{"field": "doc_name", "any": ["vechi.pdf"]}]
+    }
+
+  - field: doc_name, page_num, uploaded_at sau o cheie din metadata
+    ("metadata.course" este acceptat și el)
+  - match (valoare exactă), any (una dintre valori) sau range (gt, gte, lt,
+    lte cu numere sau date); pentru liste, ajunge ca un element să se potrivească
+  - o condiție fără field poate conține la rândul ei must/should/must_not
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxMetadataKeys        = 32
+	maxMetadataValueChars  = 1024
+	maxMetadataListItems   = 100
+	maxFilterConditions    = 64
+	maxFilterDepth         = 4
+	metadataPayloadKey     = "metadata"
+	metadataDateOnlyLayout = "2006-01-02"
+)
+
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// builtinFilterFields are payload fields a filter may use directly; everything
+// else is a metadata key. username is always set by the server.
+var builtinFilterFields = map[string]bool{
+	"doc_name":    true,
+	"page_num":    true,
+	"uploaded_at": true,
+}
+
+// parseMetadata validates the "metadata" form field (empty means none)
+func parseMetadata(raw string) (map[string]interface{}, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var metadata map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("metadata must be a JSON object: %v", err)
+	}
+	if len(metadata) > maxMetadataKeys {
+		return nil, fmt.Errorf("metadata has %d keys, at most %d are allowed", len(metadata), maxMetadataKeys)
+	}
+
+	for key, value := range metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("metadata key %q must contain only letters, digits and _ (max 64)", key)
+		}
+		normalized, err := normalizeMetadataValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("metadata %q: %v", key, err)
+		}
+		metadata[key] = normalized
+	}
+	return metadata, nil
+}
+
+// normalizeMetadataValue checks the type and turns json.Number into int64/float64
+func normalizeMetadataValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if len([]rune(v)) > maxMetadataValueChars {
+			return nil, fmt.Errorf("text longer than %d characters", maxMetadataValueChars)
+		}
+		return v, nil
+	case bool:
+		return v, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		f, err := v.Float64()
+		if err != nil || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("invalid number %s", v)
+		}
+		return f, nil
+	case []interface{}:
+		if len(v) == 0 || len(v) > maxMetadataListItems {
+			return nil, fmt.Errorf("lists must have 1 to %d items", maxMetadataListItems)
+		}
+		items := make([]interface{}, len(v))
+		schema := ""
+		for i, item := range v {
+			if _, nested := item.([]interface{}); nested {
+				return nil, fmt.Errorf("nested lists are not supported")
+			}
+			normalized, err := normalizeMetadataValue(item)
+			if err != nil {
+				return nil, err
+			}
+			if _, isBool := normalized.(bool); isBool {
+				return nil, fmt.Errorf("lists may contain only text or numbers")
+			}
+			itemSchema := metadataIndexSchema(normalized)
+			if itemSchema == "integer" && schema == "float" {
+				itemSchema = "float"
+			} else if itemSchema == "float" && schema == "integer" {
+				schema = "float"
+			}
+			if schema != "" && itemSchema != schema {
+				return nil, fmt.Errorf("list items must all have the same type")
+			}
+			schema = itemSchema
+			items[i] = normalized
+		}
+		return items, nil
+	case nil:
+		return nil, fmt.Errorf("null values are not supported")
+	default:
+		return nil, fmt.Errorf("objects are not supported, use flat keys")
+	}
+}
+
+// isMetadataDate accepts 2024-05-01 and RFC 3339 timestamps
+func isMetadataDate(s string) bool {
+	if _, err := time.Parse(metadataDateOnlyLayout, s); err == nil {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339, s)
+	return err == nil
+}
+
+// metadataIndexSchema is the Qdrant payload index type for a normalized value
+func metadataIndexSchema(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		return "bool"
+	case int64:
+		return "integer"
+	case float64:
+		return "float"
+	case string:
+		if isMetadataDate(v) {
+			return "datetime"
+		}
+		return "keyword"
+	case []interface{}:
+		schema := metadataIndexSchema(v[0])
+		for _, item := range v[1:] {
+			if metadataIndexSchema(item) == "float" {
+				schema = "float"
+			}
+		}
+		return schema
+	}
+	return "keyword"
+}
+
+// ensureMetadataIndexes indexes every metadata key. A key already indexed with
+// another type keeps its index (filters on it still work, unindexed).
+func (q *QdrantClient) ensureMetadataIndexes(metadata map[string]interface{}) {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field := metadataPayloadKey + "." + key
+		schema := metadataIndexSchema(metadata[key])
+		existing := q.indexedSchema(field)
+		if existing == schema {
+			continue
+		}
+		if existing != "" {
+			fmt.Printf("⚠️ Metadata '%s' is indexed as %s, keeping it (new value is %s)\n", key, existing, schema)
+			continue
+		}
+		if err := q.ensurePayloadIndex(field, schema); err != nil {
+			fmt.Printf("⚠️ Failed to index metadata '%s': %v\n", key, err)
+			continue
+		}
+		fmt.Printf("🏷️ Indexed metadata '%s' as %s\n", key, schema)
+	}
+}
+
+// SearchFilter is the "filter" expression of the search endpoints
+type SearchFilter struct {
+	Must    []FilterCondition `json:"must,omitempty"`
+	Should  []FilterCondition `json:"should,omitempty"`
+	MustNot []FilterCondition `json:"must_not,omitempty"`
+}
+
+// FilterCondition tests one field, or groups conditions when Field is empty
+type FilterCondition struct {
+	Field string        `json:"field,omitempty"`
+	Match interface{}   `json:"match,omitempty"`
+	Any   []interface{} `json:"any,omitempty"`
+	Range *FilterRange  `json:"range,omitempty"`
+	SearchFilter
+}
+
+// FilterRange bounds are numbers or dates
+type FilterRange struct {
+	Gt  interface{} `json:"gt,omitempty"`
+	Gte interface{} `json:"gte,omitempty"`
+	Lt  interface{} `json:"lt,omitempty"`
+	Lte interface{} `json:"lte,omitempty"`
+}
+
+func (f *SearchFilter) empty() bool {
+	return f == nil || len(f.Must)+len(f.Should)+len(f.MustNot) == 0
+}
+
+// usesField reports whether any condition, in any group, tests field
+func (f *SearchFilter) usesField(field string) bool {
+	if f == nil {
+		return false
+	}
+	for _, conditions := range [][]FilterCondition{f.Must, f.Should, f.MustNot} {
+		for _, c := range conditions {
+			if c.Field == field || c.SearchFilter.usesField(field) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// searchScope is the Qdrant filter of a search: the user's points, optionally of
+// one document, narrowed by the request filter
+func searchScope(username, docName string, filter *SearchFilter) (map[string]interface{}, error) {
+	scope := userDocFilter(username, docName)
+	if filter.empty() {
+		return scope, nil
+	}
+
+	count := 0
+	translated, err := filter.qdrantFilter(1, &count)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %v", err)
+	}
+	return withMust(scope, translated), nil
+}
+
+// withMust returns a copy of filter with extra "must" conditions (filter is not modified)
+func withMust(filter map[string]interface{}, conditions ...map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(filter))
+	for key, value := range filter {
+		out[key] = value
+	}
+	must, _ := filter["must"].([]map[string]interface{})
+	out["must"] = append(append([]map[string]interface{}{}, must...), conditions...)
+	return out
+}
+
+func (f *SearchFilter) qdrantFilter(depth int, count *int) (map[string]interface{}, error) {
+	if depth > maxFilterDepth {
+		return nil, fmt.Errorf("groups may be nested at most %d levels", maxFilterDepth)
+	}
+
+	out := make(map[string]interface{})
+	for _, clause := range []struct {
+		name       string
+		conditions []FilterCondition
+	}{
+		{"must", f.Must}, {"should", f.Should}, {"must_not", f.MustNot},
+	} {
+		if len(clause.conditions) == 0 {
+			continue
+		}
+		translated := make([]map[string]interface{}, 0, len(clause.conditions))
+		for _, condition := range clause.conditions {
+			*count++
+			if *count > maxFilterConditions {
+				return nil, fmt.Errorf("at most %d conditions are allowed", maxFilterConditions)
+			}
+			c, err := condition.qdrantCondition(depth, count)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", clause.name, err)
+			}
+			translated = append(translated, c)
+		}
+		out[clause.name] = translated
+	}
+	return out, nil
+}
+
+func (c FilterCondition) qdrantCondition(depth int, count *int) (map[string]interface{}, error) {
+	if c.Field == "" {
+		if c.SearchFilter.empty() {
+			return nil, fmt.Errorf("a condition needs a field or must/should/must_not")
+		}
+		if c.Match != nil || c.Any != nil || c.Range != nil {
+			return nil, fmt.Errorf("match/any/range need a field")
+		}
+		return c.SearchFilter.qdrantFilter(depth+1, count)
+	}
+	if !c.SearchFilter.empty() {
+		return nil, fmt.Errorf("field %q: a condition is either a field test or a group", c.Field)
+	}
+
+	key, err := filterFieldKey(c.Field)
+	if err != nil {
+		return nil, err
+	}
+
+	tests := 0
+	for _, set := range []bool{c.Match != nil, c.Any != nil, c.Range != nil} {
+		if set {
+			tests++
+		}
+	}
+	if tests != 1 {
+		return nil, fmt.Errorf("field %q needs exactly one of match, any or range", c.Field)
+	}
+
+	switch {
+	case c.Match != nil:
+		value, err := filterMatchValue(c.Match)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", c.Field, err)
+		}
+		return map[string]interface{}{"key": key, "match": map[string]interface{}{"value": value}}, nil
+
+	case c.Any != nil:
+		if len(c.Any) == 0 || len(c.Any) > maxMetadataListItems {
+			return nil, fmt.Errorf("field %q: any must have 1 to %d values", c.Field, maxMetadataListItems)
+		}
+		values := make([]interface{}, len(c.Any))
+		for i, v := range c.Any {
+			value, err := filterMatchValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %v", c.Field, err)
+			}
+			if _, isBool := value.(bool); isBool {
+				return nil, fmt.Errorf("field %q: any accepts text or integers", c.Field)
+			}
+			values[i] = value
+		}
+		return map[string]interface{}{"key": key, "match": map[string]interface{}{"any": values}}, nil
+
+	default:
+		bounds, err := c.Range.qdrantRange()
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", c.Field, err)
+		}
+		return map[string]interface{}{"key": key, "range": bounds}, nil
+	}
+}
+
+// filterFieldKey maps a filter field to its payload key
+func filterFieldKey(field string) (string, error) {
+	if builtinFilterFields[field] {
+		return field, nil
+	}
+	key := strings.TrimPrefix(field, metadataPayloadKey+".")
+	if !metadataKeyPattern.MatchString(key) {
+		return "", fmt.Errorf("unknown field %q", field)
+	}
+	return metadataPayloadKey + "." + key, nil
+}
+
+// filterMatchValue accepts text, integers and booleans (Qdrant matches no floats)
+func filterMatchValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string, bool:
+		return v, nil
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) > 1<<53 {
+			return nil, fmt.Errorf("match needs an integer, use range for %v", v)
+		}
+		return int64(v), nil
+	default:
+		return nil, fmt.Errorf("match accepts text, integers or booleans")
+	}
+}
+
+func (r *FilterRange) qdrantRange() (map[string]interface{}, error) {
+	bounds := make(map[string]interface{})
+	kind := ""
+	for _, bound := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"gt", r.Gt}, {"gte", r.Gte}, {"lt", r.Lt}, {"lte", r.Lte},
+	} {
+		if bound.value == nil {
+			continue
+		}
+		boundKind := ""
+		switch v := bound.value.(type) {
+		case float64:
+			boundKind = "number"
+		case string:
+			if !isMetadataDate(v) {
+				return nil, fmt.Errorf("range %s %q is not a number or a date (2024-05-01 or RFC 3339)", bound.name, v)
+			}
+			boundKind = "date"
+		default:
+			return nil, fmt.Errorf("range %s must be a number or a date", bound.name)
+		}
+		if kind != "" && kind != boundKind {
+			return nil, fmt.Errorf("range bounds must all be numbers or all dates")
+		}
+		kind = boundKind
+		bounds[bound.name] = bound.value
+	}
+	if len(bounds) == 0 {
+		return nil, fmt.Errorf("range needs gt, gte, lt or lte")
+	}
+	return bounds, nil
+}
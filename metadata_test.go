@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{"empty", "  ", nil, ""},
+		{"values", `{"course": "Fizica 1", "year": 2024, "score": 9.5, "final": true}`,
+			map[string]interface{}{"course": "Fizica 1", "year": int64(2024), "score": 9.5, "final": true}, ""},
+		{"lists", `{"tags": ["fizică", "examen"], "weeks": [1, 2.5]}`,
+			map[string]interface{}{"tags": []interface{}{"fizică", "examen"}, "weeks": []interface{}{int64(1), 2.5}}, ""},
+		{"not an object", `["a"]`, nil, "must be a JSON object"},
+		{"bad key", `{"the course": "x"}`, nil, "letters, digits and _"},
+		{"key starting with a digit", `{"1st": "x"}`, nil, "letters, digits and _"},
+		{"null", `{"a": null}`, nil, "null values"},
+		{"object", `{"a": {"b": 1}}`, nil, "objects are not supported"},
+		{"empty list", `{"a": []}`, nil, "1 to 100 items"},
+		{"nested list", `{"a": [[1]]}`, nil, "nested lists"},
+		{"mixed list", `{"a": ["x", 1]}`, nil, "same type"},
+		{"bool list", `{"a": [true]}`, nil, "only text or numbers"},
+		{"long text", `{"a": "` + strings.Repeat("ă", maxMetadataValueChars+1) + `"}`, nil, "longer than"},
+		{"huge number", `{"a": 1e999}`, nil, "invalid number"},
+		{"too many keys", manyMetadataKeys(maxMetadataKeys + 1), nil, "at most 32"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMetadata(tt.raw)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseMetadata error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMetadata failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMetadata = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func manyMetadataKeys(n int) string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = `"k` + strings.Repeat("x", i) + `": 1`
+	}
+	return "{" + strings.Join(keys, ", ") + "}"
+}
+
+func TestSearchFilterQdrantFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		want    string // Qdrant filter as JSON
+		wantErr string
+	}{
+		{"match metadata",
+			`{"must": [{"field": "course", "match": "Fizica 1"}]}`,
+			`{"must":[{"key":"metadata.course","match":{"value":"Fizica 1"}}]}`, ""},
+		{"prefixed key and builtin field",
+			`{"must": [{"field": "metadata.year", "match": 2024}, {"field": "page_num", "range": {"gte": 1, "lte": 10}}]}`,
+			`{"must":[{"key":"metadata.year","match":{"value":2024}},{"key":"page_num","range":{"gte":1,"lte":10}}]}`, ""},
+		{"any and must_not",
+			`{"should": [{"field": "tags", "any": ["examen", "curs"]}], "must_not": [{"field": "doc_name", "any": ["vechi.pdf"]}]}`,
+			`{"must_not":[{"key":"doc_name","match":{"any":["vechi.pdf"]}}],"should":[{"key":"metadata.tags","match":{"any":["examen","curs"]}}]}`, ""},
+		{"date range",
+			`{"must": [{"field": "uploaded_at", "range": {"gte": "2024-05-01", "lt": "2024-06-01T00:00:00Z"}}]}`,
+			`{"must":[{"key":"uploaded_at","range":{"gte":"2024-05-01","lt":"2024-06-01T00:00:00Z"}}]}`, ""},
+		{"nested group",
+			`{"must": [{"should": [{"field": "year", "match": 2023}, {"field": "year", "match": 2024}]}]}`,
+			`{"must":[{"should":[{"key":"metadata.year","match":{"value":2023}},{"key":"metadata.year","match":{"value":2024}}]}]}`, ""},
+		{"bool match",
+			`{"must": [{"field": "final", "match": true}]}`,
+			`{"must":[{"key":"metadata.final","match":{"value":true}}]}`, ""},
+
+		{"unknown field", `{"must": [{"field": "a-b", "match": "x"}]}`, "", `unknown field "a-b"`},
+		{"no test", `{"must": [{"field": "year"}]}`, "", "exactly one of match, any or range"},
+		{"two tests", `{"must": [{"field": "year", "match": 1, "any": [1]}]}`, "", "exactly one of match, any or range"},
+		{"float match", `{"must": [{"field": "score", "match": 9.5}]}`, "", "use range"},
+		{"object match", `{"must": [{"field": "year", "match": {"a": 1}}]}`, "", "match accepts text"},
+		{"bool in any", `{"must": [{"field": "tags", "any": [true]}]}`, "", "any accepts text or integers"},
+		{"mixed range", `{"must": [{"field": "year", "range": {"gte": 1, "lte": "2024-05-01"}}]}`, "", "must all be numbers or all dates"},
+		{"text range", `{"must": [{"field": "year", "range": {"gte": "soon"}}]}`, "", "not a number or a date"},
+		{"empty range", `{"must": [{"field": "year", "range": {}}]}`, "", "range needs gt"},
+		{"empty condition", `{"must": [{}]}`, "", "needs a field or must/should/must_not"},
+		{"field and group", `{"must": [{"field": "year", "must": [{"field": "year", "match": 1}]}]}`, "", "either a field test or a group"},
+		{"test without field", `{"must": [{"match": 1, "must": [{"field": "year", "match": 1}]}]}`, "", "need a field"},
+		{"deepest group", `{"must": [{"must": [{"must": [{"must": [{"field": "year", "match": 1}]}]}]}]}`,
+			`{"must":[{"must":[{"must":[{"must":[{"key":"metadata.year","match":{"value":1}}]}]}]}]}`, ""},
+		{"too deep", `{"must": [{"must": [{"must": [{"must": [{"must": [{"field": "year", "match": 1}]}]}]}]}]}`, "", "nested at most 4 levels"},
+		{"too many conditions", `{"must": [` + strings.TrimSuffix(strings.Repeat(`{"field": "year", "match": 1},`, maxFilterConditions+1), ",") + `]}`,
+			"", "at most 64 conditions"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filter SearchFilter
+			if err := json.Unmarshal([]byte(tt.filter), &filter); err != nil {
+				t.Fatalf("bad test filter: %v", err)
+			}
+			count := 0
+			got, err := filter.qdrantFilter(1, &count)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("qdrantFilter error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("qdrantFilter failed: %v", err)
+			}
+			if encoded, _ := json.Marshal(got); string(encoded) != tt.want {
+				t.Errorf("qdrantFilter = %s, want %s", encoded, tt.want)
+			}
+		})
+	}
+}
+
+// scopeDocNames lists the documents with at least one point in scope
+func scopeDocNames(t *testing.T, scope map[string]interface{}) []string {
+	t.Helper()
+	points, err := scrollAllPoints(scope, []string{"doc_name"})
+	if err != nil {
+		t.Fatalf("scroll failed: %v", err)
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, point := range points {
+		if !seen[point.Payload.DocName] {
+			seen[point.Payload.DocName] = true
+			names = append(names, point.Payload.DocName)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSearchScopeFiltersMetadata(t *testing.T) {
+	useTestVectorStore(t)
+	documents := []struct {
+		name     string
+		metadata string
+	}{
+		{"fizica.pdf", `{"course": "Fizica 1", "year": 2024, "tags": ["examen", "curs"], "date": "2024-05-01"}`},
+		{"chimie.pdf", `{"course": "Chimie", "year": 2023, "tags": ["curs"], "date": "2023-10-01"}`},
+		{"notite.pdf", ""},
+	}
+	for _, doc := range documents {
+		metadata, err := parseMetadata(doc.metadata)
+		if err != nil {
+			t.Fatalf("bad metadata for %s: %v", doc.name, err)
+		}
+		chunks := []StoreChunk{{Text: "text of " + doc.name, PageNum: 1}, {Text: "more of " + doc.name, PageNum: 2}}
+		if _, err := storePagesInQdrant("ana", chunks, doc.name, "hash-"+doc.name, "page", metadata, nil, nil); err != nil {
+			t.Fatalf("failed to store %s: %v", doc.name, err)
+		}
+	}
+	storeTestChunks(t, "bob", "fizica.pdf", []int{1}, []string{"bob's physics"})
+
+	tests := []struct {
+		name   string
+		filter string
+		want   []string
+	}{
+		{"no filter", `{}`, []string{"chimie.pdf", "fizica.pdf", "notite.pdf"}},
+		{"match", `{"must": [{"field": "course", "match": "Chimie"}]}`, []string{"chimie.pdf"}},
+		{"list element", `{"must": [{"field": "tags", "any": ["examen"]}]}`, []string{"fizica.pdf"}},
+		{"number range", `{"must": [{"field": "year", "range": {"gte": 2024}}]}`, []string{"fizica.pdf"}},
+		{"date range", `{"must": [{"field": "date", "range": {"lt": "2024-01-01"}}]}`, []string{"chimie.pdf"}},
+		{"must_not keeps documents without the key", `{"must_not": [{"field": "year", "match": 2024}]}`, []string{"chimie.pdf", "notite.pdf"}},
+		{"group", `{"must": [{"should": [{"field": "year", "match": 2023}, {"field": "doc_name", "match": "notite.pdf"}]}]}`,
+			[]string{"chimie.pdf", "notite.pdf"}},
+		{"page", `{"must": [{"field": "course", "match": "Fizica 1"}, {"field": "page_num", "range": {"gte": 2}}]}`, []string{"fizica.pdf"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filter SearchFilter
+			if err := json.Unmarshal([]byte(tt.filter), &filter); err != nil {
+				t.Fatalf("bad test filter: %v", err)
+			}
+			scope, err := searchScope("ana", "", &filter)
+			if err != nil {
+				t.Fatalf("searchScope failed: %v", err)
+			}
+			if got := scopeDocNames(t, scope); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("searched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
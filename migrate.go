@@ -0,0 +1,200 @@
+package main
+
+/*
+MIGRARE COLECȚIE SIMPLĂ -> DENSE + SPARSE
+
+    pdf-response migrate-collection [-source pages] [-target pages_hybrid] [-batch 256]
+
+Copiază toate punctele dintr-o colecție cu un singur vector nenumit într-o
+colecție nouă cu vectorii "dense" și "bm25" (vezi sparse.go):
+  - vectorul existent devine "dense", fără apeluri noi către provider
+  - vectorul sparse și token_count sunt calculate din payload-ul "text"
+  - ID-urile și payload-ul rămân aceleași, deci comanda poate fi reluată
+    după o întrerupere (upsert idempotent)
+
+Colecția sursă nu este modificată. După migrare se setează
+QDRANT_COLLECTION=<target> și se repornește serverul; revenirea înseamnă
+doar setarea la loc a vechii valori.
+*/
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// migratedPoint is a point read from a simple vector collection
+type migratedPoint struct {
+	ID      interface{}            `json:"id"` // UUID string or integer
+	Vector  []float32              `json:"vector"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// runCollectionMigration implements the "migrate-collection" command; returns the exit code
+func runCollectionMigration(args []string) int {
+	if kind, _ := vectorStoreKind(); kind == VectorStoreEmbedded {
+		fmt.Printf("❌ migrate-collection applies to Qdrant only (embedded collections are always dense + sparse)\n")
+		return 1
+	}
+	source := newQdrantConnectionFromEnv()
+
+	flags := flag.NewFlagSet("migrate-collection", flag.ContinueOnError)
+	sourceName := flags.String("source", source.Collection, "simple vector collection to copy")
+	targetName := flags.String("target", "", "hybrid collection to create (default <source>_hybrid)")
+	batch := flags.Int("batch", documentScrollPageSize, "points per scroll/upsert request")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	source.Collection = *sourceName
+	if *targetName == "" {
+		*targetName = source.Collection + "_hybrid"
+	}
+	if *batch <= 0 || *targetName == source.Collection {
+		fmt.Printf("❌ -batch must be positive and -target must differ from -source\n")
+		return 2
+	}
+	target := newQdrantConnectionFromEnv()
+	target.Collection = *targetName
+
+	body, status, err := source.do("GET", source.collectionPath(""), nil)
+	if err != nil || status >= 400 {
+		fmt.Printf("❌ Cannot read collection '%s': %v %s\n", source.Collection, err, truncateBody(body, 256))
+		return 1
+	}
+	vectors, hybrid, err := parseVectorConfig(body)
+	if err != nil {
+		fmt.Printf("❌ Collection '%s': %v\n", source.Collection, err)
+		return 1
+	}
+	if hybrid {
+		fmt.Printf("✅ Collection '%s' already has dense + sparse vectors, nothing to migrate\n", source.Collection)
+		return 0
+	}
+
+	if err := prepareMigrationTarget(target, vectors); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("🚚 Migrating '%s' -> '%s' (dense %d %s + sparse %s)\n", source.Collection, target.Collection, vectors.Size, vectors.Distance, sparseVectorName)
+
+	copied := 0
+	var offset interface{}
+	for {
+		points, next, err := source.scrollWithVectors(offset, *batch)
+		if err != nil {
+			fmt.Printf("❌ %v (copied %d points, safe to re-run)\n", err, copied)
+			return 1
+		}
+		if len(points) > 0 {
+			if err := target.upsertMigrated(points); err != nil {
+				fmt.Printf("❌ %v (copied %d points, safe to re-run)\n", err, copied)
+				return 1
+			}
+			copied += len(points)
+			fmt.Printf("📤 %d points copied\n", copied)
+		}
+		if next == nil || len(points) == 0 {
+			break
+		}
+		offset = next
+	}
+
+	fmt.Printf("✅ Migrated %d points to '%s'. Set QDRANT_COLLECTION=%s and restart; '%s' was left unchanged.\n",
+		copied, target.Collection, target.Collection, source.Collection)
+	return 0
+}
+
+// prepareMigrationTarget creates the hybrid collection, or checks an existing one
+// (an interrupted migration) has the same dense vector config
+func prepareMigrationTarget(target *QdrantClient, vectors VectorConfig) error {
+	body, status, err := target.do("GET", target.collectionPath(""), nil)
+	if err != nil {
+		return fmt.Errorf("failed to reach Qdrant at %s: %v", target.URL, err)
+	}
+
+	switch {
+	case status == http.StatusNotFound:
+		if !strings.EqualFold(vectors.Distance, qdrantDistance) {
+			return fmt.Errorf("source distance is %s, only %s is supported", vectors.Distance, qdrantDistance)
+		}
+		if err := target.createHybridCollection(vectors.Size); err != nil {
+			return err
+		}
+	case status >= 400:
+		return fmt.Errorf("failed to get collection '%s': status %d, response: %s", target.Collection, status, string(body))
+	default:
+		existing, hybrid, err := parseVectorConfig(body)
+		if err != nil || !hybrid || existing.Size != vectors.Size {
+			return fmt.Errorf("target collection '%s' exists and is not a hybrid collection of size %d", target.Collection, vectors.Size)
+		}
+		fmt.Printf("♻️ Target '%s' exists, resuming\n", target.Collection)
+	}
+	return target.ensurePayloadIndexes()
+}
+
+func (q *QdrantClient) scrollWithVectors(offset interface{}, limit int) ([]migratedPoint, interface{}, error) {
+	scrollReq := map[string]interface{}{
+		"limit":        limit,
+		"with_payload": true,
+		"with_vector":  true,
+	}
+	if offset != nil {
+		scrollReq["offset"] = offset
+	}
+	payload, err := json.Marshal(scrollReq)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal scroll request: %v", err)
+	}
+
+	bodyBytes, status, err := q.do("POST", q.collectionPath("/points/scroll"), payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to execute scroll: %v", err)
+	}
+	if status >= 400 {
+		return nil, nil, fmt.Errorf("scroll failed: status %d, response: %s", status, string(bodyBytes))
+	}
+
+	var scrollResp struct {
+		Result struct {
+			Points         []migratedPoint `json:"points"`
+			NextPageOffset interface{}     `json:"next_page_offset"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(bodyBytes, &scrollResp); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode scroll response: %v", err)
+	}
+	return scrollResp.Result.Points, scrollResp.Result.NextPageOffset, nil
+}
+
+func (q *QdrantClient) upsertMigrated(points []migratedPoint) error {
+	batch := make([]map[string]interface{}, 0, len(points))
+	for _, point := range points {
+		text, _ := point.Payload["text"].(string)
+		if _, ok := point.Payload["token_count"]; !ok {
+			point.Payload["token_count"] = len(tokenizeForBM25(text))
+		}
+		// The sparse vector sees the same text as the dense one (enrich.go)
+		header, _ := point.Payload["context_header"].(string)
+		batch = append(batch, map[string]interface{}{
+			"id":      point.ID,
+			"vector":  hybridPointVector(point.Vector, header+text),
+			"payload": point.Payload,
+		})
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{"points": batch})
+	if err != nil {
+		return fmt.Errorf("failed to marshal batch payload: %v", err)
+	}
+	bodyBytes, status, err := q.do("PUT", q.collectionPath("/points?wait=true"), payload)
+	if err != nil {
+		return fmt.Errorf("failed to upload batch: %v", err)
+	}
+	if status >= 400 {
+		return fmt.Errorf("batch upload failed: Status %d, Response: %s", status, string(bodyBytes))
+	}
+	return nil
+}
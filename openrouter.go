@@ -2,10 +2,8 @@ package main
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"strings"
@@ -14,6 +12,12 @@ import (
 
 const OpenRouterAPIURL = "https://openrouter.ai/api/v1/chat/completions"
 
+// openRouterURL is where callOpenRouter sends requests (a local server in tests)
+var openRouterURL = OpenRouterAPIURL
+
+// openRouterClient is created in main() after .env is loaded
+var openRouterClient *ResilientClient
+
 // const OpenRouterModel = "google/gemini-flash-1.5-8b"
 const OpenRouterModel = "google/gemini-2.0-flash-001"
 
@@ -267,44 +271,28 @@ func callOpenRouter(reqBody OpenRouterRequest, apiKey string) (string, error) {
 		return "", fmt.Errorf("failed to marshal request: %v", err)
 	}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "POST", OpenRouterAPIURL, bytes.NewBuffer(payload))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("HTTP-Referer", "https://github.com/catalinfl/pdf-response")
-	req.Header.Set("X-Title", "PDF Response Tool")
-
-	// Client with timeout
-	client := &http.Client{
-		Timeout: 35 * time.Second, // Slightly higher than context timeout
-	}
-
+	// Retries, Retry-After and the circuit breaker are handled by the resilient client
 	startTime := time.Now()
-	resp, err := client.Do(req)
+	result, err := openRouterClient.Do(func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", openRouterURL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("HTTP-Referer", "https://github.com/catalinfl/pdf-response")
+		req.Header.Set("X-Title", "PDF Response Tool")
+		return req, nil
+	})
 	apiCallDuration := time.Since(startTime)
 
 	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("OpenRouter API call timeout after %v", apiCallDuration)
-		}
 		return "", fmt.Errorf("failed to call OpenRouter API: %v (took %v)", err, apiCallDuration)
 	}
-	defer resp.Body.Close()
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %v", err)
-	}
 
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("OpenRouter API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	bodyBytes := result.Body
+	if result.StatusCode != 200 {
+		return "", fmt.Errorf("OpenRouter API returned status %d: %s", result.StatusCode, string(bodyBytes))
 	}
 
 	var openRouterResp OpenRouterResponse
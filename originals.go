@@ -0,0 +1,182 @@
+package main
+
+/*
+ORIGINALE (PDF-urile salvate, pentru /render cu doc_name sau doc_hash)
+
+/extract/store păstrează PDF-ul încărcat în ORIGINALS_PATH (bbolt, implicit
+originals.db; "off" = nu se păstrează, iar /render acceptă doar fișiere
+trimise). Cheia este username + doc_hash, deci același fișier salvat sub două
+nume ocupă loc o singură dată. Doar PDF-urile sunt păstrate, fiindcă doar ele
+pot fi randate.
+
+Un original este șters când niciun document al utilizatorului nu mai are acel
+doc_hash: după DELETE /documents, după înlocuirea cu o versiune nouă și la
+/leave.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const defaultOriginalsPath = "originals.db"
+
+var (
+	originalsBucket = []byte("originals") // username \x00 doc_hash -> file bytes
+
+	errOriginalsDisabled = errors.New("stored originals are disabled (ORIGINALS_PATH=off), send the file instead")
+	errOriginalNotFound  = errors.New("no stored original")
+)
+
+// OriginalStore keeps the uploaded PDFs on local disk
+type OriginalStore struct {
+	db   *bolt.DB
+	path string
+}
+
+// originals is nil when ORIGINALS_PATH is off (every method accepts a nil store)
+var originals *OriginalStore
+
+func newOriginalStoreFromEnv() (*OriginalStore, error) {
+	path := os.Getenv("ORIGINALS_PATH")
+	if path == "" {
+		path = defaultOriginalsPath
+	}
+	if strings.EqualFold(path, "off") {
+		return nil, nil
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open originals store %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(originalsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize originals store: %v", err)
+	}
+
+	fmt.Printf("📁 Originals store %s\n", path)
+	return &OriginalStore{db: db, path: path}, nil
+}
+
+func originalKey(username, docHash string) []byte {
+	return []byte(username + "\x00" + docHash)
+}
+
+// Save keeps data unless this user already has the same file
+func (s *OriginalStore) Save(username, docHash string, data []byte) error {
+	if s == nil {
+		return nil
+	}
+	key := originalKey(username, docHash)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(originalsBucket)
+		if b.Get(key) != nil {
+			return nil
+		}
+		return b.Put(key, data)
+	})
+}
+
+// Load returns a copy of the stored file
+func (s *OriginalStore) Load(username, docHash string) ([]byte, error) {
+	if s == nil {
+		return nil, errOriginalsDisabled
+	}
+	var data []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if stored := tx.Bucket(originalsBucket).Get(originalKey(username, docHash)); stored != nil {
+			data = append([]byte(nil), stored...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the original: %v", err)
+	}
+	if data == nil {
+		return nil, errOriginalNotFound
+	}
+	return data, nil
+}
+
+// Prune removes the originals of username that no stored point references anymore
+func (s *OriginalStore) Prune(username string) {
+	if s == nil {
+		return
+	}
+	prefix := originalKey(username, "")
+	var hashes []string
+	s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(originalsBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			hashes = append(hashes, string(k[len(prefix):]))
+		}
+		return nil
+	})
+
+	for _, docHash := range hashes {
+		count, err := countPoints(withMust(userDocFilter(username, ""),
+			map[string]interface{}{"key": "doc_hash", "match": map[string]string{"value": docHash}}))
+		if err != nil {
+			fmt.Printf("⚠️ Failed to check the original %.12s of user '%s': %v\n", docHash, username, err)
+			continue
+		}
+		if count > 0 {
+			continue
+		}
+		err = s.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(originalsBucket).Delete(originalKey(username, docHash))
+		})
+		if err != nil {
+			fmt.Printf("⚠️ Failed to delete the original %.12s of user '%s': %v\n", docHash, username, err)
+			continue
+		}
+		fmt.Printf("🧹 Deleted the original %.12s of user '%s'\n", docHash, username)
+	}
+}
+
+func (s *OriginalStore) Close() {
+	if s != nil {
+		s.db.Close()
+	}
+}
+
+// storedOriginal finds the original of a stored document by name or by doc_hash
+func storedOriginal(username, docName, docHash string) ([]byte, error) {
+	if originals == nil {
+		return nil, errOriginalsDisabled
+	}
+	ref := docName
+	if docHash != "" {
+		ref = docHash
+	} else {
+		filter := userDocFilter(username, docName)
+		filter["must_not"] = []map[string]interface{}{{"is_empty": map[string]string{"key": "doc_hash"}}}
+
+		var points []SearchResult
+		if _, err := qdrant.Store.Scroll(ScrollRequest{Filter: filter, Limit: 1, WithPayload: []string{"doc_hash"}}, &points); err != nil {
+			return nil, fmt.Errorf("failed to look up document: %v", err)
+		}
+		if len(points) == 0 {
+			return nil, fmt.Errorf("%w: document '%s' not found", errOriginalNotFound, docName)
+		}
+		docHash = points[0].Payload.DocHash
+	}
+
+	data, err := originals.Load(username, docHash)
+	if errors.Is(err, errOriginalNotFound) {
+		// Stored before originals were kept, or not a PDF
+		return nil, fmt.Errorf("%w for '%s', send the file instead", errOriginalNotFound, ref)
+	}
+	return data, err
+}
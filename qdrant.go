@@ -1,43 +1,21 @@
 package main
 
 import (
-	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
 
-const QdrantURL = "https://qdrant-production-449a.up.railway.app"
-const OpenAIAPIURL = "https://api.openai.com/v1/embeddings"
-
-// OpenAI Embedding Request/Response structures
-type OpenAIEmbeddingRequest struct {
-	Input          []string `json:"input"`
-	Model          string   `json:"model"`
-	EncodingFormat string   `json:"encoding_format,omitempty"`
-}
-
-type OpenAIEmbeddingResponse struct {
-	Data []struct {
-		Object    string    `json:"object"`
-		Embedding []float32 `json:"embedding"`
-		Index     int       `json:"index"`
-	} `json:"data"`
-	Model string `json:"model"`
-	Usage struct {
-		PromptTokens int `json:"prompt_tokens"`
-		TotalTokens  int `json:"total_tokens"`
-	} `json:"usage"`
-}
-
 // Qdrant Collection and Vector Configuration
 type QdrantCollection struct {
-	Vectors VectorConfig `json:"vectors"` // Simple vector config, not named vectors
+	Vectors       interface{}                   `json:"vectors"` // VectorConfig, or named VectorConfigs
+	SparseVectors map[string]SparseVectorConfig `json:"sparse_vectors,omitempty"`
 }
 
 type VectorConfig struct {
@@ -45,19 +23,39 @@ type VectorConfig struct {
 	Distance string `json:"distance"`
 }
 
-// Vector Point for Qdrant with simple vectors
+// Vector Point for Qdrant: a simple vector array, or named dense + sparse
+// vectors in hybrid collections (see sparse.go)
 type QdrantPoint struct {
 	ID      string      `json:"id"`
-	Vector  []float32   `json:"vector"` // Simple vector array
+	Vector  interface{} `json:"vector"`
 	Payload interface{} `json:"payload"`
 }
 
 // Page payload structure
 type QdrantPage struct {
-	Username string `json:"username"`
-	Text     string `json:"text"`
-	PageNum  int    `json:"page_num"`
-	DocName  string `json:"doc_name,omitempty"`
+	Username      string                 `json:"username"`
+	Text          string                 `json:"text"`
+	PageNum       int                    `json:"page_num"`
+	DocName       string                 `json:"doc_name,omitempty"`
+	Embedder      string                 `json:"embedder,omitempty"`    // model that produced the vector
+	UploadedAt    string                 `json:"uploaded_at,omitempty"` // RFC 3339, UTC
+	DocHash       string                 `json:"doc_hash,omitempty"`    // SHA-256 of the uploaded file
+	DocID         string                 `json:"doc_id,omitempty"`      // random, kept across versions and renames
+	ChunksHash    string                 `json:"chunks_hash,omitempty"` // SHA-256 of all stored texts (detects chunking changes)
+	ChunkIndex    int                    `json:"chunk_index"`
+	TokenCount    int                    `json:"token_count,omitempty"`  // BM25 document length
+	Chunking      string                 `json:"chunking,omitempty"`     // strategy and parameters, e.g. "fixed:400/50"
+	ChunkTokens   int                    `json:"chunk_tokens,omitempty"` // BPE tokens of Text
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`     // user fields from the upload (metadata.go)
+	ChunkStart    int                    `json:"chunk_start,omitempty"`  // rune offsets of Text in the page
+	ChunkEnd      int                    `json:"chunk_end,omitempty"`
+	ParentID      string                 `json:"parent_id,omitempty"`      // small-to-big parent (context.go)
+	ParentText    string                 `json:"parent_text,omitempty"`    // only on the first child of a parent
+	ParentTokens  int                    `json:"parent_tokens,omitempty"`  // BPE tokens of the parent
+	Section       string                 `json:"section,omitempty"`        // heading path, "A > B" (enrich.go)
+	ContextHeader string                 `json:"context_header,omitempty"` // embedded before Text, not part of it
+	Enrichment    string                 `json:"enrichment,omitempty"`     // header or llm:<model>
+	Layout        *ChunkLayout           `json:"layout,omitempty"`         // offsets relative to Text
 }
 
 // Search request structure
@@ -66,9 +64,13 @@ type SearchRequest struct {
 	Vector      []float32   `json:"vector"`
 	Filter      interface{} `json:"filter,omitempty"`
 	Limit       int         `json:"limit"`
-	WithPayload bool        `json:"with_payload,omitempty"`
+	WithPayload interface{} `json:"with_payload,omitempty"`
 }
 
+// searchPayload is the payload returned with search hits: everything except the
+// parent text, which is only read when building the answer context
+var searchPayload = map[string]interface{}{"exclude": []string{"parent_text"}}
+
 // Search response structure
 type SearchResponse struct {
 	Result []SearchResult `json:"result"`
@@ -79,493 +81,462 @@ type SearchResult struct {
 	ID      string     `json:"id"`
 	Score   float32    `json:"score"`
 	Payload QdrantPage `json:"payload"`
-}
-
-// Store pages in Qdrant with OpenAI embeddings
-func storePagesInQdrant(username string, pages []string, docName string) error {
-	var allPages []string
-	var pagePayload []QdrantPage
-
-	// Create pages with 20% overlap for better context preservation
-	pagesWithOverlap := createPagesWithOverlap(pages, 0.2) // 20% overlap
-
-	// Collect all pages and their metadata
-	for pageNum, page := range pagesWithOverlap {
-		if strings.TrimSpace(page) == "" || len(page) < 20 {
-			continue // Skip empty pages
-		}
 
-		allPages = append(allPages, page)
-		pagePayload = append(pagePayload, QdrantPage{
-			Username: username,
-			Text:     page,
-			PageNum:  pageNum + 1,
-			DocName:  docName,
-		})
-	}
+	// Set by hybrid search: 1-based rank and raw score in each retriever
+	KeywordRank  int     `json:"keyword_rank,omitempty"`
+	KeywordScore float32 `json:"keyword_score,omitempty"`
+	VectorRank   int     `json:"vector_rank,omitempty"`
+	VectorScore  float32 `json:"vector_score,omitempty"`
 
-	if len(allPages) == 0 {
-		return fmt.Errorf("no pages found to store")
-	}
-
-	// Get embeddings from OpenAI in batches
-	embeddings, err := getOpenAIEmbeddings(allPages)
-	if err != nil {
-		return fmt.Errorf("failed to get OpenAI embeddings: %v", err)
-	}
+	// Set by the reranker (see rerank.go): Score is then the rerank score
+	RetrievalScore float32  `json:"retrieval_score,omitempty"`
+	RerankScore    *float32 `json:"rerank_score,omitempty"`
 
-	if len(embeddings) != len(allPages) {
-		return fmt.Errorf("mismatch between pages (%d) and embeddings (%d)", len(allPages), len(embeddings))
-	}
-
-	// Create Qdrant points with UUID IDs and named vectors
-	var points []QdrantPoint
-	for i, embedding := range embeddings {
-		// Generate UUID for unique ID
-		pointID := uuid.New().String()
-
-		point := QdrantPoint{
-			ID:      pointID,
-			Vector:  embedding, // Simple vector array
-			Payload: pagePayload[i],
-		}
-		points = append(points, point)
-	}
-
-	fmt.Printf("📤 Uploading %d pages to Qdrant...\n", len(points))
-
-	// Upload all points in a single batch request for better performance
-	batchPayload := map[string]interface{}{
-		"points": points,
-	}
-
-	payload, err := json.Marshal(batchPayload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal batch payload: %v", err)
-	}
-
-	// Use wait=true parameter to ensure operation completes
-	url := fmt.Sprintf("%s/collections/pages/points?wait=true", QdrantURL)
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(payload))
-	if err != nil {
-		return fmt.Errorf("failed to create batch request: %v", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
+	// Set by /search (see snippets.go)
+	Snippets []Snippet `json:"snippets,omitempty"`
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to upload batch: %v", err)
-	}
-	defer resp.Body.Close()
+// Store outcomes returned by storePagesInQdrant
+const (
+	StoreCreated   = "created"
+	StoreUnchanged = "unchanged" // same file already stored, nothing uploaded
+	StoreReplaced  = "replaced"  // previous version of doc_name was replaced
+)
 
-	// Read response body
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %v", err)
-	}
+// qdrantUpsertBatchSize - points per upsert request
+const qdrantUpsertBatchSize = 256
 
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("batch upload failed: Status %d, Response: %s", resp.StatusCode, string(bodyBytes))
-	}
+// pointIDNamespace seeds the deterministic (UUID v5) point IDs
+var pointIDNamespace = uuid.MustParse("6f1c2a9e-4b7d-5e3a-9c1f-2d8b7a6e5f40")
 
-	fmt.Printf("✅ Successfully uploaded all %d pages with OpenAI embeddings for user '%s' in Qdrant\n", len(points), username)
-	return nil
+// chunkPointID derives the point ID from (user, document, file hash, chunk index), so
+// uploading the same file again overwrites the same points instead of adding new ones.
+// The same file stored under two names gets two sets of points; docID keeps them apart
+// after a rename too (a renamed document keeps the IDs derived from its old name).
+func chunkPointID(username, docName, docID, docHash string, chunkIndex int) string {
+	key := fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%d", username, docName, docID, docHash, chunkIndex)
+	return uuid.NewSHA1(pointIDNamespace, []byte(key)).String()
 }
 
-// Search pages by username and similarity using OpenAI embeddings
-func searchPages(username, query, docName string, limit int) ([]SearchResult, error) {
-	// Generate embedding for search query using OpenAI
-	queryEmbeddings, err := getOpenAIEmbeddings([]string{query})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get query embedding: %v", err)
-	}
+// storedDocumentID returns the doc_id of a stored document, or a new one when the
+// document is new (or was stored before doc_id existed)
+func storedDocumentID(username, docName string) (string, error) {
+	filter := userDocFilter(username, docName)
+	filter["must_not"] = []map[string]interface{}{{"is_empty": map[string]string{"key": "doc_id"}}}
 
-	if len(queryEmbeddings) == 0 {
-		return nil, fmt.Errorf("no embedding generated for query")
-	}
-
-	queryVector := queryEmbeddings[0]
-
-	// Increase limit for hybrid search (get more results to filter)
-	searchLimit := limit * 3
-	if searchLimit < 10 {
-		searchLimit = 10
+	var points []SearchResult
+	if _, err := qdrant.Store.Scroll(ScrollRequest{Filter: filter, Limit: 1, WithPayload: []string{"doc_id"}}, &points); err != nil {
+		return "", fmt.Errorf("failed to look up document id: %v", err)
 	}
-
-	// Create filter conditions - always include username
-	filterConditions := []map[string]interface{}{
-		{
-			"key": "username",
-			"match": map[string]string{
-				"value": username,
-			},
-		},
+	if len(points) > 0 && points[0].Payload.DocID != "" {
+		return points[0].Payload.DocID, nil
 	}
+	return uuid.NewString(), nil
+}
 
-	// Add doc_name filter if specified
-	if docName != "" {
-		filterConditions = append(filterConditions, map[string]interface{}{
-			"key": "doc_name",
-			"match": map[string]string{
-				"value": docName,
-			},
-		})
-	}
+// parentChunkID links the chunks of one parent. docID keeps the same file stored
+// under two names (or by two users) apart, and the version (docHash) keeps the
+// parents of a replaced file from mixing with the new ones.
+func parentChunkID(docID, docHash string, parent int) string {
+	return fmt.Sprintf("%s-%.16s-p%d", docID, docHash, parent)
+}
 
-	// Create search request with username filter (simple vector collection)
-	searchReq := SearchRequest{
-		Vector:      queryVector, // Direct vector array
-		WithPayload: true,
-		Filter: map[string]interface{}{
-			"must": filterConditions,
-		},
-		Limit: searchLimit,
-	}
+// StoreChunk is one text stored as a point
+type StoreChunk struct {
+	Text    string
+	PageNum int
+	Tokens  int          // BPE tokens (0 for page chunking)
+	Layout  *ChunkLayout // offsets relative to Text, optional
 
-	payload, err := json.Marshal(searchReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal search request: %v", err)
-	}
+	// Rune offsets of Text in the page (End 0: unknown, page chunking)
+	Start int
+	End   int
 
-	// Log the search request for debugging
-	fmt.Printf("🔍 Search Request: %s\n", string(payload))
+	// Small-to-big (see context.go): 1-based index of the parent chunk (0 none);
+	// the parent text is stored only on its first child
+	Parent       int
+	ParentText   string
+	ParentTokens int
 
-	// Use simple search endpoint for simple vector collections
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/collections/pages/points/search", QdrantURL), bytes.NewBuffer(payload))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create search request: %v", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed toa execute search: %v", err)
-	}
-	defer resp.Body.Close()
+	Section string // heading path for the context header (enrich.go)
+}
 
-	// Read response body for debugging
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
+// pageStoreChunks is the "page" chunking: every non-empty page (or paragraph split)
+// with 20% overlap from its neighbours. layouts is optional (nil) or aligned with pages;
+// offsets are relative to each page string.
+func pageStoreChunks(pages []string, layouts []*ChunkLayout) []StoreChunk {
+	// Drop empty pages here so layouts stay aligned with the overlap pages
+	var cleanPages []string
+	var cleanLayouts []*ChunkLayout
+	for i, page := range pages {
+		if strings.TrimSpace(page) == "" {
+			continue
+		}
+		cleanPages = append(cleanPages, page)
+		if i < len(layouts) {
+			cleanLayouts = append(cleanLayouts, layouts[i])
+		} else {
+			cleanLayouts = append(cleanLayouts, nil)
+		}
 	}
 
-	// Log the full response for debugging
-	fmt.Printf("🔍 Search Response: Status %d, Body: %s\n", resp.StatusCode, string(bodyBytes))
+	// Create pages with 20% overlap for better context preservation
+	pagesWithOverlap := createPagesWithOverlap(cleanPages, 0.2) // 20% overlap
 
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("search failed: status %d, response: %s", resp.StatusCode, string(bodyBytes))
-	}
+	var chunks []StoreChunk
+	for pageNum, page := range pagesWithOverlap {
+		if strings.TrimSpace(page) == "" || len(page) < 20 {
+			continue // Skip empty pages
+		}
 
-	var searchResp SearchResponse
-	if err := json.Unmarshal(bodyBytes, &searchResp); err != nil {
-		return nil, fmt.Errorf("failed to decode search response: %v", err)
+		chunk := StoreChunk{Text: page, PageNum: pageNum + 1}
+
+		// Shift layout offsets past the overlap prefix
+		if layout := cleanLayouts[pageNum]; layout != nil {
+			// The layout counts from the untrimmed page, the overlap page holds it trimmed
+			original := cleanPages[pageNum]
+			trimmed := strings.TrimSpace(original)
+			leading := len(original) - len(strings.TrimLeftFunc(original, unicode.IsSpace))
+			if idx := strings.Index(page, trimmed); idx >= 0 {
+				shift := utf8.RuneCountInString(page[:idx]) - utf8.RuneCountInString(original[:leading])
+				chunk.Layout = shiftChunkLayout(layout, shift)
+			}
+		}
+		chunks = append(chunks, chunk)
 	}
-
-	// Hybrid search: Filter results by text similarity for more precise matches
-	filteredResults := filterByTextSimilarity(searchResp.Result, query, limit)
-
-	return filteredResults, nil
+	return chunks
 }
 
-// Filter search results by text similarity to improve precision for name searches
-func filterByTextSimilarity(results []SearchResult, query string, limit int) []SearchResult {
-	if len(results) == 0 {
-		return results
-	}
-
-	// Convert query to lowercase for case-insensitive matching
-	queryLower := strings.ToLower(query)
-	queryWords := strings.Fields(queryLower)
-
-	// Score results based on exact matches and partial matches
-	type scoredResult struct {
-		result    SearchResult
-		textScore float32
-	}
-
-	var scoredResults []scoredResult
+// Store chunks in Qdrant with embeddings from the collection's embedder.
+// docHash fingerprints the file: re-uploading it is a no-op and a changed file under
+// the same docName replaces the old points. chunking describes the strategy
+// (empty for page chunking, so documents stored before it was recorded stay unchanged).
+// metadata is copied on every chunk; for an unchanged file it replaces the stored one.
+// enricher (optional) prepends a context header to the embedded texts; its LLM calls
+// are made only when the document is really (re)embedded.
+// Returns one of the Store* outcomes.
+func storePagesInQdrant(username string, chunks []StoreChunk, docName, docHash, chunking string, metadata map[string]interface{}, enricher *chunkEnricher, progress ingestProgress) (string, error) {
+	var allPages []string
+	var pagePayload []QdrantPage
+	var parents []int // parent of each chunk, 0 for none
 
-	for _, result := range results {
-		textLower := strings.ToLower(result.Payload.Text)
-		textScore := float32(0)
+	uploadedAt := time.Now().UTC().Format(time.RFC3339)
 
-		// Exact match gets highest score
-		if strings.Contains(textLower, queryLower) {
-			textScore = 1.0
-		} else {
-			// Partial word matches
-			matchedWords := 0
-			for _, word := range queryWords {
-				if len(word) > 2 && strings.Contains(textLower, word) {
-					matchedWords++
-				}
-			}
-			if len(queryWords) > 0 {
-				textScore = float32(matchedWords) / float32(len(queryWords))
-			}
+	for _, chunk := range chunks {
+		if strings.TrimSpace(chunk.Text) == "" {
+			continue
 		}
-
-		// Combine semantic score with text score
-		combinedScore := result.Score*0.7 + textScore*0.3
-
-		scoredResults = append(scoredResults, scoredResult{
-			result: SearchResult{
-				ID:      result.ID,
-				Score:   combinedScore,
-				Payload: result.Payload,
-			},
-			textScore: textScore,
+		allPages = append(allPages, chunk.Text)
+		pagePayload = append(pagePayload, QdrantPage{
+			Username:     username,
+			Text:         chunk.Text,
+			PageNum:      chunk.PageNum,
+			DocName:      docName,
+			Embedder:     qdrant.Embedder.Name(),
+			UploadedAt:   uploadedAt,
+			DocHash:      docHash,
+			ChunkIndex:   len(pagePayload),
+			TokenCount:   len(tokenizeForBM25(chunk.Text)),
+			Chunking:     chunking,
+			ChunkTokens:  chunk.Tokens,
+			Metadata:     metadata,
+			ChunkStart:   chunk.Start,
+			ChunkEnd:     chunk.End,
+			ParentText:   chunk.ParentText,
+			ParentTokens: chunk.ParentTokens,
+			Section:      chunk.Section,
+			Layout:       chunk.Layout,
 		})
+		parents = append(parents, chunk.Parent)
 	}
 
-	// Sort by combined score (descending)
-	for i := 0; i < len(scoredResults)-1; i++ {
-		for j := i + 1; j < len(scoredResults); j++ {
-			if scoredResults[i].result.Score < scoredResults[j].result.Score {
-				scoredResults[i], scoredResults[j] = scoredResults[j], scoredResults[i]
-			}
+	if len(allPages) == 0 {
+		return "", fmt.Errorf("no pages found to store")
+	}
+
+	chunksHash := sha256.New()
+	if chunking != "" {
+		chunksHash.Write([]byte(chunking))
+		chunksHash.Write([]byte{0})
+	}
+	if enricher != nil {
+		// A new title (e.g. metadata "title") changes every header
+		chunksHash.Write([]byte("enrich:" + enricher.Name()))
+		chunksHash.Write([]byte{0})
+		chunksHash.Write([]byte(enricher.title))
+		chunksHash.Write([]byte{0})
+		for i := range pagePayload {
+			chunksHash.Write([]byte(pagePayload[i].Section))
+			chunksHash.Write([]byte{0})
 		}
 	}
-
-	// Return top results up to limit
-	var finalResults []SearchResult
-	for i := 0; i < len(scoredResults) && i < limit; i++ {
-		finalResults = append(finalResults, scoredResults[i].result)
+	for _, text := range allPages {
+		chunksHash.Write([]byte(text))
+		chunksHash.Write([]byte{0})
 	}
-
-	return finalResults
-}
-
-// Get OpenAI embeddings for multiple texts
-func getOpenAIEmbeddings(texts []string) ([][]float32, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	chunksDigest := fmt.Sprintf("%x", chunksHash.Sum(nil))
+	for i := range pagePayload {
+		pagePayload[i].ChunksHash = chunksDigest
 	}
 
-	// OpenAI has a limit on batch size, process in chunks of 100
-	const maxBatchSize = 100
-	var allEmbeddings [][]float32
-
-	for i := 0; i < len(texts); i += maxBatchSize {
-		end := i + maxBatchSize
-		if end > len(texts) {
-			end = len(texts)
+	// Same file, same chunks, same model: nothing to do
+	docFilter := userDocFilter(username, docName)
+	existing, err := countPoints(docFilter)
+	if err != nil {
+		return "", err
+	}
+	if existing == len(allPages) {
+		sameFile := userDocFilter(username, docName)
+		sameFile["must"] = append(sameFile["must"].([]map[string]interface{}),
+			map[string]interface{}{"key": "doc_hash", "match": map[string]string{"value": docHash}},
+			map[string]interface{}{"key": "chunks_hash", "match": map[string]string{"value": chunksDigest}},
+			map[string]interface{}{"key": "embedder", "match": map[string]string{"value": qdrant.Embedder.Name()}},
+		)
+		if enricher != nil {
+			// Chunks whose LLM summary failed were stored as "header": embed them again
+			sameFile = withMust(sameFile, map[string]interface{}{"key": "enrichment", "match": map[string]string{"value": enricher.Name()}})
 		}
-
-		batch := texts[i:end]
-		batchEmbeddings, err := getOpenAIEmbeddingsBatch(batch, apiKey)
+		unchanged, err := countPoints(sameFile)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get embeddings for batch %d-%d: %v", i, end-1, err)
+			return "", err
+		}
+		if unchanged == len(allPages) {
+			if metadata != nil {
+				qdrant.ensureMetadataIndexes(metadata)
+				if err := setPayloadByFilter(docFilter, map[string]interface{}{metadataPayloadKey: metadata}); err != nil {
+					return "", fmt.Errorf("failed to update metadata: %v", err)
+				}
+				fmt.Printf("🏷️ Updated metadata of '%s' for user '%s'\n", docName, username)
+			}
+			fmt.Printf("♻️ '%s' for user '%s' is already stored (%d chunks), skipping\n", docName, username, unchanged)
+			return StoreUnchanged, nil
 		}
-
-		allEmbeddings = append(allEmbeddings, batchEmbeddings...)
 	}
 
-	return allEmbeddings, nil
-}
-
-// Get embeddings for a single batch from OpenAI
-func getOpenAIEmbeddingsBatch(texts []string, apiKey string) ([][]float32, error) {
-	reqBody := OpenAIEmbeddingRequest{
-		Input:          texts,
-		Model:          "text-embedding-3-small", // Fast, efficient, 1536 dimensions
-		EncodingFormat: "float",
+	if metadata != nil {
+		qdrant.ensureMetadataIndexes(metadata)
 	}
 
-	payload, err := json.Marshal(reqBody)
+	docID, err := storedDocumentID(username, docName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal embedding request: %v", err)
+		return "", err
 	}
-
-	req, err := http.NewRequest("POST", OpenAIAPIURL, bytes.NewBuffer(payload))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create embedding request: %v", err)
+	for i := range pagePayload {
+		pagePayload[i].DocID = docID
+		if parents[i] > 0 {
+			pagePayload[i].ParentID = parentChunkID(docID, docHash, parents[i])
+		}
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to call OpenAI API: %v", err)
+	// The vectors see the context header, the payload keeps the raw text
+	embedTexts := allPages
+	if enricher != nil {
+		embedTexts = make([]string, len(pagePayload))
+		headers, applied := enricher.Headers(pagePayload)
+		for i, header := range headers {
+			pagePayload[i].ContextHeader = header
+			pagePayload[i].Enrichment = applied[i]
+			embedTexts[i] = embeddedText(pagePayload[i])
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("OpenAI API returned status %d", resp.StatusCode)
+	// Get embeddings in batches (progress is reported per batch)
+	var embeddings [][]float32
+	for start := 0; start < len(embedTexts); start += embeddingRequestBatchSize {
+		progress.report(JobStageEmbedding, start, len(embedTexts))
+		end := start + embeddingRequestBatchSize
+		if end > len(embedTexts) {
+			end = len(embedTexts)
+		}
+		batch, err := qdrant.Embedder.Embed(embedTexts[start:end])
+		if err != nil {
+			return "", fmt.Errorf("failed to get embeddings: %v", err)
+		}
+		embeddings = append(embeddings, batch...)
 	}
 
-	var embeddingResp OpenAIEmbeddingResponse
-	if err := json.NewDecoder(resp.Body).Decode(&embeddingResp); err != nil {
-		return nil, fmt.Errorf("failed to decode embedding response: %v", err)
+	if len(embeddings) != len(allPages) {
+		return "", fmt.Errorf("mismatch between pages (%d) and embeddings (%d)", len(allPages), len(embeddings))
 	}
 
-	// Extract embeddings in the same order as input
-	embeddings := make([][]float32, len(texts))
-	for _, data := range embeddingResp.Data {
-		if data.Index < len(embeddings) {
-			embeddings[data.Index] = data.Embedding
+	// Create Qdrant points with deterministic IDs
+	var points []QdrantPoint
+	var pointIDs []string
+	for i, embedding := range embeddings {
+		pointID := chunkPointID(username, docName, docID, docHash, i)
+		pointIDs = append(pointIDs, pointID)
+
+		point := QdrantPoint{
+			ID:      pointID,
+			Vector:  embedding,
+			Payload: pagePayload[i],
 		}
+		if qdrant.Hybrid {
+			point.Vector = hybridPointVector(embedding, embedTexts[i])
+		}
+		points = append(points, point)
 	}
 
-	fmt.Printf("🔮 Generated %d OpenAI embeddings (tokens: %d)\n", len(embeddings), embeddingResp.Usage.TotalTokens)
-	return embeddings, nil
-}
-
-// Hybrid search combining keyword matching with semantic search
-func searchPagesHybrid(username, query, docName string, limit int) ([]SearchResult, error) {
-	fmt.Printf("🔍 Starting hybrid search for: '%s'\n", query)
-
-	// First: Try exact text matching using scroll endpoint
-	keywordResults, keywordErr := searchPagesKeyword(username, query, docName, limit)
-	if keywordErr != nil {
-		fmt.Printf("⚠️ Keyword search failed: %v\n", keywordErr)
-	} else {
-		fmt.Printf("✅ Keyword search found %d results\n", len(keywordResults))
-	}
+	fmt.Printf("📤 Uploading %d pages to Qdrant...\n", len(points))
 
-	// If keyword search found exact matches, prioritize them
-	if len(keywordResults) > 0 {
-		// Check if any result contains the exact query
-		for _, result := range keywordResults {
-			if strings.Contains(strings.ToLower(result.Payload.Text), strings.ToLower(query)) {
-				fmt.Printf("🎯 Found exact match in keyword results\n")
-				return keywordResults, nil
-			}
+	// Upload in large batches; point IDs are deterministic, so a retry overwrites a partial upload
+	for start := 0; start < len(points); start += qdrantUpsertBatchSize {
+		progress.report(JobStageUpserting, start, len(points))
+		end := start + qdrantUpsertBatchSize
+		if end > len(points) {
+			end = len(points)
+		}
+		if err := qdrant.Store.Upsert(points[start:end]); err != nil {
+			removePartialUpload(username, docName, docHash, uploadedAt, start)
+			return "", fmt.Errorf("failed to upload batch: %v", err)
 		}
 	}
-
-	// Second: Semantic search for broader context
-	semanticResults, semanticErr := searchPages(username, query, docName, limit)
-	if semanticErr != nil {
-		fmt.Printf("⚠️ Semantic search failed: %v\n", semanticErr)
-		// If semantic fails but keyword worked, return keyword results
-		if len(keywordResults) > 0 {
-			return keywordResults, nil
+	progress.report(JobStageUpserting, len(points), len(points))
+	invalidateBM25Stats()
+
+	// The new version is written before the old one is removed, so the document
+	// never disappears from search: drop every other point of the document (other
+	// versions, extra chunks, IDs of an older scheme)
+	outcome := StoreCreated
+	if existing > 0 {
+		outcome = StoreReplaced
+		stale := userDocFilter(username, docName)
+		stale["must_not"] = []map[string]interface{}{{"has_id": pointIDs}}
+		if err := deletePointsByFilter(stale); err != nil {
+			return "", fmt.Errorf("failed to remove the previous version: %v", err)
 		}
-		return nil, semanticErr
 	}
 
-	fmt.Printf("✅ Semantic search found %d results\n", len(semanticResults))
-
-	// Combine results, prioritizing exact matches
-	combined := combineSearchResults(keywordResults, semanticResults, limit)
+	fmt.Printf("✅ Successfully uploaded all %d pages with %s embeddings for user '%s' in Qdrant (%s)\n", len(points), qdrant.Embedder.Name(), username, outcome)
+	return outcome, nil
+}
 
-	fmt.Printf("🔗 Combined search returned %d total results\n", len(combined))
-	return combined, nil
+// removePartialUpload drops the batches a failed upload already wrote (points of
+// this version stamped with this attempt's uploaded_at), so a failed ingestion
+// does not leave half a document searchable. Best effort: a retry overwrites them.
+func removePartialUpload(username, docName, docHash, uploadedAt string, written int) {
+	if written == 0 {
+		return
+	}
+	partial := withMust(userDocFilter(username, docName),
+		map[string]interface{}{"key": "doc_hash", "match": map[string]string{"value": docHash}},
+		map[string]interface{}{"key": "uploaded_at", "range": map[string]string{"gte": uploadedAt}},
+	)
+	if err := deletePointsByFilter(partial); err != nil {
+		fmt.Printf("⚠️ Failed to remove %d chunks of the failed upload of '%s': %v\n", written, docName, err)
+		return
+	}
+	invalidateBM25Stats()
+	fmt.Printf("🧹 Removed the %d chunks already uploaded for '%s' (user '%s')\n", written, docName, username)
 }
 
-// Keyword-based search using text matching
-func searchPagesKeyword(username, query, docName string, limit int) ([]SearchResult, error) {
-	// Create filter conditions - always include username
-	filterConditions := []map[string]interface{}{
-		{
-			"key": "username",
-			"match": map[string]string{
-				"value": username,
-			},
-		},
+// Search pages in scope (searchScope) by similarity using the collection's embedder
+// (simple vector collections). Results keep Qdrant's ranking; lexical signals
+// are added by searchPagesHybrid.
+func searchPages(scope map[string]interface{}, query string, limit int) ([]SearchResult, error) {
+	// Generate embedding for search query
+	queryEmbeddings, err := qdrant.Embedder.Embed([]string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get query embedding: %v", err)
 	}
 
-	// Add doc_name filter if specified
-	if docName != "" {
-		filterConditions = append(filterConditions, map[string]interface{}{
-			"key": "doc_name",
-			"match": map[string]string{
-				"value": docName,
-			},
-		})
+	if len(queryEmbeddings) == 0 {
+		return nil, fmt.Errorf("no embedding generated for query")
 	}
 
-	// Use scroll endpoint with text filter for exact matching
-	scrollReq := map[string]interface{}{
-		"filter": map[string]interface{}{
-			"must": filterConditions,
-		},
-		"limit":        limit * 10, // Get more results to search through
-		"with_payload": true,
-	}
+	queryVector := queryEmbeddings[0]
 
-	payload, err := json.Marshal(scrollReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal scroll request: %v", err)
+	// Create search request with the scope filter (simple vector collection),
+	// only comparing against vectors from the same model
+	searchReq := SearchRequest{
+		Vector:      queryVector, // Direct vector array
+		WithPayload: searchPayload,
+		Filter:      withMust(scope, embedderFilter(qdrant.Embedder.Name())),
+		Limit:       limit,
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/collections/pages/points/scroll", QdrantURL), bytes.NewBuffer(payload))
+	// Log the search request for debugging (without the vector)
+	filter, err := json.Marshal(searchReq.Filter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create scroll request: %v", err)
+		return nil, fmt.Errorf("failed to marshal search filter: %v", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	fmt.Printf("🔍 Search Request: %q (limit %d, filter %s)\n", query, limit, filter)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute scroll: %v", err)
+	var results []SearchResult
+	if err := qdrant.Store.Search(searchReq, &results); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
+	fmt.Printf("🔍 Search Response: %d results\n", len(results))
 
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read scroll response: %v", err)
-	}
+	return results, nil
+}
 
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("scroll failed: status %d, response: %s", resp.StatusCode, string(bodyBytes))
+// embedderFilter matches points embedded by the given model. Points stored before
+// the "embedder" payload field existed were all made with the legacy OpenAI model.
+func embedderFilter(name string) map[string]interface{} {
+	condition := map[string]interface{}{
+		"key":   "embedder",
+		"match": map[string]string{"value": name},
 	}
-
-	var scrollResp struct {
-		Result struct {
-			Points []SearchResult `json:"points"`
-		} `json:"result"`
+	if name != legacyEmbedderName {
+		return condition
 	}
-
-	if err := json.Unmarshal(bodyBytes, &scrollResp); err != nil {
-		return nil, fmt.Errorf("failed to decode scroll response: %v", err)
+	return map[string]interface{}{
+		"should": []map[string]interface{}{
+			condition,
+			{"is_empty": map[string]string{"key": "embedder"}},
+		},
 	}
+}
 
-	// Filter results that contain the query text
-	var filtered []SearchResult
-	queryLower := strings.ToLower(query)
-
-	for _, point := range scrollResp.Result.Points {
-		textLower := strings.ToLower(point.Payload.Text)
-		if strings.Contains(textLower, queryLower) {
-			filtered = append(filtered, point)
-			if len(filtered) >= limit {
-				break
-			}
-		}
+// Hybrid search: BM25 keyword ranking and vector ranking fused with weighted RRF.
+// Either retriever may fail or be disabled (weight 0) and the other one still answers.
+func searchPagesHybrid(scope map[string]interface{}, query string, limit int, weights SearchWeights) ([]SearchResult, error) {
+	// Collections with a sparse vector let Qdrant do both retrievals in one query
+	if qdrant.Hybrid {
+		return searchPagesFused(scope, query, limit, weights)
 	}
 
-	return filtered, nil
-}
+	fmt.Printf("🔍 Starting hybrid search for: '%s' (keyword %.2f, vector %.2f, k=%d)\n", query, weights.Keyword, weights.Vector, weights.RRFK)
 
-// Combine and deduplicate search results
-func combineSearchResults(keywordResults, semanticResults []SearchResult, limit int) []SearchResult {
-	seen := make(map[string]bool)
-	var combined []SearchResult
+	fanout := limit * 4
+	if fanout < minSearchFanout {
+		fanout = minSearchFanout
+	}
 
-	// First add keyword results (exact matches have priority)
-	for _, result := range keywordResults {
-		if !seen[result.ID] && len(combined) < limit {
-			combined = append(combined, result)
-			seen[result.ID] = true
+	var keywordResults []SearchResult
+	var keywordErr error
+	if weights.Keyword > 0 {
+		keywordResults, keywordErr = searchPagesKeyword(scope, query, fanout)
+		if keywordErr != nil {
+			fmt.Printf("⚠️ Keyword search failed: %v\n", keywordErr)
+		} else {
+			fmt.Printf("✅ Keyword search found %d results\n", len(keywordResults))
 		}
 	}
 
-	// Then add semantic results if there's still space
-	for _, result := range semanticResults {
-		if !seen[result.ID] && len(combined) < limit {
-			combined = append(combined, result)
-			seen[result.ID] = true
+	var semanticResults []SearchResult
+	var semanticErr error
+	if weights.Vector > 0 {
+		semanticResults, semanticErr = searchPages(scope, query, fanout)
+		if semanticErr != nil {
+			fmt.Printf("⚠️ Semantic search failed: %v\n", semanticErr)
+		} else {
+			fmt.Printf("✅ Semantic search found %d results\n", len(semanticResults))
 		}
 	}
 
-	return combined
+	if keywordErr != nil && (semanticErr != nil || weights.Vector <= 0) {
+		return nil, keywordErr
+	}
+	if semanticErr != nil && (len(keywordResults) == 0 || weights.Keyword <= 0) {
+		return nil, semanticErr
+	}
+
+	combined := rrfFuse(keywordResults, semanticResults, weights, limit)
+
+	fmt.Printf("🔗 RRF fusion returned %d total results\n", len(combined))
+	return combined, nil
 }
 
 // Delete all data for a specific user from Qdrant using filter-based deletion
@@ -576,65 +547,21 @@ func onLeave(username string) (int, error) {
 
 	fmt.Printf("🗑️ Starting cleanup for user: '%s'\n", username)
 
-	// Use filter-based deletion to delete all points for this user in one request
-	deleteReq := map[string]interface{}{
-		"filter": map[string]interface{}{
-			"must": []map[string]interface{}{
-				{
-					"key": "username",
-					"match": map[string]string{
-						"value": username,
-					},
-				},
-			},
-		},
-		"wait": true, // Wait for operation to complete
-	}
-
-	payload, err := json.Marshal(deleteReq)
+	// Count first (the delete response has no count), then delete with one filter
+	filter := userDocFilter(username, "")
+	deletedCount, err := countPoints(filter)
 	if err != nil {
-		return 0, fmt.Errorf("failed to marshal delete request: %v", err)
+		return 0, err
 	}
-
-	url := fmt.Sprintf("%s/collections/pages/points/delete", QdrantURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
-	if err != nil {
-		return 0, fmt.Errorf("failed to create delete request: %v", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, fmt.Errorf("failed to execute delete request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read delete response: %v", err)
-	}
-
-	if resp.StatusCode >= 400 {
-		return 0, fmt.Errorf("delete failed: status %d, response: %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	// Parse response to get the number of deleted points
-	var deleteResp struct {
-		Result struct {
-			Operation struct {
-				Deleted int `json:"deleted"`
-			} `json:"operation"`
-		} `json:"result"`
+	if err := deletePointsByFilter(filter); err != nil {
+		return 0, err
 	}
 
-	if err := json.Unmarshal(bodyBytes, &deleteResp); err != nil {
-		fmt.Printf("⚠️ Could not parse delete response, but operation succeeded\n")
-		fmt.Printf("✅ Successfully deleted all data for user '%s'\n", username)
-		return -1, nil // Return -1 to indicate success but unknown count
+	if err := deleteDocumentSummaries(username, ""); err != nil {
+		fmt.Printf("⚠️ Failed to delete the document summaries of user '%s': %v\n", username, err)
 	}
+	originals.Prune(username)
 
-	deletedCount := deleteResp.Result.Operation.Deleted
 	if deletedCount == 0 {
 		fmt.Printf("ℹ️ No data found for user '%s'\n", username)
 	} else {
@@ -680,7 +607,7 @@ func createPagesWithOverlap(pages []string, overlap float64) []string {
 
 			if len(prevPage) >= overlapSize {
 				// Take the last X characters of previous page
-				startPos := len(prevPage) - overlapSize
+				startPos := runeStart(prevPage, len(prevPage)-overlapSize)
 				overlapText := prevPage[startPos:]
 
 				// Find a good word boundary to start from
@@ -702,7 +629,7 @@ func createPagesWithOverlap(pages []string, overlap float64) []string {
 			overlapSize := 200
 
 			if len(nextPage) > overlapSize {
-				overlapText := nextPage[:overlapSize]
+				overlapText := nextPage[:runeStart(nextPage, overlapSize)]
 
 				// Find a good word boundary to end at
 				if idx := strings.LastIndex(overlapText, " "); idx > 150 {
@@ -0,0 +1,326 @@
+package main
+
+/*
+CLIENT QDRANT (configurat din env)
+
+  - QDRANT_URL              (implicit instanța Railway)
+  - QDRANT_API_KEY          (opțional, trimis în header-ul api-key)
+  - QDRANT_COLLECTION       (implicit "pages")
+  - QDRANT_TIMEOUT_SECONDS  (implicit 30)
+
+La pornire EnsureCollection creează colecția dacă lipsește, cu vectorii numiți
+"dense" (dimensiunea embedding-urilor, distanță Cosine) și "bm25" (sparse, vezi
+sparse.go), verifică configurația vectorilor pentru o colecție existentă și
+creează indexuri keyword pe username, doc_name, embedder, doc_hash și
+parent_id, integer pe page_num, datetime pe uploaded_at, plus un index
+full-text pe text (folosit de căutarea BM25 din bm25.go). Cheile din metadata
+sunt indexate la salvare (metadata.go).
+
+O colecție veche cu un singur vector nenumit este acceptată în continuare
+(Hybrid = false), cu un avertisment că poate fi migrată.
+
+Cu VECTOR_STORE=embedded colecția este ținută în proces (embedded_store.go),
+iar QDRANT_URL nu este folosit; numele colecției rămâne QDRANT_COLLECTION.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQdrantURL        = "https://qdrant-production-449a.up.railway.app"
+	defaultQdrantCollection = "pages"
+	defaultQdrantTimeout    = 30
+	qdrantDistance          = "Cosine"
+)
+
+// errQdrantVectorMismatch - colecția există, dar cu altă dimensiune/distanță
+var errQdrantVectorMismatch = errors.New("qdrant collection vector config mismatch")
+
+// QdrantClient is the handle of a collection: its vector config, embedder and
+// the VectorStore holding its points (Qdrant or embedded)
+type QdrantClient struct {
+	Store      VectorStore
+	URL        string
+	APIKey     string
+	Collection string
+	VectorSize int
+	Embedder   Embedder // fixed per collection
+	Hybrid     bool     // named dense + sparse vectors; false for simple vector collections
+	httpClient *ResilientClient
+
+	indexMu sync.Mutex
+	indexed map[string]string // payload field -> index type
+}
+
+// qdrant is configured in main() after .env is loaded
+var qdrant *QdrantClient
+
+func NewQdrantClientFromEnv(embedder Embedder) (*QdrantClient, error) {
+	q := newQdrantConnectionFromEnv()
+	q.VectorSize = embedder.Dimensions()
+	q.Embedder = embedder
+
+	kind, err := vectorStoreKind()
+	if err != nil {
+		return nil, err
+	}
+	if kind == VectorStoreEmbedded {
+		store, err := openEmbeddedStore(vectorStorePath(), q.Collection)
+		if err != nil {
+			return nil, err
+		}
+		q.Store = store
+	}
+	return q, nil
+}
+
+// newQdrantConnectionFromEnv returns a client without an embedder (admin commands)
+func newQdrantConnectionFromEnv() *QdrantClient {
+	baseURL := strings.TrimRight(os.Getenv("QDRANT_URL"), "/")
+	if baseURL == "" {
+		baseURL = defaultQdrantURL
+	}
+	collection := os.Getenv("QDRANT_COLLECTION")
+	if collection == "" {
+		collection = defaultQdrantCollection
+	}
+
+	q := &QdrantClient{
+		URL:        baseURL,
+		APIKey:     os.Getenv("QDRANT_API_KEY"),
+		Collection: collection,
+		httpClient: newResilientClient("qdrant",
+			time.Duration(envInt("QDRANT_TIMEOUT_SECONDS", defaultQdrantTimeout))*time.Second),
+	}
+	// Searches are reads and writes go by point id or filter, so a timed out request can be resent
+	q.httpClient.retryTimeouts = true
+	q.Store = qdrantStore{q}
+	return q
+}
+
+// do sends a JSON request (payload may be nil) and returns the body and status code
+func (q *QdrantClient) do(method, path string, payload []byte) ([]byte, int, error) {
+	result, err := q.httpClient.Do(func() (*http.Request, error) {
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequest(method, q.URL+path, body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if q.APIKey != "" {
+			req.Header.Set("api-key", q.APIKey)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return result.Body, result.StatusCode, nil
+}
+
+// collectionPath returns "/collections/<name><suffix>"
+func (q *QdrantClient) collectionPath(suffix string) string {
+	return "/collections/" + url.PathEscape(q.Collection) + suffix
+}
+
+// EnsureCollection creates the collection and payload indexes if missing and
+// verifies the vector config of an existing collection
+func (q *QdrantClient) EnsureCollection() error {
+	if store, ok := q.Store.(*EmbeddedStore); ok {
+		if err := store.ensure(q.VectorSize, true); err != nil {
+			return err
+		}
+		q.Hybrid = true
+		fmt.Printf("✅ Embedded collection '%s' ready in %s (%s, %d points)\n", q.Collection, vectorStorePath(), q.Embedder.Name(), store.Len())
+		return nil
+	}
+
+	body, status, err := q.do("GET", q.collectionPath(""), nil)
+	if err != nil {
+		return fmt.Errorf("failed to reach Qdrant at %s: %v", q.URL, err)
+	}
+
+	switch {
+	case status == http.StatusNotFound:
+		if err := q.createHybridCollection(q.VectorSize); err != nil {
+			return err
+		}
+		fmt.Printf("🆕 Created Qdrant collection '%s' (dense %d %s + sparse %s, %s)\n", q.Collection, q.VectorSize, qdrantDistance, sparseVectorName, q.Embedder.Name())
+	case status >= 400:
+		return fmt.Errorf("failed to get collection '%s': status %d, response: %s", q.Collection, status, string(body))
+	default:
+		if err := q.checkVectorConfig(body); err != nil {
+			return err
+		}
+		q.loadIndexedFields(body)
+	}
+
+	if err := q.ensurePayloadIndexes(); err != nil {
+		return err
+	}
+
+	mode := "dense + sparse"
+	if !q.Hybrid {
+		mode = "simple vector"
+		fmt.Printf("⚠️ Collection '%s' has no sparse vector; run 'migrate-collection' to enable fused search\n", q.Collection)
+	}
+	fmt.Printf("✅ Qdrant collection '%s' ready at %s (%s, %s)\n", q.Collection, q.URL, q.Embedder.Name(), mode)
+	return nil
+}
+
+// createHybridCollection creates the collection with named "dense" and sparse "bm25" vectors
+func (q *QdrantClient) createHybridCollection(size int) error {
+	create, _ := json.Marshal(QdrantCollection{
+		Vectors: map[string]VectorConfig{
+			denseVectorName: {Size: size, Distance: qdrantDistance},
+		},
+		SparseVectors: map[string]SparseVectorConfig{
+			sparseVectorName: {Modifier: "idf"},
+		},
+	})
+	body, status, err := q.do("PUT", q.collectionPath(""), create)
+	if err != nil {
+		return fmt.Errorf("failed to create collection '%s': %v", q.Collection, err)
+	}
+	if status >= 400 {
+		return fmt.Errorf("failed to create collection '%s': status %d, response: %s", q.Collection, status, string(body))
+	}
+	q.Hybrid = true
+	return nil
+}
+
+func (q *QdrantClient) ensurePayloadIndexes() error {
+	for _, field := range []string{"username", "doc_name", "embedder", "doc_hash", "parent_id"} {
+		if err := q.ensurePayloadIndex(field, "keyword"); err != nil {
+			return err
+		}
+	}
+	if err := q.ensurePayloadIndex("page_num", "integer"); err != nil {
+		return err
+	}
+	if err := q.ensurePayloadIndex("uploaded_at", "datetime"); err != nil {
+		return err
+	}
+	// Same tokenization as tokenizeForBM25, so candidates match the scored terms
+	return q.ensurePayloadIndex("text", map[string]interface{}{
+		"type": "text", "tokenizer": "word", "lowercase": true, "min_token_len": 2,
+	})
+}
+
+// checkVectorConfig accepts a simple vector collection or the hybrid layout
+// (named "dense" vector + sparse "bm25") and sets q.Hybrid accordingly
+func (q *QdrantClient) checkVectorConfig(collectionInfo []byte) error {
+	vectors, hybrid, err := parseVectorConfig(collectionInfo)
+	if err != nil {
+		return fmt.Errorf("%w: collection '%s': %v", errQdrantVectorMismatch, q.Collection, err)
+	}
+
+	if vectors.Size != q.VectorSize || !strings.EqualFold(vectors.Distance, qdrantDistance) {
+		return fmt.Errorf("%w: collection '%s' has size %d/%s, expected %d/%s",
+			errQdrantVectorMismatch, q.Collection, vectors.Size, vectors.Distance, q.VectorSize, qdrantDistance)
+	}
+	q.Hybrid = hybrid
+	return nil
+}
+
+// parseVectorConfig returns the dense vector config of a collection and whether
+// it uses the hybrid (named dense + sparse) layout
+func parseVectorConfig(collectionInfo []byte) (VectorConfig, bool, error) {
+	var info struct {
+		Result struct {
+			Config struct {
+				Params struct {
+					Vectors       json.RawMessage               `json:"vectors"`
+					SparseVectors map[string]SparseVectorConfig `json:"sparse_vectors"`
+				} `json:"params"`
+			} `json:"config"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(collectionInfo, &info); err != nil {
+		return VectorConfig{}, false, fmt.Errorf("failed to decode collection info: %v", err)
+	}
+	params := info.Result.Config.Params
+
+	// Simple vector collection: {"size": ..., "distance": ...}
+	var single VectorConfig
+	if err := json.Unmarshal(params.Vectors, &single); err == nil && single.Size > 0 {
+		return single, false, nil
+	}
+
+	var named map[string]VectorConfig
+	if err := json.Unmarshal(params.Vectors, &named); err != nil {
+		return VectorConfig{}, false, fmt.Errorf("unsupported vector config")
+	}
+	dense, ok := named[denseVectorName]
+	if !ok {
+		return VectorConfig{}, false, fmt.Errorf("named vectors without '%s'", denseVectorName)
+	}
+	if _, ok := params.SparseVectors[sparseVectorName]; !ok {
+		return VectorConfig{}, false, fmt.Errorf("no sparse vector '%s'", sparseVectorName)
+	}
+	return dense, true, nil
+}
+
+// ensurePayloadIndex creates a payload index (no-op if it already exists);
+// schema is a type name ("keyword") or a full schema object
+func (q *QdrantClient) ensurePayloadIndex(field string, schema interface{}) error {
+	if err := q.Store.CreateIndex(field, schema); err != nil {
+		return err
+	}
+
+	schemaType, ok := schema.(string)
+	if !ok {
+		schemaType, _ = schema.(map[string]interface{})["type"].(string)
+	}
+	q.indexMu.Lock()
+	if q.indexed == nil {
+		q.indexed = make(map[string]string)
+	}
+	q.indexed[field] = schemaType
+	q.indexMu.Unlock()
+	return nil
+}
+
+// indexedSchema returns the index type of a payload field ("" if not indexed)
+func (q *QdrantClient) indexedSchema(field string) string {
+	q.indexMu.Lock()
+	defer q.indexMu.Unlock()
+	return q.indexed[field]
+}
+
+// loadIndexedFields remembers the payload indexes of an existing collection
+func (q *QdrantClient) loadIndexedFields(collectionInfo []byte) {
+	var info struct {
+		Result struct {
+			PayloadSchema map[string]struct {
+				DataType string `json:"data_type"`
+			} `json:"payload_schema"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(collectionInfo, &info); err != nil {
+		return
+	}
+
+	q.indexMu.Lock()
+	defer q.indexMu.Unlock()
+	if q.indexed == nil {
+		q.indexed = make(map[string]string)
+	}
+	for field, schema := range info.Result.PayloadSchema {
+		q.indexed[field] = schema.DataType
+	}
+}
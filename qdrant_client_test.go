@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseVectorConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		info       string
+		wantSize   int
+		wantHybrid bool
+		wantErr    string
+	}{
+		{"simple vector",
+			`{"result":{"config":{"params":{"vectors":{"size":1536,"distance":"Cosine"}}}}}`, 1536, false, ""},
+		{"hybrid",
+			`{"result":{"config":{"params":{"vectors":{"dense":{"size":64,"distance":"Cosine"}},"sparse_vectors":{"bm25":{"modifier":"idf"}}}}}}`, 64, true, ""},
+		{"named without dense",
+			`{"result":{"config":{"params":{"vectors":{"image":{"size":64,"distance":"Cosine"}}}}}}`, 0, false, "without 'dense'"},
+		{"dense without sparse",
+			`{"result":{"config":{"params":{"vectors":{"dense":{"size":64,"distance":"Cosine"}}}}}}`, 0, false, "no sparse vector"},
+		{"no vectors", `{"result":{"config":{"params":{}}}}`, 0, false, "unsupported vector config"},
+		{"not json", `<html>`, 0, false, "failed to decode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, hybrid, err := parseVectorConfig([]byte(tt.info))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseVectorConfig error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVectorConfig failed: %v", err)
+			}
+			if config.Size != tt.wantSize || hybrid != tt.wantHybrid {
+				t.Errorf("size %d, hybrid %v; want %d, %v", config.Size, hybrid, tt.wantSize, tt.wantHybrid)
+			}
+		})
+	}
+}
+
+// fakeQdrantCollection answers the collection info request and records the rest
+type fakeQdrantCollection struct {
+	mu       sync.Mutex
+	info     string // "" answers 404
+	status   int    // status of the info request when info is set (default 200)
+	requests []string
+	indexes  map[string]interface{}
+	created  map[string]interface{}
+	apiKeys  []string
+}
+
+func (f *fakeQdrantCollection) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	f.apiKeys = append(f.apiKeys, r.Header.Get("api-key"))
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/collections/pages":
+		if f.info == "" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"status":{"error":"Not found"}}`))
+			return
+		}
+		if f.status != 0 {
+			w.WriteHeader(f.status)
+		}
+		w.Write([]byte(f.info))
+	case r.Method == "PUT" && r.URL.Path == "/collections/pages":
+		json.Unmarshal(body, &f.created)
+		w.Write([]byte(`{"result":true}`))
+	case r.Method == "PUT" && r.URL.Path == "/collections/pages/index":
+		var req struct {
+			FieldName   string      `json:"field_name"`
+			FieldSchema interface{} `json:"field_schema"`
+		}
+		json.Unmarshal(body, &req)
+		if f.indexes == nil {
+			f.indexes = make(map[string]interface{})
+		}
+		f.indexes[req.FieldName] = req.FieldSchema
+		w.Write([]byte(`{"result":{"status":"acknowledged"}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestEnsureCollection(t *testing.T) {
+	hybridInfo := func(size int) string {
+		return fmt.Sprintf(`{"result":{"config":{"params":{"vectors":{"dense":{"size":%d,"distance":"Cosine"}},"sparse_vectors":{"bm25":{}}}},`+
+			`"payload_schema":{"metadata.year":{"data_type":"integer"}}}}`, size)
+	}
+
+	tests := []struct {
+		name        string
+		info        string
+		status      int
+		wantCreated bool
+		wantHybrid  bool
+		wantErr     bool
+		mismatch    bool // the error is errQdrantVectorMismatch (fatal at startup)
+	}{
+		{"missing collection is created", "", 0, true, true, false, false},
+		{"existing hybrid collection", hybridInfo(64), 0, false, true, false, false},
+		{"legacy simple vector collection", `{"result":{"config":{"params":{"vectors":{"size":64,"distance":"Cosine"}}}}}`, 0, false, false, false, false},
+		{"other vector size", hybridInfo(1536), 0, false, false, true, true},
+		{"other distance", `{"result":{"config":{"params":{"vectors":{"size":64,"distance":"Dot"}}}}}`, 0, false, false, true, true},
+		{"forbidden", `{"status":{"error":"bad api key"}}`, http.StatusForbidden, false, false, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeQdrantCollection{info: tt.info, status: tt.status}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+			t.Setenv("VECTOR_STORE", "")
+			t.Setenv("QDRANT_URL", server.URL)
+			t.Setenv("QDRANT_API_KEY", "secret")
+			t.Setenv("QDRANT_COLLECTION", "")
+
+			q, err := NewQdrantClientFromEnv(hashEmbedder{dimensions: 64})
+			if err != nil {
+				t.Fatalf("NewQdrantClientFromEnv failed: %v", err)
+			}
+			err = q.EnsureCollection()
+			if tt.wantErr {
+				if err == nil || errors.Is(err, errQdrantVectorMismatch) != tt.mismatch {
+					t.Fatalf("EnsureCollection error = %v, want mismatch = %v", err, tt.mismatch)
+				}
+				if len(fake.indexes) > 0 {
+					t.Errorf("indexes created for a rejected collection: %v", fake.indexes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EnsureCollection failed: %v", err)
+			}
+
+			if q.Hybrid != tt.wantHybrid {
+				t.Errorf("Hybrid = %v, want %v", q.Hybrid, tt.wantHybrid)
+			}
+			if (fake.created != nil) != tt.wantCreated {
+				t.Errorf("created = %v, want created %v", fake.created, tt.wantCreated)
+			}
+			if tt.wantCreated {
+				encoded, _ := json.Marshal(fake.created)
+				if want := `{"sparse_vectors":{"bm25":{"modifier":"idf"}},"vectors":{"dense":{"distance":"Cosine","size":64}}}`; string(encoded) != want {
+					t.Errorf("created with %s, want %s", encoded, want)
+				}
+			}
+
+			var fields []string
+			for field := range fake.indexes {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			want := []string{"doc_hash", "doc_name", "embedder", "page_num", "parent_id", "text", "uploaded_at", "username"}
+			if strings.Join(fields, ",") != strings.Join(want, ",") {
+				t.Errorf("indexed %v, want %v", fields, want)
+			}
+			if q.indexedSchema("page_num") != "integer" || q.indexedSchema("text") != "text" {
+				t.Errorf("indexed schemas: page_num %q, text %q", q.indexedSchema("page_num"), q.indexedSchema("text"))
+			}
+			if tt.info != "" && tt.wantHybrid && q.indexedSchema("metadata.year") != "integer" {
+				t.Errorf("existing metadata index not loaded")
+			}
+			for i, key := range fake.apiKeys {
+				if key != "secret" {
+					t.Errorf("request %s sent api-key %q", fake.requests[i], key)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// qdrantStore is the VectorStore of a Qdrant collection (REST API)
+type qdrantStore struct {
+	q *QdrantClient
+}
+
+// qdrantStatusError is a request Qdrant answered with an error status
+type qdrantStatusError struct {
+	Operation string
+	Status    int
+	Body      string
+}
+
+func (e *qdrantStatusError) Error() string {
+	return fmt.Sprintf("%s failed: status %d, response: %s", e.Operation, e.Status, e.Body)
+}
+
+// post sends a request to the collection and decodes "result" into out (may be nil)
+func (s qdrantStore) post(method, suffix, operation string, request interface{}, out interface{}) error {
+	var payload []byte
+	if request != nil {
+		var err error
+		if payload, err = json.Marshal(request); err != nil {
+			return fmt.Errorf("failed to marshal %s request: %v", operation, err)
+		}
+	}
+
+	bodyBytes, status, err := s.q.do(method, s.q.collectionPath(suffix), payload)
+	if err != nil {
+		return fmt.Errorf("failed to execute %s: %v", operation, err)
+	}
+	if status >= 400 {
+		return &qdrantStatusError{Operation: operation, Status: status, Body: string(bodyBytes)}
+	}
+	if out == nil {
+		return nil
+	}
+
+	response := struct {
+		Result interface{} `json:"result"`
+	}{Result: out}
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return fmt.Errorf("failed to decode %s response: %v", operation, err)
+	}
+	return nil
+}
+
+func (s qdrantStore) Upsert(points []QdrantPoint) error {
+	// wait=true: the points are searchable when the call returns
+	return s.post("PUT", "/points?wait=true", "upsert", map[string]interface{}{"points": points}, nil)
+}
+
+func (s qdrantStore) Search(req SearchRequest, out interface{}) error {
+	return s.post("POST", "/points/search", "search", req, out)
+}
+
+func (s qdrantStore) Query(req QueryRequest, out interface{}) error {
+	result := struct {
+		Points interface{} `json:"points"`
+	}{Points: out}
+	return s.post("POST", "/points/query", "query", req, &result)
+}
+
+func (s qdrantStore) Scroll(req ScrollRequest, out interface{}) (interface{}, error) {
+	result := struct {
+		Points         interface{} `json:"points"`
+		NextPageOffset interface{} `json:"next_page_offset"`
+	}{Points: out}
+	if err := s.post("POST", "/points/scroll", "scroll", req, &result); err != nil {
+		return nil, err
+	}
+	return result.NextPageOffset, nil
+}
+
+func (s qdrantStore) Count(filter map[string]interface{}) (int, error) {
+	var result struct {
+		Count int `json:"count"`
+	}
+	err := s.post("POST", "/points/count", "count", map[string]interface{}{"filter": filter, "exact": true}, &result)
+	return result.Count, err
+}
+
+func (s qdrantStore) Delete(filter map[string]interface{}) error {
+	return s.post("POST", "/points/delete?wait=true", "delete", map[string]interface{}{"filter": filter}, nil)
+}
+
+func (s qdrantStore) SetPayload(filter map[string]interface{}, values map[string]interface{}) error {
+	return s.post("POST", "/points/payload?wait=true", "set payload", map[string]interface{}{"payload": values, "filter": filter}, nil)
+}
+
+func (s qdrantStore) Get(id string, out interface{}) (bool, error) {
+	bodyBytes, status, err := s.q.do("GET", s.q.collectionPath("/points/"+url.PathEscape(id)), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to get point: %v", err)
+	}
+	if status == http.StatusNotFound {
+		return false, nil
+	}
+	if status >= 400 {
+		return false, fmt.Errorf("get point failed: status %d, response: %s", status, string(bodyBytes))
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return false, fmt.Errorf("failed to decode point: %v", err)
+	}
+	if len(response.Result) == 0 || string(response.Result) == "null" {
+		return false, nil
+	}
+	if err := json.Unmarshal(response.Result, out); err != nil {
+		return false, fmt.Errorf("failed to decode point: %v", err)
+	}
+	return true, nil
+}
+
+func (s qdrantStore) CreateIndex(field string, schema interface{}) error {
+	request := map[string]interface{}{"field_name": field, "field_schema": schema}
+	if err := s.post("PUT", "/index?wait=true", "create index", request, nil); err != nil {
+		return fmt.Errorf("failed to create index on '%s': %v", field, err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkPointIDIsUniquePerDocument(t *testing.T) {
+	base := chunkPointID("ana", "notes.pdf", "id-1", "hash", 0)
+
+	tests := []struct {
+		name string
+		id   string
+		same bool
+	}{
+		{"same inputs", chunkPointID("ana", "notes.pdf", "id-1", "hash", 0), true},
+		{"other user", chunkPointID("bob", "notes.pdf", "id-1", "hash", 0), false},
+		{"same file under another name", chunkPointID("ana", "copy.pdf", "id-1", "hash", 0), false},
+		{"other document id", chunkPointID("ana", "notes.pdf", "id-2", "hash", 0), false},
+		{"other version", chunkPointID("ana", "notes.pdf", "id-1", "hash2", 0), false},
+		{"other chunk", chunkPointID("ana", "notes.pdf", "id-1", "hash", 1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.id == base) != tt.same {
+				t.Errorf("chunkPointID = %s, base %s, want same = %v", tt.id, base, tt.same)
+			}
+		})
+	}
+}
+
+func TestChunkIndexZeroIsSerialized(t *testing.T) {
+	data, err := json.Marshal(QdrantPage{Username: "ana", Text: "first", PageNum: 1})
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"chunk_index":0`) {
+		t.Errorf("payload %s has no chunk_index for the first chunk", data)
+	}
+}
+
+func TestStoreSameFileUnderSeveralNames(t *testing.T) {
+	useTestVectorStore(t)
+
+	texts := []string{"the ocean covers most of the planet", "waves carry energy across vast distances"}
+	store := func(docName string, texts []string) string {
+		t.Helper()
+		chunks := []StoreChunk{{Text: texts[0], PageNum: 1}}
+		for _, text := range texts[1:] {
+			chunks = append(chunks, StoreChunk{Text: text, PageNum: 2})
+		}
+		outcome, err := storePagesInQdrant("ana", chunks, docName, fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(texts, "|")))), "page", nil, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to store %s: %v", docName, err)
+		}
+		return outcome
+	}
+	chunksOf := func(docName string) int {
+		t.Helper()
+		count, err := countPoints(userDocFilter("ana", docName))
+		if err != nil {
+			t.Fatalf("count failed: %v", err)
+		}
+		return count
+	}
+
+	steps := []struct {
+		name        string
+		run         func() string
+		wantOutcome string
+		wantChunks  map[string]int
+	}{
+		{"first name", func() string { return store("a.pdf", texts) }, StoreCreated, map[string]int{"a.pdf": 2}},
+		{"same file, second name", func() string { return store("b.pdf", texts) }, StoreCreated, map[string]int{"a.pdf": 2, "b.pdf": 2}},
+		{"same file, same name", func() string { return store("a.pdf", texts) }, StoreUnchanged, map[string]int{"a.pdf": 2, "b.pdf": 2}},
+		{"rename a to c", func() string {
+			if err := setPayloadByFilter(userDocFilter("ana", "a.pdf"), map[string]interface{}{"doc_name": "c.pdf"}); err != nil {
+				t.Fatalf("rename failed: %v", err)
+			}
+			return ""
+		}, "", map[string]int{"a.pdf": 0, "b.pdf": 2, "c.pdf": 2}},
+		{"same file under the old name", func() string { return store("a.pdf", texts) }, StoreCreated, map[string]int{"a.pdf": 2, "b.pdf": 2, "c.pdf": 2}},
+		{"shorter version replaces", func() string { return store("a.pdf", texts[:1]) }, StoreReplaced, map[string]int{"a.pdf": 1, "b.pdf": 2, "c.pdf": 2}},
+	}
+
+	for _, step := range steps {
+		if outcome := step.run(); outcome != step.wantOutcome {
+			t.Errorf("%s: outcome %q, want %q", step.name, outcome, step.wantOutcome)
+		}
+		for docName, want := range step.wantChunks {
+			if got := chunksOf(docName); got != want {
+				t.Errorf("%s: %s has %d chunks, want %d", step.name, docName, got, want)
+			}
+		}
+	}
+}
+
+func TestPageStoreChunksShiftsLayouts(t *testing.T) {
+	pages := []string{
+		"The first page has enough text to be stored on its own.",
+		"\n\n  Second page starts after blank lines and indentation.",
+		"Third page has no surrounding whitespace at all, fine.",
+	}
+	// One line per page, located in the untrimmed page text
+	var layouts []*ChunkLayout
+	for i, page := range pages {
+		word := strings.Fields(page)[0]
+		start := utf8.RuneCountInString(page[:strings.Index(page, word)])
+		layouts = append(layouts, &ChunkLayout{SourcePage: i + 1, Lines: []LayoutLine{
+			{Text: word, Start: start, End: start + utf8.RuneCountInString(word)},
+		}})
+	}
+
+	chunks := pageStoreChunks(pages, layouts)
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if chunk.Layout == nil {
+			t.Fatalf("chunk %d has no layout", i)
+		}
+		line := chunk.Layout.Lines[0]
+		if got := string([]rune(chunk.Text)[line.Start:line.End]); got != line.Text {
+			t.Errorf("chunk %d: line %q points at %q", i, line.Text, got)
+		}
+	}
+}
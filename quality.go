@@ -0,0 +1,248 @@
+package main
+
+/*
+CALITATEA EXTRAGERII (diagnostic pe pagină)
+
+Pentru fiecare pagină sursă (inclusiv cele goale, care nu apar în "pages"):
+  - dacă are strat de text sau e goală (pagină scanată -> OCR)
+  - raportul de caractere printabile și de litere
+  - caractere "gunoi" (U+FFFD, zona privată, caractere de control) = font fără ToUnicode
+  - text cu spații între litere (isCorruptedText)
+  - limba detectată, numărul de caractere și de cuvinte
+  - un scor între 0 și 1
+
+La nivel de document: scorul mediu, paginile goale/suspecte și o recomandare
+(ok | review | ocr), ca clientul să decidă dacă face OCR sau avertizează utilizatorul.
+*/
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	QualityOK      = "ok"
+	QualityEmpty   = "empty"
+	QualityLowText = "low_text"
+	QualityGarbled = "garbled"
+	QualityError   = "error"
+)
+
+// PageQuality - diagnosticul unei pagini
+type PageQuality struct {
+	Page           int      `json:"page"` // 1-based source page
+	Status         string   `json:"status"`
+	HasTextLayer   bool     `json:"has_text_layer"`
+	Chars          int      `json:"chars"`
+	Words          int      `json:"words"`
+	PrintableRatio float64  `json:"printable_ratio"`
+	LetterRatio    float64  `json:"letter_ratio"`
+	GarbageRatio   float64  `json:"garbage_ratio"`
+	SpacedLetters  bool     `json:"spaced_letters"` // "H e l l o" style text
+	Language       string   `json:"language,omitempty"`
+	Score          float64  `json:"score"`
+	Issues         []string `json:"issues,omitempty"`
+}
+
+// QualityReport - diagnosticul documentului
+type QualityReport struct {
+	Score          float64       `json:"score"`
+	Language       string        `json:"language,omitempty"`
+	TotalPages     int           `json:"total_pages"`
+	EmptyPages     int           `json:"empty_pages"`
+	SuspectPages   int           `json:"suspect_pages"`
+	Recommendation string        `json:"recommendation"` // ok, review, ocr
+	Pages          []PageQuality `json:"pages"`
+}
+
+// assessPageQuality analyses the raw text of one page (before cleanup)
+func assessPageQuality(page int, text string) PageQuality {
+	q := PageQuality{Page: page}
+
+	total, printable, letters, garbage := 0, 0, 0, 0
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		total++
+		switch {
+		case r == unicode.ReplacementChar || unicode.Is(unicode.Co, r) || unicode.IsControl(r):
+			garbage++
+		case unicode.IsPrint(r):
+			printable++
+			if unicode.IsLetter(r) {
+				letters++
+			}
+		}
+	}
+
+	q.Chars = total
+	q.Words = len(strings.Fields(text))
+	if total == 0 {
+		q.Status = QualityEmpty
+		q.Issues = append(q.Issues, "no text layer (scanned page or image only)")
+		return q
+	}
+
+	q.HasTextLayer = true
+	q.PrintableRatio = round2(float64(printable) / float64(total))
+	q.LetterRatio = round2(float64(letters) / float64(total))
+	q.GarbageRatio = round2(float64(garbage) / float64(total))
+	q.SpacedLetters = isCorruptedText(text)
+	q.Language = detectTextLanguage(text)
+
+	score := 1.0
+	score -= 2 * q.GarbageRatio
+	score -= math.Max(0, 0.95-q.PrintableRatio)
+	if q.LetterRatio < 0.5 {
+		score -= 0.5 - q.LetterRatio
+		q.Issues = append(q.Issues, "few letters (tables, numbers or symbols)")
+	}
+	if q.GarbageRatio > 0.05 {
+		q.Issues = append(q.Issues, "unmapped glyphs (font without Unicode mapping)")
+	}
+	if q.SpacedLetters {
+		score -= 0.4
+		q.Issues = append(q.Issues, "letters separated by spaces")
+	}
+	if q.Words < 5 {
+		score -= 0.2
+		q.Issues = append(q.Issues, "very little text")
+	}
+	q.Score = round2(math.Max(0, math.Min(1, score)))
+
+	switch {
+	case q.GarbageRatio > 0.1 || q.SpacedLetters || q.Score < 0.5:
+		q.Status = QualityGarbled
+	case q.Words < 5:
+		q.Status = QualityLowText
+	default:
+		q.Status = QualityOK
+	}
+	return q
+}
+
+// buildQualityReport aggregates page diagnostics into a document report
+func buildQualityReport(pages []PageQuality) *QualityReport {
+	report := &QualityReport{TotalPages: len(pages), Pages: pages}
+	if len(pages) == 0 {
+		report.Recommendation = "ocr"
+		return report
+	}
+
+	languageChars := map[string]int{}
+	scoreSum := 0.0
+	for _, p := range pages {
+		scoreSum += p.Score
+		switch p.Status {
+		case QualityEmpty, QualityError:
+			report.EmptyPages++
+		case QualityGarbled:
+			report.SuspectPages++
+		}
+		if p.Language != "" && p.Language != "unknown" {
+			languageChars[p.Language] += p.Chars
+		}
+	}
+	report.Score = round2(scoreSum / float64(len(pages)))
+
+	best := 0
+	for lang, chars := range languageChars {
+		if chars > best {
+			report.Language, best = lang, chars
+		}
+	}
+
+	switch {
+	case report.EmptyPages*2 > len(pages) || report.Score < 0.5:
+		report.Recommendation = "ocr"
+	case report.EmptyPages > 0 || report.SuspectPages > 0:
+		report.Recommendation = "review"
+	default:
+		report.Recommendation = "ok"
+	}
+	return report
+}
+
+// qualityFromPages is used by extractors that do not report per-page diagnostics
+func qualityFromPages(pages []string) *QualityReport {
+	var diagnostics []PageQuality
+	for i, page := range pages {
+		diagnostics = append(diagnostics, assessPageQuality(i+1, page))
+	}
+	return buildQualityReport(diagnostics)
+}
+
+// Frequent short words per language, used by detectTextLanguage
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "are", "this"},
+	"ro": {"și", "în", "de", "la", "cu", "este", "pentru", "care", "nu", "sunt", "pe", "din"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "que", "dans", "pour", "pas", "sur"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "den", "ein", "zu", "sich", "auf"},
+	"es": {"el", "la", "que", "los", "las", "y", "en", "es", "por", "una", "para", "con"},
+	"it": {"il", "di", "che", "la", "e", "per", "non", "sono", "una", "del", "della", "con"},
+	"pt": {"o", "que", "os", "as", "do", "da", "em", "um", "para", "com", "não", "uma"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "met", "voor", "zijn"},
+}
+
+// detectTextLanguage returns an ISO 639-1 code from the script, or from
+// stopword frequency for Latin text ("unknown" when unsure)
+func detectTextLanguage(text string) string {
+	scripts := map[string]int{}
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			scripts["ru"]++
+		case unicode.Is(unicode.Greek, r):
+			scripts["el"]++
+		case unicode.Is(unicode.Arabic, r):
+			scripts["ar"]++
+		case unicode.Is(unicode.Hebrew, r):
+			scripts["he"]++
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			scripts["ja"]++
+		case unicode.Is(unicode.Hangul, r):
+			scripts["ko"]++
+		case unicode.Is(unicode.Han, r):
+			scripts["zh"]++
+		}
+	}
+	if letters == 0 {
+		return "unknown"
+	}
+	// Japanese text mixes kana with Han characters
+	if scripts["ja"] > 0 && scripts["ja"]+scripts["zh"] > letters/2 {
+		return "ja"
+	}
+	for lang, count := range scripts {
+		if count > letters/2 {
+			return lang
+		}
+	}
+
+	words := map[string]int{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		words[w]++
+	}
+
+	best, bestHits := "unknown", 0
+	for lang, stopwords := range languageStopwords {
+		hits := 0
+		for _, sw := range stopwords {
+			hits += words[sw]
+		}
+		if hits > bestHits || (hits == bestHits && hits > 0 && lang < best) {
+			best, bestHits = lang, hits
+		}
+	}
+	if bestHits < 2 {
+		return "unknown"
+	}
+	return best
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssessPageQuality(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		wantStatus string
+		wantIssue  string // "" for none
+		minScore   float64
+		maxScore   float64
+	}{
+		{"ok", "The quick brown fox jumps over the lazy dog and runs into the forest.", QualityOK, "", 0.9, 1},
+		{"empty", " \n\t ", QualityEmpty, "no text layer", 0, 0},
+		{"few words", "Chapter one", QualityLowText, "very little text", 0.7, 0.8},
+		{"unmapped glyphs", strings.Repeat("�� ", 10) + "some real words here too", QualityGarbled, "unmapped glyphs", 0, 0.5},
+		{"spaced letters", "T  h  i  s   i  s   s  p  a  c  e  d   t  e  x  t", QualityGarbled, "letters separated by spaces", 0, 0.6},
+		{"table of numbers", "12.5 13.7 14.2 15.9 16.1 17.3 18.8 19.0 20.4 21.6", QualityOK, "few letters", 0.5, 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := assessPageQuality(3, tt.text)
+			if q.Page != 3 || q.Status != tt.wantStatus {
+				t.Fatalf("page %d status %s, want page 3 status %s (%+v)", q.Page, q.Status, tt.wantStatus, q)
+			}
+			if q.Score < tt.minScore || q.Score > tt.maxScore {
+				t.Errorf("score %.2f, want between %.2f and %.2f", q.Score, tt.minScore, tt.maxScore)
+			}
+			if tt.wantIssue == "" && len(q.Issues) > 0 {
+				t.Errorf("issues %v, want none", q.Issues)
+			}
+			if tt.wantIssue != "" && !strings.Contains(strings.Join(q.Issues, "; "), tt.wantIssue) {
+				t.Errorf("issues %v, want %q", q.Issues, tt.wantIssue)
+			}
+			if q.HasTextLayer != (tt.wantStatus != QualityEmpty) {
+				t.Errorf("has_text_layer = %v", q.HasTextLayer)
+			}
+		})
+	}
+}
+
+func TestDetectTextLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"The results of the study are in the appendix and the tables.", "en"},
+		{"Rezultatele studiului sunt în anexă și în tabelele de la final.", "ro"},
+		{"Les résultats de l'étude sont dans les annexes et le tableau.", "fr"},
+		{"Die Ergebnisse der Studie sind nicht in der Tabelle und die Anlage.", "de"},
+		{"Результаты исследования приведены в приложении.", "ru"},
+		{"Τα αποτελέσματα της μελέτης βρίσκονται στο παράρτημα.", "el"},
+		{"研究の結果はふろくにあります。", "ja"},
+		{"研究结果见附录。", "zh"},
+		{"연구 결과는 부록에 있습니다.", "ko"},
+		{"Lorem ipsum dolor sit amet", "unknown"},
+		{"12345 67890", "unknown"},
+		{"", "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want+"/"+tt.text, func(t *testing.T) {
+			if got := detectTextLanguage(tt.text); got != tt.want {
+				t.Errorf("detectTextLanguage(%q) = %s, want %s", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildQualityReport(t *testing.T) {
+	good := "The quick brown fox jumps over the lazy dog and runs into the forest."
+	tests := []struct {
+		name  string
+		pages []string
+		want  string
+	}{
+		{"clean document", []string{good, good}, "ok"},
+		{"one empty page", []string{good, good, ""}, "review"},
+		{"mostly scanned", []string{good, "", ""}, "ocr"},
+		{"no pages", nil, "ocr"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := qualityFromPages(tt.pages)
+			if report.Recommendation != tt.want {
+				t.Errorf("recommendation = %s, want %s (%+v)", report.Recommendation, tt.want, report)
+			}
+			if report.TotalPages != len(tt.pages) {
+				t.Errorf("total pages = %d, want %d", report.TotalPages, len(tt.pages))
+			}
+			if len(tt.pages) > 0 && report.Language != "en" {
+				t.Errorf("language = %q, want en", report.Language)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+/*
+RENDER (imagini pentru pagini PDF)
+
+POST /render
+  - file:       documentul (multipart sau body raw, ca la /extract)
+  - page:       pagina (1-based, implicit 1)
+  - dpi:        rezoluția (implicit 150, între 36 și 300)
+  - format:     png | jpeg | webp (implicit png)
+  - quality:    calitatea JPEG (1-100, implicit 85)
+  - thumbnails: true -> JSON cu miniaturi pentru toate paginile (dpi implicit 24, maxim 72)
+
+În loc de fișier se poate trimite o referință la un PDF salvat cu /extract/store:
+  - username + doc_name sau username + doc_hash (originalul din ORIGINALS_PATH,
+    vezi originals.go); 404 dacă documentul nu are original păstrat
+
+Randarea rulează în procesele worker (ca extragerea), deci un PDF corupt nu
+oprește serverul.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/gen2brain/go-fitz"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultRenderDPI    = 150
+	minRenderDPI        = 36
+	maxRenderDPI        = 300
+	defaultThumbnailDPI = 24
+	maxThumbnailDPI     = 72
+	defaultJPEGQuality  = 85
+	maxThumbnailPages   = 500
+)
+
+// errPageOutOfRange is returned when the requested page does not exist (400)
+var errPageOutOfRange = errors.New("page out of range")
+
+// RenderOptions - ce pagini se randează și în ce format
+type RenderOptions struct {
+	Page       int // 1-based, ignored for thumbnails
+	DPI        float64
+	Format     string // png, jpeg, webp
+	Quality    int    // JPEG only
+	Thumbnails bool   // every page at low resolution
+}
+
+// RenderedPage is one encoded page image
+type RenderedPage struct {
+	Page        int    `json:"page"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"` // base64 in JSON
+}
+
+// RenderResult - imaginile și numărul total de pagini
+type RenderResult struct {
+	TotalPages int
+	Images     []RenderedPage
+}
+
+type RenderResponse struct {
+	Success    bool           `json:"success"`
+	Filename   string         `json:"filename,omitempty"`
+	NumPages   int            `json:"num_pages,omitempty"`
+	Format     string         `json:"format,omitempty"`
+	DPI        float64        `json:"dpi,omitempty"`
+	Thumbnails []RenderedPage `json:"thumbnails,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// renderPDF renders one page, or every page as thumbnails
+func renderPDF(data []byte, opts RenderOptions) (*RenderResult, error) {
+	doc, err := fitz.NewFromMemory(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PDF: %v", err)
+	}
+	defer doc.Close()
+
+	result := &RenderResult{TotalPages: doc.NumPage()}
+
+	pages := []int{opts.Page}
+	if opts.Thumbnails {
+		pages = nil
+		for p := 1; p <= result.TotalPages && p <= maxThumbnailPages; p++ {
+			pages = append(pages, p)
+		}
+	} else if opts.Page < 1 || opts.Page > result.TotalPages {
+		return nil, fmt.Errorf("%w: page %d (document has %d pages)", errPageOutOfRange, opts.Page, result.TotalPages)
+	}
+
+	for _, page := range pages {
+		img, err := doc.ImageDPI(page-1, opts.DPI)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render page %d: %v", page, err)
+		}
+
+		encoded, contentType, err := encodeImage(img, opts.Format, opts.Quality)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode page %d: %v", page, err)
+		}
+
+		result.Images = append(result.Images, RenderedPage{
+			Page:        page,
+			Width:       img.Bounds().Dx(),
+			Height:      img.Bounds().Dy(),
+			ContentType: contentType,
+			Data:        encoded,
+		})
+	}
+
+	return result, nil
+}
+
+func encodeImage(img image.Image, format string, quality int) ([]byte, string, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	case "webp":
+		if err := nativewebp.Encode(&buf, img, nil); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/webp", nil
+	default:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+}
+
+// renderPDFIsolated runs rendering in a worker process when the pool is enabled
+func renderPDFIsolated(data []byte, opts RenderOptions) (*RenderResult, error) {
+	if extractionPool == nil {
+		return renderPDF(data, opts)
+	}
+
+	resp, err := extractionPool.Run(workerRequest{Op: "pdf_render", Data: data, Render: opts})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Render, nil
+}
+
+// parseRenderOptions validates the query/form parameters of /render
+func parseRenderOptions(c *fiber.Ctx) (RenderOptions, error) {
+	param := func(key, def string) string {
+		return strings.TrimSpace(c.FormValue(key, c.Query(key, def)))
+	}
+
+	opts := RenderOptions{Quality: defaultJPEGQuality}
+
+	thumbnails := strings.ToLower(param("thumbnails", "false"))
+	opts.Thumbnails = thumbnails == "true" || thumbnails == "1"
+
+	opts.Format = strings.ToLower(param("format", "png"))
+	if opts.Format == "jpg" {
+		opts.Format = "jpeg"
+	}
+	if opts.Format != "png" && opts.Format != "jpeg" && opts.Format != "webp" {
+		return opts, fmt.Errorf("format must be one of: png, jpeg, webp")
+	}
+
+	page, err := strconv.Atoi(param("page", "1"))
+	if err != nil || page < 1 {
+		return opts, fmt.Errorf("page must be a positive integer")
+	}
+	opts.Page = page
+
+	minDPI, maxDPI, defDPI := float64(minRenderDPI), float64(maxRenderDPI), defaultRenderDPI
+	if opts.Thumbnails {
+		minDPI, maxDPI, defDPI = 1, maxThumbnailDPI, defaultThumbnailDPI
+	}
+	dpi, err := strconv.ParseFloat(param("dpi", strconv.Itoa(defDPI)), 64)
+	if err != nil || dpi < minDPI || dpi > maxDPI {
+		return opts, fmt.Errorf("dpi must be between %.0f and %.0f", minDPI, maxDPI)
+	}
+	opts.DPI = dpi
+
+	if q := param("quality", ""); q != "" {
+		quality, err := strconv.Atoi(q)
+		if err != nil || quality < 1 || quality > 100 {
+			return opts, fmt.Errorf("quality must be between 1 and 100")
+		}
+		opts.Quality = quality
+	}
+
+	return opts, nil
+}
+
+// Handler: render a page as an image, or thumbnails for every page
+func handleRender(c *fiber.Ctx) error {
+	var fileData []byte
+	var fileType, filename string
+	var err error
+
+	// A stored document is rendered from its kept original (see originals.go)
+	docName := c.FormValue("doc_name", c.Query("doc_name"))
+	docHash := c.FormValue("doc_hash", c.Query("doc_hash"))
+	if docName != "" || docHash != "" {
+		username := c.FormValue("username", c.Query("username", "anon1"))
+		fileData, err = storedOriginal(username, docName, docHash)
+		if err != nil {
+			status := fiber.StatusInternalServerError
+			if errors.Is(err, errOriginalNotFound) {
+				status = fiber.StatusNotFound
+			} else if errors.Is(err, errOriginalsDisabled) {
+				status = fiber.StatusBadRequest
+			}
+			return c.Status(status).JSON(RenderResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+		}
+		fileType, filename = "pdf", docName
+		if filename == "" {
+			filename = docHash
+		}
+	} else if fileData, fileType, filename, err = getFileFromRequest(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(RenderResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+	if fileType != "pdf" {
+		return c.Status(fiber.StatusBadRequest).JSON(RenderResponse{
+			Success: false,
+			Error:   "rendering is only available for PDF files",
+		})
+	}
+
+	opts, err := parseRenderOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(RenderResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	result, err := renderPDFIsolated(fileData, opts)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, errPageOutOfRange) {
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(RenderResponse{
+			Success: false,
+			Error:   "Failed to render: " + err.Error(),
+		})
+	}
+
+	fmt.Printf("🖼️ Rendered %d image(s) from '%s' (%s, %.0f dpi)\n", len(result.Images), filename, opts.Format, opts.DPI)
+
+	if opts.Thumbnails {
+		return c.JSON(RenderResponse{
+			Success:    true,
+			Filename:   filename,
+			NumPages:   result.TotalPages,
+			Format:     opts.Format,
+			DPI:        opts.DPI,
+			Thumbnails: result.Images,
+		})
+	}
+
+	rendered := result.Images[0]
+	c.Set("Content-Type", rendered.ContentType)
+	c.Set("X-Page-Count", strconv.Itoa(result.TotalPages))
+	c.Set("X-Image-Width", strconv.Itoa(rendered.Width))
+	c.Set("X-Image-Height", strconv.Itoa(rendered.Height))
+	return c.Send(rendered.Data)
+}
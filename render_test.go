@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// testTextPDF builds a PDF whose pages have enough text to be stored
+func testTextPDF(t *testing.T, pages int) []byte {
+	t.Helper()
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetFont("Helvetica", "", 12)
+	for i := 1; i <= pages; i++ {
+		pdf.AddPage()
+		pdf.Cell(40, 10, fmt.Sprintf("Page %d talks about the ocean and its waves", i))
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatalf("failed to build test PDF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// testPDF builds a small PDF with one line of text per page
+func testPDF(t *testing.T, pages int) []byte {
+	t.Helper()
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetFont("Helvetica", "", 12)
+	for i := 1; i <= pages; i++ {
+		pdf.AddPage()
+		pdf.Cell(40, 10, fmt.Sprintf("Page %d text", i))
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatalf("failed to build test PDF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRenderPDFPages(t *testing.T) {
+	data := testPDF(t, 2)
+
+	tests := []struct {
+		name       string
+		opts       RenderOptions
+		wantImages int
+		outOfRange bool
+	}{
+		{"first page", RenderOptions{Page: 1, DPI: 36, Format: "png"}, 1, false},
+		{"last page as jpeg", RenderOptions{Page: 2, DPI: 36, Format: "jpeg", Quality: 80}, 1, false},
+		{"page after the last", RenderOptions{Page: 3, DPI: 36, Format: "png"}, 0, true},
+		{"page zero", RenderOptions{Page: 0, DPI: 36, Format: "png"}, 0, true},
+		{"thumbnails ignore the page", RenderOptions{Page: 9, DPI: 10, Format: "png", Thumbnails: true}, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := renderPDF(data, tt.opts)
+			if tt.outOfRange {
+				if !errors.Is(err, errPageOutOfRange) {
+					t.Fatalf("renderPDF error = %v, want errPageOutOfRange", err)
+				}
+				// The sentinel must survive the worker pipe as well
+				if remote := decodeWorkerError(workerFailure(err)); !errors.Is(remote, errPageOutOfRange) || remote.Error() != err.Error() {
+					t.Errorf("worker error = %v, want %v wrapping errPageOutOfRange", remote, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("renderPDF failed: %v", err)
+			}
+			if len(result.Images) != tt.wantImages || result.TotalPages != 2 {
+				t.Errorf("got %d images of %d pages, want %d of 2", len(result.Images), result.TotalPages, tt.wantImages)
+			}
+		})
+	}
+}
+
+func TestWorkerErrorWithoutSentinel(t *testing.T) {
+	err := decodeWorkerError(workerFailure(fmt.Errorf("failed to open PDF: broken")))
+	if errors.Is(err, errPageOutOfRange) {
+		t.Errorf("plain worker error %v matches errPageOutOfRange", err)
+	}
+	if err.Error() != "failed to open PDF: broken" {
+		t.Errorf("worker error message = %q", err.Error())
+	}
+}
+
+// useTestOriginals keeps originals in a temporary store for the test
+func useTestOriginals(t *testing.T) *OriginalStore {
+	t.Helper()
+	t.Setenv("ORIGINALS_PATH", filepath.Join(t.TempDir(), "originals.db"))
+	store, err := newOriginalStoreFromEnv()
+	if err != nil {
+		t.Fatalf("failed to open originals store: %v", err)
+	}
+	previous := originals
+	originals = store
+	t.Cleanup(func() {
+		originals = previous
+		store.Close()
+	})
+	return store
+}
+
+func TestHandleRender(t *testing.T) {
+	useTestVectorStore(t)
+	useTestOriginals(t)
+	app := fiber.New()
+	app.Post("/render", handleRender)
+	app.Delete("/documents/:username/:docName", handleDeleteDocument)
+
+	data := testTextPDF(t, 2)
+	for _, name := range []string{"a.pdf", "copy.pdf"} {
+		if _, err := ingestDocument(&IngestRequest{
+			Username: "ana", Filename: name, FileType: "pdf", FileData: data,
+			ChunkOpts: ChunkOptions{Strategy: ChunkPage}, ParagraphGrade: 1,
+		}, nil); err != nil {
+			t.Fatalf("failed to store %s: %v", name, err)
+		}
+	}
+	docHash := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	render := func(t *testing.T, query string, body []byte) int {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/render"+query, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/pdf")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		body   []byte
+		status int
+	}{
+		{"uploaded file", "?page=1&dpi=36", testPDF(t, 1), fiber.StatusOK},
+		{"page out of range", "?page=5&dpi=36", testPDF(t, 1), fiber.StatusBadRequest},
+		{"stored by name", "?username=ana&doc_name=a.pdf&page=2&dpi=36", nil, fiber.StatusOK},
+		{"stored by hash", "?username=ana&doc_hash=" + docHash + "&dpi=36", nil, fiber.StatusOK},
+		{"stored, page out of range", "?username=ana&doc_name=a.pdf&page=3&dpi=36", nil, fiber.StatusBadRequest},
+		{"unknown document", "?username=ana&doc_name=b.pdf", nil, fiber.StatusNotFound},
+		{"another user's document", "?username=bob&doc_hash=" + docHash, nil, fiber.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := render(t, tt.query, tt.body); status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+		})
+	}
+
+	// The original is kept while one of the two names still references it
+	deleteDoc := func(name string) {
+		resp, err := app.Test(httptest.NewRequest("DELETE", "/documents/ana/"+name, nil), -1)
+		if err != nil || resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("delete %s failed: %v", name, err)
+		}
+	}
+	deleteDoc("a.pdf")
+	if status := render(t, "?username=ana&doc_name=copy.pdf&dpi=36", nil); status != fiber.StatusOK {
+		t.Errorf("copy.pdf after deleting a.pdf: status %d, want 200", status)
+	}
+	deleteDoc("copy.pdf")
+	if _, err := originals.Load("ana", docHash); !errors.Is(err, errOriginalNotFound) {
+		t.Errorf("original after deleting both names: %v, want errOriginalNotFound", err)
+	}
+}
+
+func TestHandleRenderWithoutOriginals(t *testing.T) {
+	previous := originals
+	originals = nil
+	defer func() { originals = previous }()
+
+	app := fiber.New()
+	app.Post("/render", handleRender)
+	resp, err := app.Test(httptest.NewRequest("POST", "/render?doc_name=a.pdf", nil), -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+/*
+RERANKING DUPĂ CĂUTARE
+
+Căutarea (bm25.go / sparse.go) aduce mai mulți candidați decât limita, iar un
+reranker îi reordonează. Reranker-ul se alege per cerere (câmpul "rerank" în
+/search, /answer, /smart-search) sau global cu RERANKER:
+  - none           ordinea din căutare (implicit)
+  - llm            reranking listwise printr-un model OpenRouter (RERANK_LLM_MODEL)
+  - cross-encoder  endpoint HTTP local de tip /rerank (RERANK_URL, RERANK_MODEL,
+                   RERANK_API_KEY), ex. text-embeddings-inference sau Jina/Cohere
+
+Fiecare rezultat păstrează scorul din căutare în retrieval_score, iar score
+devine rerank_score. Dacă reranker-ul eșuează, se întoarce ordinea din căutare
+cu rerank_error completat.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCrossEncoderURL = "http://localhost:8080/rerank"
+	rerankFanout           = 3  // candidates per requested result
+	minRerankCandidates    = 20 // at least this many candidates are reranked
+	maxRerankCandidates    = 50
+	rerankPassageChars     = 1200 // passage length sent to the LLM reranker
+)
+
+// Reranker scores each candidate against the query (higher is better)
+type Reranker interface {
+	Name() string
+	Score(query string, results []SearchResult) ([]float32, error)
+}
+
+// crossEncoderClient is created in main() after .env is loaded
+var crossEncoderClient *ResilientClient
+
+// rerankerByName resolves the request's "rerank" field; empty means RERANKER (default none)
+func rerankerByName(name string) (Reranker, error) {
+	if name == "" {
+		name = os.Getenv("RERANKER")
+	}
+	switch strings.ToLower(name) {
+	case "", "none":
+		return nil, nil
+	case "llm":
+		model := os.Getenv("RERANK_LLM_MODEL")
+		if model == "" {
+			model = OpenRouterModel
+		}
+		return llmReranker{model: model}, nil
+	case "cross-encoder", "cross_encoder":
+		url := os.Getenv("RERANK_URL")
+		if url == "" {
+			url = defaultCrossEncoderURL
+		}
+		return crossEncoderReranker{url: url, model: os.Getenv("RERANK_MODEL"), apiKey: os.Getenv("RERANK_API_KEY")}, nil
+	default:
+		return nil, fmt.Errorf("unknown reranker %q (use none, llm or cross-encoder)", name)
+	}
+}
+
+// rerankCandidates is how many results retrieval should return for a reranker
+func rerankCandidates(reranker Reranker, limit int) int {
+	if reranker == nil {
+		return limit
+	}
+	candidates := limit * rerankFanout
+	if candidates < minRerankCandidates {
+		candidates = minRerankCandidates
+	}
+	if candidates > maxRerankCandidates {
+		candidates = maxRerankCandidates
+	}
+	if candidates < limit {
+		candidates = limit
+	}
+	return candidates
+}
+
+// applyReranker reorders results and trims them to limit. On error the retrieval
+// order is kept and the error is returned for the response.
+func applyReranker(reranker Reranker, query string, results []SearchResult, limit int) ([]SearchResult, error) {
+	if reranker == nil || len(results) == 0 {
+		if len(results) > limit {
+			results = results[:limit]
+		}
+		return results, nil
+	}
+
+	start := time.Now()
+	scores, err := reranker.Score(query, results)
+	if err == nil && len(scores) != len(results) {
+		err = fmt.Errorf("reranker returned %d scores for %d results", len(scores), len(results))
+	}
+	if err != nil {
+		fmt.Printf("⚠️ Reranker %s failed, keeping retrieval order: %v\n", reranker.Name(), err)
+		if len(results) > limit {
+			results = results[:limit]
+		}
+		return results, err
+	}
+
+	reranked := make([]SearchResult, len(results))
+	for i, result := range results {
+		score := scores[i]
+		result.RetrievalScore = result.Score
+		result.RerankScore = &score
+		result.Score = score
+		reranked[i] = result
+	}
+	// Stable: ties keep the retrieval order
+	sort.SliceStable(reranked, func(i, j int) bool { return reranked[i].Score > reranked[j].Score })
+	if len(reranked) > limit {
+		reranked = reranked[:limit]
+	}
+
+	fmt.Printf("🏅 Reranked %d candidates with %s in %v\n", len(results), reranker.Name(), time.Since(start).Round(time.Millisecond))
+	return reranked, nil
+}
+
+// searchAndRerank retrieves candidates for retrievalQuery and reranks them against
+// rerankQuery (smart-search retrieves with extracted keywords, reranks with the question).
+// The returned warning is the reranker error, if any (results are then in retrieval order).
+func searchAndRerank(scope map[string]interface{}, retrievalQuery, rerankQuery string, limit int, weights SearchWeights, reranker Reranker) ([]SearchResult, string, error) {
+	results, err := searchPagesHybrid(scope, retrievalQuery, rerankCandidates(reranker, limit), weights)
+	if err != nil {
+		return nil, "", err
+	}
+	reranked, rerankErr := applyReranker(reranker, rerankQuery, results, limit)
+	if rerankErr != nil {
+		return reranked, rerankErr.Error(), nil
+	}
+	return reranked, "", nil
+}
+
+func rerankerName(reranker Reranker) string {
+	if reranker == nil {
+		return "none"
+	}
+	return reranker.Name()
+}
+
+// llmReranker asks a chat model to order the passages by relevance (listwise)
+type llmReranker struct {
+	model string
+}
+
+func (r llmReranker) Name() string { return "llm:" + r.model }
+
+func (r llmReranker) Score(query string, results []SearchResult) ([]float32, error) {
+	apiKey := os.Getenv("OPENROUTER_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENROUTER_API_KEY environment variable not set")
+	}
+
+	var passages strings.Builder
+	for i, result := range results {
+		text := []rune(strings.TrimSpace(result.Payload.Text))
+		if len(text) > rerankPassageChars {
+			text = text[:rerankPassageChars]
+		}
+		passages.WriteString(fmt.Sprintf("[%d]\n%s\n\n", i+1, string(text)))
+	}
+
+	prompt := fmt.Sprintf(`You rank passages by how well they answer a search query.
+
+QUERY:
+%s
+
+PASSAGES:
+%s
+Return ONLY valid JSON, without markdown or explanations, in this format:
+{"ranking": [passage numbers from most to least relevant]}
+
+Include every passage number from 1 to %d exactly once.`, query, passages.String(), len(results))
+
+	response, err := callOpenRouter(OpenRouterRequest{
+		Model:       r.model,
+		Temperature: 0,
+		Messages:    []OpenRouterMessage{{Role: "user", Content: prompt}},
+	}, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return parseLLMRanking(response, len(results))
+}
+
+// parseLLMRanking turns the model's {"ranking": [...]} for n passages into scores
+func parseLLMRanking(response string, n int) ([]float32, error) {
+	clean := strings.TrimSpace(response)
+	clean = strings.TrimPrefix(clean, "```json")
+	clean = strings.ReplaceAll(clean, "```", "")
+	clean = strings.TrimSpace(clean)
+
+	var parsed struct {
+		Ranking []int `json:"ranking"`
+	}
+	if err := json.Unmarshal([]byte(sanitizeJSONString(clean)), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse ranking: %v. Response was: %s", err, clean)
+	}
+
+	// Position i of n scores (n-i)/n; passages the model left out score 0
+	scores := make([]float32, n)
+	seen := make(map[int]bool)
+	position := 0
+	for _, number := range parsed.Ranking {
+		if number < 1 || number > n || seen[number] {
+			continue
+		}
+		seen[number] = true
+		scores[number-1] = float32(n-position) / float32(n)
+		position++
+	}
+	if position == 0 {
+		return nil, fmt.Errorf("ranking contains no valid passage numbers: %s", clean)
+	}
+	return scores, nil
+}
+
+// crossEncoderReranker calls a /rerank endpoint. The passages are sent as both
+// "texts" (text-embeddings-inference) and "documents" (Jina/Cohere); the response
+// may be TEI's [{"index", "score"}] or {"results": [{"index", "relevance_score"}]}.
+type crossEncoderReranker struct {
+	url    string
+	model  string
+	apiKey string
+}
+
+func (r crossEncoderReranker) Name() string {
+	if r.model != "" {
+		return "cross-encoder:" + r.model
+	}
+	return "cross-encoder"
+}
+
+type crossEncoderScore struct {
+	Index          int      `json:"index"`
+	Score          *float32 `json:"score"`
+	RelevanceScore *float32 `json:"relevance_score"`
+}
+
+func (r crossEncoderReranker) Score(query string, results []SearchResult) ([]float32, error) {
+	texts := make([]string, len(results))
+	for i, result := range results {
+		texts[i] = result.Payload.Text
+	}
+
+	body := map[string]interface{}{
+		"query":     query,
+		"texts":     texts,
+		"documents": texts,
+	}
+	if r.model != "" {
+		body["model"] = r.model
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rerank request: %v", err)
+	}
+
+	result, err := crossEncoderClient.Do(func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", r.url, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if r.apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+r.apiKey)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call reranker at %s: %v", r.url, err)
+	}
+	if result.StatusCode != 200 {
+		return nil, fmt.Errorf("reranker returned status %d: %s", result.StatusCode, truncateBody(result.Body, 512))
+	}
+
+	var items []crossEncoderScore
+	if err := json.Unmarshal(result.Body, &items); err != nil {
+		var wrapped struct {
+			Results []crossEncoderScore `json:"results"`
+		}
+		if err := json.Unmarshal(result.Body, &wrapped); err != nil {
+			return nil, fmt.Errorf("failed to decode rerank response: %v", err)
+		}
+		items = wrapped.Results
+	}
+
+	scores := make([]float32, len(results))
+	scored := 0
+	for _, item := range items {
+		if item.Index < 0 || item.Index >= len(results) {
+			continue
+		}
+		switch {
+		case item.Score != nil:
+			scores[item.Index] = *item.Score
+		case item.RelevanceScore != nil:
+			scores[item.Index] = *item.RelevanceScore
+		default:
+			continue
+		}
+		scored++
+	}
+	if scored != len(results) {
+		return nil, fmt.Errorf("reranker scored %d of %d passages", scored, len(results))
+	}
+	return scores, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fixedReranker returns preset scores (or an error) whatever the query
+type fixedReranker struct {
+	scores []float32
+	err    error
+}
+
+func (r fixedReranker) Name() string { return "fixed" }
+
+func (r fixedReranker) Score(query string, results []SearchResult) ([]float32, error) {
+	return r.scores, r.err
+}
+
+func rerankResults(ids ...string) []SearchResult {
+	results := make([]SearchResult, len(ids))
+	for i, id := range ids {
+		results[i] = SearchResult{ID: id, Score: float32(len(ids) - i)}
+	}
+	return results
+}
+
+func TestApplyReranker(t *testing.T) {
+	tests := []struct {
+		name      string
+		reranker  Reranker
+		limit     int
+		want      []string
+		wantErr   bool
+		reordered bool // scores were replaced by the reranker's
+	}{
+		{"no reranker trims", nil, 2, []string{"a", "b"}, false, false},
+		{"reorders by score", fixedReranker{scores: []float32{0.1, 0.9, 0.5, 0.3}}, 3, []string{"b", "c", "d"}, false, true},
+		{"ties keep retrieval order", fixedReranker{scores: []float32{0.5, 0.5, 0.9, 0.5}}, 4, []string{"c", "a", "b", "d"}, false, true},
+		{"error keeps retrieval order", fixedReranker{err: errors.New("down")}, 2, []string{"a", "b"}, true, false},
+		{"wrong score count", fixedReranker{scores: []float32{1, 2}}, 3, []string{"a", "b", "c"}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := applyReranker(tt.reranker, "query", rerankResults("a", "b", "c", "d"), tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyReranker error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := resultIDs(results); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("results = %v, want %v", got, tt.want)
+			}
+			for _, r := range results {
+				if (r.RerankScore != nil) != tt.reordered {
+					t.Fatalf("%s rerank_score = %v, want set %v", r.ID, r.RerankScore, tt.reordered)
+				}
+				if tt.reordered && (r.Score != *r.RerankScore || r.RetrievalScore == 0) {
+					t.Errorf("%s score %.2f, rerank %.2f, retrieval %.2f", r.ID, r.Score, *r.RerankScore, r.RetrievalScore)
+				}
+			}
+		})
+	}
+}
+
+func TestParseLLMRanking(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []float32
+		wantErr  string
+	}{
+		{"full ranking", `{"ranking": [2, 3, 1]}`, []float32{1.0 / 3, 1, 2.0 / 3}, ""},
+		{"markdown fence", "```json\n{\"ranking\": [1, 2, 3]}\n```", []float32{1, 2.0 / 3, 1.0 / 3}, ""},
+		{"missing passages score 0", `{"ranking": [3]}`, []float32{0, 0, 1}, ""},
+		{"duplicates and out of range skipped", `{"ranking": [0, 2, 2, 7, 1]}`, []float32{2.0 / 3, 1, 0}, ""},
+		{"no valid numbers", `{"ranking": [9, -1]}`, nil, "no valid passage numbers"},
+		{"not json", `Passage 2 is best`, nil, "failed to parse ranking"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scores, err := parseLLMRanking(tt.response, 3)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseLLMRanking error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLLMRanking failed: %v", err)
+			}
+			if !reflect.DeepEqual(scores, tt.want) {
+				t.Errorf("scores = %v, want %v", scores, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrossEncoderResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []float32
+		wantErr  bool
+	}{
+		{"tei list", `[{"index":1,"score":0.9},{"index":0,"score":0.2}]`, []float32{0.2, 0.9}, false},
+		{"cohere results", `{"results":[{"index":0,"relevance_score":0.7},{"index":1,"relevance_score":0.1}]}`, []float32{0.7, 0.1}, false},
+		{"missing passage", `[{"index":0,"score":0.9}]`, nil, true},
+		{"index out of range", `[{"index":0,"score":0.9},{"index":4,"score":0.1}]`, nil, true},
+		{"not json", `<html>`, nil, true},
+	}
+
+	previous := crossEncoderClient
+	crossEncoderClient = newResilientClient("test-reranker", 0)
+	t.Cleanup(func() { crossEncoderClient = previous })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			scores, err := crossEncoderReranker{url: server.URL}.Score("query", rerankResults("a", "b"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Score error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(scores, tt.want) {
+				t.Errorf("scores = %v, want %v", scores, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+/*
+HTTP REZILIENT (OpenAI / embeddings, OpenRouter, Qdrant)
+
+Toate apelurile externe trec prin ResilientClient:
+  - retry cu backoff exponențial și jitter pentru erori de rețea și statusuri
+    408, 425, 429, 500, 502, 503, 504; un timeout nu spune dacă cererea a fost
+    procesată, așa că se reîncearcă doar pentru metode idempotente sau pentru
+    clienții care aleg asta (Qdrant), nu pentru POST-urile către OpenRouter
+  - respectă Retry-After (secunde sau dată HTTP), limitat la HTTP_RETRY_MAX_MS
+  - un circuit breaker per provider: după CIRCUIT_BREAKER_THRESHOLD eșecuri
+    consecutive cererile sunt refuzate imediat timp de CIRCUIT_BREAKER_COOLDOWN_SECONDS,
+    apoi o singură cerere de probă decide dacă circuitul se închide
+
+Env: HTTP_RETRY_MAX_ATTEMPTS (implicit 4), HTTP_RETRY_BASE_MS (500),
+HTTP_RETRY_MAX_MS (20000), CIRCUIT_BREAKER_THRESHOLD (5),
+CIRCUIT_BREAKER_COOLDOWN_SECONDS (30). Starea circuitelor apare în /health.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts = 4
+	defaultRetryBaseMs      = 500
+	defaultRetryMaxMs       = 20000
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30
+)
+
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// errCircuitOpen - providerul a eșuat de prea multe ori, cererea nu mai este trimisă
+var errCircuitOpen = errors.New("circuit breaker open")
+
+// HTTPResult is a fully read response
+type HTTPResult struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func retryPolicyFromEnv() RetryPolicy {
+	policy := RetryPolicy{
+		MaxAttempts: envInt("HTTP_RETRY_MAX_ATTEMPTS", defaultRetryMaxAttempts),
+		BaseDelay:   time.Duration(envInt("HTTP_RETRY_BASE_MS", defaultRetryBaseMs)) * time.Millisecond,
+		MaxDelay:    time.Duration(envInt("HTTP_RETRY_MAX_MS", defaultRetryMaxMs)) * time.Millisecond,
+	}
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	return policy
+}
+
+// backoff returns a random delay in [0, min(max, base*2^attempt)] (full jitter)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.BaseDelay << attempt
+	if ceiling > p.MaxDelay || ceiling <= 0 {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// CircuitBreaker counts consecutive failures of one provider
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	name      string
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     string
+	openUntil time.Time
+	probing   bool
+}
+
+// CircuitStatus - starea unui circuit pentru /health
+type CircuitStatus struct {
+	State    string `json:"state"`
+	Failures int    `json:"consecutive_failures"`
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = map[string]*CircuitBreaker{}
+)
+
+// breakerFor returns the shared breaker of a provider
+func breakerFor(name string) *CircuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	if b, ok := breakers[name]; ok {
+		return b
+	}
+	b := &CircuitBreaker{
+		name:      name,
+		threshold: envInt("CIRCUIT_BREAKER_THRESHOLD", defaultBreakerThreshold),
+		cooldown:  time.Duration(envInt("CIRCUIT_BREAKER_COOLDOWN_SECONDS", defaultBreakerCooldown)) * time.Second,
+		state:     circuitClosed,
+	}
+	breakers[name] = b
+	return b
+}
+
+func circuitStatuses() map[string]CircuitStatus {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	statuses := make(map[string]CircuitStatus, len(breakers))
+	for name, b := range breakers {
+		b.mu.Lock()
+		statuses[name] = CircuitStatus{State: b.state, Failures: b.failures}
+		b.mu.Unlock()
+	}
+	return statuses
+}
+
+// allow reports whether a request may be sent; after the cooldown one probe is let through
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Now().Before(b.openUntil) {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		return true
+	case circuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// cancel gives back a probe that was never sent, so the next request can probe
+func (b *CircuitBreaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *CircuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != circuitClosed {
+		fmt.Printf("🟢 Circuit '%s' closed\n", b.name)
+	}
+	b.failures = 0
+	b.state = circuitClosed
+	b.probing = false
+}
+
+func (b *CircuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == circuitHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		if b.state != circuitOpen {
+			fmt.Printf("🔴 Circuit '%s' open for %v after %d failures\n", b.name, b.cooldown, b.failures)
+		}
+		b.state = circuitOpen
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// ResilientClient is an http.Client with retries and a circuit breaker.
+// retryTimeouts also retries timed out non-idempotent requests (e.g. POST), for
+// providers where they are safe to resend.
+type ResilientClient struct {
+	name          string
+	client        *http.Client
+	policy        RetryPolicy
+	breaker       *CircuitBreaker
+	retryTimeouts bool
+}
+
+func newResilientClient(name string, timeout time.Duration) *ResilientClient {
+	return &ResilientClient{
+		name:    name,
+		client:  &http.Client{Timeout: timeout},
+		policy:  retryPolicyFromEnv(),
+		breaker: breakerFor(name),
+	}
+}
+
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isIdempotentMethod reports whether resending method cannot repeat a side effect
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isRetryableError treats connection failures as transient. A timeout may come after
+// the provider received the request, so it is retried only when retryTimeouts is set.
+func isRetryableError(err error, retryTimeouts bool) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return !netErr.Timeout() || retryTimeouts
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// retryAfter parses the Retry-After header (seconds or HTTP date)
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at), true
+	}
+	return 0, false
+}
+
+// Do sends the request built by newRequest (called again for every attempt, so
+// the body can be re-read). Non-2xx responses are returned with their body;
+// an error means the provider could not be reached or the circuit is open.
+func (c *ResilientClient) Do(newRequest func() (*http.Request, error)) (*HTTPResult, error) {
+	if !c.breaker.allow() {
+		return nil, fmt.Errorf("%s: %w", c.name, errCircuitOpen)
+	}
+
+	var lastErr error
+	var lastResult *HTTPResult
+
+	for attempt := 0; attempt < c.policy.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			delay := c.policy.backoff(attempt - 1)
+			if lastResult != nil {
+				if wait, ok := retryAfter(lastResult.Header); ok {
+					delay = wait
+					if delay > c.policy.MaxDelay {
+						delay = c.policy.MaxDelay
+					}
+				}
+			}
+			fmt.Printf("🔁 %s: retry %d/%d in %v (%s)\n", c.name, attempt, c.policy.MaxAttempts-1, delay.Round(time.Millisecond), describeAttempt(lastResult, lastErr))
+			time.Sleep(delay)
+		}
+
+		req, err := newRequest()
+		if err != nil {
+			// Nothing was sent, the provider is not to blame (and a probe must not stay taken)
+			c.breaker.cancel()
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			lastErr, lastResult = err, nil
+			if isRetryableError(err, c.retryTimeouts || isIdempotentMethod(req.Method)) {
+				continue
+			}
+			c.breaker.failure()
+			return nil, err
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr, lastResult = fmt.Errorf("failed to read response body: %v", err), nil
+			// The request reached the provider, a POST may already have taken effect
+			if c.retryTimeouts || isIdempotentMethod(req.Method) {
+				continue
+			}
+			c.breaker.failure()
+			return nil, lastErr
+		}
+
+		lastErr = nil
+		lastResult = &HTTPResult{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}
+		if isRetryableStatus(resp.StatusCode) {
+			continue
+		}
+
+		// 2xx and non-retryable 4xx mean the provider is up
+		c.breaker.success()
+		return lastResult, nil
+	}
+
+	c.breaker.failure()
+	if lastResult != nil {
+		return lastResult, nil
+	}
+	return nil, fmt.Errorf("%v (after %d attempts)", lastErr, c.policy.MaxAttempts)
+}
+
+func describeAttempt(result *HTTPResult, err error) string {
+	if result != nil {
+		return fmt.Sprintf("status %d", result.StatusCode)
+	}
+	return fmt.Sprintf("%v", err)
+}
+
+// truncateBody keeps error messages readable when a provider returns a large page
+func truncateBody(body []byte, limit int) string {
+	if len(body) <= limit {
+		return string(body)
+	}
+	return string(body[:limit]) + "..."
+}
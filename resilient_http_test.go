@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// timeoutError is a net.Error that reports a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryableError(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		name          string
+		err           error
+		retryTimeouts bool
+		want          bool
+	}{
+		{"connection refused", refused, false, true},
+		{"unexpected EOF", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), false, true},
+		{"timeout not retried by default", timeoutError{}, false, false},
+		{"timeout retried when allowed", timeoutError{}, true, true},
+		{"other errors", errors.New("bad url"), true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableError(tt.err, tt.retryTimeouts); got != tt.want {
+				t.Errorf("isRetryableError(%v, %v) = %v, want %v", tt.err, tt.retryTimeouts, got, tt.want)
+			}
+		})
+	}
+}
+
+func testResilientClient(name string, timeout time.Duration, retryTimeouts bool) *ResilientClient {
+	return &ResilientClient{
+		name:          name,
+		client:        &http.Client{Timeout: timeout},
+		policy:        RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond},
+		breaker:       &CircuitBreaker{name: name, threshold: 2, cooldown: time.Hour, state: circuitClosed},
+		retryTimeouts: retryTimeouts,
+	}
+}
+
+// truncatedBody promises more bytes than it sends, so reading the body fails
+func truncatedBody(_ int32, w http.ResponseWriter) {
+	w.Header().Set("Content-Length", "100")
+	w.Write([]byte("short"))
+}
+
+func TestResilientClientRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		handler       func(attempt int32, w http.ResponseWriter)
+		retryTimeouts bool
+		wantAttempts  int32
+		wantStatus    int
+		wantErr       bool
+	}{
+		{
+			name:   "5xx then success",
+			method: http.MethodPost,
+			handler: func(attempt int32, w http.ResponseWriter) {
+				if attempt < 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			},
+			wantAttempts: 3,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "4xx is not retried",
+			method:       http.MethodPost,
+			handler:      func(_ int32, w http.ResponseWriter) { w.WriteHeader(http.StatusBadRequest) },
+			wantAttempts: 1,
+			wantStatus:   http.StatusBadRequest,
+		},
+		{
+			name:         "POST timeout is sent once",
+			method:       http.MethodPost,
+			handler:      func(_ int32, _ http.ResponseWriter) { time.Sleep(100 * time.Millisecond) },
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:          "POST timeout retried when the client allows it",
+			method:        http.MethodPost,
+			handler:       func(_ int32, _ http.ResponseWriter) { time.Sleep(100 * time.Millisecond) },
+			retryTimeouts: true,
+			wantAttempts:  3,
+			wantErr:       true,
+		},
+		{
+			name:         "GET timeout is retried",
+			method:       http.MethodGet,
+			handler:      func(_ int32, _ http.ResponseWriter) { time.Sleep(100 * time.Millisecond) },
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+		{
+			name:         "POST with a truncated body is sent once",
+			method:       http.MethodPost,
+			handler:      truncatedBody,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "GET with a truncated body is retried",
+			method:       http.MethodGet,
+			handler:      truncatedBody,
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.handler(attempts.Add(1), w)
+			}))
+			defer server.Close()
+
+			client := testResilientClient(tt.name, 30*time.Millisecond, tt.retryTimeouts)
+			result, err := client.Do(func() (*http.Request, error) {
+				return http.NewRequest(tt.method, server.URL, nil)
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && result.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", result.StatusCode, tt.wantStatus)
+			}
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("server saw %d attempts, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerProbeReleasedWhenRequestCannotBeBuilt(t *testing.T) {
+	client := testResilientClient("probe", time.Second, false)
+	client.breaker.state = circuitOpen
+	client.breaker.openUntil = time.Now().Add(-time.Second)
+
+	_, err := client.Do(func() (*http.Request, error) {
+		return nil, errors.New("cannot marshal body")
+	})
+	if err == nil {
+		t.Fatalf("expected the request error")
+	}
+
+	// The failed probe was never sent, so the next request may probe
+	if !client.breaker.allow() {
+		t.Errorf("half-open circuit still refuses requests after a request that was never sent")
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+/*
+SNIPPET-URI PENTRU REZULTATELE /search
+
+Fiecare rezultat primește cele mai relevante fragmente din textul său:
+  - keyword:  propoziția cu cei mai mulți termeni diferiți din interogare
+              (același tokenizer ca BM25), apoi cele cu cele mai multe apariții
+  - semantic: propoziția cu embedding-ul cel mai apropiat de interogare;
+              implicit activ (SEARCH_SEMANTIC_SNIPPETS=0 sau "semantic_snippets":
+              false îl opresc), fiecare propoziție comparată fiind un embedding
+              în plus, deci cel mult 128 de propoziții per cerere
+Dacă ambele aleg aceeași propoziție, snippet-ul are source "keyword+semantic";
+fără nicio potrivire se întoarce începutul textului (source "lead").
+
+Offset-urile (start/end în textul rezultatului, highlights în textul
+snippet-ului) sunt în caractere Unicode (rune), nu în bytes. "highlighted"
+este textul escapat HTML cu termenii găsiți între <mark> și </mark>.
+
+Câmpuri în /search: "snippets" (număr per rezultat, implicit SEARCH_SNIPPETS=2,
+0 dezactivează) și "include_text": false pentru a nu mai trimite textul întreg.
+*/
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultSearchSnippets = 2
+	maxSearchSnippets     = 5
+	minSnippetChars       = 80  // short sentences are extended with the next ones
+	maxSnippetChars       = 280 // long sentences are cut around the first match
+	snippetLeadChars      = 60  // context kept before the first match of a cut sentence
+	maxSnippetSentences   = 64  // sentences per result compared with the query embedding
+	maxSnippetEmbeddings  = 128 // sentences embedded per request, over all results
+	snippetSourceKeyword  = "keyword"
+	snippetSourceSemantic = "semantic"
+	snippetSourceBoth     = "keyword+semantic"
+	snippetSourceLead     = "lead"
+)
+
+// Snippet is a passage of a search result that explains the match
+type Snippet struct {
+	Text         string          `json:"text"`
+	Highlighted  string          `json:"highlighted"`
+	Start        int             `json:"start"` // rune offsets in the result text
+	End          int             `json:"end"`
+	Highlights   []HighlightSpan `json:"highlights,omitempty"` // rune offsets in Text
+	Source       string          `json:"source"`               // keyword, semantic, keyword+semantic or lead
+	TermsMatched int             `json:"terms_matched,omitempty"`
+	Similarity   *float32        `json:"similarity,omitempty"` // cosine with the query embedding
+}
+
+type HighlightSpan struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// termHit is a query term found in the text (byte offsets)
+type termHit struct {
+	term       string
+	start, end int
+}
+
+// snippetCount applies the request value (nil means SEARCH_SNIPPETS)
+func snippetCount(requested *int) (int, error) {
+	if requested == nil {
+		count := envInt("SEARCH_SNIPPETS", defaultSearchSnippets)
+		if count < 0 || count > maxSearchSnippets {
+			fmt.Printf("⚠️ SEARCH_SNIPPETS=%d out of range, using %d\n", count, defaultSearchSnippets)
+			count = defaultSearchSnippets
+		}
+		return count, nil
+	}
+	if *requested < 0 || *requested > maxSearchSnippets {
+		return 0, fmt.Errorf("snippets must be between 0 and %d", maxSearchSnippets)
+	}
+	return *requested, nil
+}
+
+// semanticSnippets applies the request value (nil means SEARCH_SEMANTIC_SNIPPETS, on by default)
+func semanticSnippets(requested *bool) bool {
+	if requested == nil {
+		return envInt("SEARCH_SEMANTIC_SNIPPETS", 1) != 0
+	}
+	return *requested
+}
+
+// findTermHits returns every occurrence of a query term, tokenized like tokenizeForBM25
+func findTermHits(text string, terms map[string]bool) []termHit {
+	var hits []termHit
+	start := -1
+	for i, r := range text + " " {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			word := strings.ToLower(text[start:i])
+			if terms[word] {
+				hits = append(hits, termHit{term: word, start: start, end: i})
+			}
+			start = -1
+		}
+	}
+	return hits
+}
+
+// addSnippets fills Snippets of every result. semantic enables the embedding-based
+// snippet (one batched embedding call for all results).
+func addSnippets(results []SearchResult, query string, count int, semantic bool) {
+	if count == 0 || len(results) == 0 {
+		return
+	}
+
+	terms := make(map[string]bool)
+	for _, term := range queryTerms(query) {
+		terms[term] = true
+	}
+
+	sentences := make([][]span, len(results))
+	for i, result := range results {
+		text := result.Payload.Text
+		for _, s := range sentenceSpans(text, span{0, len(text)}) {
+			if s = trimSpan(text, s); s.end > s.start {
+				sentences[i] = append(sentences[i], s)
+			}
+		}
+	}
+
+	var best []semanticSentence
+	if semantic {
+		var err error
+		if best, err = mostSimilarSentences(results, sentences, query); err != nil {
+			fmt.Printf("⚠️ Semantic snippets skipped: %v\n", err)
+			best = nil
+		}
+	}
+
+	for i := range results {
+		text := results[i].Payload.Text
+		hits := findTermHits(text, terms)
+
+		// Sentences ranked by distinct terms, then by occurrences
+		type ranked struct {
+			index, distinct, total int
+		}
+		var lexical []ranked
+		for j, s := range sentences[i] {
+			seen := make(map[string]bool)
+			total := 0
+			for _, hit := range hits {
+				if hit.start >= s.start && hit.end <= s.end {
+					seen[hit.term] = true
+					total++
+				}
+			}
+			if total > 0 {
+				lexical = append(lexical, ranked{j, len(seen), total})
+			}
+		}
+		sort.SliceStable(lexical, func(a, b int) bool {
+			if lexical[a].distinct != lexical[b].distinct {
+				return lexical[a].distinct > lexical[b].distinct
+			}
+			return lexical[a].total > lexical[b].total
+		})
+
+		var snippets []Snippet
+		var windows []span // byte range of each snippet
+		// covering finds the snippet that already contains a sentence
+		covering := func(sentence int) (int, bool) {
+			s := sentences[i][sentence]
+			for k, w := range windows {
+				if s.start < w.end && s.end > w.start {
+					return k, true
+				}
+			}
+			return 0, false
+		}
+		add := func(sentence int, source string, distinct int) {
+			if k, ok := covering(sentence); ok {
+				if snippets[k].Source != source {
+					snippets[k].Source = snippetSourceBoth
+				}
+				return
+			}
+			if len(snippets) == count {
+				return
+			}
+			snippet, window := buildSnippet(text, sentences[i], sentence, hits)
+			snippet.Source = source
+			snippet.TermsMatched = distinct
+			windows = append(windows, window)
+			snippets = append(snippets, snippet)
+		}
+
+		if len(lexical) > 0 {
+			add(lexical[0].index, snippetSourceKeyword, lexical[0].distinct)
+		}
+		if best != nil && best[i].index >= 0 {
+			add(best[i].index, snippetSourceSemantic, 0)
+			if k, ok := covering(best[i].index); ok {
+				similarity := best[i].similarity
+				snippets[k].Similarity = &similarity
+			}
+		}
+		for _, r := range lexical {
+			add(r.index, snippetSourceKeyword, r.distinct)
+		}
+		// No match at all: the start of the text
+		if len(snippets) == 0 && len(sentences[i]) > 0 {
+			add(0, snippetSourceLead, 0)
+		}
+		results[i].Snippets = snippets
+	}
+}
+
+type semanticSentence struct {
+	index      int // -1 when the result has no sentence
+	similarity float32
+}
+
+// mostSimilarSentences embeds the query and the sentences of all results in one call.
+// At most maxSnippetEmbeddings sentences are embedded, shared evenly by the results; results
+// past the budget get no semantic snippet.
+func mostSimilarSentences(results []SearchResult, sentences [][]span, query string) ([]semanticSentence, error) {
+	perResult := maxSnippetEmbeddings / len(results)
+	if perResult > maxSnippetSentences {
+		perResult = maxSnippetSentences
+	}
+	if perResult < 1 {
+		perResult = 1
+	}
+
+	inputs := []string{query} // the query, then the sentences
+	owners := []int{-1}
+	indexes := []int{-1}
+	for i, result := range results {
+		for j, s := range sentences[i] {
+			if j == perResult || len(inputs)-1 >= maxSnippetEmbeddings {
+				break
+			}
+			inputs = append(inputs, result.Payload.Text[s.start:s.end])
+			owners = append(owners, i)
+			indexes = append(indexes, j)
+		}
+	}
+
+	embeddings, err := qdrant.Embedder.Embed(inputs)
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) != len(inputs) {
+		return nil, fmt.Errorf("got %d embeddings for %d inputs", len(embeddings), len(inputs))
+	}
+
+	best := make([]semanticSentence, len(results))
+	for i := range best {
+		best[i] = semanticSentence{index: -1}
+	}
+	for k := 1; k < len(inputs); k++ {
+		similarity := float32(cosineSimilarity(embeddings[0], embeddings[k]))
+		owner := owners[k]
+		if best[owner].index < 0 || similarity > best[owner].similarity {
+			best[owner] = semanticSentence{index: indexes[k], similarity: similarity}
+		}
+	}
+	return best, nil
+}
+
+// buildSnippet turns sentence i into a snippet: short sentences grow with their
+// neighbours, long ones are cut around the first match. Also returns the byte range.
+func buildSnippet(text string, sentences []span, i int, hits []termHit) (Snippet, span) {
+	window := sentences[i]
+	for next := i + 1; utf8.RuneCountInString(text[window.start:window.end]) < minSnippetChars && next < len(sentences); next++ {
+		window.end = sentences[next].end
+	}
+	for prev := i - 1; utf8.RuneCountInString(text[window.start:window.end]) < minSnippetChars && prev >= 0; prev-- {
+		window.start = sentences[prev].start
+	}
+
+	cutStart, cutEnd := false, false
+	if utf8.RuneCountInString(text[window.start:window.end]) > maxSnippetChars {
+		anchor := window.start
+		for _, hit := range hits {
+			if hit.start >= sentences[i].start && hit.end <= sentences[i].end {
+				anchor = hit.start
+				break
+			}
+		}
+		start := moveRunes(text, anchor, -snippetLeadChars, window.start)
+		if start > window.start {
+			start = wordStartAfter(text, start, anchor)
+			cutStart = true
+		}
+		end := moveRunes(text, start, maxSnippetChars, window.end)
+		if end < window.end {
+			end = wordEndBefore(text, end, start)
+			cutEnd = true
+		}
+		window = trimSpan(text, span{start, end})
+	}
+
+	snippetText := text[window.start:window.end]
+	snippet := Snippet{
+		Text:  snippetText,
+		Start: utf8.RuneCountInString(text[:window.start]),
+		End:   utf8.RuneCountInString(text[:window.end]),
+	}
+
+	var highlighted strings.Builder
+	if cutStart {
+		highlighted.WriteString("…")
+	}
+	last := window.start
+	for _, hit := range hits {
+		if hit.start < window.start || hit.end > window.end {
+			continue
+		}
+		snippet.Highlights = append(snippet.Highlights, HighlightSpan{
+			Start: utf8.RuneCountInString(text[window.start:hit.start]),
+			End:   utf8.RuneCountInString(text[window.start:hit.end]),
+		})
+		highlighted.WriteString(html.EscapeString(text[last:hit.start]))
+		highlighted.WriteString("<mark>")
+		highlighted.WriteString(html.EscapeString(text[hit.start:hit.end]))
+		highlighted.WriteString("</mark>")
+		last = hit.end
+	}
+	highlighted.WriteString(html.EscapeString(text[last:window.end]))
+	if cutEnd {
+		highlighted.WriteString("…")
+	}
+	snippet.Highlighted = highlighted.String()
+	return snippet, window
+}
+
+// moveRunes moves a byte offset by n runes (negative: backwards), stopping at limit
+func moveRunes(text string, i, n, limit int) int {
+	for ; n < 0 && i > limit; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:i])
+		i -= size
+	}
+	for ; n > 0 && i < limit; n-- {
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	return i
+}
+
+// wordStartAfter moves i forward to the next word start, not past limit
+func wordStartAfter(text string, i, limit int) int {
+	if space := strings.IndexFunc(text[i:limit], unicode.IsSpace); space >= 0 {
+		return i + space
+	}
+	return i
+}
+
+// wordEndBefore moves i back to the previous space, not before limit
+func wordEndBefore(text string, i, limit int) int {
+	if space := strings.LastIndexFunc(text[limit:i], unicode.IsSpace); space > 0 {
+		return limit + space
+	}
+	return i
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSemanticSnippetsDefaultOn(t *testing.T) {
+	on, off := true, false
+	tests := []struct {
+		name      string
+		env       string
+		requested *bool
+		want      bool
+	}{
+		{"default", "", nil, true},
+		{"disabled by env", "0", nil, false},
+		{"enabled by env", "1", nil, true},
+		{"request overrides env", "1", &off, false},
+		{"request enables", "0", &on, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SEARCH_SEMANTIC_SNIPPETS", tt.env)
+			if got := semanticSnippets(tt.requested); got != tt.want {
+				t.Errorf("semanticSnippets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddSnippetsCapsEmbeddedSentences(t *testing.T) {
+	embedded := 0
+	previous := qdrant
+	qdrant = &QdrantClient{Embedder: countingEmbedder{Embedder: hashEmbedder{dimensions: 64}, texts: &embedded}}
+	t.Cleanup(func() { qdrant = previous })
+
+	results := func(count, sentences int) []SearchResult {
+		out := make([]SearchResult, count)
+		for i := range out {
+			var text strings.Builder
+			for j := 0; j < sentences; j++ {
+				fmt.Fprintf(&text, "Sentence %d of result %d talks about the ocean. ", j, i)
+			}
+			out[i].ID = fmt.Sprint(i)
+			out[i].Payload.Text = text.String()
+		}
+		return out
+	}
+
+	tests := []struct {
+		name         string
+		results      []SearchResult
+		semantic     bool
+		wantEmbedded int // query included
+	}{
+		{"keyword only", results(5, 10), false, 0},
+		{"few sentences", results(3, 4), true, 1 + 12},
+		{"per result cap", results(1, 100), true, 1 + maxSnippetSentences},
+		{"shared budget", results(8, 100), true, 1 + maxSnippetEmbeddings},
+		{"more results than budget", results(200, 3), true, 1 + maxSnippetEmbeddings},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedded = 0
+			addSnippets(tt.results, "ocean", 2, tt.semantic)
+			if embedded != tt.wantEmbedded {
+				t.Errorf("embedded %d texts, want %d", embedded, tt.wantEmbedded)
+			}
+			for _, result := range tt.results {
+				if len(result.Snippets) == 0 {
+					t.Fatalf("result %s has no snippets", result.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestAddSnippetsHighlightsTerms(t *testing.T) {
+	results := []SearchResult{{ID: "a"}}
+	results[0].Payload.Text = "Mountains are tall. The ocean is deep & wide. Rivers flow."
+	addSnippets(results, "deep ocean", 1, false)
+
+	if len(results[0].Snippets) != 1 {
+		t.Fatalf("got %d snippets, want 1", len(results[0].Snippets))
+	}
+	snippet := results[0].Snippets[0]
+	if snippet.Source != snippetSourceKeyword || snippet.TermsMatched != 2 {
+		t.Errorf("source %q with %d terms, want keyword with 2", snippet.Source, snippet.TermsMatched)
+	}
+	if !strings.Contains(snippet.Highlighted, "The <mark>ocean</mark> is <mark>deep</mark> &amp; wide.") {
+		t.Errorf("highlighted = %q", snippet.Highlighted)
+	}
+}
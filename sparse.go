@@ -0,0 +1,221 @@
+package main
+
+/*
+VECTORI SPARSE (BM25) + QUERY API
+
+Colecțiile noi au doi vectori numiți pe fiecare punct:
+  - "dense": embedding-ul modelului (distanță Cosine)
+  - "bm25":  vector sparse lexical, calculat în Go la salvare
+
+Indicele unui termen este FNV-32a(token), iar valoarea este partea BM25 care
+depinde de document: tf*(k1+1) / (tf + k1*(1-b+b*len/avgdl)), cu avgdl fix.
+IDF-ul îl aplică Qdrant la căutare (modifier "idf" pe vectorul sparse), deci
+statisticile corpusului nu trebuie ținute în aplicație.
+
+/search folosește /points/query: un prefetch dense și unul sparse, combinate
+cu fuziunea RRF din Qdrant, cu k trimis explicit ({"rrf": {"k": ...}}; fără el
+Qdrant folosește k=2, nu 60). Pentru ponderi diferite, sau un server Qdrant
+care nu acceptă RRF parametrizat (înainte de 1.16), cele două liste sunt
+cerute separat și combinate local cu rrfFuse (bm25.go).
+
+Colecțiile vechi (un singur vector nenumit) continuă să funcționeze cu căutarea
+din bm25.go; migrarea se face cu "pdf-response migrate-collection" (migrate.go).
+*/
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	denseVectorName    = "dense"
+	sparseVectorName   = "bm25"
+	sparseAvgDocLength = 256.0 // tokens; chunks are roughly one page
+)
+
+// SparseVector is Qdrant's sparse vector format
+type SparseVector struct {
+	Indices []uint32  `json:"indices"`
+	Values  []float32 `json:"values"`
+}
+
+type SparseVectorConfig struct {
+	Modifier string `json:"modifier,omitempty"`
+}
+
+func sparseTokenIndex(token string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(token))
+	return h.Sum32()
+}
+
+// newSparseVector builds a vector with sorted indices; hash collisions are summed
+func newSparseVector(weights map[uint32]float64) SparseVector {
+	vector := SparseVector{
+		Indices: make([]uint32, 0, len(weights)),
+		Values:  make([]float32, 0, len(weights)),
+	}
+	for index := range weights {
+		vector.Indices = append(vector.Indices, index)
+	}
+	sort.Slice(vector.Indices, func(i, j int) bool { return vector.Indices[i] < vector.Indices[j] })
+	for _, index := range vector.Indices {
+		vector.Values = append(vector.Values, float32(weights[index]))
+	}
+	return vector
+}
+
+// bm25SparseVector encodes a chunk for the "bm25" sparse vector
+func bm25SparseVector(text string) SparseVector {
+	tokens := tokenizeForBM25(text)
+	freqs := make(map[string]int)
+	for _, token := range tokens {
+		freqs[token]++
+	}
+
+	norm := bm25K1 * (1 - bm25B + bm25B*float64(len(tokens))/sparseAvgDocLength)
+	weights := make(map[uint32]float64, len(freqs))
+	for token, tf := range freqs {
+		weights[sparseTokenIndex(token)] += float64(tf) * (bm25K1 + 1) / (float64(tf) + norm)
+	}
+	return newSparseVector(weights)
+}
+
+// querySparseVector gives every distinct query term weight 1 (Qdrant adds the IDF)
+func querySparseVector(query string) SparseVector {
+	weights := make(map[uint32]float64)
+	for _, term := range queryTerms(query) {
+		weights[sparseTokenIndex(term)] = 1
+	}
+	return newSparseVector(weights)
+}
+
+// hybridPointVector is the vector field of a point in a hybrid collection
+func hybridPointVector(dense []float32, text string) map[string]interface{} {
+	return map[string]interface{}{
+		denseVectorName:  dense,
+		sparseVectorName: bm25SparseVector(text),
+	}
+}
+
+// QueryPrefetch is one retriever of a /points/query request
+type QueryPrefetch struct {
+	Query  interface{} `json:"query"`
+	Using  string      `json:"using,omitempty"`
+	Filter interface{} `json:"filter,omitempty"`
+	Limit  int         `json:"limit"`
+}
+
+type QueryRequest struct {
+	Prefetch    []QueryPrefetch `json:"prefetch,omitempty"`
+	Query       interface{}     `json:"query"`
+	Using       string          `json:"using,omitempty"`
+	Filter      interface{}     `json:"filter,omitempty"`
+	Limit       int             `json:"limit"`
+	WithPayload interface{}     `json:"with_payload"`
+}
+
+// serverRRFUnsupported is set once Qdrant rejects a parameterized RRF query
+var serverRRFUnsupported atomic.Bool
+
+// isRRFQueryRejected reports whether Qdrant refused the shape of the
+// {"rrf": {"k": ...}} query (a 400 from a server before 1.16), not a failure
+// that may pass on the next request
+func isRRFQueryRejected(err error) bool {
+	var statusErr *qdrantStatusError
+	if !errors.As(err, &statusErr) || statusErr.Status != http.StatusBadRequest {
+		return false
+	}
+	body := strings.ToLower(statusErr.Body)
+	return strings.Contains(body, "rrf") || strings.Contains(body, "variant")
+}
+
+func queryPoints(req QueryRequest) ([]SearchResult, error) {
+	var results []SearchResult
+	if err := qdrant.Store.Query(req, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// searchPagesFused searches a hybrid collection: dense and sparse prefetch fused by
+// Qdrant with the requested k when both weights are equal (scaling both does not
+// change the ranking), otherwise fused locally with rrfFuse
+func searchPagesFused(scope map[string]interface{}, query string, limit int, weights SearchWeights) ([]SearchResult, error) {
+	fmt.Printf("🔍 Starting fused search for: '%s' (keyword %.2f, vector %.2f, k=%d)\n", query, weights.Keyword, weights.Vector, weights.RRFK)
+
+	fanout := limit * 4
+	if fanout < minSearchFanout {
+		fanout = minSearchFanout
+	}
+
+	filter := scope
+	denseFilter := withMust(scope, embedderFilter(qdrant.Embedder.Name()))
+
+	var prefetch []QueryPrefetch
+	if weights.Vector > 0 {
+		queryEmbeddings, err := qdrant.Embedder.Embed([]string{query})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get query embedding: %v", err)
+		}
+		if len(queryEmbeddings) == 0 {
+			return nil, fmt.Errorf("no embedding generated for query")
+		}
+		prefetch = append(prefetch, QueryPrefetch{
+			Query: queryEmbeddings[0], Using: denseVectorName, Filter: denseFilter, Limit: fanout,
+		})
+	}
+	if sparse := querySparseVector(query); weights.Keyword > 0 && len(sparse.Indices) > 0 {
+		prefetch = append(prefetch, QueryPrefetch{
+			Query: sparse, Using: sparseVectorName, Filter: filter, Limit: fanout,
+		})
+	}
+
+	switch {
+	case len(prefetch) == 0:
+		return nil, nil
+
+	case len(prefetch) == 1:
+		// A single retriever: query it directly
+		p := prefetch[0]
+		return queryPoints(QueryRequest{Query: p.Query, Using: p.Using, Filter: p.Filter, Limit: limit, WithPayload: searchPayload})
+
+	case weights.Keyword == weights.Vector && !serverRRFUnsupported.Load():
+		results, err := queryPoints(QueryRequest{
+			Prefetch:    prefetch,
+			Query:       map[string]interface{}{"rrf": map[string]int{"k": weights.RRFK}},
+			Limit:       limit,
+			WithPayload: searchPayload,
+		})
+		if err == nil {
+			fmt.Printf("🔗 Qdrant RRF fusion (k=%d) returned %d results\n", weights.RRFK, len(results))
+			return results, nil
+		}
+		if isRRFQueryRejected(err) {
+			// Older servers only know {"fusion": "rrf"} with a fixed k: fuse locally from now on
+			serverRRFUnsupported.Store(true)
+			fmt.Printf("⚠️ Qdrant does not accept RRF with k=%d (%v), fusing locally from now on\n", weights.RRFK, err)
+		} else {
+			fmt.Printf("⚠️ Qdrant RRF with k=%d failed (%v), fusing this search locally\n", weights.RRFK, err)
+		}
+		fallthrough
+
+	default:
+		dense, err := queryPoints(QueryRequest{Query: prefetch[0].Query, Using: denseVectorName, Filter: denseFilter, Limit: fanout, WithPayload: searchPayload})
+		if err != nil {
+			return nil, err
+		}
+		sparse, err := queryPoints(QueryRequest{Query: prefetch[1].Query, Using: sparseVectorName, Filter: filter, Limit: fanout, WithPayload: searchPayload})
+		if err != nil {
+			return nil, err
+		}
+		combined := rrfFuse(sparse, dense, weights, limit)
+		fmt.Printf("🔗 Weighted RRF fusion returned %d results\n", len(combined))
+		return combined, nil
+	}
+}
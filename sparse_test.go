@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// queryRecorder keeps the fusion queries sent to the store
+type queryRecorder struct {
+	*EmbeddedStore
+	fusions []string
+}
+
+func (r *queryRecorder) Query(req QueryRequest, out interface{}) error {
+	if len(req.Prefetch) > 0 {
+		data, _ := json.Marshal(req.Query)
+		r.fusions = append(r.fusions, string(data))
+	}
+	return r.EmbeddedStore.Query(req, out)
+}
+
+func TestSearchPagesFusedSendsRRFK(t *testing.T) {
+	store := useTestVectorStore(t)
+	recorder := &queryRecorder{EmbeddedStore: store}
+	qdrant.Store = recorder
+	serverRRFUnsupported.Store(false)
+	t.Cleanup(func() { serverRRFUnsupported.Store(false) })
+
+	storeTestChunks(t, "ana", "ocean.pdf", []int{1, 2, 3, 4}, []string{
+		"the ocean covers most of the planet",
+		"ocean waves carry energy",
+		"mountains rise above the clouds",
+		"tides follow the moon and the ocean",
+	})
+	scope := userDocFilter("ana", "")
+
+	tests := []struct {
+		name      string
+		weights   SearchWeights
+		wantQuery string
+	}{
+		{"default k", SearchWeights{Keyword: 1, Vector: 1, RRFK: 60}, `{"rrf":{"k":60}}`},
+		{"small k", SearchWeights{Keyword: 1, Vector: 1, RRFK: 2}, `{"rrf":{"k":2}}`},
+		{"scaled weights keep the server fusion", SearchWeights{Keyword: 3, Vector: 3, RRFK: 10}, `{"rrf":{"k":10}}`},
+		{"different weights fuse locally", SearchWeights{Keyword: 2, Vector: 1, RRFK: 60}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.fusions = nil
+			wasUnsupported := serverRRFUnsupported.Load()
+			results, err := searchPagesFused(scope, "ocean waves", 3, tt.weights)
+			if err != nil {
+				t.Fatalf("searchPagesFused failed: %v", err)
+			}
+
+			switch {
+			case tt.wantQuery == "" || wasUnsupported:
+				if len(recorder.fusions) != 0 {
+					t.Errorf("fusion queries = %v, want none", recorder.fusions)
+				}
+			case len(recorder.fusions) != 1 || recorder.fusions[0] != tt.wantQuery:
+				t.Errorf("fusion queries = %v, want [%s]", recorder.fusions, tt.wantQuery)
+			}
+
+			// Whoever fuses, the ranking is the one rrfFuse gives with the same k
+			want := localFusion(t, scope, "ocean waves", 3, tt.weights)
+			if !reflect.DeepEqual(resultIDs(results), resultIDs(want)) {
+				t.Errorf("results = %v, want %v", resultIDs(results), resultIDs(want))
+			}
+		})
+	}
+}
+
+// localFusion ranks query with separate dense and sparse queries fused by rrfFuse
+func localFusion(t *testing.T, scope map[string]interface{}, query string, limit int, weights SearchWeights) []SearchResult {
+	t.Helper()
+	embeddings, err := qdrant.Embedder.Embed([]string{query})
+	if err != nil {
+		t.Fatalf("embed failed: %v", err)
+	}
+	dense, err := queryPoints(QueryRequest{Query: embeddings[0], Using: denseVectorName, Filter: withMust(scope, embedderFilter(qdrant.Embedder.Name())), Limit: minSearchFanout, WithPayload: searchPayload})
+	if err != nil {
+		t.Fatalf("dense query failed: %v", err)
+	}
+	sparse, err := queryPoints(QueryRequest{Query: querySparseVector(query), Using: sparseVectorName, Filter: scope, Limit: minSearchFanout, WithPayload: searchPayload})
+	if err != nil {
+		t.Fatalf("sparse query failed: %v", err)
+	}
+	return rrfFuse(sparse, dense, weights, limit)
+}
+
+func resultIDs(results []SearchResult) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	return ids
+}
+
+// failingFusion fails every fusion query with err
+type failingFusion struct {
+	*EmbeddedStore
+	err error
+}
+
+func (f failingFusion) Query(req QueryRequest, out interface{}) error {
+	if len(req.Prefetch) > 0 {
+		return f.err
+	}
+	return f.EmbeddedStore.Query(req, out)
+}
+
+func TestSearchPagesFusedFallsBackLocally(t *testing.T) {
+	store := useTestVectorStore(t)
+	storeTestChunks(t, "ana", "ocean.pdf", []int{1, 2, 3}, []string{
+		"the ocean covers most of the planet",
+		"ocean waves carry energy",
+		"mountains rise above the clouds",
+	})
+	scope := userDocFilter("ana", "")
+	weights := defaultSearchWeights()
+	want := resultIDs(localFusion(t, scope, "ocean waves", 3, weights))
+
+	tests := []struct {
+		name            string
+		err             error
+		wantUnsupported bool
+	}{
+		{"rrf query rejected", &qdrantStatusError{Operation: "query", Status: http.StatusBadRequest,
+			Body: `{"status":{"error":"Format error in JSON body: data did not match any variant of untagged enum QueryInterface"}}`}, true},
+		{"rrf named in a 400", &qdrantStatusError{Operation: "query", Status: http.StatusBadRequest,
+			Body: `{"status":{"error":"unknown field rrf"}}`}, true},
+		{"other bad request", &qdrantStatusError{Operation: "query", Status: http.StatusBadRequest,
+			Body: `{"status":{"error":"Bad request: Index required but not found for \"username\""}}`}, false},
+		{"server error", &qdrantStatusError{Operation: "query", Status: http.StatusServiceUnavailable, Body: "overloaded"}, false},
+		{"unreachable", errors.New("failed to execute query: connection refused"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverRRFUnsupported.Store(false)
+			t.Cleanup(func() { serverRRFUnsupported.Store(false) })
+			qdrant.Store = failingFusion{EmbeddedStore: store, err: tt.err}
+
+			results, err := searchPagesFused(scope, "ocean waves", 3, weights)
+			if err != nil {
+				t.Fatalf("searchPagesFused failed: %v", err)
+			}
+			if !reflect.DeepEqual(resultIDs(results), want) {
+				t.Errorf("results = %v, want %v", resultIDs(results), want)
+			}
+			if got := serverRRFUnsupported.Load(); got != tt.wantUnsupported {
+				t.Errorf("serverRRFUnsupported = %v, want %v", got, tt.wantUnsupported)
+			}
+		})
+	}
+}
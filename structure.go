@@ -0,0 +1,280 @@
+package main
+
+/*
+STRUCTURĂ DOCUMENT (format=markdown / format=tree)
+
+Extractoarele pot returna, pe lângă textul pe pagini, o listă de blocuri
+(titluri, paragrafe, elemente de listă, tabele) construită din ce parsează deja:
+  - PDF:  ieșirea HTML a MuPDF (mărimea fontului, bold, italic, poziția pe pagină)
+  - DOCX: word/document.xml + word/styles.xml (stiluri Heading, numerotare, tabele)
+  - ODT:  content.xml (text:h, text:list, table:table, stiluri automate)
+  - DOC:  doar paragrafe (extragerea este euristică)
+
+Din blocuri se generează:
+  - Markdown (titluri, liste, tabele, emphasis)
+  - un arbore JSON de secțiuni cu pagini și offset-uri de caractere
+*/
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	BlockHeading   = "heading"
+	BlockParagraph = "paragraph"
+	BlockListItem  = "list_item"
+	BlockTable     = "table"
+)
+
+// DocBlock is one structural element of a document, in reading order
+type DocBlock struct {
+	Kind     string     `json:"kind"`
+	Level    int        `json:"level,omitempty"` // heading level (1..6) or list nesting depth (0..)
+	Text     string     `json:"text"`            // plain text
+	Markdown string     `json:"markdown,omitempty"`
+	Ordered  bool       `json:"ordered,omitempty"` // numbered list item
+	Rows     [][]string `json:"rows,omitempty"`    // table cells
+	Page     int        `json:"page"`              // 1-based source page
+}
+
+// DocumentNode is a node of the section tree returned by format=tree.
+// CharStart/CharEnd are character (rune) offsets into the plain text returned alongside the tree.
+type DocumentNode struct {
+	Type      string          `json:"type"` // document, section, paragraph, list_item, table
+	Title     string          `json:"title,omitempty"`
+	Level     int             `json:"level,omitempty"`
+	Text      string          `json:"text,omitempty"`
+	Rows      [][]string      `json:"rows,omitempty"`
+	PageStart int             `json:"page_start"`
+	PageEnd   int             `json:"page_end"`
+	CharStart int             `json:"char_start"`
+	CharEnd   int             `json:"char_end"`
+	Children  []*DocumentNode `json:"children,omitempty"`
+}
+
+// blocksFromPages is the fallback for extractors without structural information
+func blocksFromPages(pages []string) []DocBlock {
+	var blocks []DocBlock
+	for i, page := range pages {
+		for _, paragraph := range strings.Split(page, "\n\n") {
+			paragraph = strings.TrimSpace(paragraph)
+			if paragraph == "" {
+				continue
+			}
+			blocks = append(blocks, DocBlock{Kind: BlockParagraph, Text: paragraph, Page: i + 1})
+		}
+	}
+	return blocks
+}
+
+// blockPlainText is the text of a block as it appears in the tree's plain text
+func blockPlainText(b DocBlock) string {
+	if b.Kind == BlockTable {
+		var rows []string
+		for _, row := range b.Rows {
+			rows = append(rows, strings.Join(row, "\t"))
+		}
+		return strings.Join(rows, "\n")
+	}
+	return b.Text
+}
+
+// renderMarkdown converts blocks to Markdown
+func renderMarkdown(blocks []DocBlock) string {
+	var out strings.Builder
+	orderedCounters := map[int]int{}
+
+	for i, b := range blocks {
+		if i > 0 {
+			// Consecutive list items stay in the same list
+			if b.Kind == BlockListItem && blocks[i-1].Kind == BlockListItem {
+				out.WriteString("\n")
+			} else {
+				out.WriteString("\n\n")
+			}
+		}
+		if b.Kind != BlockListItem {
+			orderedCounters = map[int]int{}
+		}
+
+		inline := b.Markdown
+		if inline == "" {
+			inline = escapeMarkdown(b.Text)
+		}
+
+		switch b.Kind {
+		case BlockHeading:
+			level := b.Level
+			if level < 1 {
+				level = 1
+			}
+			if level > 6 {
+				level = 6
+			}
+			out.WriteString(strings.Repeat("#", level) + " " + inline)
+		case BlockListItem:
+			out.WriteString(strings.Repeat("  ", b.Level))
+			if b.Ordered {
+				orderedCounters[b.Level]++
+				out.WriteString(fmt.Sprintf("%d. ", orderedCounters[b.Level]))
+			} else {
+				out.WriteString("- ")
+			}
+			out.WriteString(inline)
+		case BlockTable:
+			out.WriteString(renderMarkdownTable(b.Rows))
+		default:
+			out.WriteString(inline)
+		}
+	}
+
+	return strings.TrimSpace(out.String())
+}
+
+func renderMarkdownTable(rows [][]string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	writeRow := func(out *strings.Builder, row []string) {
+		out.WriteString("|")
+		for c := 0; c < columns; c++ {
+			cell := ""
+			if c < len(row) {
+				cell = strings.ReplaceAll(escapeMarkdown(row[c]), "\n", " ")
+			}
+			out.WriteString(" " + cell + " |")
+		}
+	}
+
+	var out strings.Builder
+	// The first row is used as header
+	writeRow(&out, rows[0])
+	out.WriteString("\n|")
+	for c := 0; c < columns; c++ {
+		out.WriteString(" --- |")
+	}
+	for _, row := range rows[1:] {
+		out.WriteString("\n")
+		writeRow(&out, row)
+	}
+	return out.String()
+}
+
+// escapeMarkdown escapes characters that would change the meaning of plain text
+func escapeMarkdown(text string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		"*", `\*`,
+		"_", `\_`,
+		"`", "\\`",
+		"|", `\|`,
+	)
+	return replacer.Replace(text)
+}
+
+// emphasize wraps text in Markdown bold/italic markers, keeping surrounding spaces outside
+func emphasize(text string, bold, italic bool) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" || (!bold && !italic) {
+		return escapeMarkdown(text)
+	}
+
+	lead := text[:strings.Index(text, trimmed)]
+	trail := text[len(lead)+len(trimmed):]
+
+	marked := escapeMarkdown(trimmed)
+	if italic {
+		marked = "_" + marked + "_"
+	}
+	if bold {
+		marked = "**" + marked + "**"
+	}
+	return lead + marked + trail
+}
+
+// buildDocumentTree nests blocks into sections by heading level.
+// It returns the root node and the plain text the character offsets refer to.
+func buildDocumentTree(blocks []DocBlock) (*DocumentNode, string) {
+	var text strings.Builder
+	offset := 0 // in runes
+
+	root := &DocumentNode{Type: "document"}
+	stack := []*DocumentNode{root}
+
+	for i, b := range blocks {
+		blockText := blockPlainText(b)
+		if i > 0 {
+			text.WriteString("\n\n")
+			offset += 2
+		}
+		start := offset
+		text.WriteString(blockText)
+		offset += utf8.RuneCountInString(blockText)
+
+		if b.Kind == BlockHeading {
+			// Close sections at the same or deeper level
+			for len(stack) > 1 && stack[len(stack)-1].Level >= b.Level {
+				stack = stack[:len(stack)-1]
+			}
+			section := &DocumentNode{
+				Type:      "section",
+				Title:     b.Text,
+				Level:     b.Level,
+				PageStart: b.Page,
+				PageEnd:   b.Page,
+				CharStart: start,
+				CharEnd:   offset,
+			}
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, section)
+			stack = append(stack, section)
+			continue
+		}
+
+		node := &DocumentNode{
+			Type:      b.Kind,
+			Level:     b.Level,
+			Text:      b.Text,
+			Rows:      b.Rows,
+			PageStart: b.Page,
+			PageEnd:   b.Page,
+			CharStart: start,
+			CharEnd:   offset,
+		}
+		if b.Kind != BlockListItem {
+			node.Level = 0
+		}
+		parent := stack[len(stack)-1]
+		parent.Children = append(parent.Children, node)
+	}
+
+	closeDocumentSpans(root)
+	return root, text.String()
+}
+
+// closeDocumentSpans extends every section's page and character span to cover its children
+func closeDocumentSpans(node *DocumentNode) {
+	for _, child := range node.Children {
+		closeDocumentSpans(child)
+
+		if child.PageStart > 0 && (node.PageStart == 0 || child.PageStart < node.PageStart) {
+			node.PageStart = child.PageStart
+		}
+		if child.PageEnd > node.PageEnd {
+			node.PageEnd = child.PageEnd
+		}
+		if child.CharEnd > node.CharEnd {
+			node.CharEnd = child.CharEnd
+		}
+	}
+}
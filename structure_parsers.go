@@ -0,0 +1,887 @@
+package main
+
+import (
+	"encoding/xml"
+	"html"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ---------- PDF (MuPDF structured text printed as HTML) ----------
+
+// pdfTextLine is one line of MuPDF structured text: <p style="top;left;line-height"><span>...</span></p>
+type pdfTextLine struct {
+	Text       string
+	Markdown   string
+	Top        float64
+	Left       float64
+	LineHeight float64
+	FontSize   float64
+	Bold       bool
+	Italic     bool
+}
+
+// pdfPageLines holds the lines of one page and its size in points
+type pdfPageLines struct {
+	Page   int // 1-based
+	Width  float64
+	Height float64
+	Lines  []pdfTextLine
+	Glyphs []pdfGlyph // only for layout output
+}
+
+// pdfGlyph is one non-space character drawn on the page: its baseline, font size
+// and horizontal extent (origin and ink) in points, origin top-left
+type pdfGlyph struct {
+	Rune rune
+	X0   float64
+	X1   float64
+	Y    float64
+	Size float64
+}
+
+type styledSegment struct {
+	text   string
+	bold   bool
+	italic bool
+}
+
+// parseCSSPoints parses "top:33.5pt;left:31.2pt" into a map of point values
+func parseCSSPoints(style string) map[string]float64 {
+	values := make(map[string]float64)
+	for _, decl := range strings.Split(style, ";") {
+		parts := strings.SplitN(decl, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		v := strings.TrimSuffix(strings.TrimSpace(parts[1]), "pt")
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			values[strings.TrimSpace(parts[0])] = f
+		}
+	}
+	return values
+}
+
+func xmlAttr(attrs []xml.Attr, local string) string {
+	for _, a := range attrs {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// parseMuPDFHTML reads the HTML produced by fitz.Document.HTML into lines with style information
+func parseMuPDFHTML(html string, pageNum int) pdfPageLines {
+	page := pdfPageLines{Page: pageNum}
+
+	dec := xml.NewDecoder(strings.NewReader(html))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	var current *pdfTextLine
+	var segments []styledSegment
+	boldDepth, italicDepth := 0, 0
+
+	finishLine := func() {
+		if current == nil {
+			return
+		}
+		var plain, md strings.Builder
+		allBold, allItalic := true, true
+		hasText := false
+		for _, seg := range mergeSegments(segments) {
+			plain.WriteString(seg.text)
+			md.WriteString(emphasize(seg.text, seg.bold, seg.italic))
+			if strings.TrimSpace(seg.text) != "" {
+				hasText = true
+				allBold = allBold && seg.bold
+				allItalic = allItalic && seg.italic
+			}
+		}
+		if hasText {
+			current.Text = cleanUnicodeText(plain.String())
+			current.Markdown = strings.TrimSpace(md.String())
+			current.Bold = allBold
+			current.Italic = allItalic
+			page.Lines = append(page.Lines, *current)
+		}
+		current = nil
+		segments = nil
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "div":
+				css := parseCSSPoints(xmlAttr(t.Attr, "style"))
+				if w, ok := css["width"]; ok {
+					page.Width = w
+				}
+				if h, ok := css["height"]; ok {
+					page.Height = h
+				}
+			case "p":
+				finishLine()
+				css := parseCSSPoints(xmlAttr(t.Attr, "style"))
+				current = &pdfTextLine{Top: css["top"], Left: css["left"], LineHeight: css["line-height"]}
+			case "b":
+				boldDepth++
+			case "i":
+				italicDepth++
+			case "span":
+				size := parseCSSPoints(xmlAttr(t.Attr, "style"))["font-size"]
+				if current != nil && size > current.FontSize {
+					current.FontSize = size
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p":
+				finishLine()
+			case "b":
+				if boldDepth > 0 {
+					boldDepth--
+				}
+			case "i":
+				if italicDepth > 0 {
+					italicDepth--
+				}
+			}
+		case xml.CharData:
+			if current != nil {
+				segments = append(segments, styledSegment{text: string(t), bold: boldDepth > 0, italic: italicDepth > 0})
+			}
+		}
+	}
+	finishLine()
+
+	return page
+}
+
+// mergeSegments joins neighbouring segments with the same style
+func mergeSegments(segments []styledSegment) []styledSegment {
+	var merged []styledSegment
+	for _, seg := range segments {
+		if n := len(merged); n > 0 && merged[n-1].bold == seg.bold && merged[n-1].italic == seg.italic {
+			merged[n-1].text += seg.text
+			continue
+		}
+		merged = append(merged, seg)
+	}
+	return merged
+}
+
+// svgTagAttr returns the value of attr inside tag (a single element, up to ">")
+func svgTagAttr(tag, attr string) (string, bool) {
+	i := strings.Index(tag, " "+attr+`="`)
+	if i < 0 {
+		return "", false
+	}
+	value := tag[i+len(attr)+3:]
+	end := strings.IndexByte(value, '"')
+	if end < 0 {
+		return "", false
+	}
+	return value[:end], true
+}
+
+// svgTags calls fn for every element of svg starting with prefix (e.g. "<use ").
+// The SVG of a page can be tens of MB, so it is scanned without regular expressions.
+func svgTags(svg, prefix string, fn func(tag string)) {
+	for {
+		i := strings.Index(svg, prefix)
+		if i < 0 {
+			return
+		}
+		svg = svg[i:]
+		end := strings.IndexByte(svg, '>')
+		if end < 0 {
+			return
+		}
+		fn(svg[:end])
+		svg = svg[end:]
+	}
+}
+
+// parseMuPDFSVGGlyphs reads the glyph positions from fitz.Document.SVG (text drawn as
+// paths): every <use> carries the character (data-text) and the glyph origin in its
+// transform, the referenced <path> gives the ink extent in font units. Rotated or
+// mirrored glyphs are skipped; ligatures share their extent between their characters.
+func parseMuPDFSVGGlyphs(svg string) []pdfGlyph {
+	inkByID := make(map[string][2]float64)
+	svgTags(svg, `<path id="font_`, func(tag string) {
+		id, _ := svgTagAttr(tag, "id")
+		d, ok := svgTagAttr(tag, "d")
+		if !ok {
+			return
+		}
+		if minX, maxX, ok := svgPathXExtent(d); ok {
+			inkByID[id] = [2]float64{minX, maxX}
+		}
+	})
+
+	var glyphs []pdfGlyph
+	svgTags(svg, "<use ", func(tag string) {
+		text, ok := svgTagAttr(tag, "data-text")
+		href, _ := svgTagAttr(tag, "xlink:href")
+		transform, _ := svgTagAttr(tag, "transform")
+		if !ok || !strings.HasPrefix(transform, "matrix(") || !strings.HasSuffix(transform, ")") {
+			return
+		}
+
+		var runes []rune
+		for _, r := range html.UnescapeString(text) {
+			if !unicode.IsSpace(r) && r != '\u200B' && r != '\u200C' && r != '\u200D' && r != '\uFEFF' {
+				runes = append(runes, r)
+			}
+		}
+		if len(runes) == 0 {
+			return
+		}
+
+		matrix := strings.Split(transform[len("matrix("):len(transform)-1], ",")
+		if len(matrix) != 6 {
+			return
+		}
+		var v [6]float64
+		valid := true
+		for i, s := range matrix {
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				valid = false
+				break
+			}
+			v[i] = f
+		}
+		// matrix(size, 0, 0, -size, x, y) for upright text
+		if !valid || v[0] <= 0 || v[1] != 0 || v[2] != 0 {
+			return
+		}
+		size, x, y := v[0], v[4], v[5]
+
+		x0, x1 := x, x
+		if ink, ok := inkByID[strings.TrimPrefix(href, "#")]; ok {
+			x0 = math.Min(x, x+ink[0]*size)
+			x1 = math.Max(x, x+ink[1]*size)
+		}
+		step := (x1 - x0) / float64(len(runes))
+		for i, r := range runes {
+			glyphs = append(glyphs, pdfGlyph{Rune: r, X0: x0 + step*float64(i), X1: x0 + step*float64(i+1), Y: y, Size: size})
+		}
+	})
+	return glyphs
+}
+
+// svgPathXExtent returns the smallest and largest x coordinate of an SVG path written
+// with absolute commands (as MuPDF does). Relative commands are not supported.
+func svgPathXExtent(d string) (float64, float64, bool) {
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	cmd := byte(0)
+	index := 0 // position of the number after the last command
+	for i := 0; i < len(d); {
+		c := d[i]
+		switch {
+		case c == ' ' || c == ',' || c == '\n' || c == '\t':
+			i++
+			continue
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			if c >= 'a' && c <= 'z' {
+				return 0, 0, false
+			}
+			cmd, index = c, 0
+			i++
+			continue
+		}
+
+		// A number ends at the next sign, second dot, letter or separator
+		j := i
+		if d[j] == '-' || d[j] == '+' {
+			j++
+		}
+		dot := false
+		for j < len(d) {
+			if d[j] == '.' {
+				if dot {
+					break
+				}
+				dot = true
+			} else if d[j] < '0' || d[j] > '9' {
+				if (d[j] == 'e' || d[j] == 'E') && j+1 < len(d) && (d[j+1] == '-' || (d[j+1] >= '0' && d[j+1] <= '9')) {
+					j += 2
+					continue
+				}
+				break
+			}
+			j++
+		}
+		v, err := strconv.ParseFloat(d[i:j], 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		i = j
+
+		isX := false
+		switch cmd {
+		case 'H':
+			isX = true
+		case 'M', 'L', 'C', 'S', 'Q', 'T':
+			isX = index%2 == 0
+		}
+		index++
+		if isX {
+			minX = math.Min(minX, v)
+			maxX = math.Max(maxX, v)
+		}
+	}
+	if math.IsInf(minX, 0) {
+		return 0, 0, false
+	}
+	return minX, maxX, true
+}
+
+var (
+	bulletPattern  = regexp.MustCompile(`^([•·▪◦‣●○■□\-\*–—])\s+`)
+	orderedPattern = regexp.MustCompile(`^(\d{1,3}|[a-zA-Z])[.)]\s+`)
+)
+
+// pdfBlocksFromLines groups MuPDF lines into headings, list items and paragraphs.
+// Headings are lines noticeably larger than the body font, or short all-bold lines.
+func pdfBlocksFromLines(pages []pdfPageLines) []DocBlock {
+	// Body font size = the size with the most characters
+	charsBySize := make(map[float64]int)
+	for _, p := range pages {
+		for _, l := range p.Lines {
+			charsBySize[math.Round(l.FontSize*2)/2] += utf8.RuneCountInString(l.Text)
+		}
+	}
+	bodySize, maxChars := 0.0, 0
+	for size, chars := range charsBySize {
+		if chars > maxChars || (chars == maxChars && size < bodySize) {
+			bodySize, maxChars = size, chars
+		}
+	}
+
+	isLargeHeading := func(l pdfTextLine) bool {
+		return bodySize > 0 && l.FontSize >= bodySize*1.15 && utf8.RuneCountInString(l.Text) <= 200
+	}
+	isBoldHeading := func(l pdfTextLine) bool {
+		text := strings.TrimSpace(l.Text)
+		return l.Bold && utf8.RuneCountInString(text) <= 80 && !strings.HasSuffix(text, ".") &&
+			!bulletPattern.MatchString(text)
+	}
+
+	// Heading levels: distinct large sizes, biggest first; bold body-size headings come last
+	var headingSizes []float64
+	seen := make(map[float64]bool)
+	for _, p := range pages {
+		for _, l := range p.Lines {
+			size := math.Round(l.FontSize*2) / 2
+			if isLargeHeading(l) && !seen[size] {
+				seen[size] = true
+				headingSizes = append(headingSizes, size)
+			}
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(headingSizes)))
+	headingLevel := func(l pdfTextLine) int {
+		size := math.Round(l.FontSize*2) / 2
+		for i, s := range headingSizes {
+			if s == size {
+				return minInt(i+1, 6)
+			}
+		}
+		return minInt(len(headingSizes)+1, 6)
+	}
+
+	var blocks []DocBlock
+	for _, p := range pages {
+		var current *DocBlock
+		var prev pdfTextLine
+		var listLeft float64
+
+		flush := func() {
+			if current != nil {
+				current.Text = strings.TrimSpace(current.Text)
+				current.Markdown = strings.TrimSpace(current.Markdown)
+				if current.Text != "" {
+					blocks = append(blocks, *current)
+				}
+			}
+			current = nil
+		}
+
+		for _, l := range p.Lines {
+			gap := l.Top - prev.Top
+			closeToPrevious := current != nil && gap >= 0 && gap <= math.Max(prev.LineHeight, l.LineHeight)*1.6
+
+			switch {
+			case isLargeHeading(l) || isBoldHeading(l):
+				level := headingLevel(l)
+				// Multi-line headings continue with the same level
+				if current != nil && current.Kind == BlockHeading && current.Level == level && closeToPrevious {
+					appendLine(current, l)
+				} else {
+					flush()
+					current = &DocBlock{Kind: BlockHeading, Level: level, Text: l.Text, Markdown: stripEmphasis(l), Page: p.Page}
+				}
+
+			case bulletPattern.MatchString(l.Text) || orderedPattern.MatchString(l.Text):
+				flush()
+				ordered := !bulletPattern.MatchString(l.Text)
+				marker := bulletPattern
+				if ordered {
+					marker = orderedPattern
+				}
+				text := marker.ReplaceAllString(l.Text, "")
+				md := marker.ReplaceAllString(l.Markdown, "")
+				if md == l.Markdown {
+					// The marker sits inside emphasis (e.g. a fully italic line)
+					md = emphasize(text, l.Bold, l.Italic)
+				}
+				current = &DocBlock{Kind: BlockListItem, Ordered: ordered, Text: text, Markdown: md, Page: p.Page}
+				listLeft = l.Left
+
+			case current != nil && current.Kind == BlockListItem && closeToPrevious && l.Left > listLeft:
+				// Continuation of a wrapped list item (indented under the bullet)
+				appendLine(current, l)
+
+			case current != nil && current.Kind == BlockParagraph && closeToPrevious:
+				appendLine(current, l)
+
+			default:
+				flush()
+				current = &DocBlock{Kind: BlockParagraph, Text: l.Text, Markdown: l.Markdown, Page: p.Page}
+			}
+			prev = l
+		}
+		flush()
+	}
+
+	return blocks
+}
+
+// stripEmphasis returns the heading text without the bold markers that made it a heading
+func stripEmphasis(l pdfTextLine) string {
+	if l.Bold {
+		return escapeMarkdown(l.Text)
+	}
+	return l.Markdown
+}
+
+// appendLine joins a wrapped line to a block, undoing end-of-line hyphenation
+func appendLine(b *DocBlock, l pdfTextLine) {
+	md := l.Markdown
+	if b.Kind == BlockHeading {
+		md = stripEmphasis(l)
+	}
+	if strings.HasSuffix(b.Text, "-") && len(b.Text) > 1 {
+		r, _ := utf8.DecodeLastRuneInString(strings.TrimSuffix(b.Text, "-"))
+		if unicode.IsLetter(r) {
+			b.Text = strings.TrimSuffix(b.Text, "-") + l.Text
+			b.Markdown = strings.TrimSuffix(b.Markdown, "-") + md
+			return
+		}
+	}
+	b.Text += " " + l.Text
+	b.Markdown += " " + md
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// ---------- DOCX (word/document.xml) ----------
+
+// docxHeadingLevels maps paragraph style ids to heading levels using word/styles.xml
+func docxHeadingLevels(stylesXML []byte) map[string]int {
+	levels := make(map[string]int)
+	if len(stylesXML) == 0 {
+		return levels
+	}
+
+	dec := xml.NewDecoder(strings.NewReader(string(stylesXML)))
+	var styleID string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "style":
+				styleID = xmlAttr(t.Attr, "styleId")
+			case "name":
+				name := strings.ToLower(xmlAttr(t.Attr, "val"))
+				if name == "title" {
+					levels[styleID] = 1
+				} else if strings.HasPrefix(name, "heading ") {
+					if n, err := strconv.Atoi(strings.TrimPrefix(name, "heading ")); err == nil {
+						levels[styleID] = n
+					}
+				}
+			case "outlineLvl":
+				if n, err := strconv.Atoi(xmlAttr(t.Attr, "val")); err == nil && n < 9 {
+					if _, ok := levels[styleID]; !ok {
+						levels[styleID] = n + 1
+					}
+				}
+			}
+		}
+	}
+	return levels
+}
+
+var docxHeadingStyleID = regexp.MustCompile(`(?i)^heading(\d)$`)
+
+// docxWordValueOn interprets <w:b/>, <w:b w:val="0"/> and similar toggles
+func docxWordValueOn(attrs []xml.Attr) bool {
+	v := strings.ToLower(xmlAttr(attrs, "val"))
+	return v != "0" && v != "false" && v != "none"
+}
+
+// extractDOCXBlocks parses paragraphs, headings, lists and tables from a DOCX archive
+func extractDOCXBlocks(data []byte) []DocBlock {
+	documentXML := zipFileContent(data, "word/document.xml")
+	if len(documentXML) == 0 {
+		return nil
+	}
+	headingLevels := docxHeadingLevels(zipFileContent(data, "word/styles.xml"))
+
+	dec := xml.NewDecoder(strings.NewReader(string(documentXML)))
+
+	var blocks []DocBlock
+	page := 1
+
+	// Paragraph state
+	var segments []styledSegment
+	var styleID string
+	isList := false
+	listLevel := 0
+	pageBreakInParagraph := false
+
+	// Run state
+	inRunProps := false
+	runBold, runItalic := false, false
+
+	// Table state
+	tableDepth := 0
+	var rows [][]string
+	var row []string
+	var cell strings.Builder
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				segments = nil
+				styleID = ""
+				isList = false
+				listLevel = 0
+				pageBreakInParagraph = false
+			case "pStyle":
+				styleID = xmlAttr(t.Attr, "val")
+			case "numPr":
+				isList = true
+			case "ilvl":
+				listLevel, _ = strconv.Atoi(xmlAttr(t.Attr, "val"))
+			case "r":
+				runBold, runItalic = false, false
+			case "rPr":
+				inRunProps = true
+			case "b":
+				if inRunProps {
+					runBold = docxWordValueOn(t.Attr)
+				}
+			case "i":
+				if inRunProps {
+					runItalic = docxWordValueOn(t.Attr)
+				}
+			case "t":
+				var text string
+				if err := dec.DecodeElement(&text, &t); err == nil {
+					segments = append(segments, styledSegment{text: text, bold: runBold, italic: runItalic})
+				}
+			case "tab":
+				segments = append(segments, styledSegment{text: " "})
+			case "br":
+				if xmlAttr(t.Attr, "type") == "page" {
+					page++
+					pageBreakInParagraph = true
+				} else {
+					segments = append(segments, styledSegment{text: " "})
+				}
+			case "lastRenderedPageBreak":
+				if !pageBreakInParagraph {
+					page++
+				}
+			case "tbl":
+				tableDepth++
+				if tableDepth == 1 {
+					rows = nil
+				}
+			case "tr":
+				if tableDepth == 1 {
+					row = nil
+				}
+			case "tc":
+				if tableDepth == 1 {
+					cell.Reset()
+				}
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "rPr":
+				inRunProps = false
+			case "p":
+				var plain, md strings.Builder
+				for _, seg := range mergeSegments(segments) {
+					plain.WriteString(seg.text)
+					md.WriteString(emphasize(seg.text, seg.bold, seg.italic))
+				}
+				text := strings.TrimSpace(plain.String())
+				if text == "" {
+					continue
+				}
+
+				if tableDepth > 0 {
+					if cell.Len() > 0 {
+						cell.WriteString("\n")
+					}
+					cell.WriteString(text)
+					continue
+				}
+
+				block := DocBlock{Kind: BlockParagraph, Text: text, Markdown: strings.TrimSpace(md.String()), Page: page}
+				level, isHeading := headingLevels[styleID]
+				if !isHeading {
+					if m := docxHeadingStyleID.FindStringSubmatch(styleID); m != nil {
+						level, _ = strconv.Atoi(m[1])
+						isHeading = true
+					}
+				}
+				switch {
+				case isHeading:
+					block.Kind = BlockHeading
+					block.Level = level
+					block.Markdown = escapeMarkdown(text)
+				case isList || strings.Contains(strings.ToLower(styleID), "list"):
+					block.Kind = BlockListItem
+					block.Level = listLevel
+					block.Ordered = orderedPattern.MatchString(text)
+				}
+				blocks = append(blocks, block)
+			case "tc":
+				if tableDepth == 1 {
+					row = append(row, cell.String())
+				}
+			case "tr":
+				if tableDepth == 1 && len(row) > 0 {
+					rows = append(rows, row)
+				}
+			case "tbl":
+				tableDepth--
+				if tableDepth == 0 && len(rows) > 0 {
+					blocks = append(blocks, DocBlock{Kind: BlockTable, Text: "", Rows: rows, Page: page})
+				}
+			}
+		}
+	}
+
+	return blocks
+}
+
+// ---------- ODT (content.xml) ----------
+
+type odtTextStyle struct {
+	bold   bool
+	italic bool
+}
+
+// extractODTBlocks parses headings, paragraphs, lists and tables from an ODT archive
+func extractODTBlocks(data []byte) []DocBlock {
+	contentXML := zipFileContent(data, "content.xml")
+	if len(contentXML) == 0 {
+		return nil
+	}
+
+	dec := xml.NewDecoder(strings.NewReader(string(contentXML)))
+
+	styles := make(map[string]odtTextStyle)
+	var currentStyle string
+
+	var blocks []DocBlock
+	page := 1
+
+	inParagraph := false
+	var segments []styledSegment
+	var spanStack []odtTextStyle
+	headingLevel := 0
+	listDepth := 0
+
+	tableDepth := 0
+	var rows [][]string
+	var row []string
+	var cell strings.Builder
+
+	currentEmphasis := func() odtTextStyle {
+		var s odtTextStyle
+		for _, span := range spanStack {
+			s.bold = s.bold || span.bold
+			s.italic = s.italic || span.italic
+		}
+		return s
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "style":
+				currentStyle = xmlAttr(t.Attr, "name")
+			case "text-properties":
+				if currentStyle != "" {
+					s := styles[currentStyle]
+					if xmlAttr(t.Attr, "font-weight") == "bold" {
+						s.bold = true
+					}
+					if xmlAttr(t.Attr, "font-style") == "italic" {
+						s.italic = true
+					}
+					styles[currentStyle] = s
+				}
+			case "h":
+				inParagraph = true
+				segments = nil
+				headingLevel, _ = strconv.Atoi(xmlAttr(t.Attr, "outline-level"))
+				if headingLevel < 1 {
+					headingLevel = 1
+				}
+			case "p":
+				inParagraph = true
+				segments = nil
+				headingLevel = 0
+			case "span":
+				spanStack = append(spanStack, styles[xmlAttr(t.Attr, "style-name")])
+			case "s":
+				count, _ := strconv.Atoi(xmlAttr(t.Attr, "c"))
+				if count < 1 {
+					count = 1
+				}
+				segments = append(segments, styledSegment{text: strings.Repeat(" ", count)})
+			case "tab", "line-break":
+				segments = append(segments, styledSegment{text: " "})
+			case "soft-page-break":
+				page++
+			case "list":
+				listDepth++
+			case "table":
+				tableDepth++
+				if tableDepth == 1 {
+					rows = nil
+				}
+			case "table-row":
+				if tableDepth == 1 {
+					row = nil
+				}
+			case "table-cell":
+				if tableDepth == 1 {
+					cell.Reset()
+				}
+			}
+
+		case xml.CharData:
+			if inParagraph {
+				emphasis := currentEmphasis()
+				segments = append(segments, styledSegment{text: string(t), bold: emphasis.bold, italic: emphasis.italic})
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "style":
+				currentStyle = ""
+			case "span":
+				if len(spanStack) > 0 {
+					spanStack = spanStack[:len(spanStack)-1]
+				}
+			case "list":
+				listDepth--
+			case "h", "p":
+				inParagraph = false
+				var plain, md strings.Builder
+				for _, seg := range mergeSegments(segments) {
+					plain.WriteString(seg.text)
+					md.WriteString(emphasize(seg.text, seg.bold, seg.italic))
+				}
+				text := strings.TrimSpace(plain.String())
+				if text == "" {
+					continue
+				}
+
+				if tableDepth > 0 {
+					if cell.Len() > 0 {
+						cell.WriteString("\n")
+					}
+					cell.WriteString(text)
+					continue
+				}
+
+				block := DocBlock{Kind: BlockParagraph, Text: text, Markdown: strings.TrimSpace(md.String()), Page: page}
+				switch {
+				case t.Name.Local == "h":
+					block.Kind = BlockHeading
+					block.Level = headingLevel
+					block.Markdown = escapeMarkdown(text)
+				case listDepth > 0:
+					block.Kind = BlockListItem
+					block.Level = listDepth - 1
+					block.Ordered = orderedPattern.MatchString(text)
+				}
+				blocks = append(blocks, block)
+			case "table-cell":
+				if tableDepth == 1 {
+					row = append(row, cell.String())
+				}
+			case "table-row":
+				if tableDepth == 1 && len(row) > 0 {
+					rows = append(rows, row)
+				}
+			case "table":
+				tableDepth--
+				if tableDepth == 0 && len(rows) > 0 {
+					blocks = append(blocks, DocBlock{Kind: BlockTable, Rows: rows, Page: page})
+				}
+			}
+		}
+	}
+
+	return blocks
+}
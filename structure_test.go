@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testDOCX is a small document: two headings, styled text, a list and a table
+func testDOCX(t *testing.T) []byte {
+	t.Helper()
+	const document = `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Introducere</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">Textul are </w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>bold</w:t></w:r><w:r><w:t xml:space="preserve"> și </w:t></w:r><w:r><w:rPr><w:i/></w:rPr><w:t>italic</w:t></w:r><w:r><w:t>.</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>primul element</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="1"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>al doilea_element</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="Subtitlu"/></w:pPr><w:r><w:t>Date</w:t></w:r></w:p>
+<w:tbl>
+<w:tr><w:tc><w:p><w:r><w:t>An</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Valoare</w:t></w:r></w:p></w:tc></w:tr>
+<w:tr><w:tc><w:p><w:r><w:t>2024</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>a|b</w:t></w:r></w:p></w:tc></w:tr>
+</w:tbl>
+<w:p><w:r><w:br w:type="page"/><w:t>Pe pagina a doua.</w:t></w:r></w:p>
+</w:body></w:document>`
+	const styles = `<?xml version="1.0" encoding="UTF-8"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:style w:type="paragraph" w:styleId="Subtitlu"><w:name w:val="heading 2"/></w:style>
+</w:styles>`
+	return testZip(t, [2]string{"word/document.xml", document}, [2]string{"word/styles.xml", styles})
+}
+
+func TestDOCXMarkdown(t *testing.T) {
+	result, err := extractDocument(testDOCX(t), "docx", ExtractOptions{Structure: true})
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+
+	want := "# Introducere\n\n" +
+		"Textul are **bold** și _italic_.\n\n" +
+		"- primul element\n" +
+		"  - al doilea\\_element\n\n" +
+		"## Date\n\n" +
+		"| An | Valoare |\n| --- | --- |\n| 2024 | a\\|b |\n\n" +
+		"Pe pagina a doua."
+	if got := renderMarkdown(result.Blocks); got != want {
+		t.Errorf("markdown =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDOCXDocumentTree(t *testing.T) {
+	result, err := extractDocument(testDOCX(t), "docx", ExtractOptions{Structure: true})
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+	root, text := buildDocumentTree(result.Blocks)
+
+	wantText := "Introducere\n\nTextul are bold și italic.\n\nprimul element\n\nal doilea_element\n\nDate\n\nAn\tValoare\n2024\ta|b\n\nPe pagina a doua."
+	if text != wantText {
+		t.Fatalf("plain text = %q, want %q", text, wantText)
+	}
+
+	// One top section with a nested section; the last paragraph belongs to "Date"
+	if len(root.Children) != 1 {
+		t.Fatalf("root has %d children, want 1", len(root.Children))
+	}
+	intro := root.Children[0]
+	var types []string
+	for _, child := range intro.Children {
+		types = append(types, child.Type)
+	}
+	if want := []string{"paragraph", "list_item", "list_item", "section"}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("section children = %v, want %v", types, want)
+	}
+	date := intro.Children[3]
+	if date.Title != "Date" || date.Level != 2 || len(date.Children) != 2 {
+		t.Fatalf("subsection = %+v", date)
+	}
+	if intro.Children[2].Level != 1 {
+		t.Errorf("nested list item has level %d, want 1", intro.Children[2].Level)
+	}
+
+	// Spans cover the children and point into the plain text
+	runes := []rune(text)
+	tests := []struct {
+		node      *DocumentNode
+		text      string
+		pageStart int
+		pageEnd   int
+	}{
+		{root, text, 1, 2},
+		{intro, text, 1, 2},
+		{intro.Children[1], "primul element", 1, 1},
+		{date, "Date\n\nAn\tValoare\n2024\ta|b\n\nPe pagina a doua.", 1, 2},
+		{date.Children[1], "Pe pagina a doua.", 2, 2},
+	}
+	for _, tt := range tests {
+		got := string(runes[tt.node.CharStart:tt.node.CharEnd])
+		if got != tt.text || tt.node.PageStart != tt.pageStart || tt.node.PageEnd != tt.pageEnd {
+			t.Errorf("%s %q spans %q on pages %d-%d, want %q on %d-%d", tt.node.Type, tt.node.Title,
+				got, tt.node.PageStart, tt.node.PageEnd, tt.text, tt.pageStart, tt.pageEnd)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+/*
+TOKENIZER BPE (pentru chunking)
+
+Numărul de tokeni se calculează cu aceeași codificare BPE ca modelul de
+embeddings (tiktoken, fișierele BPE sunt incluse în binar, fără download):
+  - openai:text-embedding-3-* / ada-002  -> cl100k_base
+  - alte modele (local, hash)            -> cl100k_base, ca aproximare
+  - CHUNK_TOKENIZER                      suprascrie codificarea (ex. o200k_base)
+
+Codificarea se încarcă o singură dată, la prima folosire.
+*/
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+const defaultTokenizerEncoding = "cl100k_base"
+
+// Tokenizer counts tokens and reports where each token ends in the text
+type Tokenizer interface {
+	Name() string
+	Count(text string) int
+	// Boundaries returns the byte offset after each token, on rune boundaries
+	Boundaries(text string) []int
+}
+
+var (
+	tokenizersMu sync.Mutex
+	tokenizers   = map[string]Tokenizer{}
+)
+
+func init() {
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// tokenizerForEmbedder returns the tokenizer matching an embedder name ("provider:model")
+func tokenizerForEmbedder(embedderName string) (Tokenizer, error) {
+	encoding := os.Getenv("CHUNK_TOKENIZER")
+	if encoding == "" {
+		encoding = defaultTokenizerEncoding
+		if provider, model, ok := strings.Cut(embedderName, ":"); ok && provider == "openai" {
+			if name, known := tiktoken.MODEL_TO_ENCODING[model]; known {
+				encoding = name
+			}
+		}
+	}
+
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+
+	if t, ok := tokenizers[encoding]; ok {
+		return t, nil
+	}
+	enc, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer %s: %v", encoding, err)
+	}
+	t := bpeTokenizer{name: encoding, enc: enc}
+	tokenizers[encoding] = t
+	return t, nil
+}
+
+type bpeTokenizer struct {
+	name string
+	enc  *tiktoken.Tiktoken
+}
+
+func (t bpeTokenizer) Name() string { return t.name }
+
+func (t bpeTokenizer) Count(text string) int {
+	return len(t.enc.EncodeOrdinary(text))
+}
+
+func (t bpeTokenizer) Boundaries(text string) []int {
+	ids := t.enc.EncodeOrdinary(text)
+	boundaries := make([]int, 0, len(ids))
+	offset := 0
+	for _, id := range ids {
+		offset += len(t.enc.Decode([]int{id}))
+		if offset > len(text) {
+			offset = len(text)
+		}
+		// A token may end inside a multi-byte rune; the cut moves to the rune start
+		boundaries = append(boundaries, runeStart(text, offset))
+	}
+	return boundaries
+}
+
+// runeStart moves a byte offset back to the start of the rune containing it
+func runeStart(s string, i int) int {
+	if i >= len(s) {
+		return len(s)
+	}
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
@@ -0,0 +1,90 @@
+package main
+
+/*
+STOCARE VECTORIALĂ (VECTOR_STORE)
+
+Toate operațiile pe puncte trec prin interfața VectorStore, cu două
+implementări:
+  - qdrant    (implicit) API-ul REST Qdrant, QDRANT_URL (qdrant_store.go)
+  - embedded  în proces, fără bază de date externă (embedded_store.go):
+              căutare exhaustivă cosine / sparse cu aceleași filtre, salvată
+              în VECTOR_STORE_PATH (implicit "data/vectors", un fișier per
+              colecție)
+
+Cererile și filtrele au formatul Qdrant (SearchRequest, QueryRequest, filtre
+must/should/must_not), deci codul de căutare nu știe ce implementare folosește.
+Rezultatele sunt decodate în valoarea dată de apelant (ca un răspuns JSON), de
+exemplu *[]SearchResult sau payload-ul unui document (docroute.go).
+
+Modul embedded este gândit pentru laptop și teste (mii - zeci de mii de
+puncte); colecțiile sale au mereu vectorii dense + bm25, deci
+"migrate-collection" nu se aplică.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	VectorStoreQdrant      = "qdrant"
+	VectorStoreEmbedded    = "embedded"
+	defaultVectorStorePath = "data/vectors"
+)
+
+// VectorStore holds the points of one collection
+type VectorStore interface {
+	Upsert(points []QdrantPoint) error
+	// Search ranks points by dense similarity (simple vector collections)
+	Search(req SearchRequest, out interface{}) error
+	// Query runs the Query API: one dense or sparse query, or prefetches fused with RRF
+	Query(req QueryRequest, out interface{}) error
+	// Scroll returns points in id order and the offset of the next page (nil at the end)
+	Scroll(req ScrollRequest, out interface{}) (interface{}, error)
+	Count(filter map[string]interface{}) (int, error)
+	Delete(filter map[string]interface{}) error
+	// SetPayload overwrites the given top-level keys on every point matching filter
+	SetPayload(filter map[string]interface{}, values map[string]interface{}) error
+	// Get decodes one point ({"id", "payload"}); false when it does not exist
+	Get(id string, out interface{}) (bool, error)
+	CreateIndex(field string, schema interface{}) error
+}
+
+type ScrollRequest struct {
+	Filter      interface{} `json:"filter,omitempty"`
+	Limit       int         `json:"limit"`
+	Offset      interface{} `json:"offset,omitempty"`
+	WithPayload interface{} `json:"with_payload"`
+	WithVector  bool        `json:"with_vector"`
+}
+
+// vectorStoreKind returns the VECTOR_STORE setting
+func vectorStoreKind() (string, error) {
+	kind := strings.ToLower(os.Getenv("VECTOR_STORE"))
+	switch kind {
+	case "", VectorStoreQdrant:
+		return VectorStoreQdrant, nil
+	case VectorStoreEmbedded:
+		return kind, nil
+	default:
+		return "", fmt.Errorf("unknown VECTOR_STORE %q (use qdrant or embedded)", kind)
+	}
+}
+
+func vectorStorePath() string {
+	if path := os.Getenv("VECTOR_STORE_PATH"); path != "" {
+		return path
+	}
+	return defaultVectorStorePath
+}
+
+// decodeResult copies a value into out the way a JSON response would be decoded
+func decodeResult(value interface{}, out interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
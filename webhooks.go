@@ -0,0 +1,621 @@
+package main
+
+/*
+WEBHOOK-URI (callback_url)
+
+/extract/store și /summary/* acceptă câmpul callback_url. Când lucrul se
+termină, serviciul trimite un POST JSON la acel URL:
+
+    {
+      "id": "<event id>",
+      "type": "ingestion.succeeded",      // <kind>.succeeded | <kind>.failed
+      "created_at": "2024-05-01T10:00:00Z",
+      "data": { ... }
+    }
+
+  - kind: ingestion, summary.chapters, summary.general, summary.level
+  - failed: răspuns HTTP >= 300, "success": false, sau un eșec raportat de
+    handler chiar cu 200 (c.Locals(callbackFailureLocal); de exemplu
+    /extract/store care a extras fișierul, dar nu l-a putut salva); eroarea
+    ajunge în data.error
+  - data: răspunsul endpoint-ului (fără textul paginilor); pentru un job
+    (async=true) starea jobului, trimisă când jobul se termină; pentru
+    descărcările PDF doar content_type, bytes și filename
+
+Headere: X-Webhook-Id, X-Webhook-Event, X-Webhook-Timestamp (secunde Unix) și
+X-Webhook-Signature: sha256=<hex HMAC-SHA256(WEBHOOK_SECRET, timestamp + "." + body)>.
+Fără WEBHOOK_SECRET câmpul callback_url este refuzat (400).
+
+Livrarea este reîncercată de cel mult WEBHOOK_MAX_ATTEMPTS ori (implicit 5),
+după WEBHOOK_RETRY_BASE_SECONDS * 2^n secunde (implicit 2), pentru erori de
+rețea, 408, 425, 429 și 5xx; alte răspunsuri 4xx opresc livrarea. Timeout per
+încercare: WEBHOOK_TIMEOUT_SECONDS (implicit 10).
+
+Jurnalul livrărilor (fiecare încercare, cu status și eroare) este salvat în
+WEBHOOKS_DB_PATH (bbolt, implicit webhooks.db; "off" = doar în memorie) și
+păstrat WEBHOOK_RETENTION_HOURS (implicit 72); livrările neterminate sunt
+reluate la pornire.
+  - GET  /webhooks/deliveries?status=failed&limit=50
+  - GET  /webhooks/deliveries/:id           (cu payload)
+  - POST /webhooks/deliveries/:id/replay    retrimite același eveniment
+
+Adresele private și loopback sunt refuzate (la conectare, deci și după DNS);
+WEBHOOK_ALLOW_PRIVATE=true le permite, de exemplu pentru un receiver local
+în teste.
+*/
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+
+	defaultWebhooksDBPath       = "webhooks.db"
+	defaultWebhookWorkers       = 2
+	defaultWebhookMaxAttempts   = 5
+	defaultWebhookRetryBaseSecs = 2
+	defaultWebhookTimeout       = 10
+	defaultWebhookRetentionHrs  = 72
+	maxWebhookRetryDelay        = 15 * time.Minute
+	webhookQueueSize            = 1000
+	defaultDeliveryListLimit    = 50
+	maxWebhookLogBody           = 512
+)
+
+var (
+	webhooksBucket = []byte("deliveries") // id -> WebhookDelivery JSON
+
+	errWebhookBlocked = errors.New("callback address is private or loopback (set WEBHOOK_ALLOW_PRIVATE=true to allow)")
+)
+
+// callbackFailureLocal is the fiber.Ctx local (error) a handler sets when it
+// answers 200 but the work failed, so withCallback sends "<kind>.failed"
+const callbackFailureLocal = "callback_failure"
+
+// WebhookEvent is the signed JSON body
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookAttempt is one entry of the delivery log
+type WebhookAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// WebhookDelivery is an event and the attempts to deliver it
+type WebhookDelivery struct {
+	ID            string           `json:"id"` // event id
+	Event         string           `json:"event"`
+	URL           string           `json:"url"`
+	Status        string           `json:"status"`
+	Attempts      int              `json:"attempts"`
+	MaxAttempts   int              `json:"max_attempts"`
+	Log           []WebhookAttempt `json:"log,omitempty"`
+	Payload       json.RawMessage  `json:"payload,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+	NextAttemptAt *time.Time       `json:"next_attempt_at,omitempty"`
+	FinishedAt    *time.Time       `json:"finished_at,omitempty"`
+}
+
+// WebhookDispatcher delivers events in the background with retries
+type WebhookDispatcher struct {
+	secret      []byte
+	db          *bolt.DB // nil: the delivery log is kept in memory only
+	client      *http.Client
+	queue       chan string
+	workers     int
+	maxAttempts int
+	retryBase   time.Duration
+	retention   time.Duration
+
+	mu         sync.Mutex
+	deliveries map[string]*WebhookDelivery
+}
+
+// webhooks is configured in main()
+var webhooks *WebhookDispatcher
+
+func newWebhookDispatcherFromEnv() (*WebhookDispatcher, error) {
+	d := &WebhookDispatcher{
+		secret:      []byte(os.Getenv("WEBHOOK_SECRET")),
+		queue:       make(chan string, webhookQueueSize),
+		workers:     defaultWebhookWorkers,
+		maxAttempts: envInt("WEBHOOK_MAX_ATTEMPTS", defaultWebhookMaxAttempts),
+		retryBase:   time.Duration(envInt("WEBHOOK_RETRY_BASE_SECONDS", defaultWebhookRetryBaseSecs)) * time.Second,
+		retention:   time.Duration(envInt("WEBHOOK_RETENTION_HOURS", defaultWebhookRetentionHrs)) * time.Hour,
+		deliveries:  make(map[string]*WebhookDelivery),
+	}
+	if d.maxAttempts < 1 {
+		d.maxAttempts = 1
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !strings.EqualFold(os.Getenv("WEBHOOK_ALLOW_PRIVATE"), "true") {
+		dialer.Control = refusePrivateAddress
+	}
+	d.client = &http.Client{
+		Timeout:   time.Duration(envInt("WEBHOOK_TIMEOUT_SECONDS", defaultWebhookTimeout)) * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		// A redirect could point the signed event somewhere else
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	path := os.Getenv("WEBHOOKS_DB_PATH")
+	if path == "" {
+		path = defaultWebhooksDBPath
+	}
+	if !strings.EqualFold(path, "off") {
+		db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+		if err != nil {
+			return d, fmt.Errorf("failed to open webhook log %s: %v", path, err)
+		}
+		if err := d.load(db); err != nil {
+			db.Close()
+			return d, err
+		}
+		d.db = db
+	}
+	return d, nil
+}
+
+// refusePrivateAddress runs after DNS resolution, so a public name pointing to
+// an internal address is refused too
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return errWebhookBlocked
+	}
+	return nil
+}
+
+func (d *WebhookDispatcher) load(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(webhooksBucket)
+		if err != nil {
+			return fmt.Errorf("failed to initialize webhook log: %v", err)
+		}
+		return bucket.ForEach(func(id, data []byte) error {
+			var delivery WebhookDelivery
+			if err := json.Unmarshal(data, &delivery); err != nil {
+				fmt.Printf("⚠️ Skipping unreadable webhook delivery %s: %v\n", id, err)
+				return nil
+			}
+			d.deliveries[delivery.ID] = &delivery
+			return nil
+		})
+	})
+}
+
+// Start launches the senders and resumes the deliveries interrupted by a restart
+func (d *WebhookDispatcher) Start() {
+	for i := 0; i < d.workers; i++ {
+		go d.worker()
+	}
+
+	d.mu.Lock()
+	resumed := 0
+	for _, delivery := range d.deliveries {
+		if delivery.Status != WebhookPending {
+			continue
+		}
+		delay := time.Duration(0)
+		if delivery.NextAttemptAt != nil {
+			delay = time.Until(*delivery.NextAttemptAt)
+		}
+		d.schedule(delivery.ID, delay)
+		resumed++
+	}
+	d.mu.Unlock()
+	d.cleanup()
+
+	if len(d.secret) == 0 {
+		fmt.Printf("ℹ️ Webhooks disabled (WEBHOOK_SECRET not set)\n")
+		return
+	}
+	fmt.Printf("📮 Webhooks enabled (%d deliveries resumed)\n", resumed)
+}
+
+func (d *WebhookDispatcher) Close() {
+	if d.db != nil {
+		d.db.Close()
+	}
+}
+
+// validateCallbackURL checks a callback_url form value ("" means no callback)
+func (d *WebhookDispatcher) validateCallbackURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if len(d.secret) == 0 {
+		return fmt.Errorf("callback_url needs WEBHOOK_SECRET to be configured on the server")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callback_url must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// Send records the event and queues its delivery to callbackURL
+func (d *WebhookDispatcher) Send(callbackURL, eventType string, data interface{}) {
+	if callbackURL == "" {
+		return
+	}
+	now := time.Now().UTC()
+	event := WebhookEvent{ID: uuid.NewString(), Type: eventType, CreatedAt: now, Data: data}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		fmt.Printf("⚠️ Failed to encode webhook event %s: %v\n", eventType, err)
+		return
+	}
+
+	delivery := &WebhookDelivery{
+		ID:          event.ID,
+		Event:       eventType,
+		URL:         callbackURL,
+		Status:      WebhookPending,
+		MaxAttempts: d.maxAttempts,
+		Payload:     payload,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	d.mu.Lock()
+	d.deliveries[delivery.ID] = delivery
+	snapshot := *delivery
+	d.mu.Unlock()
+	d.save(&snapshot)
+
+	d.schedule(delivery.ID, 0)
+}
+
+// Replay sends a stored event again (same id and body, new signature)
+func (d *WebhookDispatcher) Replay(id string) (*WebhookDelivery, error) {
+	d.mu.Lock()
+	delivery, ok := d.deliveries[id]
+	if !ok {
+		d.mu.Unlock()
+		return nil, nil
+	}
+	if delivery.Status == WebhookPending {
+		d.mu.Unlock()
+		return nil, fmt.Errorf("delivery %s is still pending", id)
+	}
+	delivery.Status = WebhookPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = nil
+	delivery.FinishedAt = nil
+	delivery.UpdatedAt = time.Now().UTC()
+	snapshot := *delivery
+	d.mu.Unlock()
+	d.save(&snapshot)
+
+	d.schedule(id, 0)
+	fmt.Printf("🔁 Replaying webhook %s (%s) to %s\n", id, snapshot.Event, snapshot.URL)
+	return &snapshot, nil
+}
+
+// Get returns a copy of the delivery (nil if unknown)
+func (d *WebhookDispatcher) Get(id string) *WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivery, ok := d.deliveries[id]
+	if !ok {
+		return nil
+	}
+	snapshot := *delivery
+	return &snapshot
+}
+
+// List returns the most recent deliveries (status "" for all), without payloads
+func (d *WebhookDispatcher) List(status string, limit int) []WebhookDelivery {
+	d.mu.Lock()
+	var list []WebhookDelivery
+	for _, delivery := range d.deliveries {
+		if status == "" || delivery.Status == status {
+			snapshot := *delivery
+			snapshot.Payload = nil
+			list = append(list, snapshot)
+		}
+	}
+	d.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
+
+// schedule queues the delivery after delay
+func (d *WebhookDispatcher) schedule(id string, delay time.Duration) {
+	if delay <= 0 {
+		select {
+		case d.queue <- id:
+			return
+		default:
+			delay = time.Second // queue full: try again shortly
+		}
+	}
+	time.AfterFunc(delay, func() { d.queue <- id })
+}
+
+func (d *WebhookDispatcher) worker() {
+	for id := range d.queue {
+		d.deliver(id)
+	}
+}
+
+func (d *WebhookDispatcher) deliver(id string) {
+	d.mu.Lock()
+	delivery, ok := d.deliveries[id]
+	if !ok || delivery.Status != WebhookPending {
+		d.mu.Unlock()
+		return
+	}
+	target, eventType, payload := delivery.URL, delivery.Event, delivery.Payload
+	d.mu.Unlock()
+
+	started := time.Now()
+	status, err := d.post(target, id, eventType, payload)
+	attempt := WebhookAttempt{At: started.UTC(), StatusCode: status, DurationMs: time.Since(started).Milliseconds()}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	retryable := err != nil && !errors.Is(err, errWebhookBlocked) && (status == 0 || isRetryableStatus(status) || status >= 500)
+
+	var retryIn time.Duration
+	d.mu.Lock()
+	delivery.Attempts++
+	delivery.Log = append(delivery.Log, attempt)
+	now := time.Now().UTC()
+	delivery.UpdatedAt = now
+	switch {
+	case err == nil:
+		delivery.Status = WebhookDelivered
+		delivery.FinishedAt = &now
+		delivery.NextAttemptAt = nil
+	case retryable && delivery.Attempts < delivery.MaxAttempts:
+		retryIn = d.retryBase << (delivery.Attempts - 1)
+		if retryIn > maxWebhookRetryDelay || retryIn <= 0 {
+			retryIn = maxWebhookRetryDelay
+		}
+		next := now.Add(retryIn)
+		delivery.NextAttemptAt = &next
+	default:
+		delivery.Status = WebhookFailed
+		delivery.FinishedAt = &now
+		delivery.NextAttemptAt = nil
+	}
+	snapshot := *delivery
+	d.mu.Unlock()
+	d.save(&snapshot)
+
+	switch {
+	case err == nil:
+		fmt.Printf("📮 Webhook %s delivered to %s (status %d)\n", eventType, target, status)
+	case retryIn > 0:
+		fmt.Printf("🔁 Webhook %s to %s failed (attempt %d/%d), retrying in %v: %v\n", eventType, target, snapshot.Attempts, snapshot.MaxAttempts, retryIn, err)
+		d.schedule(id, retryIn)
+	default:
+		fmt.Printf("❌ Webhook %s to %s failed: %v\n", eventType, target, err)
+	}
+	if snapshot.Status != WebhookPending {
+		d.cleanup()
+	}
+}
+
+// post sends one signed attempt; a non-2xx status is an error
+func (d *WebhookDispatcher) post(target, id, eventType string, payload []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(context.Background(), "POST", target, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "document-extractor-webhooks")
+	req.Header.Set("X-Webhook-Id", id)
+	req.Header.Set("X-Webhook-Event", eventType)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(d.secret, timestamp, payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookLogBody+1))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("status %d: %s", resp.StatusCode, truncateBody(body, maxWebhookLogBody))
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhook is the hex HMAC-SHA256 of "<timestamp>.<body>"
+func signWebhook(secret []byte, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *WebhookDispatcher) save(delivery *WebhookDelivery) {
+	if d.db == nil {
+		return
+	}
+	data, err := json.Marshal(delivery)
+	if err == nil {
+		err = d.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(webhooksBucket).Put([]byte(delivery.ID), data)
+		})
+	}
+	if err != nil {
+		fmt.Printf("⚠️ Failed to save webhook delivery %s: %v\n", delivery.ID, err)
+	}
+}
+
+// cleanup removes the deliveries finished more than WEBHOOK_RETENTION_HOURS ago
+func (d *WebhookDispatcher) cleanup() {
+	cutoff := time.Now().Add(-d.retention)
+	var expired []string
+	d.mu.Lock()
+	for id, delivery := range d.deliveries {
+		if delivery.FinishedAt != nil && delivery.FinishedAt.Before(cutoff) {
+			expired = append(expired, id)
+			delete(d.deliveries, id)
+		}
+	}
+	d.mu.Unlock()
+	if len(expired) == 0 || d.db == nil {
+		return
+	}
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		for _, id := range expired {
+			if err := tx.Bucket(webhooksBucket).Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("⚠️ Failed to delete webhook deliveries: %v\n", err)
+	}
+}
+
+// withCallback sends a "<kind>.succeeded|failed" event to the request's
+// callback_url once the handler has answered. A 202 means the work continues
+// in the background (async ingestion), which sends its own event.
+func withCallback(kind string, handler fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		callbackURL := c.FormValue("callback_url", c.Query("callback_url"))
+		if err := webhooks.validateCallbackURL(callbackURL); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "error": err.Error()})
+		}
+
+		err := handler(c)
+		if callbackURL == "" || (err == nil && c.Response().StatusCode() == fiber.StatusAccepted) {
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		var data interface{}
+		switch {
+		case err != nil:
+			data = fiber.Map{"success": false, "error": err.Error()}
+			status = fiber.StatusInternalServerError
+		case strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON):
+			var body map[string]interface{}
+			if json.Unmarshal(c.Response().Body(), &body) == nil {
+				delete(body, "pages") // page texts are not needed to react to the event
+				data = body
+			}
+		default:
+			// File download: describe it, the caller already has the file
+			filename := ""
+			if _, params, err := mime.ParseMediaType(string(c.Response().Header.Peek(fiber.HeaderContentDisposition))); err == nil {
+				filename = params["filename"]
+			}
+			data = fiber.Map{
+				"success":      status < 300,
+				"content_type": string(c.Response().Header.ContentType()),
+				"bytes":        c.Response().Header.ContentLength(),
+				"filename":     filename,
+			}
+		}
+
+		failure, _ := c.Locals(callbackFailureLocal).(error)
+		if body, ok := data.(map[string]interface{}); ok && failure != nil {
+			if _, present := body["error"]; !present {
+				body["error"] = failure.Error()
+			}
+		}
+		webhooks.Send(callbackURL, kind+"."+callbackOutcome(status, data, failure), data)
+		return err
+	}
+}
+
+// callbackOutcome is "failed" for an error status, a failure reported by the
+// handler and a body with "success": false
+func callbackOutcome(status int, data interface{}, failure error) string {
+	if status >= 300 || failure != nil {
+		return "failed"
+	}
+	var body map[string]interface{}
+	switch d := data.(type) {
+	case map[string]interface{}:
+		body = d
+	case fiber.Map:
+		body = d
+	}
+	if success, present := body["success"].(bool); present && !success {
+		return "failed"
+	}
+	return "succeeded"
+}
+
+func handleListWebhookDeliveries(c *fiber.Ctx) error {
+	limit := defaultDeliveryListLimit
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	deliveries := webhooks.List(c.Query("status"), limit)
+	return c.JSON(fiber.Map{"success": true, "deliveries": deliveries, "total": len(deliveries)})
+}
+
+func handleGetWebhookDelivery(c *fiber.Ctx) error {
+	delivery := webhooks.Get(c.Params("id"))
+	if delivery == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "delivery not found"})
+	}
+	return c.JSON(fiber.Map{"success": true, "delivery": delivery})
+}
+
+func handleReplayWebhookDelivery(c *fiber.Ctx) error {
+	delivery, err := webhooks.Replay(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"success": false, "error": err.Error()})
+	}
+	if delivery == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "error": "delivery not found"})
+	}
+	delivery.Payload = nil
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"success": true, "delivery": delivery})
+}
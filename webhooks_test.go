@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSignWebhook(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		payload   string
+		want      string
+	}{
+		{"event", "secret", "1700000000", `{"id":"e1"}`, "46fc0b60e09563a94dea2fa3b7b63d83458dd87b30fac860dcbabac0df9bdbde"},
+		{"empty", "", "0", "", "b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signWebhook([]byte(tt.secret), tt.timestamp, []byte(tt.payload)); got != tt.want {
+				t.Errorf("signWebhook = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Every signed part changes the signature
+	base := signWebhook([]byte("secret"), "1700000000", []byte(`{"id":"e1"}`))
+	for name, other := range map[string]string{
+		"secret":    signWebhook([]byte("other"), "1700000000", []byte(`{"id":"e1"}`)),
+		"timestamp": signWebhook([]byte("secret"), "1700000001", []byte(`{"id":"e1"}`)),
+		"body":      signWebhook([]byte("secret"), "1700000000", []byte(`{"id":"e2"}`)),
+	} {
+		if other == base {
+			t.Errorf("changing the %s keeps the signature", name)
+		}
+	}
+}
+
+func TestCallbackOutcome(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		data    interface{}
+		failure error
+		want    string
+	}{
+		{"ok", 200, map[string]interface{}{"success": true, "stored_in_qdrant": true}, nil, "succeeded"},
+		{"error status", 500, fiber.Map{"success": false}, nil, "failed"},
+		{"client error", 400, map[string]interface{}{"error": "bad"}, nil, "failed"},
+		{"200 with success false", 200, map[string]interface{}{"success": false}, nil, "failed"},
+		{"200, store failed", 200, map[string]interface{}{"success": true}, errStoreFailed, "failed"},
+		{"file download", 200, fiber.Map{"success": true, "bytes": 10}, nil, "succeeded"},
+		{"no body", 200, nil, nil, "succeeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := callbackOutcome(tt.status, tt.data, tt.failure); got != tt.want {
+				t.Errorf("callbackOutcome = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// webhookReceiver records the requests and answers with the next status
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int // answered in order, then 200
+	requests []receivedWebhook
+	received chan struct{}
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.requests = append(r.requests, receivedWebhook{req.Header.Clone(), body})
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	r.mu.Unlock()
+	w.WriteHeader(status)
+	r.received <- struct{}{}
+}
+
+func (r *webhookReceiver) snapshot() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.requests...)
+}
+
+// startTestWebhooks starts a dispatcher logging to dir, with fast retries, as the global one
+func startTestWebhooks(t *testing.T, dir string) *WebhookDispatcher {
+	t.Helper()
+	t.Setenv("WEBHOOK_SECRET", "test-secret")
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "true")
+	t.Setenv("WEBHOOKS_DB_PATH", filepath.Join(dir, "webhooks.db"))
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+	d, err := newWebhookDispatcherFromEnv()
+	if err != nil {
+		t.Fatalf("failed to start webhooks: %v", err)
+	}
+	d.retryBase = 10 * time.Millisecond
+	d.Start()
+
+	previous := webhooks
+	webhooks = d
+	t.Cleanup(func() {
+		webhooks = previous
+		d.Close()
+	})
+	return d
+}
+
+// waitDelivery waits until the only delivery is no longer pending
+func waitDelivery(t *testing.T, d *WebhookDispatcher) WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if list := d.List("", 0); len(list) == 1 && list[0].Status != WebhookPending {
+			return *d.Get(list[0].ID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("delivery still pending: %+v", d.List("", 0))
+	return WebhookDelivery{}
+}
+
+func TestWebhookDeliveryRetriesAndReplays(t *testing.T) {
+	dir := t.TempDir()
+	d := startTestWebhooks(t, dir)
+	receiver := &webhookReceiver{statuses: []int{503, 500}, received: make(chan struct{}, 10)}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	d.Send(server.URL, "ingestion.succeeded", map[string]interface{}{"doc_name": "a.pdf"})
+	delivery := waitDelivery(t, d)
+
+	if delivery.Status != WebhookDelivered || delivery.Attempts != 3 {
+		t.Fatalf("delivery = %s after %d attempts, want delivered after 3", delivery.Status, delivery.Attempts)
+	}
+	var codes []int
+	for _, attempt := range delivery.Log {
+		codes = append(codes, attempt.StatusCode)
+	}
+	if len(codes) != 3 || codes[0] != 503 || codes[1] != 500 || codes[2] != 200 {
+		t.Errorf("logged status codes = %v, want [503 500 200]", codes)
+	}
+	if delivery.Log[0].Error == "" {
+		t.Errorf("failed attempt has no error in the log")
+	}
+
+	// Every attempt is the same signed event
+	checkRequests := func(requests []receivedWebhook) {
+		t.Helper()
+		for i, req := range requests {
+			mac := hmac.New(sha256.New, []byte("test-secret"))
+			mac.Write([]byte(req.header.Get("X-Webhook-Timestamp") + "."))
+			mac.Write(req.body)
+			if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.header.Get("X-Webhook-Signature") != want {
+				t.Errorf("request %d: signature %s, want %s", i, req.header.Get("X-Webhook-Signature"), want)
+			}
+			if req.header.Get("X-Webhook-Id") != delivery.ID || req.header.Get("X-Webhook-Event") != "ingestion.succeeded" {
+				t.Errorf("request %d: id %s, event %s", i, req.header.Get("X-Webhook-Id"), req.header.Get("X-Webhook-Event"))
+			}
+			var event WebhookEvent
+			if err := json.Unmarshal(req.body, &event); err != nil || event.ID != delivery.ID || event.Type != "ingestion.succeeded" {
+				t.Errorf("request %d: body %s", i, req.body)
+			}
+			if string(req.body) != string(requests[0].body) {
+				t.Errorf("request %d: body changed between attempts", i)
+			}
+		}
+	}
+	checkRequests(receiver.snapshot())
+
+	// Replay sends the same event again; attempts restart, the log keeps the earlier ones
+	if _, err := d.Replay(delivery.ID); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	replayed := waitDelivery(t, d)
+	if replayed.Status != WebhookDelivered || replayed.Attempts != 1 || len(replayed.Log) != 4 {
+		t.Errorf("replayed = %s, %d attempts, %d log entries; want delivered, 1, 4", replayed.Status, replayed.Attempts, len(replayed.Log))
+	}
+	requests := receiver.snapshot()
+	if len(requests) != 4 {
+		t.Fatalf("receiver got %d requests, want 4", len(requests))
+	}
+	checkRequests(requests)
+
+	// The log survives a restart
+	d.Close()
+	reopened, err := newWebhookDispatcherFromEnv()
+	if err != nil {
+		t.Fatalf("failed to reopen the webhook log: %v", err)
+	}
+	defer reopened.Close()
+	if saved := reopened.Get(delivery.ID); saved == nil || saved.Status != WebhookDelivered || len(saved.Log) != 4 {
+		t.Errorf("saved delivery = %+v", saved)
+	}
+}
+
+func TestWebhookDeliveryStopsOnClientError(t *testing.T) {
+	d := startTestWebhooks(t, t.TempDir())
+	receiver := &webhookReceiver{statuses: []int{404}, received: make(chan struct{}, 10)}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	d.Send(server.URL, "ingestion.failed", nil)
+	if delivery := waitDelivery(t, d); delivery.Status != WebhookFailed || delivery.Attempts != 1 {
+		t.Errorf("delivery = %s after %d attempts, want failed after 1", delivery.Status, delivery.Attempts)
+	}
+}
+
+func TestWithCallbackReportsHandlerFailures(t *testing.T) {
+	startTestWebhooks(t, t.TempDir())
+	receiver := &webhookReceiver{received: make(chan struct{}, 10)}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		handler   fiber.Handler
+		wantEvent string
+		wantError string
+	}{
+		{"stored", func(c *fiber.Ctx) error {
+			return c.JSON(fiber.Map{"success": true, "stored_in_qdrant": true, "pages": []string{"text"}})
+		}, "ingestion.succeeded", ""},
+		{"extracted but not stored", func(c *fiber.Ctx) error {
+			c.Locals(callbackFailureLocal, errors.New("failed to store the document: qdrant is down"))
+			return c.JSON(fiber.Map{"success": true, "pages": []string{"text"}})
+		}, "ingestion.failed", "failed to store the document: qdrant is down"},
+		{"error status", func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "error": "boom"})
+		}, "ingestion.failed", "boom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Post("/", withCallback("ingestion", tt.handler))
+			resp, err := app.Test(httptest.NewRequest("POST", "/?callback_url="+server.URL, nil))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			select {
+			case <-receiver.received:
+			case <-time.After(10 * time.Second):
+				t.Fatal("no webhook received")
+			}
+			requests := receiver.snapshot()
+			last := requests[len(requests)-1]
+			var event struct {
+				Type string                 `json:"type"`
+				Data map[string]interface{} `json:"data"`
+			}
+			if err := json.Unmarshal(last.body, &event); err != nil {
+				t.Fatalf("bad event %s: %v", last.body, err)
+			}
+			if event.Type != tt.wantEvent {
+				t.Errorf("event = %s, want %s", event.Type, tt.wantEvent)
+			}
+			if got, _ := event.Data["error"].(string); got != tt.wantError {
+				t.Errorf("data.error = %q, want %q", got, tt.wantError)
+			}
+			if _, ok := event.Data["pages"]; ok {
+				t.Errorf("the event carries the page texts")
+			}
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+/*
+IZOLARE MUPDF ÎN PROCESE SEPARATE
+
+MuPDF rulează prin cgo, deci un PDF malformat poate produce un segfault în cod C
+pe care recover.New() din Fiber nu îl poate prinde - tot serverul cade.
+
+Soluția: extragerea PDF rulează în procese copil (același binar pornit cu
+argumentul "worker"). Fiecare worker:
+  - își setează singur limite de CPU și memorie (rlimit) la pornire
+  - primește cereri pe un pipe (fd 3) și trimite rezultatele pe alt pipe (fd 4)
+  - este omorât dacă depășește timeout-ul și repornit automat dacă moare
+
+Configurare (env):
+  EXTRACT_WORKERS              numărul de procese (0 = extragere în proces, fără izolare)
+  EXTRACT_TIMEOUT_SECONDS      timeout per document
+  EXTRACT_WORKER_MEMORY_MB     limită de memorie virtuală per worker
+  EXTRACT_WORKER_CPU_SECONDS   limită de timp CPU per worker
+  EXTRACT_WORKER_MAX_JOBS      după câte documente este reciclat un worker
+*/
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultExtractWorkers   = 2
+	defaultExtractTimeout   = 120 * time.Second
+	defaultWorkerMemoryMB   = 2048
+	defaultWorkerCPUSeconds = 600
+	defaultWorkerMaxJobs    = 200
+	workerRequestFD         = 3
+	workerResponseFD        = 4
+)
+
+// workerRequest is sent from the server to a worker process over the request pipe
+type workerRequest struct {
+	Op      string
+	Data    []byte
+	Options ExtractOptions
+	Render  RenderOptions
+}
+
+// workerResponse is sent back by the worker over the response pipe
+type workerResponse struct {
+	Result   *ExtractResult
+	Render   *RenderResult
+	Error    string
+	Sentinel string // message of the sentinel error wrapped by Error, if any
+}
+
+// workerSentinels are the errors whose identity survives the pipe, so callers can
+// use errors.Is on failures from worker processes as on in-process ones
+var workerSentinels = []error{errPageOutOfRange}
+
+// workerError is an error returned by a worker process
+type workerError struct {
+	msg      string
+	sentinel error
+}
+
+func (e *workerError) Error() string { return e.msg }
+func (e *workerError) Unwrap() error { return e.sentinel }
+
+// workerFailure encodes err for the response pipe
+func workerFailure(err error) workerResponse {
+	resp := workerResponse{Error: err.Error()}
+	for _, sentinel := range workerSentinels {
+		if errors.Is(err, sentinel) {
+			resp.Sentinel = sentinel.Error()
+			break
+		}
+	}
+	return resp
+}
+
+// decodeWorkerError restores the sentinel of a failure sent by a worker
+func decodeWorkerError(resp workerResponse) error {
+	err := &workerError{msg: resp.Error}
+	for _, sentinel := range workerSentinels {
+		if resp.Sentinel != "" && sentinel.Error() == resp.Sentinel {
+			err.sentinel = sentinel
+			break
+		}
+	}
+	return err
+}
+
+// ExtractionPool keeps a fixed number of sandboxed worker processes
+type ExtractionPool struct {
+	size    int
+	timeout time.Duration
+	maxJobs int
+	idle    chan *extractionWorker
+	nextID  int64
+}
+
+type extractionWorker struct {
+	id   int64
+	cmd  *exec.Cmd
+	reqW *os.File
+	resR *os.File
+	enc  *gob.Encoder
+	dec  *gob.Decoder
+	jobs int
+	done chan struct{} // closed when the process exits
+}
+
+var extractionPool *ExtractionPool
+
+// newExtractionPoolFromEnv returns nil when EXTRACT_WORKERS=0 (in-process extraction)
+func newExtractionPoolFromEnv() (*ExtractionPool, error) {
+	size := envInt("EXTRACT_WORKERS", defaultExtractWorkers)
+	if size <= 0 {
+		return nil, nil
+	}
+
+	timeout := time.Duration(envInt("EXTRACT_TIMEOUT_SECONDS", int(defaultExtractTimeout/time.Second))) * time.Second
+
+	pool := &ExtractionPool{
+		size:    size,
+		timeout: timeout,
+		maxJobs: envInt("EXTRACT_WORKER_MAX_JOBS", defaultWorkerMaxJobs),
+		idle:    make(chan *extractionWorker, size),
+	}
+
+	for i := 0; i < size; i++ {
+		w, err := pool.spawn()
+		if err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("failed to start extraction worker: %v", err)
+		}
+		pool.idle <- w
+	}
+
+	fmt.Printf("🧩 Started %d PDF extraction workers (timeout %v)\n", size, timeout)
+	return pool, nil
+}
+
+func (p *ExtractionPool) spawn() (*extractionWorker, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("cannot locate executable: %v", err)
+	}
+
+	// Request pipe: parent writes, child reads on fd 3
+	reqR, reqW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	// Response pipe: child writes on fd 4, parent reads
+	resR, resW, err := os.Pipe()
+	if err != nil {
+		reqR.Close()
+		reqW.Close()
+		return nil, err
+	}
+
+	cmd := exec.Command(exe, "worker")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{reqR, resW} // become fd 3 and fd 4
+	cmd.SysProcAttr = workerSysProcAttr()
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("EXTRACT_WORKER_MEMORY_MB=%d", envInt("EXTRACT_WORKER_MEMORY_MB", defaultWorkerMemoryMB)),
+		fmt.Sprintf("EXTRACT_WORKER_CPU_SECONDS=%d", envInt("EXTRACT_WORKER_CPU_SECONDS", defaultWorkerCPUSeconds)),
+	)
+
+	if err := cmd.Start(); err != nil {
+		reqR.Close()
+		reqW.Close()
+		resR.Close()
+		resW.Close()
+		return nil, err
+	}
+
+	// The child owns its ends now
+	reqR.Close()
+	resW.Close()
+
+	w := &extractionWorker{
+		id:   atomic.AddInt64(&p.nextID, 1),
+		cmd:  cmd,
+		reqW: reqW,
+		resR: resR,
+		enc:  gob.NewEncoder(reqW),
+		dec:  gob.NewDecoder(resR),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		cmd.Wait()
+		close(w.done)
+	}()
+
+	return w, nil
+}
+
+// kill terminates the worker process and releases its pipes
+func (w *extractionWorker) kill() {
+	if w.cmd.Process != nil {
+		w.cmd.Process.Kill()
+	}
+	<-w.done
+	w.reqW.Close()
+	w.resR.Close()
+}
+
+func (w *extractionWorker) exited() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run sends a request to an idle worker and waits for its response.
+// A worker that crashes or times out is killed and replaced.
+func (p *ExtractionPool) Run(req workerRequest) (*workerResponse, error) {
+	w := <-p.idle
+
+	// A previous respawn may have failed, or the process died while idle
+	if w == nil || w.exited() {
+		if w != nil {
+			w.kill()
+		}
+		var err error
+		w, err = p.spawn()
+		if err != nil {
+			p.idle <- nil
+			return nil, fmt.Errorf("failed to respawn extraction worker: %v", err)
+		}
+	}
+
+	type result struct {
+		resp workerResponse
+		err  error
+	}
+	resultCh := make(chan result, 1)
+
+	go func() {
+		var res result
+		if err := w.enc.Encode(&req); err != nil {
+			res.err = err
+		} else {
+			res.err = w.dec.Decode(&res.resp)
+		}
+		resultCh <- res
+	}()
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-resultCh:
+		if res.err != nil {
+			reason := "unknown"
+			w.kill()
+			if state := w.cmd.ProcessState; state != nil {
+				reason = state.String()
+			}
+			fmt.Printf("💥 Extraction worker %d crashed (%s), respawning\n", w.id, reason)
+			p.replace()
+			return nil, fmt.Errorf("extraction worker crashed while processing document (%s)", reason)
+		}
+
+		w.jobs++
+		if p.maxJobs > 0 && w.jobs >= p.maxJobs {
+			// Recycle long-lived workers so leaks and rlimit CPU time do not accumulate
+			w.kill()
+			p.replace()
+		} else {
+			p.idle <- w
+		}
+
+		if res.resp.Error != "" {
+			return &res.resp, decodeWorkerError(res.resp)
+		}
+		return &res.resp, nil
+
+	case <-timer.C:
+		fmt.Printf("⏱️ Extraction worker %d timed out after %v, killing\n", w.id, p.timeout)
+		w.kill()
+		p.replace()
+		return nil, fmt.Errorf("extraction timed out after %v", p.timeout)
+	}
+}
+
+// replace puts a fresh worker into the idle pool (or a nil placeholder to retry later)
+func (p *ExtractionPool) replace() {
+	w, err := p.spawn()
+	if err != nil {
+		fmt.Printf("⚠️ Failed to respawn extraction worker: %v\n", err)
+		p.idle <- nil
+		return
+	}
+	p.idle <- w
+}
+
+// Close stops all idle workers
+func (p *ExtractionPool) Close() {
+	for {
+		select {
+		case w := <-p.idle:
+			if w != nil {
+				w.kill()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// extractPDFIsolated runs PDF extraction in a worker process when the pool is enabled
+func extractPDFIsolated(data []byte, opts ExtractOptions) (*ExtractResult, error) {
+	if extractionPool == nil {
+		return extractPDF(data, opts)
+	}
+
+	resp, err := extractionPool.Run(workerRequest{Op: "pdf_extract", Data: data, Options: opts})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Result, nil
+}
+
+// runExtractionWorker is the entry point of a child process started with the "worker" argument
+func runExtractionWorker() {
+	applyWorkerLimits(
+		uint64(envInt("EXTRACT_WORKER_MEMORY_MB", defaultWorkerMemoryMB)),
+		uint64(envInt("EXTRACT_WORKER_CPU_SECONDS", defaultWorkerCPUSeconds)),
+	)
+
+	in := os.NewFile(workerRequestFD, "worker-requests")
+	out := os.NewFile(workerResponseFD, "worker-responses")
+	if in == nil || out == nil {
+		fmt.Fprintln(os.Stderr, "worker: request/response pipes not provided")
+		os.Exit(2)
+	}
+
+	dec := gob.NewDecoder(in)
+	enc := gob.NewEncoder(out)
+
+	for {
+		var req workerRequest
+		if err := dec.Decode(&req); err != nil {
+			if err == io.EOF {
+				return // parent closed the pipe
+			}
+			fmt.Fprintf(os.Stderr, "worker: failed to decode request: %v\n", err)
+			os.Exit(1)
+		}
+
+		resp := handleWorkerRequest(req)
+		if err := enc.Encode(&resp); err != nil {
+			fmt.Fprintf(os.Stderr, "worker: failed to encode response: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func handleWorkerRequest(req workerRequest) (resp workerResponse) {
+	// Go panics are still recoverable here; only C faults kill the process
+	defer func() {
+		if r := recover(); r != nil {
+			resp = workerResponse{Error: fmt.Sprintf("panic during extraction: %v", r)}
+		}
+	}()
+
+	switch req.Op {
+	case "pdf_extract":
+		result, err := extractPDF(req.Data, req.Options)
+		if err != nil {
+			return workerFailure(err)
+		}
+		return workerResponse{Result: result}
+	case "pdf_render":
+		result, err := renderPDF(req.Data, req.Render)
+		if err != nil {
+			return workerFailure(err)
+		}
+		return workerResponse{Render: result}
+	default:
+		return workerResponse{Error: fmt.Sprintf("unknown worker operation: %s", req.Op)}
+	}
+}
+
+// envInt reads an integer environment variable with a default
+func envInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
@@ -0,0 +1,6 @@
+//go:build !linux && !darwin
+
+package main
+
+// applyWorkerLimits is a no-op on platforms without setrlimit; timeouts still apply
+func applyWorkerLimits(memoryMB, cpuSeconds uint64) {}
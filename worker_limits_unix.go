@@ -0,0 +1,25 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// applyWorkerLimits sets address-space and CPU-time rlimits on the current (worker) process
+func applyWorkerLimits(memoryMB, cpuSeconds uint64) {
+	if memoryMB > 0 {
+		limit := &syscall.Rlimit{Cur: memoryMB << 20, Max: memoryMB << 20}
+		if err := syscall.Setrlimit(syscall.RLIMIT_AS, limit); err != nil {
+			fmt.Fprintf(os.Stderr, "worker: cannot set memory limit: %v\n", err)
+		}
+	}
+	if cpuSeconds > 0 {
+		limit := &syscall.Rlimit{Cur: cpuSeconds, Max: cpuSeconds}
+		if err := syscall.Setrlimit(syscall.RLIMIT_CPU, limit); err != nil {
+			fmt.Fprintf(os.Stderr, "worker: cannot set CPU limit: %v\n", err)
+		}
+	}
+}
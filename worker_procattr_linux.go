@@ -0,0 +1,10 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+// workerSysProcAttr makes sure workers are killed together with the server
+func workerSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "syscall"
+
+// workerSysProcAttr has no parent-death signal outside Linux
+func workerSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{}
+}